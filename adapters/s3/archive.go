@@ -0,0 +1,145 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"github.com/gostratum/storagex"
+)
+
+// Transition changes the storage class of an object by copying it onto
+// itself with its metadata. CopyObject is limited to objects up to 5 GiB,
+// and archived objects must be restored first.
+func (s *S3Storage) Transition(ctx context.Context, key, class string) (storagex.Stat, error) {
+	if class == "" {
+		return storagex.Stat{}, &storagex.StorageError{
+			Op:  "transition",
+			Key: key,
+			Err: fmt.Errorf("%w: storage class is required", storagex.ErrInvalidConfig),
+		}
+	}
+
+	storageKey := s.keyBuilder.BuildKey(key, nil)
+	bucket := s.client.GetConfig().Bucket
+
+	s.logger.Debug("Transitioning object", storagex.ArgsToFields(
+		"key", key,
+		"storage_key", storageKey,
+		"storage_class", class,
+	)...)
+
+	input := &s3.CopyObjectInput{
+		Bucket:            aws.String(bucket),
+		Key:               aws.String(storageKey),
+		CopySource:        aws.String(bucket + "/" + url.PathEscape(storageKey)),
+		StorageClass:      types.StorageClass(class),
+		MetadataDirective: types.MetadataDirectiveCopy,
+	}
+
+	if _, err := s.client.GetS3Client().CopyObject(ctx, input); err != nil {
+		return storagex.Stat{}, MapS3Error(err, "transition", key)
+	}
+
+	stat, err := s.Head(ctx, key)
+	if err != nil {
+		return storagex.Stat{}, err
+	}
+	if stat.StorageClass == "" {
+		// S3 omits the header for STANDARD objects
+		stat.StorageClass = class
+	}
+	return stat, nil
+}
+
+// RestoreObject requests a temporary copy of an archived object, readable
+// for days once the restore completes. An empty tier means
+// storagex.RestoreTierStandard.
+func (s *S3Storage) RestoreObject(ctx context.Context, key string, days int, tier storagex.RestoreTier) error {
+	if days <= 0 {
+		return &storagex.StorageError{
+			Op:  "restore",
+			Key: key,
+			Err: fmt.Errorf("%w: restore days must be positive", storagex.ErrInvalidConfig),
+		}
+	}
+	if tier == "" {
+		tier = storagex.RestoreTierStandard
+	}
+
+	storageKey := s.keyBuilder.BuildKey(key, nil)
+
+	s.logger.Debug("Restoring object", storagex.ArgsToFields(
+		"key", key,
+		"storage_key", storageKey,
+		"days", days,
+		"tier", string(tier),
+	)...)
+
+	input := &s3.RestoreObjectInput{
+		Bucket: aws.String(s.client.GetConfig().Bucket),
+		Key:    aws.String(storageKey),
+		RestoreRequest: &types.RestoreRequest{
+			Days: aws.Int32(int32(days)),
+			GlacierJobParameters: &types.GlacierJobParameters{
+				Tier: types.Tier(tier),
+			},
+		},
+	}
+
+	_, err := s.client.GetS3Client().RestoreObject(ctx, input)
+	if err != nil {
+		// A second request while a restore is running is answered with 409
+		var coded interface{ ErrorCode() string }
+		if errors.As(err, &coded) && coded.ErrorCode() == "RestoreAlreadyInProgress" {
+			return nil
+		}
+		var statusErr interface{ HTTPStatusCode() int }
+		if errors.As(err, &statusErr) && statusErr.HTTPStatusCode() == http.StatusConflict {
+			return nil
+		}
+		return MapS3Error(err, "restore", key)
+	}
+	return nil
+}
+
+// parseRestore parses the x-amz-restore header, e.g.
+// `ongoing-request="false", expiry-date="Fri, 21 Dec 2012 00:00:00 GMT"`
+func parseRestore(header string) *storagex.RestoreStatus {
+	if header == "" {
+		return nil
+	}
+
+	status := &storagex.RestoreStatus{}
+	for _, field := range []string{"ongoing-request", "expiry-date"} {
+		i := strings.Index(header, field+`="`)
+		if i < 0 {
+			continue
+		}
+		value := header[i+len(field)+2:]
+		if end := strings.IndexByte(value, '"'); end >= 0 {
+			value = value[:end]
+		}
+		switch field {
+		case "ongoing-request":
+			status.InProgress = value == "true"
+		case "expiry-date":
+			if expires, err := time.Parse(http.TimeFormat, value); err == nil {
+				status.ExpiresAt = expires
+			} else if expires, err := time.Parse(time.RFC1123, value); err == nil {
+				status.ExpiresAt = expires
+			}
+		}
+	}
+	return status
+}
+
+var _ storagex.StorageClassManager = (*S3Storage)(nil)
@@ -0,0 +1,100 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/johannesboyne/gofakes3"
+	"github.com/johannesboyne/gofakes3/backend/s3mem"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/gostratum/storagex"
+)
+
+func TestParseRestore(t *testing.T) {
+	assert.Nil(t, parseRestore(""))
+
+	status := parseRestore(`ongoing-request="true"`)
+	require.NotNil(t, status)
+	assert.True(t, status.InProgress)
+	assert.True(t, status.ExpiresAt.IsZero())
+
+	status = parseRestore(`ongoing-request="false", expiry-date="Fri, 21 Dec 2012 00:00:00 GMT"`)
+	require.NotNil(t, status)
+	assert.False(t, status.InProgress)
+	assert.Equal(t, time.Date(2012, 12, 21, 0, 0, 0, 0, time.UTC), status.ExpiresAt.UTC())
+}
+
+// codedError mimics an SDK API error carrying an error code
+type codedError struct{ code string }
+
+func (e *codedError) Error() string {
+	return "https response error StatusCode: 403, " + e.code + ": The operation is not valid for the object's storage class"
+}
+
+func (e *codedError) ErrorCode() string { return e.code }
+
+func TestMapS3Error_Archived(t *testing.T) {
+	for _, err := range []error{
+		fmt.Errorf("operation error S3: GetObject: %w", &codedError{code: "InvalidObjectState"}),
+		fmt.Errorf("operation error S3: GetObject: %w", &types.InvalidObjectState{}),
+	} {
+		mapped := MapS3Error(err, "get", "archive/a.bin")
+		assert.True(t, storagex.IsArchived(mapped), "%v", mapped)
+		assert.ErrorIs(t, mapped, storagex.ErrConflict)
+	}
+
+	// Other 403s are still access errors
+	mapped := MapS3Error(&codedError{code: "AccessDenied"}, "get", "a.bin")
+	assert.False(t, storagex.IsArchived(mapped))
+}
+
+func TestTransition(t *testing.T) {
+	backend := s3mem.New()
+	require.NoError(t, backend.CreateBucket("classes"))
+	ts := httptest.NewServer(gofakes3.New(backend).Server())
+	defer ts.Close()
+
+	ctx := context.Background()
+	storage, err := NewS3Storage(ctx, &storagex.Config{
+		Provider:     "s3",
+		Bucket:       "classes",
+		Region:       "us-east-1",
+		Endpoint:     ts.URL,
+		AccessKey:    testAccessKey,
+		SecretKey:    testSecretKey,
+		UsePathStyle: true,
+		DisableSSL:   true,
+	})
+	require.NoError(t, err)
+
+	_, err = storage.PutBytes(ctx, "reports/q1.csv", []byte("a,b"), &storagex.PutOptions{
+		ContentType:  "text/csv",
+		Metadata:     map[string]string{"owner": "finance"},
+		StorageClass: storagex.StorageClassStandard,
+	})
+	require.NoError(t, err)
+
+	stat, err := storage.Transition(ctx, "reports/q1.csv", storagex.StorageClassStandardIA)
+	require.NoError(t, err)
+	assert.Equal(t, "text/csv", stat.ContentType)
+	assert.Equal(t, "finance", stat.Metadata["owner"])
+
+	reader, _, err := storage.Get(ctx, "reports/q1.csv")
+	require.NoError(t, err)
+	defer reader.Close()
+	data, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "a,b", string(data))
+
+	_, err = storage.Transition(ctx, "reports/q1.csv", "")
+	assert.ErrorIs(t, err, storagex.ErrInvalidConfig)
+	err = storage.RestoreObject(ctx, "reports/q1.csv", 0, storagex.RestoreTierBulk)
+	assert.ErrorIs(t, err, storagex.ErrInvalidConfig)
+}
@@ -0,0 +1,219 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"github.com/gostratum/core/logx"
+	"github.com/gostratum/storagex"
+)
+
+// BucketAdmin manages the configuration of the bucket of a ClientManager,
+// as opposed to its objects. The credentials need the matching bucket
+// permissions (e.g., s3:GetLifecycleConfiguration and
+// s3:PutLifecycleConfiguration).
+type BucketAdmin struct {
+	client *s3.Client
+	bucket string
+	region string
+	logger logx.Logger
+}
+
+// BucketAdmin returns a BucketAdmin for the configured bucket
+func (cm *ClientManager) BucketAdmin() *BucketAdmin {
+	return &BucketAdmin{
+		client: cm.s3Client,
+		bucket: cm.config.Bucket,
+		region: cm.config.Region,
+		logger: cm.logger,
+	}
+}
+
+// BucketAdmin returns a BucketAdmin for the storage's bucket
+func (s *S3Storage) BucketAdmin() *BucketAdmin {
+	return s.client.BucketAdmin()
+}
+
+// GetLifecycle returns the lifecycle rules of the bucket. Filters other than
+// a key prefix (tags, object size) and noncurrent version transitions are
+// not represented, so rules using them show up as changed when diffed.
+func (a *BucketAdmin) GetLifecycle(ctx context.Context) ([]storagex.LifecycleRule, error) {
+	output, err := a.client.GetBucketLifecycleConfiguration(ctx, &s3.GetBucketLifecycleConfigurationInput{
+		Bucket: aws.String(a.bucket),
+	})
+	if err != nil {
+		if hasErrorCode(err, "NoSuchLifecycleConfiguration") {
+			return nil, nil
+		}
+		return nil, MapS3Error(err, "get_lifecycle", "")
+	}
+
+	rules := make([]storagex.LifecycleRule, 0, len(output.Rules))
+	for _, r := range output.Rules {
+		rules = append(rules, fromS3LifecycleRule(r))
+	}
+	return rules, nil
+}
+
+// PutLifecycle replaces the lifecycle rules of the bucket. No rules removes
+// the lifecycle configuration.
+func (a *BucketAdmin) PutLifecycle(ctx context.Context, rules []storagex.LifecycleRule) error {
+	if len(rules) == 0 {
+		_, err := a.client.DeleteBucketLifecycle(ctx, &s3.DeleteBucketLifecycleInput{
+			Bucket: aws.String(a.bucket),
+		})
+		if err != nil {
+			return MapS3Error(err, "put_lifecycle", "")
+		}
+		return nil
+	}
+
+	s3Rules := make([]types.LifecycleRule, 0, len(rules))
+	for _, rule := range rules {
+		s3Rules = append(s3Rules, toS3LifecycleRule(rule))
+	}
+	_, err := a.client.PutBucketLifecycleConfiguration(ctx, &s3.PutBucketLifecycleConfigurationInput{
+		Bucket:                 aws.String(a.bucket),
+		LifecycleConfiguration: &types.BucketLifecycleConfiguration{Rules: s3Rules},
+	})
+	if err != nil {
+		return MapS3Error(err, "put_lifecycle", "")
+	}
+	return nil
+}
+
+// PlanLifecycle returns the changes that would make the bucket's lifecycle
+// rules match the declared ones
+func (a *BucketAdmin) PlanLifecycle(ctx context.Context, desired []storagex.LifecycleRule) ([]storagex.LifecycleChange, error) {
+	current, err := a.GetLifecycle(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return storagex.DiffLifecycleRules(current, desired), nil
+}
+
+// ApplyLifecycle logs the changes that make the bucket's lifecycle rules
+// match cfg.Rules and, unless cfg.DryRun is set, applies them. It returns
+// the planned changes.
+func (a *BucketAdmin) ApplyLifecycle(ctx context.Context, cfg storagex.BucketLifecycleConfig) ([]storagex.LifecycleChange, error) {
+	changes, err := a.PlanLifecycle(ctx, cfg.Rules)
+	if err != nil {
+		return nil, err
+	}
+	if len(changes) == 0 {
+		a.logger.Debug("Lifecycle rules up to date", storagex.ArgsToFields("bucket", a.bucket)...)
+		return nil, nil
+	}
+
+	for _, change := range changes {
+		a.logger.Info("Lifecycle change planned", storagex.ArgsToFields(
+			"bucket", a.bucket,
+			"op", change.Op,
+			"rule", change.ID,
+			"change", change.String(),
+			"dry_run", cfg.DryRun,
+		)...)
+	}
+	if cfg.DryRun {
+		return changes, nil
+	}
+
+	if err := a.PutLifecycle(ctx, cfg.Rules); err != nil {
+		return changes, err
+	}
+	a.logger.Info("Lifecycle rules applied", storagex.ArgsToFields(
+		"bucket", a.bucket,
+		"changes", len(changes),
+	)...)
+	return changes, nil
+}
+
+func toS3LifecycleRule(rule storagex.LifecycleRule) types.LifecycleRule {
+	r := types.LifecycleRule{
+		ID:     aws.String(rule.ID),
+		Status: types.ExpirationStatusEnabled,
+		Filter: &types.LifecycleRuleFilter{Prefix: aws.String(rule.Prefix)},
+	}
+	if rule.Disabled {
+		r.Status = types.ExpirationStatusDisabled
+	}
+	if rule.ExpirationDays > 0 {
+		r.Expiration = &types.LifecycleExpiration{Days: aws.Int32(int32(rule.ExpirationDays))}
+	}
+	for _, t := range rule.Transitions {
+		r.Transitions = append(r.Transitions, types.Transition{
+			Days:         aws.Int32(int32(t.Days)),
+			StorageClass: types.TransitionStorageClass(t.StorageClass),
+		})
+	}
+	if rule.AbortIncompleteMultipartDays > 0 {
+		r.AbortIncompleteMultipartUpload = &types.AbortIncompleteMultipartUpload{
+			DaysAfterInitiation: aws.Int32(int32(rule.AbortIncompleteMultipartDays)),
+		}
+	}
+	if rule.NoncurrentExpirationDays > 0 {
+		r.NoncurrentVersionExpiration = &types.NoncurrentVersionExpiration{
+			NoncurrentDays: aws.Int32(int32(rule.NoncurrentExpirationDays)),
+		}
+	}
+	return r
+}
+
+func fromS3LifecycleRule(r types.LifecycleRule) storagex.LifecycleRule {
+	rule := storagex.LifecycleRule{
+		ID:       aws.ToString(r.ID),
+		Prefix:   aws.ToString(r.Prefix),
+		Disabled: r.Status == types.ExpirationStatusDisabled,
+	}
+	if r.Filter != nil {
+		switch {
+		case r.Filter.Prefix != nil:
+			rule.Prefix = aws.ToString(r.Filter.Prefix)
+		case r.Filter.And != nil:
+			rule.Prefix = aws.ToString(r.Filter.And.Prefix)
+		}
+	}
+	if r.Expiration != nil {
+		rule.ExpirationDays = int(aws.ToInt32(r.Expiration.Days))
+	}
+	for _, t := range r.Transitions {
+		rule.Transitions = append(rule.Transitions, storagex.LifecycleTransition{
+			Days:         int(aws.ToInt32(t.Days)),
+			StorageClass: string(t.StorageClass),
+		})
+	}
+	if r.AbortIncompleteMultipartUpload != nil {
+		rule.AbortIncompleteMultipartDays = int(aws.ToInt32(r.AbortIncompleteMultipartUpload.DaysAfterInitiation))
+	}
+	if r.NoncurrentVersionExpiration != nil {
+		rule.NoncurrentExpirationDays = int(aws.ToInt32(r.NoncurrentVersionExpiration.NoncurrentDays))
+	}
+	return rule
+}
+
+// applyBucketConfig applies the declarative bucket settings of the config
+// when the storage starts
+func applyBucketConfig(ctx context.Context, cm *ClientManager) error {
+	cfg := cm.GetConfig()
+	if cfg.Provisioning.Enabled {
+		changes, err := cm.BucketAdmin().Provision(ctx, cfg.Provisioning)
+		if err != nil {
+			return fmt.Errorf("failed to provision bucket: %w", err)
+		}
+		if cfg.Provisioning.DryRun && len(changes) > 0 && changes[0].Setting == "bucket" {
+			// The bucket does not exist, so there is nothing else to plan
+			return nil
+		}
+	}
+	if cfg.Lifecycle.Apply {
+		if _, err := cm.BucketAdmin().ApplyLifecycle(ctx, cfg.Lifecycle); err != nil {
+			return fmt.Errorf("failed to apply lifecycle rules: %w", err)
+		}
+	}
+	warnUploadCORS(ctx, cm)
+	return nil
+}
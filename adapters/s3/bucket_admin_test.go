@@ -0,0 +1,175 @@
+package s3
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/johannesboyne/gofakes3"
+	"github.com/johannesboyne/gofakes3/backend/s3mem"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/gostratum/storagex"
+)
+
+// bucketConfigServer serves bucket configuration subresources gofakes3
+// does not implement from memory and passes everything else to gofakes3
+type bucketConfigServer struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	configs map[string][]byte // subresource -> XML document
+	puts    map[string]int
+}
+
+// missingConfigCodes are the error codes S3 answers for unset subresources
+var missingConfigCodes = map[string]string{
+	"lifecycle":         "NoSuchLifecycleConfiguration",
+	"encryption":        "ServerSideEncryptionConfigurationNotFoundError",
+	"cors":              "NoSuchCORSConfiguration",
+	"publicAccessBlock": "NoSuchPublicAccessBlockConfiguration",
+	"tagging":           "NoSuchTagSet",
+}
+
+func newBucketConfigServer(t *testing.T, buckets ...string) *bucketConfigServer {
+	t.Helper()
+	backend := s3mem.New()
+	for _, bucket := range buckets {
+		require.NoError(t, backend.CreateBucket(bucket))
+	}
+	fake := gofakes3.New(backend).Server()
+
+	srv := &bucketConfigServer{configs: map[string][]byte{}, puts: map[string]int{}}
+	srv.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for subresource, code := range missingConfigCodes {
+			if !r.URL.Query().Has(subresource) {
+				continue
+			}
+			srv.mu.Lock()
+			defer srv.mu.Unlock()
+			switch r.Method {
+			case http.MethodGet:
+				doc, ok := srv.configs[subresource]
+				if !ok {
+					w.WriteHeader(http.StatusNotFound)
+					io.WriteString(w, "<Error><Code>"+code+"</Code><Message>not set</Message></Error>")
+					return
+				}
+				w.Write(doc)
+			case http.MethodPut:
+				doc, _ := io.ReadAll(r.Body)
+				srv.configs[subresource] = doc
+				srv.puts[subresource]++
+			case http.MethodDelete:
+				delete(srv.configs, subresource)
+				srv.puts[subresource]++
+				w.WriteHeader(http.StatusNoContent)
+			}
+			return
+		}
+		fake.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func (s *bucketConfigServer) putCount(subresource string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.puts[subresource]
+}
+
+func (s *bucketConfigServer) config(bucket string) *storagex.Config {
+	return &storagex.Config{
+		Provider:     "s3",
+		Bucket:       bucket,
+		Region:       "us-east-1",
+		Endpoint:     s.URL,
+		AccessKey:    testAccessKey,
+		SecretKey:    testSecretKey,
+		UsePathStyle: true,
+		DisableSSL:   true,
+	}
+}
+
+func TestBucketAdmin_Lifecycle(t *testing.T) {
+	ctx := context.Background()
+	srv := newBucketConfigServer(t, "lifecycle")
+	cm, err := NewClientManager(ctx, ClientConfig{Config: srv.config("lifecycle")})
+	require.NoError(t, err)
+	admin := cm.BucketAdmin()
+
+	rules, err := admin.GetLifecycle(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, rules)
+
+	desired := []storagex.LifecycleRule{
+		{
+			ID:             "logs",
+			Prefix:         "logs/",
+			ExpirationDays: 365,
+			Transitions: []storagex.LifecycleTransition{
+				{Days: 30, StorageClass: storagex.StorageClassStandardIA},
+				{Days: 90, StorageClass: storagex.StorageClassGlacier},
+			},
+		},
+		{ID: "uploads", AbortIncompleteMultipartDays: 7, NoncurrentExpirationDays: 30},
+	}
+
+	// A dry run only plans
+	changes, err := admin.ApplyLifecycle(ctx, storagex.BucketLifecycleConfig{DryRun: true, Rules: desired})
+	require.NoError(t, err)
+	require.Len(t, changes, 2)
+	assert.Equal(t, storagex.LifecycleAdd, changes[0].Op)
+	assert.Equal(t, 0, srv.putCount("lifecycle"))
+
+	changes, err = admin.ApplyLifecycle(ctx, storagex.BucketLifecycleConfig{Rules: desired})
+	require.NoError(t, err)
+	assert.Len(t, changes, 2)
+	rules, err = admin.GetLifecycle(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, desired, rules)
+
+	// Applying again changes nothing
+	changes, err = admin.ApplyLifecycle(ctx, storagex.BucketLifecycleConfig{Rules: desired})
+	require.NoError(t, err)
+	assert.Empty(t, changes)
+	assert.Equal(t, 1, srv.putCount("lifecycle"))
+
+	changes, err = admin.PlanLifecycle(ctx, []storagex.LifecycleRule{{ID: "logs", Prefix: "logs/", ExpirationDays: 30}})
+	require.NoError(t, err)
+	require.Len(t, changes, 2)
+	assert.Equal(t, storagex.LifecycleUpdate, changes[0].Op)
+	assert.Equal(t, storagex.LifecycleRemove, changes[1].Op)
+	assert.Equal(t, "uploads", changes[1].ID)
+
+	// No rules removes the configuration
+	require.NoError(t, admin.PutLifecycle(ctx, nil))
+	rules, err = admin.GetLifecycle(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, rules)
+}
+
+func TestNewS3Storage_AppliesLifecycle(t *testing.T) {
+	ctx := context.Background()
+	srv := newBucketConfigServer(t, "startup")
+	cfg := srv.config("startup")
+	cfg.Lifecycle = storagex.BucketLifecycleConfig{
+		Apply: true,
+		Rules: []storagex.LifecycleRule{{ID: "tmp", Prefix: "tmp/", ExpirationDays: 1}},
+	}
+
+	storage, err := NewS3Storage(ctx, cfg)
+	require.NoError(t, err)
+	rules, err := storage.BucketAdmin().GetLifecycle(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, cfg.Lifecycle.Rules, rules)
+
+	_, err = NewS3Storage(ctx, cfg)
+	require.NoError(t, err)
+	assert.Equal(t, 1, srv.putCount("lifecycle"))
+}
@@ -31,6 +31,7 @@ type ClientConfig struct {
 type ClientManager struct {
 	s3Client      *s3.Client
 	presignClient *s3.PresignClient
+	awsConfig     aws.Config
 	config        *storagex.Config
 	logger        logx.Logger
 }
@@ -77,9 +78,11 @@ func NewClientManager(ctx context.Context, clientConfig ClientConfig) (*ClientMa
 			o.BaseEndpoint = aws.String(cfg.GetEndpointURL())
 		}
 
-		// Configure retries
-		o.RetryMaxAttempts = cfg.MaxRetries
-		o.RetryMode = aws.RetryModeAdaptive
+		// Configure retries (left to storagex.RetryStorage in storagex mode)
+		if cfg.RetryMode != storagex.RetryModeStorageX {
+			o.RetryMaxAttempts = cfg.MaxRetries
+			o.RetryMode = aws.RetryModeAdaptive
+		}
 
 		// Custom HTTP client with timeout
 		o.HTTPClient = &http.Client{
@@ -93,6 +96,7 @@ func NewClientManager(ctx context.Context, clientConfig ClientConfig) (*ClientMa
 	manager := &ClientManager{
 		s3Client:      s3Client,
 		presignClient: presignClient,
+		awsConfig:     awsConfig,
 		config:        cfg,
 		logger:        logger,
 	}
@@ -158,8 +162,13 @@ func buildAWSConfigWithLoader(ctx context.Context, cfg *storagex.Config, logger
 		// If no explicit credentials, loader will use SDK default chain
 	}
 
-	// Configure retries with exponential backoff
+	// Configure retries with exponential backoff. In storagex retry mode the
+	// storage is wrapped in a storagex.RetryStorage instead, so the SDK
+	// makes a single attempt.
 	options = append(options, config.WithRetryer(func() aws.Retryer {
+		if cfg.RetryMode == storagex.RetryModeStorageX {
+			return aws.NopRetryer{}
+		}
 		return retry.NewStandard(func(o *retry.StandardOptions) {
 			o.MaxAttempts = cfg.MaxRetries
 			o.MaxBackoff = cfg.BackoffMax
@@ -297,8 +306,13 @@ func (cm *ClientManager) Close() error {
 
 // BucketExists checks if the configured bucket exists and is accessible
 func (cm *ClientManager) BucketExists(ctx context.Context) (bool, error) {
-	_, err := cm.s3Client.HeadBucket(ctx, &s3.HeadBucketInput{
-		Bucket: aws.String(cm.config.Bucket),
+	return bucketExists(ctx, cm.s3Client, cm.config.Bucket)
+}
+
+// bucketExists checks if a bucket exists and is accessible
+func bucketExists(ctx context.Context, client *s3.Client, bucket string) (bool, error) {
+	_, err := client.HeadBucket(ctx, &s3.HeadBucketInput{
+		Bucket: aws.String(bucket),
 	})
 
 	if err != nil {
@@ -327,22 +341,30 @@ func (cm *ClientManager) CreateBucketIfNotExists(ctx context.Context) error {
 
 	cm.logger.Info("Creating bucket", storagex.ArgsToFields("bucket", cm.config.Bucket)...)
 
+	_, err = cm.s3Client.CreateBucket(ctx, createBucketInput(cm.config.Bucket, cm.config.Region, false))
+	if err != nil {
+		return fmt.Errorf("failed to create bucket %q: %w", cm.config.Bucket, err)
+	}
+
+	cm.logger.Info("Bucket created successfully", storagex.ArgsToFields("bucket", cm.config.Bucket)...)
+	return nil
+}
+
+// createBucketInput builds the request creating bucket in region
+func createBucketInput(bucket, region string, objectLock bool) *s3.CreateBucketInput {
 	input := &s3.CreateBucketInput{
-		Bucket: aws.String(cm.config.Bucket),
+		Bucket: aws.String(bucket),
 	}
 
 	// For regions other than us-east-1, we need to specify the location constraint
-	if cm.config.Region != "" && cm.config.Region != "us-east-1" {
+	if region != "" && region != "us-east-1" {
 		input.CreateBucketConfiguration = &s3Types.CreateBucketConfiguration{
-			LocationConstraint: s3Types.BucketLocationConstraint(cm.config.Region),
+			LocationConstraint: s3Types.BucketLocationConstraint(region),
 		}
 	}
 
-	_, err = cm.s3Client.CreateBucket(ctx, input)
-	if err != nil {
-		return fmt.Errorf("failed to create bucket %q: %w", cm.config.Bucket, err)
+	if objectLock {
+		input.ObjectLockEnabledForBucket = aws.Bool(true)
 	}
-
-	cm.logger.Info("Bucket created successfully", storagex.ArgsToFields("bucket", cm.config.Bucket)...)
-	return nil
+	return input
 }
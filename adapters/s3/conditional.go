@@ -0,0 +1,49 @@
+package s3
+
+import (
+	"context"
+	"io"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"github.com/gostratum/storagex"
+)
+
+// PutIfAbsent stores an object only if the key does not exist, using an
+// If-None-Match: * conditional write
+func (s *S3Storage) PutIfAbsent(ctx context.Context, key string, r io.Reader, opts *storagex.PutOptions) (storagex.Stat, error) {
+	return s.put(ctx, "put_if_absent", key, r, opts, func(input *s3.PutObjectInput) {
+		input.IfNoneMatch = aws.String("*")
+	})
+}
+
+// PutIfMatch replaces an object only if its current ETag is etag, using an
+// If-Match conditional write
+func (s *S3Storage) PutIfMatch(ctx context.Context, key string, r io.Reader, etag string, opts *storagex.PutOptions) (storagex.Stat, error) {
+	return s.put(ctx, "put_if_match", key, r, opts, func(input *s3.PutObjectInput) {
+		input.IfMatch = aws.String(etag)
+	})
+}
+
+// DeleteIfMatch removes an object only if its current ETag is etag. Backends
+// that ignore If-Match on DeleteObject delete the object unconditionally.
+func (s *S3Storage) DeleteIfMatch(ctx context.Context, key, etag string) error {
+	storageKey := s.keyBuilder.BuildKey(key, nil)
+
+	input := &s3.DeleteObjectInput{
+		Bucket:  aws.String(s.client.GetConfig().Bucket),
+		Key:     aws.String(storageKey),
+		IfMatch: aws.String(etag),
+	}
+	if storagex.GovernanceBypassFromContext(ctx) {
+		input.BypassGovernanceRetention = aws.Bool(true)
+	}
+
+	if _, err := s.client.GetS3Client().DeleteObject(ctx, input); err != nil {
+		return MapS3Error(err, "delete_if_match", key)
+	}
+	return nil
+}
+
+var _ storagex.ConditionalWriter = (*S3Storage)(nil)
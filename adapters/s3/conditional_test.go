@@ -0,0 +1,79 @@
+package s3
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/gostratum/storagex"
+	"github.com/gostratum/storagex/lock"
+)
+
+func TestGetIfNoneMatch(t *testing.T) {
+	ctx := context.Background()
+	storage := newWatchStorage(t)
+
+	stat, err := storage.PutBytes(ctx, "a.txt", []byte("alpha"), nil)
+	require.NoError(t, err)
+
+	_, _, err = storage.GetIfNoneMatch(ctx, "a.txt", stat.ETag)
+	require.ErrorIs(t, err, storagex.ErrNotModified)
+
+	reader, _, err := storage.GetIfNoneMatch(ctx, "a.txt", `"other"`)
+	require.NoError(t, err)
+	require.NoError(t, reader.Close())
+}
+
+func TestConditionalWrites(t *testing.T) {
+	ctx := context.Background()
+	storage := newWatchStorage(t)
+
+	created, err := storage.PutIfAbsent(ctx, "cond/a.txt", strings.NewReader("v1"), nil)
+	require.NoError(t, err)
+	assert.NotEmpty(t, created.ETag)
+
+	_, err = storage.PutIfAbsent(ctx, "cond/a.txt", strings.NewReader("v2"), nil)
+	assert.True(t, storagex.IsPreconditionFailed(err), "%v", err)
+	assert.ErrorIs(t, err, storagex.ErrConflict)
+
+	_, err = storage.PutIfMatch(ctx, "cond/a.txt", strings.NewReader("v2"), `"0123456789abcdef0123456789abcdef"`, nil)
+	assert.True(t, storagex.IsPreconditionFailed(err), "%v", err)
+
+	updated, err := storage.PutIfMatch(ctx, "cond/a.txt", strings.NewReader("v2"), created.ETag, nil)
+	require.NoError(t, err)
+	assert.NotEqual(t, created.ETag, updated.ETag)
+
+	body, _, err := storage.Get(ctx, "cond/a.txt")
+	require.NoError(t, err)
+	defer body.Close()
+	data, err := io.ReadAll(body)
+	require.NoError(t, err)
+	assert.Equal(t, "v2", string(data))
+}
+
+func TestLockOverS3(t *testing.T) {
+	ctx := context.Background()
+	storage := newWatchStorage(t)
+
+	first, err := lock.New(storage, lock.Options{TTL: time.Minute, Owner: "first"})
+	require.NoError(t, err)
+	second, err := lock.New(storage, lock.Options{TTL: time.Minute, Owner: "second"})
+	require.NoError(t, err)
+
+	lease, err := first.TryAcquire(ctx, "locks/job")
+	require.NoError(t, err)
+	_, err = second.TryAcquire(ctx, "locks/job")
+	assert.ErrorIs(t, err, lock.ErrLocked)
+
+	require.NoError(t, lease.Renew(ctx))
+	require.NoError(t, lease.Release(ctx))
+
+	lease, err = second.TryAcquire(ctx, "locks/job")
+	require.NoError(t, err)
+	require.NoError(t, lease.Release(ctx))
+}
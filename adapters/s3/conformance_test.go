@@ -0,0 +1,37 @@
+package s3
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/johannesboyne/gofakes3"
+	"github.com/johannesboyne/gofakes3/backend/s3mem"
+	"github.com/stretchr/testify/require"
+
+	"github.com/gostratum/storagex"
+	"github.com/gostratum/storagex/storagextest"
+)
+
+func TestConformance_S3(t *testing.T) {
+	backend := s3mem.New()
+	require.NoError(t, backend.CreateBucket("conformance"))
+	ts := httptest.NewServer(gofakes3.New(backend).Server())
+	defer ts.Close()
+
+	storage, err := NewS3Storage(context.Background(), &storagex.Config{
+		Provider:     "s3",
+		Bucket:       "conformance",
+		Region:       "us-east-1",
+		Endpoint:     ts.URL,
+		AccessKey:    testAccessKey,
+		SecretKey:    testSecretKey,
+		UsePathStyle: true,
+		DisableSSL:   true,
+	})
+	require.NoError(t, err)
+
+	storagextest.RunConformance(t, func(t *testing.T) storagex.Storage {
+		return storage
+	})
+}
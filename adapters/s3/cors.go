@@ -0,0 +1,54 @@
+package s3
+
+import (
+	"context"
+
+	"github.com/gostratum/storagex"
+)
+
+// GetCORS returns the CORS rules of the configured bucket
+func (cm *ClientManager) GetCORS(ctx context.Context) ([]storagex.CORSRule, error) {
+	return cm.BucketAdmin().GetCORS(ctx)
+}
+
+// PutCORS replaces the CORS rules of the configured bucket. No rules removes
+// the CORS configuration. storagex.UploadCORSRule derives the rule presigned
+// browser uploads need.
+func (cm *ClientManager) PutCORS(ctx context.Context, rules []storagex.CORSRule) error {
+	return cm.BucketAdmin().PutCORS(ctx, rules)
+}
+
+// CheckUploadCORS reads the bucket's CORS rules and reports how they would
+// block the browser uploads described by uploads (see
+// storagex.CheckUploadCORS)
+func (cm *ClientManager) CheckUploadCORS(ctx context.Context, uploads storagex.BrowserUploadConfig) ([]string, error) {
+	rules, err := cm.GetCORS(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return storagex.CheckUploadCORS(rules, uploads.RequiredCORSRule()), nil
+}
+
+// warnUploadCORS logs a warning for every way the bucket's CORS rules would
+// block the configured browser uploads. It never fails startup.
+func warnUploadCORS(ctx context.Context, cm *ClientManager) {
+	uploads := cm.GetConfig().BrowserUploads
+	if len(uploads.AllowedOrigins) == 0 {
+		return
+	}
+
+	problems, err := cm.CheckUploadCORS(ctx, uploads)
+	if err != nil {
+		cm.logger.Warn("Could not check bucket CORS for browser uploads", storagex.ArgsToFields(
+			"bucket", cm.config.Bucket,
+			"error", err,
+		)...)
+		return
+	}
+	for _, problem := range problems {
+		cm.logger.Warn("Bucket CORS blocks browser uploads", storagex.ArgsToFields(
+			"bucket", cm.config.Bucket,
+			"problem", problem,
+		)...)
+	}
+}
@@ -0,0 +1,63 @@
+package s3
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/gostratum/core/logx"
+	"github.com/gostratum/storagex"
+)
+
+func TestClientManager_CORS(t *testing.T) {
+	ctx := context.Background()
+	srv := newBucketConfigServer(t, "uploads")
+	cm, err := NewClientManager(ctx, ClientConfig{Config: srv.config("uploads")})
+	require.NoError(t, err)
+
+	uploads := storagex.BrowserUploadConfig{
+		AllowedOrigins: []string{"https://app.example.com"},
+		Methods:        []string{"PUT"},
+		Headers:        []string{"x-amz-meta-owner"},
+	}
+	problems, err := cm.CheckUploadCORS(ctx, uploads)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"PUT https://app.example.com: no CORS rule allows the origin and method"}, problems)
+
+	rule := uploads.RequiredCORSRule()
+	require.NoError(t, cm.PutCORS(ctx, []storagex.CORSRule{rule}))
+	rules, err := cm.GetCORS(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []storagex.CORSRule{rule}, rules)
+
+	problems, err = cm.CheckUploadCORS(ctx, uploads)
+	require.NoError(t, err)
+	assert.Empty(t, problems)
+}
+
+func TestNewS3Storage_WarnsAboutUploadCORS(t *testing.T) {
+	ctx := context.Background()
+	srv := newBucketConfigServer(t, "browser")
+	core, logs := observer.New(zapcore.WarnLevel)
+
+	cfg := srv.config("browser")
+	cfg.BrowserUploads = storagex.BrowserUploadConfig{AllowedOrigins: []string{"https://app.example.com"}}
+	_, err := NewS3Storage(ctx, cfg, storagex.WithLogger(logx.ProvideAdapter(zap.New(core))))
+	require.NoError(t, err, "CORS problems only warn")
+
+	warnings := logs.FilterMessage("Bucket CORS blocks browser uploads").All()
+	require.Len(t, warnings, 2)
+	assert.Equal(t, "PUT https://app.example.com: no CORS rule allows the origin and method", warnings[0].ContextMap()["problem"])
+
+	// Provisioning the derived rule silences the warning
+	cfg.Provisioning = storagex.ProvisioningConfig{Enabled: true, CORS: []storagex.CORSRule{cfg.BrowserUploads.RequiredCORSRule()}}
+	logs.TakeAll()
+	_, err = NewS3Storage(ctx, cfg, storagex.WithLogger(logx.ProvideAdapter(zap.New(core))))
+	require.NoError(t, err)
+	assert.Empty(t, logs.FilterMessage("Bucket CORS blocks browser uploads").All())
+}
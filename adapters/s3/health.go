@@ -10,27 +10,31 @@ import (
 	"github.com/gostratum/core"
 )
 
-// s3HealthCheck implements core.Check for S3 connectivity
+// s3HealthCheck implements core.Check for S3 connectivity of a storage
+// instance created by the fx module
 type s3HealthCheck struct {
-	client *ClientManager
+	name    string
+	storage *lifecycleProxy
 }
 
-func (s *s3HealthCheck) Name() string { return "storagex.s3" }
+func (s *s3HealthCheck) Name() string { return s.name }
 
 func (s *s3HealthCheck) Kind() core.Kind { return core.Readiness }
 
 func (s *s3HealthCheck) Check(ctx context.Context) error {
-	if s.client == nil {
-		return fmt.Errorf("no client manager")
+	s3Storage, ok := s.storage.get().(*S3Storage)
+	if !ok || s3Storage.client == nil {
+		return fmt.Errorf("s3 storage not started")
 	}
+	client := s3Storage.client
 
 	// Use a short timeout for health checks
 	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
 	defer cancel()
 
 	// Attempt to head the bucket
-	_, err := s.client.GetS3Client().HeadBucket(ctx, &s3.HeadBucketInput{
-		Bucket: aws.String(s.client.GetConfig().Bucket),
+	_, err := client.GetS3Client().HeadBucket(ctx, &s3.HeadBucketInput{
+		Bucket: aws.String(client.GetConfig().Bucket),
 	})
 	if err != nil {
 		return fmt.Errorf("s3 head bucket failed: %w", err)
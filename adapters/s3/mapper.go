@@ -35,6 +35,52 @@ func MapS3Error(err error, op, key string) error {
 		}
 	}
 
+	// A conditional request matched the current ETag
+	var statusErr interface{ HTTPStatusCode() int }
+	if errors.As(err, &statusErr) && statusErr.HTTPStatusCode() == http.StatusNotModified {
+		return &storagex.StorageError{
+			Op:  op,
+			Key: key,
+			Err: storagex.ErrNotModified,
+		}
+	}
+
+	// A conditional write or delete lost (412), or raced with another
+	// conditional write to the same key (409)
+	if hasErrorCode(err, "PreconditionFailed", "ConditionalRequestConflict") ||
+		(errors.As(err, &statusErr) && statusErr.HTTPStatusCode() == http.StatusPreconditionFailed) {
+		return &storagex.StorageError{
+			Op:  op,
+			Key: key,
+			Err: storagex.ErrPreconditionFailed,
+		}
+	}
+
+	// Reading or copying an archived object that was not restored. S3
+	// answers 403, so this must be checked before the status code.
+	var invalidState *types.InvalidObjectState
+	var coded interface{ ErrorCode() string }
+	if errors.As(err, &invalidState) || (errors.As(err, &coded) && coded.ErrorCode() == "InvalidObjectState") {
+		return &storagex.StorageError{
+			Op:  op,
+			Key: key,
+			Err: storagex.ErrArchived,
+		}
+	}
+
+	// Deleting a locked object version or shortening its retention. S3
+	// answers 403 AccessDenied and only the message tells it apart from a
+	// missing permission.
+	var messaged interface{ ErrorMessage() string }
+	if errors.As(err, &coded) && coded.ErrorCode() == "AccessDenied" &&
+		errors.As(err, &messaged) && strings.Contains(strings.ToLower(messaged.ErrorMessage()), "object lock") {
+		return &storagex.StorageError{
+			Op:  op,
+			Key: key,
+			Err: storagex.ErrRetained,
+		}
+	}
+
 	// Handle specific S3 error types
 	switch err.(type) {
 	case *types.NoSuchBucket:
@@ -73,13 +119,6 @@ func MapS3Error(err error, op, key string) error {
 	//        Err: fmt.Errorf("%w: invalid request", storagex.ErrInvalidConfig),
 	//    }
 
-	case *types.InvalidObjectState:
-		return &storagex.StorageError{
-			Op:  op,
-			Key: key,
-			Err: fmt.Errorf("%w: invalid object state", storagex.ErrConflict),
-		}
-
 	case *types.NotFound:
 		return &storagex.StorageError{
 			Op:  op,
@@ -112,6 +151,20 @@ func MapS3Error(err error, op, key string) error {
 	}
 }
 
+// hasErrorCode reports whether err is an S3 API error with one of codes
+func hasErrorCode(err error, codes ...string) bool {
+	var coded interface{ ErrorCode() string }
+	if !errors.As(err, &coded) {
+		return false
+	}
+	for _, code := range codes {
+		if coded.ErrorCode() == code {
+			return true
+		}
+	}
+	return false
+}
+
 // HTTPError represents an HTTP-level error
 type HTTPError struct {
 	StatusCode int
@@ -235,10 +288,17 @@ func mapHTTPError(httpErr *HTTPError, op, key string) error {
 		return &storagex.StorageError{
 			Op:  op,
 			Key: key,
-			Err: fmt.Errorf("rate limited: %w", storagex.ErrTimeout),
+			Err: fmt.Errorf("rate limited: %w", storagex.ErrThrottled),
 		}
 
-	case 500, 502, 503, 504:
+	case 503:
+		return &storagex.StorageError{
+			Op:  op,
+			Key: key,
+			Err: fmt.Errorf("server error (%d): %w", httpErr.StatusCode, storagex.ErrThrottled),
+		}
+
+	case 500, 502, 504:
 		return &storagex.StorageError{
 			Op:  op,
 			Key: key,
@@ -330,8 +390,14 @@ func mapAWSError(awsErr *AWSError, op, key string) error {
 			Err: storagex.ErrTooLarge,
 		}
 
-	case "TokenRefreshRequired", "RequestTimeTooSkewed", "SlowDown",
-		"ServiceUnavailable", "InternalError":
+	case "SlowDown", "ServiceUnavailable":
+		return &storagex.StorageError{
+			Op:  op,
+			Key: key,
+			Err: fmt.Errorf("%s: %w", awsErr.Message, storagex.ErrThrottled),
+		}
+
+	case "TokenRefreshRequired", "RequestTimeTooSkewed", "InternalError":
 		return &storagex.StorageError{
 			Op:  op,
 			Key: key,
@@ -431,30 +497,11 @@ func mapByErrorMessage(err error, op, key string) error {
 	return nil // No mapping found
 }
 
-// IsRetryableError determines if an error should be retried
+// IsRetryableError determines if an error should be retried. It applies
+// storagex.IsRetryableError and additionally classifies raw HTTP statuses
+// and AWS error codes.
 func IsRetryableError(err error) bool {
-	if err == nil {
-		return false
-	}
-
-	// Don't retry context cancellation
-	if errors.Is(err, context.Canceled) {
-		return false
-	}
-
-	// Don't retry validation errors
-	if errors.Is(err, storagex.ErrInvalidConfig) ||
-		errors.Is(err, storagex.ErrInvalidKey) {
-		return false
-	}
-
-	// Don't retry not found errors
-	if errors.Is(err, storagex.ErrNotFound) {
-		return false
-	}
-
-	// Don't retry conflict errors (usually)
-	if errors.Is(err, storagex.ErrConflict) {
+	if !storagex.IsRetryableError(err) {
 		return false
 	}
 
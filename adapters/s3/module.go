@@ -2,10 +2,12 @@ package s3
 
 import (
 	"context"
+	"fmt"
 	"io"
 	"sync"
 
 	"github.com/gostratum/core"
+	"github.com/gostratum/core/configx"
 	"github.com/gostratum/core/logx"
 	"github.com/gostratum/storagex"
 	"go.uber.org/fx"
@@ -19,21 +21,76 @@ func Module() fx.Option {
 		fx.Provide(
 			provideS3Storage,
 		),
-		// Provide a health checker for the S3 client (optional)
+	)
+}
+
+// Instance returns an fx.Module which provides a named S3 storage instance
+// configured from storage.instances.<name> (see storagex.NewInstanceConfig).
+// The storage is provided as a `name:"<name>"` value and registered in the
+// storagex.Registry, with its own readiness checks. A KeyBuilder provided
+// under the same name replaces the one built from the instance's base_prefix.
+//
+// Example usage:
+//
+//	app := core.New(
+//	    storagex.Module(),
+//	    s3.Instance("uploads"),
+//	    s3.Instance("archive"),
+//	    fx.Invoke(fx.Annotate(func(uploads, archive storagex.Storage) {
+//	        // ...
+//	    }, fx.ParamTags(`name:"uploads"`, `name:"archive"`))),
+//	)
+func Instance(name string) fx.Option {
+	nameTag := fmt.Sprintf("name:%q", name)
+	return fx.Module("storagex-s3-"+name,
 		fx.Provide(
-			fx.Annotated{
-				Target: func(cm *ClientManager) core.Check {
-					return &s3HealthCheck{client: cm}
+			fx.Annotate(
+				func(lc fx.Lifecycle, loader configx.Loader, kb storagex.KeyBuilder, logger logx.Logger, inst *storagex.Instrumenter) (storagex.Storage, storagex.NamedStorage, core.Check, core.Check, error) {
+					cfg, err := storagex.NewInstanceConfig(loader, name)
+					if err != nil {
+						return nil, storagex.NamedStorage{}, nil, nil, err
+					}
+					if kb == nil {
+						kb = storagex.NewKeyBuilder(cfg)
+					}
+
+					storage, proxy := newInstance(lc, cfg, kb, logger, inst)
+					return storage,
+						storagex.NamedStorage{Name: name, Storage: storage},
+						&s3HealthCheck{name: "storagex.s3." + name, storage: proxy},
+						storagex.NewInstanceBreakerHealthCheck(name, storage),
+						nil
 				},
-				Group: "health_checkers",
-			},
+				fx.ParamTags("", "", nameTag+` optional:"true"`, `optional:"true"`, `optional:"true"`),
+				fx.ResultTags(nameTag, `group:"storagex_instances"`, `group:"health_checkers"`, `group:"health_checkers"`),
+			),
 		),
 	)
 }
 
+// s3Storage is the result of provideS3Storage
+type s3Storage struct {
+	fx.Out
+
+	Storage storagex.Storage
+	Check   core.Check `group:"health_checkers"`
+}
+
 // provideS3Storage is an fx-friendly constructor that creates an S3 storage
-// instance. It accepts optional key builder and logger from the FX graph.
-func provideS3Storage(lc fx.Lifecycle, cfg *storagex.Config, kb storagex.KeyBuilder, logger logx.Logger) (storagex.Storage, error) {
+// instance and its health check. It accepts optional key builder, logger and
+// instrumenter from the FX graph.
+func provideS3Storage(lc fx.Lifecycle, cfg *storagex.Config, kb storagex.KeyBuilder, logger logx.Logger, inst *storagex.Instrumenter) s3Storage {
+	storage, proxy := newInstance(lc, cfg, kb, logger, inst)
+	return s3Storage{
+		Storage: storage,
+		Check:   &s3HealthCheck{name: "storagex.s3", storage: proxy},
+	}
+}
+
+// newInstance returns a storage that becomes usable once the S3 client is
+// created in the OnStart hook, decorated as configured, and the proxy that
+// holds the client.
+func newInstance(lc fx.Lifecycle, cfg *storagex.Config, kb storagex.KeyBuilder, logger logx.Logger, inst *storagex.Instrumenter) (storagex.Storage, *lifecycleProxy) {
 	var opts []storagex.Option
 	if kb != nil {
 		opts = append(opts, storagex.WithKeyBuilder(kb))
@@ -60,8 +117,8 @@ func provideS3Storage(lc fx.Lifecycle, cfg *storagex.Config, kb storagex.KeyBuil
 		},
 		OnStop: func(ctx context.Context) error {
 			// Close underlying storage if it implements Close
-			if proxy.storage != nil {
-				if closer, ok := proxy.storage.(interface{ Close() error }); ok {
+			if s := proxy.get(); s != nil {
+				if closer, ok := s.(interface{ Close() error }); ok {
 					return closer.Close()
 				}
 			}
@@ -69,7 +126,10 @@ func provideS3Storage(lc fx.Lifecycle, cfg *storagex.Config, kb storagex.KeyBuil
 		},
 	})
 
-	return proxy, nil
+	return storagex.DecorateStorage(proxy, cfg, storagex.DecorateOptions{
+		Retryable:    IsRetryableError,
+		Instrumenter: inst,
+	}), proxy
 }
 
 // lifecycleProxy is a Storage implementation that waits for the real storage
@@ -121,6 +181,16 @@ func (p *lifecycleProxy) get() storagex.Storage {
 	return s
 }
 
+// Unwrap returns the S3 storage, or nil until the OnStart hook has created
+// it, so storagex.Capability finds its optional interfaces (e.g.,
+// StorageClassManager) after startup. It does not block: Capability runs in
+// constructors such as lock.New, which fx calls before OnStart. The proxy
+// implements ConditionalWriter itself, so that capability is found before
+// startup too.
+func (p *lifecycleProxy) Unwrap() storagex.Storage {
+	return p.get()
+}
+
 // The following methods implement the storagex.Storage interface by
 // delegating to the underlying storage after startup completes.
 func (p *lifecycleProxy) Put(ctx context.Context, key string, r io.Reader, opts *storagex.PutOptions) (storagex.Stat, error) {
@@ -230,3 +300,28 @@ func (p *lifecycleProxy) PresignPut(ctx context.Context, key string, opts *stora
 	}
 	return p.get().PresignPut(ctx, key, opts)
 }
+
+// PutIfAbsent stores an object if the key does not exist, once startup
+// completes
+func (p *lifecycleProxy) PutIfAbsent(ctx context.Context, key string, r io.Reader, opts *storagex.PutOptions) (storagex.Stat, error) {
+	if err := p.wait(); err != nil {
+		return storagex.Stat{}, err
+	}
+	return p.get().(*S3Storage).PutIfAbsent(ctx, key, r, opts)
+}
+
+func (p *lifecycleProxy) PutIfMatch(ctx context.Context, key string, r io.Reader, etag string, opts *storagex.PutOptions) (storagex.Stat, error) {
+	if err := p.wait(); err != nil {
+		return storagex.Stat{}, err
+	}
+	return p.get().(*S3Storage).PutIfMatch(ctx, key, r, etag, opts)
+}
+
+func (p *lifecycleProxy) DeleteIfMatch(ctx context.Context, key, etag string) error {
+	if err := p.wait(); err != nil {
+		return err
+	}
+	return p.get().(*S3Storage).DeleteIfMatch(ctx, key, etag)
+}
+
+var _ storagex.ConditionalWriter = (*lifecycleProxy)(nil)
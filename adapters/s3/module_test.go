@@ -0,0 +1,137 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gostratum/core"
+	"github.com/gostratum/core/configx"
+	"github.com/gostratum/core/logx"
+	"github.com/johannesboyne/gofakes3"
+	"github.com/johannesboyne/gofakes3/backend/s3mem"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+
+	"github.com/gostratum/storagex"
+	"github.com/gostratum/storagex/lock"
+)
+
+func TestInstance_NamedStorages(t *testing.T) {
+	ts := httptest.NewServer(gofakes3.New(s3mem.New()).Server())
+	defer ts.Close()
+
+	loader, err := configx.NewWithReader(strings.NewReader(fmt.Sprintf(`
+storage:
+  endpoint: %s
+  use_path_style: true
+  disable_ssl: true
+  access_key: %s
+  secret_key: %s
+  instances:
+    uploads:
+      bucket: uploads
+      base_prefix: incoming
+    archive:
+      bucket: archive
+`, ts.URL, testAccessKey, testSecretKey)))
+	require.NoError(t, err)
+
+	type deps struct {
+		fx.In
+
+		Uploads  storagex.Storage `name:"uploads"`
+		Archive  storagex.Storage `name:"archive"`
+		Registry *storagex.Registry
+		Checks   []core.Check `group:"health_checkers"`
+	}
+	var d deps
+
+	app := fxtest.New(t,
+		storagex.Module(),
+		Instance("uploads"),
+		Instance("archive"),
+		fx.Supply(fx.Annotate(loader, fx.As(new(configx.Loader)))),
+		fx.Provide(func() logx.Logger { return logx.NewNoopLogger() }),
+		fx.Populate(&d),
+	)
+	app.RequireStart()
+	defer app.RequireStop()
+
+	ctx := context.Background()
+	_, err = d.Uploads.PutBytes(ctx, "a.txt", []byte("upload"), nil)
+	require.NoError(t, err)
+
+	// Instances are separate buckets
+	_, err = d.Archive.Head(ctx, "a.txt")
+	assert.True(t, storagex.IsNotFound(err))
+
+	archive, err := d.Registry.Get("archive")
+	require.NoError(t, err)
+	assert.Same(t, d.Archive, archive)
+	assert.Equal(t, []string{"archive", "uploads"}, d.Registry.Names())
+
+	// Each instance has its own readiness checks
+	names := map[string]bool{}
+	for _, check := range d.Checks {
+		names[check.Name()] = true
+		assert.NoError(t, check.Check(ctx), check.Name())
+	}
+	assert.True(t, names["storagex.s3.uploads"])
+	assert.True(t, names["storagex.s3.archive"])
+	assert.True(t, names["storagex.circuit_breaker.uploads"])
+}
+
+func TestModule_CapabilitiesThroughProxy(t *testing.T) {
+	ts := httptest.NewServer(gofakes3.New(s3mem.New()).Server())
+	defer ts.Close()
+
+	loader, err := configx.NewWithReader(strings.NewReader(fmt.Sprintf(`
+storage:
+  bucket: capabilities
+  endpoint: %s
+  use_path_style: true
+  disable_ssl: true
+  access_key: %s
+  secret_key: %s
+`, ts.URL, testAccessKey, testSecretKey)))
+	require.NoError(t, err)
+
+	var storage storagex.Storage
+	var locker *lock.Locker
+	app := fxtest.New(t,
+		storagex.Module(),
+		Module(),
+		fx.Supply(fx.Annotate(loader, fx.As(new(configx.Loader)))),
+		fx.Provide(func() logx.Logger { return logx.NewNoopLogger() }),
+		// Constructed before OnStart creates the S3 client
+		fx.Provide(func(storage storagex.Storage) (*lock.Locker, error) {
+			return lock.New(storage, lock.Options{TTL: time.Minute})
+		}),
+		fx.Populate(&storage, &locker),
+	)
+	app.RequireStart()
+	defer app.RequireStop()
+
+	// The provided storage is decorated and proxied; optional interfaces
+	// of the S3 storage are still found
+	writer, ok := storagex.Capability[storagex.ConditionalWriter](storage)
+	require.True(t, ok)
+	_, ok = storagex.Capability[storagex.StorageClassManager](storage)
+	assert.True(t, ok)
+
+	ctx := context.Background()
+	_, err = writer.PutIfAbsent(ctx, "lock.json", strings.NewReader("{}"), nil)
+	require.NoError(t, err)
+	_, err = writer.PutIfAbsent(ctx, "lock.json", strings.NewReader("{}"), nil)
+	assert.True(t, storagex.IsPreconditionFailed(err))
+
+	lease, err := locker.TryAcquire(ctx, "locks/job")
+	require.NoError(t, err)
+	require.NoError(t, lease.Release(ctx))
+}
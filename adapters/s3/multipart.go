@@ -287,6 +287,12 @@ func (mu *MultipartUploader) uploadPart(ctx context.Context, storageKey, uploadI
 
 // CreateMultipart initiates a multipart upload session
 func (s *S3Storage) CreateMultipart(ctx context.Context, key string, putOpts *storagex.PutOptions) (string, error) {
+	if putOpts != nil {
+		if err := storagex.ValidateRetention(putOpts.LockMode, putOpts.RetainUntil); err != nil {
+			return "", &storagex.StorageError{Op: "create_multipart", Key: key, Err: err}
+		}
+	}
+
 	storageKey := s.keyBuilder.BuildKey(key, nil)
 
 	s.logger.Debug("Creating multipart upload", storagex.ArgsToFields(
@@ -316,6 +322,19 @@ func (s *S3Storage) CreateMultipart(ctx context.Context, key string, putOpts *st
 		if len(putOpts.Metadata) > 0 {
 			input.Metadata = putOpts.Metadata
 		}
+
+		if putOpts.StorageClass != "" {
+			input.StorageClass = types.StorageClass(putOpts.StorageClass)
+		}
+
+		if putOpts.LockMode != "" {
+			input.ObjectLockMode = types.ObjectLockMode(putOpts.LockMode)
+			input.ObjectLockRetainUntilDate = aws.Time(putOpts.RetainUntil)
+		}
+
+		if putOpts.LegalHold {
+			input.ObjectLockLegalHoldStatus = types.ObjectLockLegalHoldStatusOn
+		}
 	}
 
 	output, err := s.client.GetS3Client().CreateMultipartUpload(ctx, input)
@@ -458,3 +477,48 @@ func (s *S3Storage) AbortMultipart(ctx context.Context, key, uploadID string) er
 
 	return nil
 }
+
+// ListMultipartUploads returns the in-progress multipart uploads whose key
+// starts with prefix. Keys are returned without the KeyBuilder prefix.
+func (s *S3Storage) ListMultipartUploads(ctx context.Context, prefix string) ([]storagex.MultipartUploadInfo, error) {
+	storagePrefix := s.keyBuilder.BuildKey(prefix, nil)
+
+	s.logger.Debug("Listing multipart uploads", storagex.ArgsToFields(
+		"prefix", prefix,
+		"storage_prefix", storagePrefix,
+	)...)
+
+	input := &s3.ListMultipartUploadsInput{
+		Bucket: aws.String(s.client.GetConfig().Bucket),
+	}
+	if storagePrefix != "" {
+		input.Prefix = aws.String(storagePrefix)
+	}
+
+	var uploads []storagex.MultipartUploadInfo
+	for {
+		output, err := s.client.GetS3Client().ListMultipartUploads(ctx, input)
+		if err != nil {
+			return nil, MapS3Error(err, "list_multipart", prefix)
+		}
+
+		for _, upload := range output.Uploads {
+			info := storagex.MultipartUploadInfo{
+				Key:      s.keyBuilder.StripKey(aws.ToString(upload.Key)),
+				UploadID: aws.ToString(upload.UploadId),
+			}
+			if upload.Initiated != nil {
+				info.Initiated = *upload.Initiated
+			}
+			uploads = append(uploads, info)
+		}
+
+		if !aws.ToBool(output.IsTruncated) {
+			break
+		}
+		input.KeyMarker = output.NextKeyMarker
+		input.UploadIdMarker = output.NextUploadIdMarker
+	}
+
+	return uploads, nil
+}
@@ -0,0 +1,275 @@
+package s3
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gostratum/storagex"
+)
+
+const (
+	// postPolicyAlgorithm is the only signing algorithm supported for POST policies
+	postPolicyAlgorithm = "AWS4-HMAC-SHA256"
+
+	// maxObjectSize is the largest single PUT/POST object accepted by S3
+	maxObjectSize = 5 << 30
+)
+
+// PostPolicy describes the conditions a browser-based POST upload must
+// satisfy. Keys are logical keys; the storage KeyBuilder is applied when the
+// policy is signed.
+type PostPolicy struct {
+	key           string
+	keyStartsWith bool
+	conditions    []any
+	fields        map[string]string
+	lengthRange   *[2]int64
+}
+
+// NewPostPolicy creates an empty POST policy
+func NewPostPolicy() *PostPolicy {
+	return &PostPolicy{
+		fields: make(map[string]string),
+	}
+}
+
+// SetKey requires the upload to use exactly this key
+func (p *PostPolicy) SetKey(key string) *PostPolicy {
+	p.key = key
+	p.keyStartsWith = false
+	return p
+}
+
+// SetKeyStartsWith allows any key beginning with prefix. The form's key field
+// defaults to prefix+"${filename}" so browsers can keep the original name.
+func (p *PostPolicy) SetKeyStartsWith(prefix string) *PostPolicy {
+	p.key = prefix
+	p.keyStartsWith = true
+	return p
+}
+
+// SetContentType requires an exact Content-Type form field
+func (p *PostPolicy) SetContentType(contentType string) *PostPolicy {
+	p.conditions = append(p.conditions, map[string]string{"Content-Type": contentType})
+	p.fields["Content-Type"] = contentType
+	return p
+}
+
+// SetContentTypeStartsWith requires the Content-Type to begin with prefix
+// (e.g. "image/")
+func (p *PostPolicy) SetContentTypeStartsWith(prefix string) *PostPolicy {
+	p.conditions = append(p.conditions, []string{"starts-with", "$Content-Type", prefix})
+	return p
+}
+
+// SetContentLengthRange restricts the uploaded file size to [min, max] bytes
+func (p *PostPolicy) SetContentLengthRange(min, max int64) *PostPolicy {
+	p.lengthRange = &[2]int64{min, max}
+	return p
+}
+
+// SetMetadata requires and sets a user metadata field (x-amz-meta-*)
+func (p *PostPolicy) SetMetadata(key, value string) *PostPolicy {
+	field := "x-amz-meta-" + strings.ToLower(key)
+	p.conditions = append(p.conditions, map[string]string{field: value})
+	p.fields[field] = value
+	return p
+}
+
+// SetCacheControl requires and sets the Cache-Control form field
+func (p *PostPolicy) SetCacheControl(cacheControl string) *PostPolicy {
+	p.conditions = append(p.conditions, map[string]string{"Cache-Control": cacheControl})
+	p.fields["Cache-Control"] = cacheControl
+	return p
+}
+
+// SetSuccessActionStatus sets the HTTP status S3 returns on success (200, 201 or 204)
+func (p *PostPolicy) SetSuccessActionStatus(status int) *PostPolicy {
+	value := strconv.Itoa(status)
+	p.conditions = append(p.conditions, map[string]string{"success_action_status": value})
+	p.fields["success_action_status"] = value
+	return p
+}
+
+// AddCondition adds an arbitrary exact-match ("eq") or prefix ("starts-with")
+// condition on a form field. The field value itself is not added to the form.
+func (p *PostPolicy) AddCondition(matchType, field, value string) *PostPolicy {
+	field = strings.TrimPrefix(field, "$")
+	if matchType == "starts-with" {
+		p.conditions = append(p.conditions, []string{"starts-with", "$" + field, value})
+	} else {
+		p.conditions = append(p.conditions, []string{"eq", "$" + field, value})
+	}
+	return p
+}
+
+// PresignPost signs a POST policy with AWS Signature Version 4 and returns
+// the URL and form fields a browser must submit along with the file.
+func (s *S3Storage) PresignPost(ctx context.Context, policy *PostPolicy, expiry time.Duration) (*PresignedPost, error) {
+	if policy == nil || (policy.key == "" && !policy.keyStartsWith) {
+		return nil, &storagex.StorageError{
+			Op:  "presign_post",
+			Err: fmt.Errorf("%w: post policy requires a key condition", storagex.ErrInvalidKey),
+		}
+	}
+
+	if expiry <= 0 {
+		expiry = 15 * time.Minute
+	}
+	if expiry > 7*24*time.Hour {
+		expiry = 7 * 24 * time.Hour
+	}
+
+	creds, err := s.client.GetS3Client().Options().Credentials.Retrieve(ctx)
+	if err != nil {
+		return nil, &storagex.StorageError{
+			Op:  "presign_post",
+			Key: policy.key,
+			Err: fmt.Errorf("failed to retrieve credentials: %w", err),
+		}
+	}
+
+	cfg := s.client.GetConfig()
+	region := s.client.GetS3Client().Options().Region
+	if region == "" {
+		region = cfg.Region
+	}
+
+	now := s.clock().UTC()
+	expiration := now.Add(expiry)
+	amzDate := now.Format("20060102T150405Z")
+	scopeDate := now.Format("20060102")
+	credential := fmt.Sprintf("%s/%s/%s/s3/aws4_request", creds.AccessKeyID, scopeDate, region)
+
+	storageKey := s.keyBuilder.BuildKey(policy.key, nil)
+
+	fields := make(map[string]string, len(policy.fields)+8)
+	for k, v := range policy.fields {
+		fields[k] = v
+	}
+
+	conditions := []any{map[string]string{"bucket": cfg.Bucket}}
+	if policy.keyStartsWith {
+		conditions = append(conditions, []string{"starts-with", "$key", storageKey})
+		fields["key"] = storageKey + "${filename}"
+	} else {
+		conditions = append(conditions, map[string]string{"key": storageKey})
+		fields["key"] = storageKey
+	}
+	conditions = append(conditions, policy.conditions...)
+	if policy.lengthRange != nil {
+		conditions = append(conditions, []any{"content-length-range", policy.lengthRange[0], policy.lengthRange[1]})
+	}
+
+	fields["x-amz-algorithm"] = postPolicyAlgorithm
+	fields["x-amz-credential"] = credential
+	fields["x-amz-date"] = amzDate
+	conditions = append(conditions,
+		map[string]string{"x-amz-algorithm": postPolicyAlgorithm},
+		map[string]string{"x-amz-credential": credential},
+		map[string]string{"x-amz-date": amzDate},
+	)
+	if creds.SessionToken != "" {
+		fields["x-amz-security-token"] = creds.SessionToken
+		conditions = append(conditions, map[string]string{"x-amz-security-token": creds.SessionToken})
+	}
+
+	document, err := json.Marshal(map[string]any{
+		"expiration": expiration.Format("2006-01-02T15:04:05.000Z"),
+		"conditions": conditions,
+	})
+	if err != nil {
+		return nil, &storagex.StorageError{
+			Op:  "presign_post",
+			Key: policy.key,
+			Err: fmt.Errorf("failed to encode post policy: %w", err),
+		}
+	}
+
+	encodedPolicy := base64.StdEncoding.EncodeToString(document)
+	fields["policy"] = encodedPolicy
+	fields["x-amz-signature"] = signPostPolicy(creds.SecretAccessKey, scopeDate, region, encodedPolicy)
+
+	postURL, err := s.postURL()
+	if err != nil {
+		return nil, &storagex.StorageError{
+			Op:  "presign_post",
+			Key: policy.key,
+			Err: err,
+		}
+	}
+
+	return &PresignedPost{
+		URL:        postURL,
+		Fields:     fields,
+		Conditions: describeConditions(conditions),
+		Expiry:     expiration,
+	}, nil
+}
+
+// signPostPolicy computes the SigV4 signature of a base64-encoded policy
+func signPostPolicy(secretKey, scopeDate, region, encodedPolicy string) string {
+	signingKey := hmacSHA256([]byte("AWS4"+secretKey), scopeDate)
+	signingKey = hmacSHA256(signingKey, region)
+	signingKey = hmacSHA256(signingKey, "s3")
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(signingKey, encodedPolicy))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// postURL returns the bucket URL browsers POST to
+func (s *S3Storage) postURL() (string, error) {
+	cfg := s.client.GetConfig()
+
+	if cfg.Endpoint == "" {
+		if cfg.UsePathStyle {
+			return fmt.Sprintf("https://s3.%s.amazonaws.com/%s", cfg.Region, cfg.Bucket), nil
+		}
+		return fmt.Sprintf("https://%s.s3.%s.amazonaws.com/", cfg.Bucket, cfg.Region), nil
+	}
+
+	endpoint, err := url.Parse(cfg.GetEndpointURL())
+	if err != nil {
+		return "", fmt.Errorf("invalid endpoint: %w", err)
+	}
+
+	if cfg.UsePathStyle {
+		endpoint.Path = strings.TrimSuffix(endpoint.Path, "/") + "/" + cfg.Bucket
+	} else {
+		endpoint.Host = cfg.Bucket + "." + endpoint.Host
+		endpoint.Path = "/"
+	}
+	return endpoint.String(), nil
+}
+
+// describeConditions flattens policy conditions for PresignedPost.Conditions
+func describeConditions(conditions []any) map[string]string {
+	described := make(map[string]string, len(conditions))
+	for _, condition := range conditions {
+		switch c := condition.(type) {
+		case map[string]string:
+			for k, v := range c {
+				described[k] = v
+			}
+		case []string:
+			described[strings.TrimPrefix(c[1], "$")] = c[0] + ":" + c[2]
+		case []any:
+			described[fmt.Sprint(c[0])] = fmt.Sprintf("%v,%v", c[1], c[2])
+		}
+	}
+	return described
+}
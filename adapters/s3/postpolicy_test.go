@@ -0,0 +1,267 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/johannesboyne/gofakes3"
+	"github.com/johannesboyne/gofakes3/backend/s3mem"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/gostratum/storagex"
+)
+
+const (
+	testAccessKey = "TEST_KEY"
+	testSecretKey = "TEST_SECRET"
+)
+
+// policyEnforcingS3 fronts gofakes3 with the POST policy checks real S3
+// performs (signature, expiration and conditions), since gofakes3 accepts any
+// browser upload.
+func policyEnforcingS3(t *testing.T, bucket string) *httptest.Server {
+	t.Helper()
+
+	backend := s3mem.New()
+	require.NoError(t, backend.CreateBucket(bucket))
+	faker := gofakes3.New(backend).Server()
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost && strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			parsed := r.Clone(r.Context())
+			parsed.Body = io.NopCloser(bytes.NewReader(body))
+			if err := parsed.ParseMultipartForm(32 << 20); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err := verifyPostPolicy(parsed.MultipartForm); err != nil {
+				http.Error(w, err.Error(), http.StatusForbidden)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+		}
+		faker.ServeHTTP(w, r)
+	}))
+}
+
+func verifyPostPolicy(form *multipart.Form) error {
+	value := func(name string) string {
+		if v := form.Value[name]; len(v) > 0 {
+			return v[0]
+		}
+		return ""
+	}
+
+	encoded := value("policy")
+	credential := strings.Split(value("x-amz-credential"), "/")
+	if encoded == "" || len(credential) != 5 || value("x-amz-algorithm") != "AWS4-HMAC-SHA256" {
+		return fmt.Errorf("missing signature fields")
+	}
+
+	sign := func(key []byte, data string) []byte {
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(data))
+		return mac.Sum(nil)
+	}
+	key := sign([]byte("AWS4"+testSecretKey), credential[1])
+	key = sign(key, credential[2])
+	key = sign(key, credential[3])
+	key = sign(key, credential[4])
+	if hex.EncodeToString(sign(key, encoded)) != value("x-amz-signature") {
+		return fmt.Errorf("SignatureDoesNotMatch")
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return err
+	}
+	var policy struct {
+		Expiration string `json:"expiration"`
+		Conditions []any  `json:"conditions"`
+	}
+	if err := json.Unmarshal(raw, &policy); err != nil {
+		return err
+	}
+	expiration, err := time.Parse("2006-01-02T15:04:05.000Z", policy.Expiration)
+	if err != nil || time.Now().After(expiration) {
+		return fmt.Errorf("policy expired")
+	}
+
+	files := form.File["file"]
+	if len(files) != 1 {
+		return fmt.Errorf("missing file")
+	}
+	size := files[0].Size
+
+	for _, condition := range policy.Conditions {
+		switch c := condition.(type) {
+		case map[string]any:
+			for field, want := range c {
+				if field == "bucket" {
+					continue
+				}
+				if value(field) != want {
+					return fmt.Errorf("condition failed: %s", field)
+				}
+			}
+		case []any:
+			switch c[0] {
+			case "content-length-range":
+				if size < int64(c[1].(float64)) || size > int64(c[2].(float64)) {
+					return fmt.Errorf("EntityTooLarge")
+				}
+			case "starts-with":
+				if !strings.HasPrefix(value(strings.TrimPrefix(c[1].(string), "$")), c[2].(string)) {
+					return fmt.Errorf("condition failed: %s", c[1])
+				}
+			case "eq":
+				if value(strings.TrimPrefix(c[1].(string), "$")) != c[2].(string) {
+					return fmt.Errorf("condition failed: %s", c[1])
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func postForm(t *testing.T, post *PresignedPost, overrides map[string]string, file []byte) *http.Response {
+	t.Helper()
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	fields := post.GetFormData()
+	for k, v := range overrides {
+		fields[k] = v
+	}
+	for k, v := range fields {
+		require.NoError(t, writer.WriteField(k, v))
+	}
+	part, err := writer.CreateFormFile("file", "upload.txt")
+	require.NoError(t, err)
+	_, err = part.Write(file)
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+
+	resp, err := http.Post(post.URL, writer.FormDataContentType(), &body)
+	require.NoError(t, err)
+	resp.Body.Close()
+	return resp
+}
+
+func newPolicyTestStorage(t *testing.T) *S3Storage {
+	t.Helper()
+	ts := policyEnforcingS3(t, "post-bucket")
+	t.Cleanup(ts.Close)
+
+	storage, err := NewS3Storage(context.Background(), &storagex.Config{
+		Provider:     "s3",
+		Bucket:       "post-bucket",
+		Region:       "us-east-1",
+		Endpoint:     ts.URL,
+		AccessKey:    testAccessKey,
+		SecretKey:    testSecretKey,
+		UsePathStyle: true,
+		DisableSSL:   true,
+	})
+	require.NoError(t, err)
+	return storage
+}
+
+func TestPresignPostPolicy_BrowserUpload(t *testing.T) {
+	storage := newPolicyTestStorage(t)
+	ctx := context.Background()
+
+	post, err := storage.PresignPostPolicy(ctx, "uploads/report.txt", &storagex.PresignOptions{
+		Expiry:             time.Hour,
+		ContentType:        "text/plain",
+		Metadata:           map[string]string{"owner": "alice"},
+		ContentLengthRange: [2]int64{1, 64},
+	})
+	require.NoError(t, err)
+
+	for _, field := range []string{"policy", "x-amz-signature", "x-amz-credential", "x-amz-date", "x-amz-algorithm"} {
+		assert.NotEmpty(t, post.Fields[field], field)
+	}
+	assert.Equal(t, "1,64", post.Conditions["content-length-range"])
+
+	t.Run("accepts valid upload", func(t *testing.T) {
+		resp := postForm(t, post, nil, []byte("hello browser"))
+		require.Less(t, resp.StatusCode, 300)
+
+		stat, err := storage.Head(ctx, "uploads/report.txt")
+		require.NoError(t, err)
+		assert.Equal(t, int64(len("hello browser")), stat.Size)
+	})
+
+	t.Run("rejects oversize upload", func(t *testing.T) {
+		resp := postForm(t, post, nil, bytes.Repeat([]byte("x"), 65))
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	})
+
+	t.Run("rejects tampered fields", func(t *testing.T) {
+		resp := postForm(t, post, map[string]string{"key": "uploads/other.txt"}, []byte("hi"))
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	})
+}
+
+func TestPresignPostPolicy_ClampsExpiry(t *testing.T) {
+	storage := newPolicyTestStorage(t)
+
+	post, err := storage.PresignPostPolicy(context.Background(), "uploads/report.txt", &storagex.PresignOptions{Expiry: 30 * 24 * time.Hour})
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(7*24*time.Hour), post.Expiry, time.Minute)
+}
+
+func TestPresignPost_KeyStartsWith(t *testing.T) {
+	storage := newPolicyTestStorage(t)
+
+	policy := NewPostPolicy().
+		SetKeyStartsWith("user-42/").
+		SetContentTypeStartsWith("image/").
+		SetContentLengthRange(0, 1024).
+		SetSuccessActionStatus(201)
+
+	post, err := storage.PresignPost(context.Background(), policy, time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, "user-42/${filename}", post.Fields["key"])
+	assert.True(t, post.IsValid())
+
+	resp := postForm(t, post, map[string]string{"key": "user-42/avatar.png", "Content-Type": "image/png"}, []byte("png"))
+	assert.Less(t, resp.StatusCode, 300)
+
+	resp = postForm(t, post, map[string]string{"key": "user-43/avatar.png"}, []byte("png"))
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+}
+
+func TestPresignPost_RequiresKey(t *testing.T) {
+	storage := newPolicyTestStorage(t)
+	_, err := storage.PresignPost(context.Background(), NewPostPolicy(), time.Minute)
+	assert.ErrorIs(t, err, storagex.ErrInvalidKey)
+}
+
+func TestSignPostPolicy_KnownVector(t *testing.T) {
+	// Example from the AWS SigV4 POST documentation
+	policy := "eyAiZXhwaXJhdGlvbiI6ICIyMDE1LTEyLTMwVDEyOjAwOjAwLjAwMFoiLA0KICAiY29uZGl0aW9ucyI6IFsNCiAgICB7ImJ1Y2tldCI6ICJzaWd2NGV4YW1wbGVidWNrZXQifSwNCiAgICBbInN0YXJ0cy13aXRoIiwgIiRrZXkiLCAidXNlci91c2VyMS8iXSwNCiAgICB7ImFjbCI6ICJwdWJsaWMtcmVhZCJ9LA0KICAgIHsic3VjY2Vzc19hY3Rpb25fcmVkaXJlY3QiOiAiaHR0cDovL3NpZ3Y0ZXhhbXBsZWJ1Y2tldC5zMy5hbWF6b25hd3MuY29tL3N1Y2Nlc3NmdWxfdXBsb2FkLmh0bWwifSwNCiAgICBbInN0YXJ0cy13aXRoIiwgIiRDb250ZW50LVR5cGUiLCAiaW1hZ2UvIl0sDQogICAgeyJ4LWFtei1tZXRhLXV1aWQiOiAiMTQzNjUxMjM2NTEyNzQifSwNCiAgICB7IngtYW16LXNlcnZlci1zaWRlLWVuY3J5cHRpb24iOiAiQUVTMjU2In0sDQogICAgWyJzdGFydHMtd2l0aCIsICIkeC1hbXotbWV0YS10YWciLCAiIl0sDQoNCiAgICB7IngtYW16LWNyZWRlbnRpYWwiOiAiQUtJQUlPU0ZPRE5ON0VYQU1QTEUvMjAxNTEyMjkvdXMtZWFzdC0xL3MzL2F3czRfcmVxdWVzdCJ9LA0KICAgIHsieC1hbXotYWxnb3JpdGhtIjogIkFXUzQtSE1BQy1TSEEyNTYifSwNCiAgICB7IngtYW16LWRhdGUiOiAiMjAxNTEyMjlUMDAwMDAwWiIgfQ0KICBdDQp9"
+	got := signPostPolicy("wJalrXUtnFEMI/K7MDENG/bPxRfiCYEXAMPLEKEY", "20151229", "us-east-1", policy)
+	assert.Equal(t, "8afdbf4008c03f22c2cd3cdb72e4afbb1f6a588f3255ac628749a66d7f09699e", got)
+}
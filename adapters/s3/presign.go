@@ -2,11 +2,15 @@ package s3
 
 import (
 	"context"
+	"crypto/md5"
+	"encoding/base64"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 
 	"github.com/gostratum/storagex"
 )
@@ -27,6 +31,14 @@ func (s *S3Storage) PresignGet(ctx context.Context, key string, opts *storagex.P
 		opts.Expiry = 7 * 24 * time.Hour
 	}
 
+	if err := ValidatePresignOptions(opts); err != nil {
+		return "", &storagex.StorageError{
+			Op:  "presign_get",
+			Key: key,
+			Err: fmt.Errorf("%w: %v", storagex.ErrInvalidConfig, err),
+		}
+	}
+
 	storageKey := s.keyBuilder.BuildKey(key, nil)
 
 	s.logger.Debug("Generating presigned GET URL", storagex.ArgsToFields(
@@ -41,11 +53,32 @@ func (s *S3Storage) PresignGet(ctx context.Context, key string, opts *storagex.P
 		Key:    aws.String(storageKey),
 	}
 
-	// Set response content type if specified
-	if opts.ContentType != "" {
+	// Set response header overrides if specified
+	if opts.ResponseContentType != "" {
+		input.ResponseContentType = aws.String(opts.ResponseContentType)
+	} else if opts.ContentType != "" {
 		input.ResponseContentType = aws.String(opts.ContentType)
 	}
 
+	if opts.ResponseContentDisposition != "" {
+		input.ResponseContentDisposition = aws.String(opts.ResponseContentDisposition)
+	}
+
+	if opts.ResponseCacheControl != "" {
+		input.ResponseCacheControl = aws.String(opts.ResponseCacheControl)
+	}
+
+	if opts.VersionID != "" {
+		input.VersionId = aws.String(opts.VersionID)
+	}
+
+	// Set SSE-C parameters; the downloader must send the matching headers
+	if algorithm, key, keyMD5, ok := sseCustomerParams(opts); ok {
+		input.SSECustomerAlgorithm = algorithm
+		input.SSECustomerKey = key
+		input.SSECustomerKeyMD5 = keyMD5
+	}
+
 	// Generate presigned request
 	req, err := s.client.GetPresignClient().PresignGetObject(ctx, input, func(presignOpts *s3.PresignOptions) {
 		presignOpts.Expires = opts.Expiry
@@ -82,6 +115,14 @@ func (s *S3Storage) PresignPut(ctx context.Context, key string, opts *storagex.P
 		opts.Expiry = 7 * 24 * time.Hour
 	}
 
+	if err := ValidatePresignOptions(opts); err != nil {
+		return "", &storagex.StorageError{
+			Op:  "presign_put",
+			Key: key,
+			Err: fmt.Errorf("%w: %v", storagex.ErrInvalidConfig, err),
+		}
+	}
+
 	storageKey := s.keyBuilder.BuildKey(key, nil)
 
 	s.logger.Debug("Generating presigned PUT URL", storagex.ArgsToFields(
@@ -106,6 +147,22 @@ func (s *S3Storage) PresignPut(ctx context.Context, key string, opts *storagex.P
 		input.Metadata = opts.Metadata
 	}
 
+	// Set SSE-C parameters; the uploader must send the matching headers
+	if algorithm, key, keyMD5, ok := sseCustomerParams(opts); ok {
+		input.SSECustomerAlgorithm = algorithm
+		input.SSECustomerKey = key
+		input.SSECustomerKeyMD5 = keyMD5
+	}
+
+	// Require a checksum if specified
+	if err := applyPutChecksum(input, opts); err != nil {
+		return "", &storagex.StorageError{
+			Op:  "presign_put",
+			Key: key,
+			Err: err,
+		}
+	}
+
 	// Generate presigned request with conditions
 	presignOpts := func(presignOpts *s3.PresignOptions) {
 		presignOpts.Expires = opts.Expiry
@@ -130,6 +187,7 @@ func (s *S3Storage) PresignPut(ctx context.Context, key string, opts *storagex.P
 
 // PresignPostPolicy generates a presigned POST policy for browser uploads
 // This is more flexible than PresignPut as it allows additional conditions
+// (content type, content-length-range and metadata) that S3 enforces.
 func (s *S3Storage) PresignPostPolicy(ctx context.Context, key string, opts *storagex.PresignOptions) (*PresignedPost, error) {
 	if opts == nil {
 		opts = &storagex.PresignOptions{
@@ -141,75 +199,47 @@ func (s *S3Storage) PresignPostPolicy(ctx context.Context, key string, opts *sto
 	if opts.Expiry <= 0 {
 		opts.Expiry = 15 * time.Minute
 	}
-	if opts.Expiry > 7*24*time.Hour {
+	if opts.Expiry > 7*24*time.Hour { // AWS limit is 7 days
 		opts.Expiry = 7 * 24 * time.Hour
 	}
 
-	storageKey := s.keyBuilder.BuildKey(key, nil)
+	if err := ValidatePresignOptions(opts); err != nil {
+		return nil, &storagex.StorageError{
+			Op:  "presign_post",
+			Key: key,
+			Err: fmt.Errorf("%w: %v", storagex.ErrInvalidConfig, err),
+		}
+	}
 
 	s.logger.Debug("Generating presigned POST policy", storagex.ArgsToFields(
 		"key", key,
-		"storage_key", storageKey,
 		"expiry", opts.Expiry,
 	)...)
 
-	// Build POST presign input
-	input := &s3.PutObjectInput{
-		Bucket: aws.String(s.client.GetConfig().Bucket),
-		Key:    aws.String(storageKey),
-	}
+	policy := NewPostPolicy().SetKey(key)
 
 	// Set content type condition if specified
-	conditions := make(map[string]string)
 	if opts.ContentType != "" {
-		input.ContentType = aws.String(opts.ContentType)
-		conditions["Content-Type"] = opts.ContentType
+		policy.SetContentType(opts.ContentType)
 	}
 
 	// Set content length range conditions if specified
 	if opts.ContentLengthRange[0] > 0 || opts.ContentLengthRange[1] > 0 {
-		conditions["content-length-range"] = fmt.Sprintf("%d,%d",
-			opts.ContentLengthRange[0], opts.ContentLengthRange[1])
+		max := opts.ContentLengthRange[1]
+		if max == 0 {
+			max = maxObjectSize
+		}
+		policy.SetContentLengthRange(opts.ContentLengthRange[0], max)
 	}
 
 	// Set metadata conditions
-	if len(opts.Metadata) > 0 {
-		input.Metadata = opts.Metadata
-		for k, v := range opts.Metadata {
-			conditions["x-amz-meta-"+k] = v
-		}
+	for k, v := range opts.Metadata {
+		policy.SetMetadata(k, v)
 	}
 
-	// Generate presigned POST
-	req, err := s.client.GetPresignClient().PresignPutObject(ctx, input, func(presignOpts *s3.PresignOptions) {
-		presignOpts.Expires = opts.Expiry
-	})
+	post, err := s.PresignPost(ctx, policy, opts.Expiry)
 	if err != nil {
-		return nil, &storagex.StorageError{
-			Op:  "presign_post",
-			Key: key,
-			Err: fmt.Errorf("failed to generate presigned POST policy: %w", err),
-		}
-	}
-
-	// Build the response (simplified - in production you might want a more complete policy)
-	post := &PresignedPost{
-		URL: req.URL,
-		Fields: map[string]string{
-			"key": storageKey,
-		},
-		Conditions: conditions,
-		Expiry:     time.Now().Add(opts.Expiry),
-	}
-
-	// Add content type field if specified
-	if opts.ContentType != "" {
-		post.Fields["Content-Type"] = opts.ContentType
-	}
-
-	// Add metadata fields
-	for k, v := range opts.Metadata {
-		post.Fields["x-amz-meta-"+k] = v
+		return nil, err
 	}
 
 	s.logger.Debug("Presigned POST policy generated successfully", storagex.ArgsToFields(
@@ -341,6 +371,53 @@ func (up *UploadPresign) GetHeaders() map[string]string {
 	return headers
 }
 
+// sseCustomerParams returns the SSE-C algorithm, base64 key and base64 key
+// MD5 for the options, or ok=false when SSE-C is not requested
+func sseCustomerParams(opts *storagex.PresignOptions) (algorithm, key, keyMD5 *string, ok bool) {
+	if len(opts.SSECustomerKey) == 0 {
+		return nil, nil, nil, false
+	}
+
+	alg := opts.SSECustomerAlgorithm
+	if alg == "" {
+		alg = "AES256"
+	}
+	sum := md5.Sum(opts.SSECustomerKey)
+
+	return aws.String(alg),
+		aws.String(base64.StdEncoding.EncodeToString(opts.SSECustomerKey)),
+		aws.String(base64.StdEncoding.EncodeToString(sum[:])),
+		true
+}
+
+// applyPutChecksum sets the checksum algorithm and expected value on a
+// PutObject input
+func applyPutChecksum(input *s3.PutObjectInput, opts *storagex.PresignOptions) error {
+	if opts.ChecksumAlgorithm == "" {
+		return nil
+	}
+
+	algorithm := types.ChecksumAlgorithm(strings.ToUpper(opts.ChecksumAlgorithm))
+	input.ChecksumAlgorithm = algorithm
+	if opts.Checksum == "" {
+		return nil
+	}
+
+	switch algorithm {
+	case types.ChecksumAlgorithmCrc32:
+		input.ChecksumCRC32 = aws.String(opts.Checksum)
+	case types.ChecksumAlgorithmCrc32c:
+		input.ChecksumCRC32C = aws.String(opts.Checksum)
+	case types.ChecksumAlgorithmSha1:
+		input.ChecksumSHA1 = aws.String(opts.Checksum)
+	case types.ChecksumAlgorithmSha256:
+		input.ChecksumSHA256 = aws.String(opts.Checksum)
+	default:
+		return fmt.Errorf("%w: unsupported checksum algorithm %q", storagex.ErrInvalidConfig, opts.ChecksumAlgorithm)
+	}
+	return nil
+}
+
 // ValidatePresignOptions validates presign options
 func ValidatePresignOptions(opts *storagex.PresignOptions) error {
 	if opts == nil {
@@ -363,6 +440,19 @@ func ValidatePresignOptions(opts *storagex.PresignOptions) error {
 		return fmt.Errorf("content length range minimum cannot exceed maximum")
 	}
 
+	// Validate SSE-C key length (AES256 requires a 256-bit key)
+	if len(opts.SSECustomerKey) > 0 && len(opts.SSECustomerKey) != 32 {
+		return fmt.Errorf("SSE-C key must be 32 bytes")
+	}
+	if opts.SSECustomerAlgorithm != "" && len(opts.SSECustomerKey) == 0 {
+		return fmt.Errorf("SSE-C algorithm requires a customer key")
+	}
+
+	// Validate checksum configuration
+	if opts.Checksum != "" && opts.ChecksumAlgorithm == "" {
+		return fmt.Errorf("checksum requires a checksum algorithm")
+	}
+
 	// Validate metadata keys (S3 has restrictions on metadata keys)
 	for key := range opts.Metadata {
 		if len(key) == 0 {
@@ -0,0 +1,70 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/gostratum/storagex"
+)
+
+func TestPresignGet_ResponseOverrides(t *testing.T) {
+	storage := newPolicyTestStorage(t)
+
+	raw, err := storage.PresignGet(context.Background(), "objects/6f1c.bin", &storagex.PresignOptions{
+		Expiry:                     time.Minute,
+		ResponseContentDisposition: storagex.ContentDispositionAttachment("Q3 report.pdf"),
+		ResponseContentType:        "application/pdf",
+		ResponseCacheControl:       "private, max-age=60",
+		VersionID:                  "3HL4kqtJlcpXroDTDmJ",
+	})
+	require.NoError(t, err)
+
+	parsed, err := url.Parse(raw)
+	require.NoError(t, err)
+	query := parsed.Query()
+	assert.Equal(t, `attachment; filename="Q3 report.pdf"`, query.Get("response-content-disposition"))
+	assert.Equal(t, "application/pdf", query.Get("response-content-type"))
+	assert.Equal(t, "private, max-age=60", query.Get("response-cache-control"))
+	assert.Equal(t, "3HL4kqtJlcpXroDTDmJ", query.Get("versionId"))
+}
+
+func TestPresignGet_SSECustomerKeyIsSigned(t *testing.T) {
+	storage := newPolicyTestStorage(t)
+
+	raw, err := storage.PresignGet(context.Background(), "secret.bin", &storagex.PresignOptions{
+		SSECustomerKey: bytes.Repeat([]byte("k"), 32),
+	})
+	require.NoError(t, err)
+
+	parsed, err := url.Parse(raw)
+	require.NoError(t, err)
+	assert.Contains(t, parsed.Query().Get("X-Amz-SignedHeaders"), "x-amz-server-side-encryption-customer-algorithm")
+
+	_, err = storage.PresignGet(context.Background(), "secret.bin", &storagex.PresignOptions{
+		SSECustomerKey: []byte("short"),
+	})
+	assert.ErrorIs(t, err, storagex.ErrInvalidConfig)
+}
+
+func TestPresignPut_ChecksumRequirement(t *testing.T) {
+	storage := newPolicyTestStorage(t)
+
+	raw, err := storage.PresignPut(context.Background(), "upload.bin", &storagex.PresignOptions{
+		ChecksumAlgorithm: "sha256",
+		Checksum:          "n4bQgYhMfWWaL+qgxVrQFaO/TxsrC4Is0V1sFbDwCgg=",
+	})
+	require.NoError(t, err)
+	assert.Contains(t, raw, "X-Amz-Checksum-Sha256=")
+
+	_, err = storage.PresignPut(context.Background(), "upload.bin", &storagex.PresignOptions{
+		ChecksumAlgorithm: "md4",
+		Checksum:          "abc",
+	})
+	assert.ErrorIs(t, err, storagex.ErrInvalidConfig)
+}
@@ -0,0 +1,418 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"github.com/gostratum/storagex"
+)
+
+// CreateBucket creates the bucket, optionally with Object Lock enabled
+func (a *BucketAdmin) CreateBucket(ctx context.Context, objectLock bool) error {
+	if _, err := a.client.CreateBucket(ctx, createBucketInput(a.bucket, a.region, objectLock)); err != nil {
+		return MapS3Error(err, "create_bucket", "")
+	}
+	return nil
+}
+
+// GetVersioning returns storagex.VersioningEnabled,
+// storagex.VersioningSuspended or "" if versioning was never enabled
+func (a *BucketAdmin) GetVersioning(ctx context.Context) (string, error) {
+	output, err := a.client.GetBucketVersioning(ctx, &s3.GetBucketVersioningInput{
+		Bucket: aws.String(a.bucket),
+	})
+	if err != nil {
+		return "", MapS3Error(err, "get_versioning", "")
+	}
+	switch output.Status {
+	case types.BucketVersioningStatusEnabled:
+		return storagex.VersioningEnabled, nil
+	case types.BucketVersioningStatusSuspended:
+		return storagex.VersioningSuspended, nil
+	}
+	return "", nil
+}
+
+// PutVersioning enables or suspends versioning
+func (a *BucketAdmin) PutVersioning(ctx context.Context, state string) error {
+	status := types.BucketVersioningStatusEnabled
+	if state == storagex.VersioningSuspended {
+		status = types.BucketVersioningStatusSuspended
+	}
+	_, err := a.client.PutBucketVersioning(ctx, &s3.PutBucketVersioningInput{
+		Bucket:                  aws.String(a.bucket),
+		VersioningConfiguration: &types.VersioningConfiguration{Status: status},
+	})
+	if err != nil {
+		return MapS3Error(err, "put_versioning", "")
+	}
+	return nil
+}
+
+// GetEncryption returns the default encryption of the bucket, or nil
+func (a *BucketAdmin) GetEncryption(ctx context.Context) (*storagex.EncryptionConfig, error) {
+	output, err := a.client.GetBucketEncryption(ctx, &s3.GetBucketEncryptionInput{
+		Bucket: aws.String(a.bucket),
+	})
+	if err != nil {
+		if hasErrorCode(err, "ServerSideEncryptionConfigurationNotFoundError") {
+			return nil, nil
+		}
+		return nil, MapS3Error(err, "get_encryption", "")
+	}
+	if output.ServerSideEncryptionConfiguration == nil {
+		return nil, nil
+	}
+	for _, rule := range output.ServerSideEncryptionConfiguration.Rules {
+		if rule.ApplyServerSideEncryptionByDefault == nil {
+			continue
+		}
+		return &storagex.EncryptionConfig{
+			Algorithm: string(rule.ApplyServerSideEncryptionByDefault.SSEAlgorithm),
+			KMSKeyID:  aws.ToString(rule.ApplyServerSideEncryptionByDefault.KMSMasterKeyID),
+			BucketKey: aws.ToBool(rule.BucketKeyEnabled),
+		}, nil
+	}
+	return nil, nil
+}
+
+// PutEncryption sets the default encryption of the bucket
+func (a *BucketAdmin) PutEncryption(ctx context.Context, encryption storagex.EncryptionConfig) error {
+	rule := types.ServerSideEncryptionRule{
+		ApplyServerSideEncryptionByDefault: &types.ServerSideEncryptionByDefault{
+			SSEAlgorithm: types.ServerSideEncryption(encryption.Algorithm),
+		},
+	}
+	if encryption.KMSKeyID != "" {
+		rule.ApplyServerSideEncryptionByDefault.KMSMasterKeyID = aws.String(encryption.KMSKeyID)
+	}
+	if encryption.BucketKey {
+		rule.BucketKeyEnabled = aws.Bool(true)
+	}
+	_, err := a.client.PutBucketEncryption(ctx, &s3.PutBucketEncryptionInput{
+		Bucket: aws.String(a.bucket),
+		ServerSideEncryptionConfiguration: &types.ServerSideEncryptionConfiguration{
+			Rules: []types.ServerSideEncryptionRule{rule},
+		},
+	})
+	if err != nil {
+		return MapS3Error(err, "put_encryption", "")
+	}
+	return nil
+}
+
+// GetCORS returns the CORS rules of the bucket
+func (a *BucketAdmin) GetCORS(ctx context.Context) ([]storagex.CORSRule, error) {
+	output, err := a.client.GetBucketCors(ctx, &s3.GetBucketCorsInput{
+		Bucket: aws.String(a.bucket),
+	})
+	if err != nil {
+		if hasErrorCode(err, "NoSuchCORSConfiguration") {
+			return nil, nil
+		}
+		return nil, MapS3Error(err, "get_cors", "")
+	}
+
+	rules := make([]storagex.CORSRule, 0, len(output.CORSRules))
+	for _, r := range output.CORSRules {
+		rules = append(rules, storagex.CORSRule{
+			ID:             aws.ToString(r.ID),
+			AllowedOrigins: r.AllowedOrigins,
+			AllowedMethods: r.AllowedMethods,
+			AllowedHeaders: r.AllowedHeaders,
+			ExposeHeaders:  r.ExposeHeaders,
+			MaxAgeSeconds:  int(aws.ToInt32(r.MaxAgeSeconds)),
+		})
+	}
+	return rules, nil
+}
+
+// PutCORS replaces the CORS rules of the bucket. No rules removes the CORS
+// configuration.
+func (a *BucketAdmin) PutCORS(ctx context.Context, rules []storagex.CORSRule) error {
+	if len(rules) == 0 {
+		_, err := a.client.DeleteBucketCors(ctx, &s3.DeleteBucketCorsInput{
+			Bucket: aws.String(a.bucket),
+		})
+		if err != nil {
+			return MapS3Error(err, "put_cors", "")
+		}
+		return nil
+	}
+
+	s3Rules := make([]types.CORSRule, 0, len(rules))
+	for _, rule := range rules {
+		r := types.CORSRule{
+			AllowedOrigins: rule.AllowedOrigins,
+			AllowedMethods: rule.AllowedMethods,
+			AllowedHeaders: rule.AllowedHeaders,
+			ExposeHeaders:  rule.ExposeHeaders,
+		}
+		if rule.ID != "" {
+			r.ID = aws.String(rule.ID)
+		}
+		if rule.MaxAgeSeconds > 0 {
+			r.MaxAgeSeconds = aws.Int32(int32(rule.MaxAgeSeconds))
+		}
+		s3Rules = append(s3Rules, r)
+	}
+	_, err := a.client.PutBucketCors(ctx, &s3.PutBucketCorsInput{
+		Bucket:            aws.String(a.bucket),
+		CORSConfiguration: &types.CORSConfiguration{CORSRules: s3Rules},
+	})
+	if err != nil {
+		return MapS3Error(err, "put_cors", "")
+	}
+	return nil
+}
+
+// GetPublicAccessBlock returns the public access block of the bucket, or nil
+func (a *BucketAdmin) GetPublicAccessBlock(ctx context.Context) (*storagex.PublicAccessBlockConfig, error) {
+	output, err := a.client.GetPublicAccessBlock(ctx, &s3.GetPublicAccessBlockInput{
+		Bucket: aws.String(a.bucket),
+	})
+	if err != nil {
+		if hasErrorCode(err, "NoSuchPublicAccessBlockConfiguration") {
+			return nil, nil
+		}
+		return nil, MapS3Error(err, "get_public_access_block", "")
+	}
+	block := output.PublicAccessBlockConfiguration
+	if block == nil {
+		return nil, nil
+	}
+	return &storagex.PublicAccessBlockConfig{
+		BlockPublicACLs:       aws.ToBool(block.BlockPublicAcls),
+		IgnorePublicACLs:      aws.ToBool(block.IgnorePublicAcls),
+		BlockPublicPolicy:     aws.ToBool(block.BlockPublicPolicy),
+		RestrictPublicBuckets: aws.ToBool(block.RestrictPublicBuckets),
+	}, nil
+}
+
+// PutPublicAccessBlock sets the public access block of the bucket
+func (a *BucketAdmin) PutPublicAccessBlock(ctx context.Context, block storagex.PublicAccessBlockConfig) error {
+	_, err := a.client.PutPublicAccessBlock(ctx, &s3.PutPublicAccessBlockInput{
+		Bucket: aws.String(a.bucket),
+		PublicAccessBlockConfiguration: &types.PublicAccessBlockConfiguration{
+			BlockPublicAcls:       aws.Bool(block.BlockPublicACLs),
+			IgnorePublicAcls:      aws.Bool(block.IgnorePublicACLs),
+			BlockPublicPolicy:     aws.Bool(block.BlockPublicPolicy),
+			RestrictPublicBuckets: aws.Bool(block.RestrictPublicBuckets),
+		},
+	})
+	if err != nil {
+		return MapS3Error(err, "put_public_access_block", "")
+	}
+	return nil
+}
+
+// GetTags returns the tag set of the bucket
+func (a *BucketAdmin) GetTags(ctx context.Context) (map[string]string, error) {
+	output, err := a.client.GetBucketTagging(ctx, &s3.GetBucketTaggingInput{
+		Bucket: aws.String(a.bucket),
+	})
+	if err != nil {
+		if hasErrorCode(err, "NoSuchTagSet") {
+			return nil, nil
+		}
+		return nil, MapS3Error(err, "get_tags", "")
+	}
+	tags := make(map[string]string, len(output.TagSet))
+	for _, tag := range output.TagSet {
+		tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+	}
+	return tags, nil
+}
+
+// PutTags replaces the tag set of the bucket. No tags removes the tag set.
+func (a *BucketAdmin) PutTags(ctx context.Context, tags map[string]string) error {
+	if len(tags) == 0 {
+		_, err := a.client.DeleteBucketTagging(ctx, &s3.DeleteBucketTaggingInput{
+			Bucket: aws.String(a.bucket),
+		})
+		if err != nil {
+			return MapS3Error(err, "put_tags", "")
+		}
+		return nil
+	}
+
+	tagSet := make([]types.Tag, 0, len(tags))
+	for k, v := range tags {
+		tagSet = append(tagSet, types.Tag{Key: aws.String(k), Value: aws.String(v)})
+	}
+	_, err := a.client.PutBucketTagging(ctx, &s3.PutBucketTaggingInput{
+		Bucket:  aws.String(a.bucket),
+		Tagging: &types.Tagging{TagSet: tagSet},
+	})
+	if err != nil {
+		return MapS3Error(err, "put_tags", "")
+	}
+	return nil
+}
+
+// bucketSetting is one managed setting of a provisioning plan
+type bucketSetting struct {
+	name    string
+	desired string
+	current func(ctx context.Context) (string, error)
+	apply   func(ctx context.Context) error
+}
+
+// bucketSettings returns the settings cfg manages
+func (a *BucketAdmin) bucketSettings(cfg storagex.ProvisioningConfig) []bucketSetting {
+	var settings []bucketSetting
+	if cfg.Versioning != "" {
+		settings = append(settings, bucketSetting{
+			name:    "versioning",
+			desired: cfg.Versioning,
+			current: func(ctx context.Context) (string, error) {
+				state, err := a.GetVersioning(ctx)
+				if state == "" {
+					state = "disabled"
+				}
+				return state, err
+			},
+			apply: func(ctx context.Context) error { return a.PutVersioning(ctx, cfg.Versioning) },
+		})
+	}
+	if cfg.Encryption != nil {
+		settings = append(settings, bucketSetting{
+			name:    "encryption",
+			desired: cfg.Encryption.String(),
+			current: func(ctx context.Context) (string, error) {
+				encryption, err := a.GetEncryption(ctx)
+				return encryption.String(), err
+			},
+			apply: func(ctx context.Context) error { return a.PutEncryption(ctx, *cfg.Encryption) },
+		})
+	}
+	if len(cfg.CORS) > 0 {
+		settings = append(settings, bucketSetting{
+			name:    "cors",
+			desired: storagex.DescribeCORS(cfg.CORS),
+			current: func(ctx context.Context) (string, error) {
+				rules, err := a.GetCORS(ctx)
+				return storagex.DescribeCORS(rules), err
+			},
+			apply: func(ctx context.Context) error { return a.PutCORS(ctx, cfg.CORS) },
+		})
+	}
+	if cfg.PublicAccessBlock != nil {
+		settings = append(settings, bucketSetting{
+			name:    "public_access_block",
+			desired: cfg.PublicAccessBlock.String(),
+			current: func(ctx context.Context) (string, error) {
+				block, err := a.GetPublicAccessBlock(ctx)
+				return block.String(), err
+			},
+			apply: func(ctx context.Context) error { return a.PutPublicAccessBlock(ctx, *cfg.PublicAccessBlock) },
+		})
+	}
+	if len(cfg.Tags) > 0 {
+		settings = append(settings, bucketSetting{
+			name:    "tags",
+			desired: storagex.DescribeTags(cfg.Tags),
+			current: func(ctx context.Context) (string, error) {
+				tags, err := a.GetTags(ctx)
+				return storagex.DescribeTags(tags), err
+			},
+			apply: func(ctx context.Context) error { return a.PutTags(ctx, cfg.Tags) },
+		})
+	}
+	return settings
+}
+
+// PlanProvisioning returns the changes that would make the bucket match cfg.
+// A missing bucket fails with storagex.ErrNotFound unless cfg.CreateBucket
+// is set.
+func (a *BucketAdmin) PlanProvisioning(ctx context.Context, cfg storagex.ProvisioningConfig) ([]storagex.BucketChange, error) {
+	changes, _, err := a.planProvisioning(ctx, cfg)
+	return changes, err
+}
+
+func (a *BucketAdmin) planProvisioning(ctx context.Context, cfg storagex.ProvisioningConfig) ([]storagex.BucketChange, []bucketSetting, error) {
+	exists, err := bucketExists(ctx, a.client, a.bucket)
+	if err != nil {
+		return nil, nil, MapS3Error(err, "provision", "")
+	}
+
+	var changes []storagex.BucketChange
+	var pending []bucketSetting
+	if !exists {
+		if !cfg.CreateBucket {
+			return nil, nil, &storagex.StorageError{
+				Op:  "provision",
+				Err: fmt.Errorf("%w: bucket %q does not exist", storagex.ErrNotFound, a.bucket),
+			}
+		}
+		desired := "created"
+		if cfg.ObjectLock {
+			desired = "created with object lock"
+		}
+		changes = append(changes, storagex.BucketChange{Setting: "bucket", Current: "missing", Desired: desired})
+	}
+
+	for _, setting := range a.bucketSettings(cfg) {
+		// A bucket about to be created has no settings yet
+		current := "none"
+		if setting.name == "versioning" {
+			current = "disabled"
+		}
+		if exists {
+			if current, err = setting.current(ctx); err != nil {
+				return nil, nil, err
+			}
+		}
+		if current != setting.desired {
+			changes = append(changes, storagex.BucketChange{Setting: setting.name, Current: current, Desired: setting.desired})
+			pending = append(pending, setting)
+		}
+	}
+	return changes, pending, nil
+}
+
+// Provision logs the changes that make the bucket match cfg and, unless
+// cfg.DryRun is set, applies them. Settings already matching are left
+// alone, so provisioning is idempotent. It returns the planned changes.
+func (a *BucketAdmin) Provision(ctx context.Context, cfg storagex.ProvisioningConfig) ([]storagex.BucketChange, error) {
+	changes, pending, err := a.planProvisioning(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if len(changes) == 0 {
+		a.logger.Debug("Bucket provisioning up to date", storagex.ArgsToFields("bucket", a.bucket)...)
+		return nil, nil
+	}
+
+	for _, change := range changes {
+		a.logger.Info("Bucket change planned", storagex.ArgsToFields(
+			"bucket", a.bucket,
+			"setting", change.Setting,
+			"change", change.String(),
+			"dry_run", cfg.DryRun,
+		)...)
+	}
+	if cfg.DryRun {
+		return changes, nil
+	}
+
+	if changes[0].Setting == "bucket" {
+		if err := a.CreateBucket(ctx, cfg.ObjectLock); err != nil {
+			return changes, err
+		}
+	}
+	for _, setting := range pending {
+		if err := setting.apply(ctx); err != nil {
+			return changes, err
+		}
+	}
+	a.logger.Info("Bucket provisioned", storagex.ArgsToFields(
+		"bucket", a.bucket,
+		"changes", len(changes),
+	)...)
+	return changes, nil
+}
@@ -0,0 +1,120 @@
+package s3
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/gostratum/storagex"
+)
+
+func TestBucketAdmin_Provision(t *testing.T) {
+	ctx := context.Background()
+	srv := newBucketConfigServer(t)
+	cm, err := NewClientManager(ctx, ClientConfig{Config: srv.config("provisioned")})
+	require.NoError(t, err)
+	admin := cm.BucketAdmin()
+
+	cfg := storagex.ProvisioningConfig{
+		Versioning: storagex.VersioningEnabled,
+		Encryption: &storagex.EncryptionConfig{Algorithm: "aws:kms", KMSKeyID: "alias/storage", BucketKey: true},
+		CORS: []storagex.CORSRule{{
+			AllowedOrigins: []string{"https://app.example.com"},
+			AllowedMethods: []string{"GET", "PUT"},
+			AllowedHeaders: []string{"*"},
+			ExposeHeaders:  []string{"ETag"},
+			MaxAgeSeconds:  3600,
+		}},
+		PublicAccessBlock: &storagex.PublicAccessBlockConfig{
+			BlockPublicACLs:       true,
+			IgnorePublicACLs:      true,
+			BlockPublicPolicy:     true,
+			RestrictPublicBuckets: true,
+		},
+		Tags: map[string]string{"team": "storage", "env": "test"},
+	}
+
+	// Missing buckets are only created when asked to
+	_, err = admin.PlanProvisioning(ctx, cfg)
+	assert.True(t, storagex.IsNotFound(err))
+
+	cfg.CreateBucket = true
+	cfg.DryRun = true
+	changes, err := admin.Provision(ctx, cfg)
+	require.NoError(t, err)
+	require.Len(t, changes, 6)
+	assert.Equal(t, "bucket: missing -> created", changes[0].String())
+	assert.Equal(t, "versioning: disabled -> enabled", changes[1].String())
+	exists, err := cm.BucketExists(ctx)
+	require.NoError(t, err)
+	assert.False(t, exists, "dry run")
+
+	cfg.DryRun = false
+	changes, err = admin.Provision(ctx, cfg)
+	require.NoError(t, err)
+	assert.Len(t, changes, 6)
+
+	versioning, err := admin.GetVersioning(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, storagex.VersioningEnabled, versioning)
+	encryption, err := admin.GetEncryption(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, cfg.Encryption, encryption)
+	cors, err := admin.GetCORS(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, cfg.CORS, cors)
+	block, err := admin.GetPublicAccessBlock(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, cfg.PublicAccessBlock, block)
+	tags, err := admin.GetTags(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, cfg.Tags, tags)
+
+	// Provisioning is idempotent
+	changes, err = admin.Provision(ctx, cfg)
+	require.NoError(t, err)
+	assert.Empty(t, changes)
+	assert.Equal(t, 1, srv.putCount("cors"))
+
+	// Only drifted settings are changed
+	require.NoError(t, admin.PutTags(ctx, map[string]string{"team": "other"}))
+	changes, err = admin.Provision(ctx, cfg)
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+	assert.Equal(t, "tags: team=other -> env=test,team=storage", changes[0].String())
+	assert.Equal(t, 1, srv.putCount("encryption"))
+}
+
+func TestNewS3Storage_Provisioning(t *testing.T) {
+	ctx := context.Background()
+	srv := newBucketConfigServer(t)
+
+	cfg := srv.config("compose")
+	cfg.Provisioning = storagex.ProvisioningConfig{
+		Enabled:      true,
+		CreateBucket: true,
+		Tags:         map[string]string{"app": "storagex"},
+	}
+	cfg.Lifecycle = storagex.BucketLifecycleConfig{
+		Apply: true,
+		Rules: []storagex.LifecycleRule{{ID: "tmp", Prefix: "tmp/", ExpirationDays: 1}},
+	}
+
+	// A dry run of a missing bucket plans nothing else
+	cfg.Provisioning.DryRun = true
+	_, err := NewS3Storage(ctx, cfg)
+	require.NoError(t, err)
+	assert.Equal(t, 0, srv.putCount("lifecycle"))
+
+	cfg.Provisioning.DryRun = false
+	storage, err := NewS3Storage(ctx, cfg)
+	require.NoError(t, err)
+	_, err = storage.PutBytes(ctx, "tmp/a.txt", []byte("a"), nil)
+	require.NoError(t, err)
+	tags, err := storage.BucketAdmin().GetTags(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, cfg.Provisioning.Tags, tags)
+	assert.Equal(t, 1, srv.putCount("lifecycle"))
+}
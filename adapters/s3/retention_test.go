@@ -0,0 +1,91 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/johannesboyne/gofakes3"
+	"github.com/johannesboyne/gofakes3/backend/s3mem"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/gostratum/storagex"
+)
+
+// messageError mimics an SDK API error carrying an error code and message
+type messageError struct{ code, message string }
+
+func (e *messageError) Error() string {
+	return "https response error StatusCode: 403, api error " + e.code + ": " + e.message
+}
+
+func (e *messageError) ErrorCode() string    { return e.code }
+func (e *messageError) ErrorMessage() string { return e.message }
+
+func TestMapS3Error_Retained(t *testing.T) {
+	err := fmt.Errorf("operation error S3: DeleteObject: %w", &messageError{
+		code:    "AccessDenied",
+		message: "Access Denied because object protected by object lock.",
+	})
+	mapped := MapS3Error(err, "delete", "records/a.pdf")
+	assert.True(t, storagex.IsRetained(mapped), "%v", mapped)
+	assert.ErrorIs(t, mapped, storagex.ErrConflict)
+
+	// Missing permissions are not retention
+	mapped = MapS3Error(&messageError{code: "AccessDenied", message: "Access Denied"}, "delete", "records/a.pdf")
+	assert.False(t, storagex.IsRetained(mapped))
+}
+
+func TestLockRetention(t *testing.T) {
+	assert.Nil(t, lockRetention("", nil, ""))
+	assert.Nil(t, lockRetention("", nil, types.ObjectLockLegalHoldStatusOff))
+
+	until := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	assert.Equal(t, &storagex.Retention{Mode: storagex.LockModeCompliance, RetainUntil: until},
+		lockRetention(types.ObjectLockModeCompliance, aws.Time(until), ""))
+	assert.Equal(t, &storagex.Retention{LegalHold: true},
+		lockRetention("", nil, types.ObjectLockLegalHoldStatusOn))
+}
+
+func TestPut_ValidatesRetention(t *testing.T) {
+	backend := s3mem.New()
+	require.NoError(t, backend.CreateBucket("records"))
+	ts := httptest.NewServer(gofakes3.New(backend).Server())
+	defer ts.Close()
+
+	ctx := context.Background()
+	storage, err := NewS3Storage(ctx, &storagex.Config{
+		Provider:     "s3",
+		Bucket:       "records",
+		Region:       "us-east-1",
+		Endpoint:     ts.URL,
+		AccessKey:    testAccessKey,
+		SecretKey:    testSecretKey,
+		UsePathStyle: true,
+		DisableSSL:   true,
+	})
+	require.NoError(t, err)
+
+	for _, opts := range []*storagex.PutOptions{
+		{LockMode: storagex.LockModeGovernance},
+		{RetainUntil: time.Now().Add(time.Hour)},
+		{LockMode: "LEGAL", RetainUntil: time.Now().Add(time.Hour)},
+		{LockMode: storagex.LockModeCompliance, RetainUntil: time.Now().Add(-time.Hour)},
+	} {
+		_, err := storage.PutBytes(ctx, "records/a.pdf", []byte("a"), opts)
+		assert.ErrorIs(t, err, storagex.ErrInvalidConfig, "%+v", opts)
+		_, err = storage.CreateMultipart(ctx, "records/a.pdf", opts)
+		assert.ErrorIs(t, err, storagex.ErrInvalidConfig, "%+v", opts)
+	}
+	err = storage.SetRetention(ctx, "records/a.pdf", storagex.LockModeGovernance, time.Time{})
+	assert.ErrorIs(t, err, storagex.ErrInvalidConfig)
+
+	// Nothing reached the bucket
+	_, err = storage.Head(ctx, "records/a.pdf")
+	assert.True(t, storagex.IsNotFound(err))
+}
@@ -0,0 +1,197 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/gostratum/storagex"
+)
+
+// SQSSource is a NotificationSource that long-polls an SQS queue (or an
+// SQS-compatible queue such as ElasticMQ or LocalStack) speaking the SQS
+// JSON protocol. Messages are deleted from the queue when acknowledged;
+// unacknowledged messages reappear after the queue's visibility timeout.
+type SQSSource struct {
+	queueURL    string
+	endpoint    string
+	region      string
+	credentials aws.CredentialsProvider
+	signer      *v4.Signer
+	httpClient  *http.Client
+
+	// WaitTime is how long one receive call waits for messages (default
+	// and maximum: 20s)
+	WaitTime time.Duration
+
+	// MaxMessages is the number of messages received at once (default and
+	// maximum: 10)
+	MaxMessages int
+
+	// VisibilityTimeout overrides the queue's visibility timeout for
+	// received messages. It should exceed the time the handler needs for
+	// all events of a message.
+	VisibilityTimeout time.Duration
+}
+
+// NewSQSSource creates a source for the queue at queueURL, signing requests
+// with the credentials and region of awsConfig
+func NewSQSSource(awsConfig aws.Config, queueURL string) (*SQSSource, error) {
+	u, err := url.Parse(queueURL)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid SQS queue URL %q: %w", queueURL, storagex.ErrInvalidConfig)
+	}
+	region := awsConfig.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+	return &SQSSource{
+		queueURL:    queueURL,
+		endpoint:    u.Scheme + "://" + u.Host + "/",
+		region:      region,
+		credentials: awsConfig.Credentials,
+		signer:      v4.NewSigner(),
+		httpClient:  &http.Client{},
+		WaitTime:    20 * time.Second,
+		MaxMessages: 10,
+	}, nil
+}
+
+// SQSSource creates a source for the queue at queueURL using the
+// credentials and region of the S3 client
+func (cm *ClientManager) SQSSource(queueURL string) (*SQSSource, error) {
+	return NewSQSSource(cm.awsConfig, queueURL)
+}
+
+// SQSSource creates a source for the queue at queueURL using the
+// credentials and region of the storage's S3 client
+func (s *S3Storage) SQSSource(queueURL string) (*SQSSource, error) {
+	return s.client.SQSSource(queueURL)
+}
+
+// Receive long-polls the queue for messages
+func (q *SQSSource) Receive(ctx context.Context) ([]NotificationMessage, error) {
+	input := map[string]any{
+		"QueueUrl":            q.queueURL,
+		"MaxNumberOfMessages": min(max(q.MaxMessages, 1), 10),
+		"WaitTimeSeconds":     min(max(int(q.WaitTime/time.Second), 0), 20),
+	}
+	if q.VisibilityTimeout > 0 {
+		input["VisibilityTimeout"] = int(q.VisibilityTimeout / time.Second)
+	}
+
+	var output struct {
+		Messages []struct {
+			MessageID     string `json:"MessageId"`
+			ReceiptHandle string `json:"ReceiptHandle"`
+			Body          string `json:"Body"`
+		} `json:"Messages"`
+	}
+	if err := q.call(ctx, "ReceiveMessage", input, &output); err != nil {
+		return nil, err
+	}
+
+	messages := make([]NotificationMessage, 0, len(output.Messages))
+	for _, m := range output.Messages {
+		messages = append(messages, NotificationMessage{ID: m.ReceiptHandle, Body: []byte(m.Body)})
+	}
+	return messages, nil
+}
+
+// Ack deletes a message from the queue
+func (q *SQSSource) Ack(ctx context.Context, msg NotificationMessage) error {
+	return q.call(ctx, "DeleteMessage", map[string]any{
+		"QueueUrl":      q.queueURL,
+		"ReceiptHandle": msg.ID,
+	}, nil)
+}
+
+// call sends one signed SQS JSON protocol request
+func (q *SQSSource) call(ctx context.Context, action string, input, output any) error {
+	body, err := json.Marshal(input)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, q.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.0")
+	req.Header.Set("X-Amz-Target", "AmazonSQS."+action)
+
+	if q.credentials != nil {
+		creds, err := q.credentials.Retrieve(ctx)
+		if err != nil {
+			return fmt.Errorf("sqs %s: retrieve credentials: %w", action, err)
+		}
+		sum := sha256.Sum256(body)
+		if err := q.signer.SignHTTP(ctx, creds, req, hex.EncodeToString(sum[:]), "sqs", q.region, time.Now()); err != nil {
+			return fmt.Errorf("sqs %s: sign request: %w", action, err)
+		}
+	}
+
+	resp, err := q.httpClient.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("sqs %s: %v: %w", action, err, storagex.ErrTimeout)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("sqs %s: read response: %v: %w", action, err, storagex.ErrTimeout)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return sqsError(action, resp.StatusCode, data)
+	}
+	if output == nil || len(data) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(data, output); err != nil {
+		return fmt.Errorf("sqs %s: decode response: %w", action, err)
+	}
+	return nil
+}
+
+// sqsError maps an SQS error response to the storagex error taxonomy
+func sqsError(action string, status int, body []byte) error {
+	var apiErr struct {
+		Type    string `json:"__type"`
+		Message string `json:"message"`
+	}
+	json.Unmarshal(body, &apiErr)
+	code := apiErr.Type
+	if i := strings.LastIndexByte(code, '#'); i >= 0 {
+		code = code[i+1:]
+	}
+	if code == "" {
+		code = http.StatusText(status)
+	}
+
+	switch {
+	case strings.Contains(code, "QueueDoesNotExist"), strings.Contains(code, "NonExistentQueue"):
+		return fmt.Errorf("sqs %s: %s: %w", action, code, storagex.ErrNotFound)
+	case strings.Contains(code, "Throttl"), strings.Contains(code, "RequestThrottled"), status == http.StatusTooManyRequests:
+		return fmt.Errorf("sqs %s: %s: %w", action, code, storagex.ErrThrottled)
+	case status >= 500:
+		return fmt.Errorf("sqs %s: %s (%d): %w", action, code, status, storagex.ErrTimeout)
+	}
+	if apiErr.Message != "" {
+		return fmt.Errorf("sqs %s: %s: %s", action, code, apiErr.Message)
+	}
+	return fmt.Errorf("sqs %s: %s", action, code)
+}
+
+var _ NotificationSource = (*SQSSource)(nil)
@@ -23,6 +23,7 @@ type S3Storage struct {
 	client     *ClientManager
 	keyBuilder storagex.KeyBuilder
 	logger     logx.Logger
+	clock      func() time.Time
 }
 
 // NewS3Storage creates a new S3 storage implementation
@@ -43,16 +44,23 @@ func NewS3Storage(ctx context.Context, cfg *storagex.Config, opts ...storagex.Op
 		return nil, fmt.Errorf("failed to create client manager: %w", err)
 	}
 
-	if config.Endpoint != "" && (strings.Contains(config.Endpoint, "localhost") || strings.Contains(config.Endpoint, "127.0.0.1")) {
+	// Without provisioning, buckets on local endpoints are still created
+	// on demand
+	if !config.Provisioning.Enabled && config.Endpoint != "" && (strings.Contains(config.Endpoint, "localhost") || strings.Contains(config.Endpoint, "127.0.0.1")) {
 		if err := clientManager.CreateBucketIfNotExists(ctx); err != nil {
 			return nil, fmt.Errorf("failed to ensure bucket exists: %w", err)
 		}
 	}
 
+	if err := applyBucketConfig(ctx, clientManager); err != nil {
+		return nil, err
+	}
+
 	storage := &S3Storage{
 		client:     clientManager,
 		keyBuilder: options.GetKeyBuilder(),
 		logger:     options.GetLogger(),
+		clock:      options.GetClock(),
 	}
 
 	return storage, nil
@@ -60,9 +68,18 @@ func NewS3Storage(ctx context.Context, cfg *storagex.Config, opts ...storagex.Op
 
 // Put stores an object from an io.Reader
 func (s *S3Storage) Put(ctx context.Context, key string, r io.Reader, opts *storagex.PutOptions) (storagex.Stat, error) {
+	return s.put(ctx, "put", key, r, opts, nil)
+}
+
+// put stores an object. A non-nil condition replaces the Overwrite check
+// with conditional write headers set on the PutObject input.
+func (s *S3Storage) put(ctx context.Context, op, key string, r io.Reader, opts *storagex.PutOptions, condition func(*s3.PutObjectInput)) (storagex.Stat, error) {
 	if opts == nil {
 		opts = &storagex.PutOptions{Overwrite: true}
 	}
+	if err := storagex.ValidateRetention(opts.LockMode, opts.RetainUntil); err != nil {
+		return storagex.Stat{}, &storagex.StorageError{Op: op, Key: key, Err: err}
+	}
 
 	// Build the actual storage key
 	storageKey := s.keyBuilder.BuildKey(key, nil)
@@ -74,12 +91,12 @@ func (s *S3Storage) Put(ctx context.Context, key string, r io.Reader, opts *stor
 	)...)
 
 	// Check if object exists when overwrite is false
-	if !opts.Overwrite {
+	if condition == nil && !opts.Overwrite {
 		if exists, err := s.objectExists(ctx, storageKey); err != nil {
-			return storagex.Stat{}, MapS3Error(err, "put", key)
+			return storagex.Stat{}, MapS3Error(err, op, key)
 		} else if exists {
 			return storagex.Stat{}, &storagex.StorageError{
-				Op:  "put",
+				Op:  op,
 				Key: key,
 				Err: storagex.ErrConflict,
 			}
@@ -90,7 +107,7 @@ func (s *S3Storage) Put(ctx context.Context, key string, r io.Reader, opts *stor
 	data, err := io.ReadAll(r)
 	if err != nil {
 		return storagex.Stat{}, &storagex.StorageError{
-			Op:  "put",
+			Op:  op,
 			Key: key,
 			Err: fmt.Errorf("failed to read data: %w", err),
 		}
@@ -123,10 +140,28 @@ func (s *S3Storage) Put(ctx context.Context, key string, r io.Reader, opts *stor
 		input.Metadata = opts.Metadata
 	}
 
+	// Set storage class
+	if opts.StorageClass != "" {
+		input.StorageClass = types.StorageClass(opts.StorageClass)
+	}
+
+	// Set Object Lock retention and legal hold
+	if opts.LockMode != "" {
+		input.ObjectLockMode = types.ObjectLockMode(opts.LockMode)
+		input.ObjectLockRetainUntilDate = aws.Time(opts.RetainUntil)
+	}
+	if opts.LegalHold {
+		input.ObjectLockLegalHoldStatus = types.ObjectLockLegalHoldStatusOn
+	}
+
+	if condition != nil {
+		condition(input)
+	}
+
 	// Execute the put operation
 	output, err := s.client.GetS3Client().PutObject(ctx, input)
 	if err != nil {
-		return storagex.Stat{}, MapS3Error(err, "put", key)
+		return storagex.Stat{}, MapS3Error(err, op, key)
 	}
 
 	// Build response stat
@@ -136,6 +171,8 @@ func (s *S3Storage) Put(ctx context.Context, key string, r io.Reader, opts *stor
 		ContentType:  opts.ContentType,
 		Metadata:     opts.Metadata,
 		LastModified: time.Now(), // S3 doesn't return this in PutObject response
+		StorageClass: opts.StorageClass,
+		Retention:    lockRetention(input.ObjectLockMode, input.ObjectLockRetainUntilDate, input.ObjectLockLegalHoldStatus),
 	}
 
 	if output.ETag != nil {
@@ -184,6 +221,16 @@ func (s *S3Storage) PutFile(ctx context.Context, key string, path string, opts *
 
 // Get retrieves an object as a streaming reader with metadata
 func (s *S3Storage) Get(ctx context.Context, key string) (storagex.ReaderAtCloser, storagex.Stat, error) {
+	return s.getObject(ctx, key, "")
+}
+
+// GetIfNoneMatch retrieves an object unless its ETag equals etag, in which
+// case it returns storagex.ErrNotModified without transferring the body
+func (s *S3Storage) GetIfNoneMatch(ctx context.Context, key, etag string) (storagex.ReaderAtCloser, storagex.Stat, error) {
+	return s.getObject(ctx, key, etag)
+}
+
+func (s *S3Storage) getObject(ctx context.Context, key, ifNoneMatch string) (storagex.ReaderAtCloser, storagex.Stat, error) {
 	storageKey := s.keyBuilder.BuildKey(key, nil)
 
 	s.logger.Debug("Getting object", storagex.ArgsToFields(
@@ -196,6 +243,9 @@ func (s *S3Storage) Get(ctx context.Context, key string) (storagex.ReaderAtClose
 		Bucket: aws.String(s.client.GetConfig().Bucket),
 		Key:    aws.String(storageKey),
 	}
+	if ifNoneMatch != "" {
+		input.IfNoneMatch = aws.String(ifNoneMatch)
+	}
 
 	output, err := s.client.GetS3Client().GetObject(ctx, input)
 	if err != nil {
@@ -227,6 +277,9 @@ func (s *S3Storage) Get(ctx context.Context, key string) (storagex.ReaderAtClose
 		stat.StorageClass = string(output.StorageClass)
 	}
 
+	stat.Restore = parseRestore(aws.ToString(output.Restore))
+	stat.Retention = lockRetention(output.ObjectLockMode, output.ObjectLockRetainUntilDate, output.ObjectLockLegalHoldStatus)
+
 	// Convert metadata
 	if output.Metadata != nil {
 		stat.Metadata = output.Metadata
@@ -291,6 +344,9 @@ func (s *S3Storage) Head(ctx context.Context, key string) (storagex.Stat, error)
 		stat.StorageClass = string(output.StorageClass)
 	}
 
+	stat.Restore = parseRestore(aws.ToString(output.Restore))
+	stat.Retention = lockRetention(output.ObjectLockMode, output.ObjectLockRetainUntilDate, output.ObjectLockLegalHoldStatus)
+
 	// Convert metadata
 	if output.Metadata != nil {
 		stat.Metadata = output.Metadata
@@ -313,11 +369,9 @@ func (s *S3Storage) List(ctx context.Context, opts storagex.ListOptions) (storag
 		"page_size", opts.PageSize,
 	)...)
 
-	// Build storage prefix
-	storagePrefix := ""
-	if opts.Prefix != "" {
-		storagePrefix = s.keyBuilder.BuildKey(opts.Prefix, nil)
-	}
+	// Build storage prefix. An empty prefix still goes through the key
+	// builder so listings never escape the configured base prefix.
+	storagePrefix := s.keyBuilder.BuildKey(opts.Prefix, nil)
 
 	input := &s3.ListObjectsV2Input{
 		Bucket: aws.String(s.client.GetConfig().Bucket),
@@ -427,6 +481,9 @@ func (s *S3Storage) Delete(ctx context.Context, key string) error {
 		Bucket: aws.String(s.client.GetConfig().Bucket),
 		Key:    aws.String(storageKey),
 	}
+	if storagex.GovernanceBypassFromContext(ctx) {
+		input.BypassGovernanceRetention = aws.Bool(true)
+	}
 
 	_, err := s.client.GetS3Client().DeleteObject(ctx, input)
 	if err != nil {
@@ -460,6 +517,9 @@ func (s *S3Storage) DeleteBatch(ctx context.Context, keys []string) ([]string, e
 			Objects: objects,
 		},
 	}
+	if storagex.GovernanceBypassFromContext(ctx) {
+		input.BypassGovernanceRetention = aws.Bool(true)
+	}
 
 	output, err := s.client.GetS3Client().DeleteObjects(ctx, input)
 	if err != nil {
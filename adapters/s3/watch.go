@@ -0,0 +1,378 @@
+package s3
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gostratum/core/logx"
+	"github.com/gostratum/storagex"
+)
+
+// NotificationMessage is one message of a NotificationSource. Its body is
+// an S3 event notification (the JSON document with a "Records" array sent
+// by S3 and MinIO), optionally wrapped in an SNS envelope.
+type NotificationMessage struct {
+	// ID identifies the message to its source (e.g., an SQS receipt handle)
+	ID string
+
+	// Body is the notification document
+	Body []byte
+}
+
+// NotificationSource delivers bucket event notifications. A message that is
+// not acknowledged is delivered again by the source, which makes a
+// NotificationWatcher at-least-once.
+type NotificationSource interface {
+	// Receive waits for the next messages
+	Receive(ctx context.Context) ([]NotificationMessage, error)
+
+	// Ack confirms that a message was handled, so it is not redelivered
+	Ack(ctx context.Context, msg NotificationMessage) error
+}
+
+// NotificationWatcher implements storagex.Watcher for S3 by consuming the
+// bucket's event notifications from a NotificationSource (an SQS queue or a
+// MinIO webhook). The bucket must be configured to publish ObjectCreated
+// and ObjectRemoved events to the source.
+//
+// Delivery is tracked by the source: a message is acknowledged once all of
+// its events were handled, so WatchOptions.Checkpoint is not used and
+// events carry no Cursor.
+type NotificationWatcher struct {
+	storage *S3Storage
+	source  NotificationSource
+	logger  logx.Logger
+}
+
+// Watcher returns a watcher for the storage's bucket fed by source
+func (s *S3Storage) Watcher(source NotificationSource) *NotificationWatcher {
+	return &NotificationWatcher{storage: s, source: source, logger: s.logger}
+}
+
+// Watch receives notifications until ctx is done. Transient source errors
+// (throttling, timeouts) are retried after opts.RetryInterval; other errors
+// end the watch.
+func (w *NotificationWatcher) Watch(ctx context.Context, opts storagex.WatchOptions, handler storagex.EventHandler) error {
+	retry := opts.RetryInterval
+	if retry <= 0 {
+		retry = time.Second
+	}
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		messages, err := w.source.Receive(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if !errors.Is(err, storagex.ErrTimeout) {
+				return &storagex.StorageError{Op: "watch", Err: err}
+			}
+			w.logger.Warn("Receiving bucket notifications failed, retrying", storagex.ArgsToFields("error", err)...)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(retry):
+			}
+			continue
+		}
+
+		for _, msg := range messages {
+			if err := w.handle(ctx, opts, handler, msg); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// handle delivers the events of one message and acknowledges it
+func (w *NotificationWatcher) handle(ctx context.Context, opts storagex.WatchOptions, handler storagex.EventHandler, msg NotificationMessage) error {
+	records, err := parseNotification(msg.Body)
+	if err != nil {
+		// Redelivering a malformed message cannot help
+		w.logger.Warn("Dropping malformed bucket notification", storagex.ArgsToFields(
+			"message_id", msg.ID,
+			"error", err,
+		)...)
+		records = nil
+	}
+
+	for _, record := range records {
+		event, ok := w.event(record)
+		if !ok || !opts.Accepts(event) {
+			continue
+		}
+		if event.Type == storagex.ObjectCreated {
+			event.Stat = w.stat(ctx, event.Stat)
+		}
+		if err := storagex.Deliver(ctx, opts, handler, event); err != nil {
+			return err
+		}
+	}
+
+	if err := w.source.Ack(ctx, msg); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		// The message comes back and its events are delivered again
+		w.logger.Warn("Acknowledging bucket notification failed", storagex.ArgsToFields(
+			"message_id", msg.ID,
+			"error", err,
+		)...)
+	}
+	return nil
+}
+
+// event converts a notification record of the storage's bucket. Records of
+// other buckets, of keys outside the key builder's prefix and of other event
+// kinds (restores, tagging, replication) are skipped.
+func (w *NotificationWatcher) event(record notificationRecord) (storagex.Event, bool) {
+	var eventType storagex.EventType
+	name := strings.TrimPrefix(record.EventName, "s3:")
+	switch {
+	case strings.HasPrefix(name, "ObjectCreated:"):
+		eventType = storagex.ObjectCreated
+	case strings.HasPrefix(name, "ObjectRemoved:"), strings.HasPrefix(name, "LifecycleExpiration:"):
+		eventType = storagex.ObjectRemoved
+	default:
+		return storagex.Event{}, false
+	}
+
+	if record.S3.Bucket.Name != w.storage.client.GetConfig().Bucket {
+		return storagex.Event{}, false
+	}
+	storageKey, err := url.QueryUnescape(record.S3.Object.Key)
+	if err != nil {
+		return storagex.Event{}, false
+	}
+	key := w.storage.keyBuilder.StripKey(storageKey)
+	if w.storage.keyBuilder.BuildKey(key, nil) != storageKey {
+		return storagex.Event{}, false
+	}
+
+	eventTime, _ := time.Parse(time.RFC3339Nano, record.EventTime)
+	stat := storagex.Stat{Key: key}
+	if eventType == storagex.ObjectCreated {
+		stat.Size = record.S3.Object.Size
+		if etag := strings.Trim(record.S3.Object.ETag, `"`); etag != "" {
+			// Quoted like the ETags returned by Put and Head
+			stat.ETag = `"` + etag + `"`
+		}
+		stat.ContentType = record.S3.Object.ContentType
+		stat.LastModified = eventTime
+		if len(record.S3.Object.UserMetadata) > 0 {
+			stat.Metadata = record.S3.Object.UserMetadata
+		}
+	}
+
+	// The sequencer orders events of one key; together they identify the
+	// event across redeliveries
+	id := storageKey + "@" + record.S3.Object.Sequencer
+	if record.S3.Object.Sequencer == "" {
+		id = storageKey + "@" + record.EventTime
+	}
+
+	return storagex.Event{
+		ID:   id,
+		Type: eventType,
+		Key:  key,
+		Stat: stat,
+		Time: eventTime,
+	}, true
+}
+
+// stat completes the Stat of a created object with Head. The notification
+// Stat is kept if the object was deleted or replaced since.
+func (w *NotificationWatcher) stat(ctx context.Context, notified storagex.Stat) storagex.Stat {
+	current, err := w.storage.Head(ctx, notified.Key)
+	if err != nil || (notified.ETag != "" && current.ETag != notified.ETag) {
+		return notified
+	}
+	return current
+}
+
+// notificationRecord is one record of an S3 event notification
+type notificationRecord struct {
+	EventName string `json:"eventName"`
+	EventTime string `json:"eventTime"`
+	S3        struct {
+		Bucket struct {
+			Name string `json:"name"`
+		} `json:"bucket"`
+		Object struct {
+			Key          string            `json:"key"`
+			Size         int64             `json:"size"`
+			ETag         string            `json:"eTag"`
+			ContentType  string            `json:"contentType"`
+			UserMetadata map[string]string `json:"userMetadata"`
+			Sequencer    string            `json:"sequencer"`
+		} `json:"object"`
+	} `json:"s3"`
+}
+
+// parseNotification decodes the records of a notification. Test events sent
+// when a notification is configured have no records.
+func parseNotification(body []byte) ([]notificationRecord, error) {
+	var doc struct {
+		Records []notificationRecord `json:"Records"`
+
+		// Set when the notification was published through SNS
+		Type    string `json:"Type"`
+		Message string `json:"Message"`
+	}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return nil, fmt.Errorf("decode bucket notification: %w", err)
+	}
+	if doc.Type == "Notification" && doc.Message != "" {
+		return parseNotification([]byte(doc.Message))
+	}
+	return doc.Records, nil
+}
+
+// maxWebhookBody bounds the size of one webhook request
+const maxWebhookBody = 10 << 20
+
+// WebhookSource is a NotificationSource fed by HTTP POSTs of bucket
+// notifications, such as a MinIO webhook target. Mount it as an
+// http.Handler at the endpoint the target posts to.
+//
+// A request is answered once all of its events were handled: 200 on
+// success, 503 if they were not handled within Timeout. The sender then
+// retries (MinIO keeps undelivered events in its queue_dir), which makes
+// delivery at-least-once.
+type WebhookSource struct {
+	authToken string
+
+	// Timeout bounds how long a request waits for its events to be
+	// handled (default: 30s)
+	Timeout time.Duration
+
+	messages chan webhookDelivery
+
+	mu      sync.Mutex
+	pending map[string]chan struct{}
+}
+
+// webhookDelivery is a received request waiting to be handled
+type webhookDelivery struct {
+	msg  NotificationMessage
+	done chan struct{}
+}
+
+// NewWebhookSource creates a webhook source. When authToken is not empty,
+// requests must carry it in the Authorization header, as configured with
+// the auth_token of a MinIO webhook target.
+func NewWebhookSource(authToken string) *WebhookSource {
+	return &WebhookSource{
+		authToken: authToken,
+		Timeout:   30 * time.Second,
+		messages:  make(chan webhookDelivery),
+		pending:   make(map[string]chan struct{}),
+	}
+}
+
+// ServeHTTP accepts one notification
+func (h *WebhookSource) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodHead:
+		// MinIO probes the endpoint before sending events
+		w.WriteHeader(http.StatusOK)
+		return
+	case http.MethodPost:
+	default:
+		w.Header().Set("Allow", "HEAD, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if h.authToken != "" {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(h.authToken)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBody))
+	if err != nil {
+		http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	var id [8]byte
+	rand.Read(id[:])
+	delivery := webhookDelivery{
+		msg:  NotificationMessage{ID: hex.EncodeToString(id[:]), Body: body},
+		done: make(chan struct{}),
+	}
+	h.mu.Lock()
+	h.pending[delivery.msg.ID] = delivery.done
+	h.mu.Unlock()
+	defer func() {
+		h.mu.Lock()
+		delete(h.pending, delivery.msg.ID)
+		h.mu.Unlock()
+	}()
+
+	timeout := h.Timeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case h.messages <- delivery:
+	case <-timer.C:
+		http.Error(w, "no watcher is receiving notifications", http.StatusServiceUnavailable)
+		return
+	case <-r.Context().Done():
+		return
+	}
+
+	select {
+	case <-delivery.done:
+		w.WriteHeader(http.StatusOK)
+	case <-timer.C:
+		http.Error(w, "notification not handled in time", http.StatusServiceUnavailable)
+	case <-r.Context().Done():
+	}
+}
+
+// Receive waits for the next request
+func (h *WebhookSource) Receive(ctx context.Context) ([]NotificationMessage, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case delivery := <-h.messages:
+		return []NotificationMessage{delivery.msg}, nil
+	}
+}
+
+// Ack answers the request of a message with 200. Messages whose request
+// already timed out are ignored; the sender retries them.
+func (h *WebhookSource) Ack(ctx context.Context, msg NotificationMessage) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if done, ok := h.pending[msg.ID]; ok {
+		close(done)
+		delete(h.pending, msg.ID)
+	}
+	return nil
+}
+
+var _ storagex.Watcher = (*NotificationWatcher)(nil)
+var _ NotificationSource = (*WebhookSource)(nil)
+var _ http.Handler = (*WebhookSource)(nil)
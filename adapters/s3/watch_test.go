@@ -0,0 +1,318 @@
+package s3
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/johannesboyne/gofakes3"
+	"github.com/johannesboyne/gofakes3/backend/s3mem"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/gostratum/storagex"
+)
+
+// newWatchStorage returns a storage for bucket "events" on a fake S3 server
+func newWatchStorage(t *testing.T, opts ...storagex.Option) *S3Storage {
+	t.Helper()
+	backend := s3mem.New()
+	require.NoError(t, backend.CreateBucket("events"))
+	ts := httptest.NewServer(gofakes3.New(backend).Server())
+	t.Cleanup(ts.Close)
+
+	storage, err := NewS3Storage(context.Background(), &storagex.Config{
+		Provider:     "s3",
+		Bucket:       "events",
+		Region:       "us-east-1",
+		Endpoint:     ts.URL,
+		AccessKey:    testAccessKey,
+		SecretKey:    testSecretKey,
+		UsePathStyle: true,
+		DisableSSL:   true,
+	}, opts...)
+	require.NoError(t, err)
+	return storage
+}
+
+// notification builds a MinIO-style notification with one record
+func notification(eventName, bucket, key, etag, sequencer string) string {
+	return fmt.Sprintf(`{"EventName":%q,"Key":%q,"Records":[{"eventVersion":"2.0","eventSource":"minio:s3",`+
+		`"eventTime":"2024-05-01T10:00:00.000Z","eventName":%q,"s3":{"bucket":{"name":%q},`+
+		`"object":{"key":%q,"size":5,"eTag":%q,"sequencer":%q}}}]}`,
+		eventName, bucket+"/"+key, eventName, bucket, key, etag, sequencer)
+}
+
+// runWatch runs Watch in the background until the test ends
+func runWatch(t *testing.T, watcher storagex.Watcher, opts storagex.WatchOptions, handler storagex.EventHandler) <-chan error {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- watcher.Watch(ctx, opts, handler) }()
+	t.Cleanup(cancel)
+	return done
+}
+
+func TestParseNotification(t *testing.T) {
+	records, err := parseNotification([]byte(notification("s3:ObjectCreated:Put", "events", "a.txt", "abc", "1")))
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, "s3:ObjectCreated:Put", records[0].EventName)
+	assert.Equal(t, "a.txt", records[0].S3.Object.Key)
+	assert.Equal(t, int64(5), records[0].S3.Object.Size)
+
+	// Published through SNS
+	envelope, err := json.Marshal(map[string]string{
+		"Type":    "Notification",
+		"Message": notification("ObjectRemoved:Delete", "events", "b.txt", "", "2"),
+	})
+	require.NoError(t, err)
+	records, err = parseNotification(envelope)
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, "b.txt", records[0].S3.Object.Key)
+
+	// Test events have no records
+	records, err = parseNotification([]byte(`{"Service":"Amazon S3","Event":"s3:TestEvent","Bucket":"events"}`))
+	require.NoError(t, err)
+	assert.Empty(t, records)
+
+	_, err = parseNotification([]byte("not json"))
+	assert.Error(t, err)
+}
+
+func TestNotificationWatcher_Webhook(t *testing.T) {
+	ctx := context.Background()
+	storage := newWatchStorage(t)
+	stat, err := storage.PutBytes(ctx, "reports/q1 final.csv", []byte("a,b,c"), &storagex.PutOptions{
+		ContentType: "text/csv",
+		Metadata:    map[string]string{"owner": "finance"},
+	})
+	require.NoError(t, err)
+
+	source := NewWebhookSource("secret")
+	server := httptest.NewServer(source)
+	defer server.Close()
+
+	var mu sync.Mutex
+	var events []storagex.Event
+	failed := false
+	runWatch(t, storage.Watcher(source), storagex.WatchOptions{RetryInterval: time.Millisecond}, func(ctx context.Context, event storagex.Event) error {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, event)
+		if !failed {
+			failed = true
+			return errors.New("handler failed")
+		}
+		return nil
+	})
+
+	post := func(token, body string) int {
+		req, err := http.NewRequest(http.MethodPost, server.URL, strings.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	resp, err := http.Head(server.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	assert.Equal(t, http.StatusUnauthorized, post("wrong", notification("s3:ObjectCreated:Put", "events", "a.txt", "", "1")))
+
+	// The request is answered after the handler succeeded on the retry
+	assert.Equal(t, http.StatusOK, post("secret", notification("s3:ObjectCreated:Put", "events", "reports/q1+final.csv", `"`+stat.ETag+`"`, "0A1")))
+	// Other buckets and event kinds are acknowledged without events
+	assert.Equal(t, http.StatusOK, post("secret", notification("s3:ObjectCreated:Put", "other", "x.txt", "", "0A2")))
+	assert.Equal(t, http.StatusOK, post("secret", notification("s3:ObjectAccessed:Get", "events", "x.txt", "", "0A3")))
+	assert.Equal(t, http.StatusOK, post("secret", notification("s3:ObjectRemoved:Delete", "events", "old.txt", "", "0A4")))
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, events, 3)
+	assert.Equal(t, events[0], events[1])
+
+	created := events[0]
+	assert.Equal(t, storagex.ObjectCreated, created.Type)
+	assert.Equal(t, "reports/q1 final.csv", created.Key)
+	assert.Equal(t, "reports/q1 final.csv@0A1", created.ID)
+	assert.Equal(t, time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC), created.Time)
+	// Completed with Head
+	assert.Equal(t, "text/csv", created.Stat.ContentType)
+	assert.Equal(t, "finance", created.Stat.Metadata["owner"])
+	assert.Equal(t, int64(5), created.Stat.Size)
+
+	removed := events[2]
+	assert.Equal(t, storagex.ObjectRemoved, removed.Type)
+	assert.Equal(t, storagex.Stat{Key: "old.txt"}, removed.Stat)
+}
+
+func TestNotificationWatcher_BasePrefix(t *testing.T) {
+	ctx := context.Background()
+	storage := newWatchStorage(t, storagex.WithKeyBuilder(storagex.NewPrefixKeyBuilder("tenant-a")))
+	_, err := storage.PutBytes(ctx, "dir/sub/a.txt", []byte("alpha"), nil)
+	require.NoError(t, err)
+
+	// Listed keys round-trip to the keys they were written with
+	page, err := storage.List(ctx, storagex.ListOptions{Prefix: "dir/"})
+	require.NoError(t, err)
+	require.Len(t, page.Keys, 1)
+	assert.Equal(t, "dir/sub/a.txt", page.Keys[0].Key)
+
+	watcher := storage.Watcher(NewWebhookSource(""))
+	records, err := parseNotification([]byte(notification("s3:ObjectCreated:Put", "events", "tenant-a/dir/sub/a.txt", "", "1")))
+	require.NoError(t, err)
+	event, ok := watcher.event(records[0])
+	require.True(t, ok)
+	assert.Equal(t, "dir/sub/a.txt", event.Key)
+
+	// Keys outside the prefix are skipped
+	records, err = parseNotification([]byte(notification("s3:ObjectCreated:Put", "events", "tenant-b/dir/a.txt", "", "2")))
+	require.NoError(t, err)
+	_, ok = watcher.event(records[0])
+	assert.False(t, ok)
+}
+
+func TestWebhookSource_UnhandledRequestsAreRetried(t *testing.T) {
+	source := NewWebhookSource("")
+	source.Timeout = 20 * time.Millisecond
+	server := httptest.NewServer(source)
+	defer server.Close()
+
+	// Nobody is receiving, so the sender has to retry later
+	resp, err := http.Post(server.URL, "application/json", strings.NewReader(notification("s3:ObjectCreated:Put", "events", "a.txt", "", "1")))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+
+	resp, err = http.Get(server.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+}
+
+// fakeSQS serves ReceiveMessage and DeleteMessage of the SQS JSON protocol
+type fakeSQS struct {
+	mu       sync.Mutex
+	messages []map[string]string
+	deleted  []string
+	authz    []string
+}
+
+func (f *fakeSQS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.authz = append(f.authz, r.Header.Get("Authorization"))
+
+	var input map[string]any
+	json.NewDecoder(r.Body).Decode(&input)
+	if input["QueueUrl"] != "http://"+r.Host+"/000000000000/events" {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"__type":"com.amazonaws.sqs#QueueDoesNotExist","message":"The specified queue does not exist."}`)
+		return
+	}
+
+	switch r.Header.Get("X-Amz-Target") {
+	case "AmazonSQS.ReceiveMessage":
+		json.NewEncoder(w).Encode(map[string]any{"Messages": f.messages})
+		f.messages = nil
+	case "AmazonSQS.DeleteMessage":
+		f.deleted = append(f.deleted, input["ReceiptHandle"].(string))
+		io.WriteString(w, "{}")
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"__type":"com.amazonaws.sqs#InvalidAction"}`)
+	}
+}
+
+func TestSQSSource(t *testing.T) {
+	fake := &fakeSQS{messages: []map[string]string{
+		{"MessageId": "m1", "ReceiptHandle": "r1", "Body": notification("ObjectCreated:Put", "events", "a.txt", "", "1")},
+		{"MessageId": "m2", "ReceiptHandle": "r2", "Body": notification("ObjectRemoved:Delete", "events", "b.txt", "", "2")},
+	}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	awsConfig := aws.Config{
+		Region:      "eu-west-1",
+		Credentials: credentials.NewStaticCredentialsProvider(testAccessKey, testSecretKey, ""),
+	}
+	source, err := NewSQSSource(awsConfig, server.URL+"/000000000000/events")
+	require.NoError(t, err)
+	source.WaitTime = 0
+
+	received := make(chan storagex.Event, 10)
+	runWatch(t, newWatchStorage(t).Watcher(source), storagex.WatchOptions{}, func(ctx context.Context, event storagex.Event) error {
+		received <- event
+		return nil
+	})
+
+	var events []storagex.Event
+	for len(events) < 2 {
+		select {
+		case event := <-received:
+			events = append(events, event)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for events")
+		}
+	}
+	assert.Equal(t, storagex.ObjectCreated, events[0].Type)
+	assert.Equal(t, "a.txt", events[0].Key)
+	// The object does not exist, so the notification's Stat is kept
+	assert.Equal(t, int64(5), events[0].Stat.Size)
+	assert.Equal(t, storagex.ObjectRemoved, events[1].Type)
+
+	require.Eventually(t, func() bool {
+		fake.mu.Lock()
+		defer fake.mu.Unlock()
+		return len(fake.deleted) == 2
+	}, time.Second, 5*time.Millisecond)
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	assert.Equal(t, []string{"r1", "r2"}, fake.deleted)
+	assert.True(t, strings.HasPrefix(fake.authz[0], "AWS4-HMAC-SHA256 Credential="+testAccessKey+"/"))
+	assert.Contains(t, fake.authz[0], "/eu-west-1/sqs/aws4_request")
+}
+
+func TestSQSSource_Errors(t *testing.T) {
+	server := httptest.NewServer(&fakeSQS{})
+	defer server.Close()
+
+	_, err := NewSQSSource(aws.Config{}, "not a url")
+	assert.ErrorIs(t, err, storagex.ErrInvalidConfig)
+
+	source, err := NewSQSSource(aws.Config{}, server.URL+"/000000000000/missing")
+	require.NoError(t, err)
+	_, err = source.Receive(context.Background())
+	assert.ErrorIs(t, err, storagex.ErrNotFound)
+
+	// A missing queue ends the watch
+	done := runWatch(t, newWatchStorage(t).Watcher(source), storagex.WatchOptions{}, func(context.Context, storagex.Event) error {
+		return nil
+	})
+	select {
+	case err := <-done:
+		assert.ErrorIs(t, err, storagex.ErrNotFound)
+	case <-time.After(5 * time.Second):
+		t.Fatal("watch did not stop")
+	}
+
+	assert.ErrorIs(t, sqsError("ReceiveMessage", http.StatusBadRequest, []byte(`{"__type":"com.amazonaws.sqs#RequestThrottled"}`)), storagex.ErrThrottled)
+	assert.ErrorIs(t, sqsError("ReceiveMessage", http.StatusServiceUnavailable, nil), storagex.ErrTimeout)
+}
@@ -0,0 +1,609 @@
+package storagex
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/gostratum/core"
+)
+
+var (
+	// ErrCircuitOpen indicates the call was rejected because the circuit
+	// breaker for its operation class is open
+	ErrCircuitOpen = errors.New("storagex: circuit breaker open")
+
+	// ErrBulkheadFull indicates the call was rejected because too many
+	// operations of its class were already in flight
+	ErrBulkheadFull = errors.New("storagex: too many operations in flight")
+)
+
+// OpClass groups operations that share a circuit breaker and bulkhead
+type OpClass string
+
+const (
+	// OpClassRead covers Get and Head
+	OpClassRead OpClass = "read"
+
+	// OpClassWrite covers puts, deletes and multipart operations
+	OpClassWrite OpClass = "write"
+
+	// OpClassList covers List
+	OpClassList OpClass = "list"
+)
+
+// opClasses lists the classes in a stable order
+var opClasses = []OpClass{OpClassRead, OpClassWrite, OpClassList}
+
+// CircuitBreakerConfig configures the per-class circuit breakers
+type CircuitBreakerConfig struct {
+	// Enabled turns the circuit breakers on
+	Enabled bool `mapstructure:"enabled" yaml:"enabled" default:"false"`
+
+	// FailureThreshold is the number of consecutive failures that opens a
+	// breaker
+	FailureThreshold int `mapstructure:"failure_threshold" yaml:"failure_threshold" default:"5"`
+
+	// OpenTimeout is how long an open breaker rejects calls before letting
+	// probes through (half-open)
+	OpenTimeout time.Duration `mapstructure:"open_timeout" yaml:"open_timeout" default:"30s"`
+
+	// HalfOpenProbes is the number of concurrent probe calls allowed while
+	// half-open; that many consecutive successes close the breaker
+	HalfOpenProbes int `mapstructure:"half_open_probes" yaml:"half_open_probes" default:"1"`
+}
+
+// BulkheadConfig limits the number of in-flight operations per class
+type BulkheadConfig struct {
+	// MaxReads limits concurrent Get/Head calls, counting a Get until its
+	// body is closed (0: unlimited)
+	MaxReads int `mapstructure:"max_reads" yaml:"max_reads"`
+
+	// MaxWrites limits concurrent put, delete and multipart calls
+	// (0: unlimited)
+	MaxWrites int `mapstructure:"max_writes" yaml:"max_writes"`
+
+	// MaxLists limits concurrent List calls (0: unlimited)
+	MaxLists int `mapstructure:"max_lists" yaml:"max_lists"`
+
+	// MaxWait is how long a call waits for a free slot before failing with
+	// ErrBulkheadFull (0: fail immediately)
+	MaxWait time.Duration `mapstructure:"max_wait" yaml:"max_wait"`
+}
+
+// enabled reports whether any class is limited
+func (c BulkheadConfig) enabled() bool {
+	return c.MaxReads > 0 || c.MaxWrites > 0 || c.MaxLists > 0
+}
+
+func (c BulkheadConfig) limit(class OpClass) int {
+	switch class {
+	case OpClassRead:
+		return c.MaxReads
+	case OpClassWrite:
+		return c.MaxWrites
+	default:
+		return c.MaxLists
+	}
+}
+
+// BreakerState is the state of a circuit breaker
+type BreakerState int
+
+const (
+	// BreakerClosed lets every call through
+	BreakerClosed BreakerState = iota
+
+	// BreakerHalfOpen lets a limited number of probe calls through
+	BreakerHalfOpen
+
+	// BreakerOpen rejects every call with ErrCircuitOpen
+	BreakerOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerHalfOpen:
+		return "half-open"
+	case BreakerOpen:
+		return "open"
+	default:
+		return fmt.Sprintf("BreakerState(%d)", int(s))
+	}
+}
+
+// circuitBreaker is the state machine for one operation class
+type circuitBreaker struct {
+	cfg      CircuitBreakerConfig
+	clock    func() time.Time
+	onChange func(BreakerState)
+
+	mu        sync.Mutex
+	state     BreakerState
+	failures  int
+	successes int
+	probes    int
+	openedAt  time.Time
+
+	// generation changes with every state change, so calls admitted
+	// before it do not count towards the new state
+	generation uint64
+}
+
+// currentState moves an open breaker to half-open once OpenTimeout has
+// passed. Callers hold b.mu.
+func (b *circuitBreaker) currentState() BreakerState {
+	if b.state == BreakerOpen && b.clock().Sub(b.openedAt) >= b.cfg.OpenTimeout {
+		b.setState(BreakerHalfOpen)
+	}
+	return b.state
+}
+
+func (b *circuitBreaker) setState(state BreakerState) {
+	if b.state == state {
+		return
+	}
+	b.state = state
+	b.generation++
+	b.failures, b.successes, b.probes = 0, 0, 0
+	if state == BreakerOpen {
+		b.openedAt = b.clock()
+	}
+	if b.onChange != nil {
+		b.onChange(state)
+	}
+}
+
+// allow reserves a call and returns the generation it was admitted in, or
+// returns ErrCircuitOpen
+func (b *circuitBreaker) allow() (uint64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.currentState() {
+	case BreakerOpen:
+		return 0, ErrCircuitOpen
+	case BreakerHalfOpen:
+		if b.probes >= b.cfg.HalfOpenProbes {
+			return 0, ErrCircuitOpen
+		}
+		b.probes++
+	}
+	return b.generation, nil
+}
+
+// record reports the outcome of a call admitted by allow in generation.
+// Outcomes of calls admitted before the last state change are ignored: a
+// slow call admitted while closed is not a probe.
+func (b *circuitBreaker) record(generation uint64, failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if generation != b.generation {
+		return
+	}
+	switch b.state {
+	case BreakerClosed:
+		if !failed {
+			b.failures = 0
+			return
+		}
+		b.failures++
+		if b.failures >= b.cfg.FailureThreshold {
+			b.setState(BreakerOpen)
+		}
+
+	case BreakerHalfOpen:
+		if failed {
+			b.setState(BreakerOpen)
+			return
+		}
+		if b.probes > 0 {
+			b.probes--
+		}
+		b.successes++
+		if b.successes >= b.cfg.HalfOpenProbes {
+			b.setState(BreakerClosed)
+		}
+	}
+}
+
+// BreakerOptions configures a CircuitBreakerStorage
+type BreakerOptions struct {
+	// CircuitBreaker configures the breakers; when disabled only bulkheads
+	// apply
+	CircuitBreaker CircuitBreakerConfig
+
+	// Bulkhead limits in-flight operations per class
+	Bulkhead BulkheadConfig
+
+	// IsFailure decides which errors count against a breaker
+	// (default: IsRetryableError, so not-found or cancelled calls do not)
+	IsFailure func(error) bool
+
+	// Instrumenter optionally records breaker state and rejections
+	Instrumenter *Instrumenter
+
+	// Clock is an optional time source (useful for testing)
+	Clock func() time.Time
+}
+
+// CircuitBreakerStorage is a Storage decorator that fails fast while the
+// backend is unhealthy and bounds the number of in-flight operations.
+//
+// Each operation class (read, write, list) has its own breaker: after
+// FailureThreshold consecutive failures it opens and rejects calls with
+// ErrCircuitOpen for OpenTimeout, then lets HalfOpenProbes probe calls
+// through and closes again once they succeed. Presigning is local and is
+// neither limited nor counted.
+type CircuitBreakerStorage struct {
+	next      Storage
+	opts      BreakerOptions
+	breakers  map[OpClass]*circuitBreaker
+	bulkheads map[OpClass]chan struct{}
+}
+
+// NewCircuitBreakerStorage wraps next with circuit breakers and bulkheads
+func NewCircuitBreakerStorage(next Storage, opts BreakerOptions) *CircuitBreakerStorage {
+	if opts.IsFailure == nil {
+		opts.IsFailure = IsRetryableError
+	}
+	if opts.Clock == nil {
+		opts.Clock = time.Now
+	}
+	if opts.CircuitBreaker.FailureThreshold <= 0 {
+		opts.CircuitBreaker.FailureThreshold = 5
+	}
+	if opts.CircuitBreaker.OpenTimeout <= 0 {
+		opts.CircuitBreaker.OpenTimeout = 30 * time.Second
+	}
+	if opts.CircuitBreaker.HalfOpenProbes <= 0 {
+		opts.CircuitBreaker.HalfOpenProbes = 1
+	}
+
+	s := &CircuitBreakerStorage{
+		next:      next,
+		opts:      opts,
+		breakers:  make(map[OpClass]*circuitBreaker),
+		bulkheads: make(map[OpClass]chan struct{}),
+	}
+	for _, class := range opClasses {
+		if opts.CircuitBreaker.Enabled {
+			class := class
+			s.breakers[class] = &circuitBreaker{
+				cfg:   opts.CircuitBreaker,
+				clock: opts.Clock,
+				onChange: func(state BreakerState) {
+					if opts.Instrumenter != nil {
+						opts.Instrumenter.RecordBreakerState(string(class), int(state))
+					}
+				},
+			}
+			if opts.Instrumenter != nil {
+				opts.Instrumenter.RecordBreakerState(string(class), int(BreakerClosed))
+			}
+		}
+		if limit := opts.Bulkhead.limit(class); limit > 0 {
+			s.bulkheads[class] = make(chan struct{}, limit)
+		}
+	}
+	return s
+}
+
+// Unwrap returns the wrapped storage
+func (s *CircuitBreakerStorage) Unwrap() Storage {
+	return s.next
+}
+
+// ForwardsTo reports that conditional writes are guarded by the write
+// breaker and forwarded to the wrapped storage
+func (s *CircuitBreakerStorage) ForwardsTo(iface reflect.Type) (Storage, bool) {
+	return s.next, iface == conditionalWriterType
+}
+
+// State returns the state of the breaker for class (BreakerClosed when
+// breakers are disabled)
+func (s *CircuitBreakerStorage) State(class OpClass) BreakerState {
+	b, ok := s.breakers[class]
+	if !ok {
+		return BreakerClosed
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.currentState()
+}
+
+// InFlight returns the number of in-flight operations of class counted by
+// its bulkhead (0 when the class is unlimited)
+func (s *CircuitBreakerStorage) InFlight(class OpClass) int {
+	return len(s.bulkheads[class])
+}
+
+// acquire admits a call of class, returning a function that reports its
+// outcome and releases its bulkhead slot
+func (s *CircuitBreakerStorage) acquire(ctx context.Context, class OpClass, op, key string) (func(error), error) {
+	release := func() {}
+	if slots, ok := s.bulkheads[class]; ok {
+		if err := s.enterBulkhead(ctx, slots); err != nil {
+			if s.opts.Instrumenter != nil {
+				s.opts.Instrumenter.RecordResilienceRejection("bulkhead", string(class))
+			}
+			return nil, &StorageError{Op: op, Key: key, Err: err}
+		}
+		if s.opts.Instrumenter != nil {
+			s.opts.Instrumenter.RecordBulkheadInFlight(string(class), len(slots))
+		}
+		release = func() {
+			<-slots
+			if s.opts.Instrumenter != nil {
+				s.opts.Instrumenter.RecordBulkheadInFlight(string(class), len(slots))
+			}
+		}
+	}
+
+	breaker, ok := s.breakers[class]
+	if !ok {
+		return func(error) { release() }, nil
+	}
+	generation, err := breaker.allow()
+	if err != nil {
+		release()
+		if s.opts.Instrumenter != nil {
+			s.opts.Instrumenter.RecordResilienceRejection("circuit_breaker", string(class))
+		}
+		return nil, &StorageError{Op: op, Key: key, Err: fmt.Errorf("%w for %s operations", err, class)}
+	}
+	return func(err error) {
+		breaker.record(generation, err != nil && s.opts.IsFailure(err))
+		release()
+	}, nil
+}
+
+// enterBulkhead takes a slot, waiting up to MaxWait
+func (s *CircuitBreakerStorage) enterBulkhead(ctx context.Context, slots chan struct{}) error {
+	select {
+	case slots <- struct{}{}:
+		return nil
+	default:
+	}
+	if s.opts.Bulkhead.MaxWait <= 0 {
+		return ErrBulkheadFull
+	}
+
+	timer := time.NewTimer(s.opts.Bulkhead.MaxWait)
+	defer timer.Stop()
+	select {
+	case slots <- struct{}{}:
+		return nil
+	case <-timer.C:
+		return ErrBulkheadFull
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return ErrTimeout
+		}
+		return ErrAborted
+	}
+}
+
+// guard runs fn as a call of class
+func guard[T any](ctx context.Context, s *CircuitBreakerStorage, class OpClass, op, key string, fn func() (T, error)) (T, error) {
+	done, err := s.acquire(ctx, class, op, key)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	v, err := fn()
+	done(err)
+	return v, err
+}
+
+// Put stores an object from an io.Reader
+func (s *CircuitBreakerStorage) Put(ctx context.Context, key string, r io.Reader, opts *PutOptions) (Stat, error) {
+	return guard(ctx, s, OpClassWrite, "put", key, func() (Stat, error) {
+		return s.next.Put(ctx, key, r, opts)
+	})
+}
+
+// PutBytes stores an object from a byte slice
+func (s *CircuitBreakerStorage) PutBytes(ctx context.Context, key string, data []byte, opts *PutOptions) (Stat, error) {
+	return guard(ctx, s, OpClassWrite, "put", key, func() (Stat, error) {
+		return s.next.PutBytes(ctx, key, data, opts)
+	})
+}
+
+// PutFile stores an object from a local file path
+func (s *CircuitBreakerStorage) PutFile(ctx context.Context, key string, path string, opts *PutOptions) (Stat, error) {
+	return guard(ctx, s, OpClassWrite, "put_file", key, func() (Stat, error) {
+		return s.next.PutFile(ctx, key, path, opts)
+	})
+}
+
+// Get retrieves an object. The read bulkhead slot is held until the body
+// is closed.
+func (s *CircuitBreakerStorage) Get(ctx context.Context, key string) (ReaderAtCloser, Stat, error) {
+	done, err := s.acquire(ctx, OpClassRead, "get", key)
+	if err != nil {
+		return nil, Stat{}, err
+	}
+	reader, stat, err := s.next.Get(ctx, key)
+	if err != nil {
+		done(err)
+		return nil, stat, err
+	}
+	return &releaseOnClose{ReaderAtCloser: reader, release: func() { done(nil) }}, stat, nil
+}
+
+// releaseOnClose reports a Get as finished when its body is closed
+type releaseOnClose struct {
+	ReaderAtCloser
+	once    sync.Once
+	release func()
+}
+
+func (r *releaseOnClose) Close() error {
+	err := r.ReaderAtCloser.Close()
+	r.once.Do(r.release)
+	return err
+}
+
+// Head retrieves object metadata
+func (s *CircuitBreakerStorage) Head(ctx context.Context, key string) (Stat, error) {
+	return guard(ctx, s, OpClassRead, "head", key, func() (Stat, error) {
+		return s.next.Head(ctx, key)
+	})
+}
+
+// List retrieves objects with optional filtering and pagination
+func (s *CircuitBreakerStorage) List(ctx context.Context, opts ListOptions) (ListPage, error) {
+	return guard(ctx, s, OpClassList, "list", "", func() (ListPage, error) {
+		return s.next.List(ctx, opts)
+	})
+}
+
+// Delete removes a single object
+func (s *CircuitBreakerStorage) Delete(ctx context.Context, key string) error {
+	_, err := guard(ctx, s, OpClassWrite, "delete", key, func() (struct{}, error) {
+		return struct{}{}, s.next.Delete(ctx, key)
+	})
+	return err
+}
+
+// DeleteBatch removes multiple objects
+func (s *CircuitBreakerStorage) DeleteBatch(ctx context.Context, keys []string) ([]string, error) {
+	failed, err := guard(ctx, s, OpClassWrite, "delete_batch", "", func() ([]string, error) {
+		return s.next.DeleteBatch(ctx, keys)
+	})
+	if err != nil && failed == nil {
+		failed = keys
+	}
+	return failed, err
+}
+
+// MultipartUpload uploads a large object using multipart upload
+func (s *CircuitBreakerStorage) MultipartUpload(ctx context.Context, key string, src io.Reader, cfg *MultipartConfig, putOpts *PutOptions) (Stat, error) {
+	return guard(ctx, s, OpClassWrite, "multipart_upload", key, func() (Stat, error) {
+		return s.next.MultipartUpload(ctx, key, src, cfg, putOpts)
+	})
+}
+
+// CreateMultipart initiates a multipart upload session
+func (s *CircuitBreakerStorage) CreateMultipart(ctx context.Context, key string, putOpts *PutOptions) (string, error) {
+	return guard(ctx, s, OpClassWrite, "create_multipart", key, func() (string, error) {
+		return s.next.CreateMultipart(ctx, key, putOpts)
+	})
+}
+
+// UploadPart uploads a single part in a multipart upload
+func (s *CircuitBreakerStorage) UploadPart(ctx context.Context, key, uploadID string, partNumber int32, part io.Reader, size int64) (string, error) {
+	return guard(ctx, s, OpClassWrite, "upload_part", key, func() (string, error) {
+		return s.next.UploadPart(ctx, key, uploadID, partNumber, part, size)
+	})
+}
+
+// CompleteMultipart finalizes a multipart upload
+func (s *CircuitBreakerStorage) CompleteMultipart(ctx context.Context, key, uploadID string, etags []string) (Stat, error) {
+	return guard(ctx, s, OpClassWrite, "complete_multipart", key, func() (Stat, error) {
+		return s.next.CompleteMultipart(ctx, key, uploadID, etags)
+	})
+}
+
+// AbortMultipart cancels a multipart upload
+func (s *CircuitBreakerStorage) AbortMultipart(ctx context.Context, key, uploadID string) error {
+	_, err := guard(ctx, s, OpClassWrite, "abort_multipart", key, func() (struct{}, error) {
+		return struct{}{}, s.next.AbortMultipart(ctx, key, uploadID)
+	})
+	return err
+}
+
+// PutIfAbsent stores an object if the key does not exist. It is a write
+// call and fails with ErrInvalidConfig if the wrapped storage does not
+// implement ConditionalWriter.
+func (s *CircuitBreakerStorage) PutIfAbsent(ctx context.Context, key string, r io.Reader, opts *PutOptions) (Stat, error) {
+	writer, err := conditionalWriterOf(s.next, "put_if_absent", key)
+	if err != nil {
+		return Stat{}, err
+	}
+	return guard(ctx, s, OpClassWrite, "put_if_absent", key, func() (Stat, error) {
+		return writer.PutIfAbsent(ctx, key, r, opts)
+	})
+}
+
+// PutIfMatch replaces an object if its ETag is etag. See PutIfAbsent.
+func (s *CircuitBreakerStorage) PutIfMatch(ctx context.Context, key string, r io.Reader, etag string, opts *PutOptions) (Stat, error) {
+	writer, err := conditionalWriterOf(s.next, "put_if_match", key)
+	if err != nil {
+		return Stat{}, err
+	}
+	return guard(ctx, s, OpClassWrite, "put_if_match", key, func() (Stat, error) {
+		return writer.PutIfMatch(ctx, key, r, etag, opts)
+	})
+}
+
+// DeleteIfMatch removes an object if its ETag is etag. It is a write call.
+func (s *CircuitBreakerStorage) DeleteIfMatch(ctx context.Context, key, etag string) error {
+	writer, err := conditionalWriterOf(s.next, "delete_if_match", key)
+	if err != nil {
+		return err
+	}
+	_, err = guard(ctx, s, OpClassWrite, "delete_if_match", key, func() (struct{}, error) {
+		return struct{}{}, writer.DeleteIfMatch(ctx, key, etag)
+	})
+	return err
+}
+
+// PresignGet generates a presigned download URL
+func (s *CircuitBreakerStorage) PresignGet(ctx context.Context, key string, opts *PresignOptions) (string, error) {
+	return s.next.PresignGet(ctx, key, opts)
+}
+
+// PresignPut generates a presigned upload URL
+func (s *CircuitBreakerStorage) PresignPut(ctx context.Context, key string, opts *PresignOptions) (string, error) {
+	return s.next.PresignPut(ctx, key, opts)
+}
+
+var (
+	_ Storage           = (*CircuitBreakerStorage)(nil)
+	_ ConditionalWriter = (*CircuitBreakerStorage)(nil)
+)
+
+// breakerHealthCheck reports not ready while any circuit breaker is open
+type breakerHealthCheck struct {
+	name    string
+	storage Storage
+}
+
+// NewBreakerHealthCheck returns a readiness check that fails while any
+// circuit breaker of storage (or of a storage it decorates) is open. It
+// always passes when storage has no circuit breaker.
+func NewBreakerHealthCheck(storage Storage) core.Check {
+	return &breakerHealthCheck{name: "storagex.circuit_breaker", storage: storage}
+}
+
+// NewInstanceBreakerHealthCheck is NewBreakerHealthCheck for a named storage
+// instance; the check is named "storagex.circuit_breaker.<instance>"
+func NewInstanceBreakerHealthCheck(instance string, storage Storage) core.Check {
+	return &breakerHealthCheck{name: "storagex.circuit_breaker." + instance, storage: storage}
+}
+
+func (c *breakerHealthCheck) Name() string { return c.name }
+
+func (c *breakerHealthCheck) Kind() core.Kind { return core.Readiness }
+
+func (c *breakerHealthCheck) Check(ctx context.Context) error {
+	breakers, _ := Capability[*CircuitBreakerStorage](c.storage)
+	if breakers == nil {
+		return nil
+	}
+	for _, class := range opClasses {
+		if breakers.State(class) == BreakerOpen {
+			return fmt.Errorf("circuit breaker open for %s operations", class)
+		}
+	}
+	return nil
+}
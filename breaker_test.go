@@ -0,0 +1,237 @@
+package storagex_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/gostratum/storagex"
+	"github.com/gostratum/storagex/faultstore"
+	"github.com/gostratum/storagex/internal/testutil"
+	"github.com/gostratum/storagex/lock"
+)
+
+// fakeClock is a manually advanced time source
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
+func newBreakerStorage(opts storagex.BreakerOptions) (*storagex.CircuitBreakerStorage, *faultstore.Store, *fakeClock) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	opts.Clock = clock.Now
+	faults := faultstore.New(testutil.NewMockStorage(), faultstore.Options{})
+	return storagex.NewCircuitBreakerStorage(faults, opts), faults, clock
+}
+
+func TestCircuitBreaker_OpensAndRecovers(t *testing.T) {
+	ctx := context.Background()
+	storage, faults, clock := newBreakerStorage(storagex.BreakerOptions{
+		CircuitBreaker: storagex.CircuitBreakerConfig{Enabled: true, FailureThreshold: 3, OpenTimeout: time.Minute},
+	})
+	_, err := storage.PutBytes(ctx, "a.txt", []byte("alpha"), nil)
+	require.NoError(t, err)
+
+	faults.AddRule(faultstore.Rule{Name: "down", Ops: []faultstore.Op{faultstore.OpHead}, Err: faultstore.ErrThrottled})
+	for i := 0; i < 3; i++ {
+		_, err = storage.Head(ctx, "a.txt")
+		assert.True(t, errors.Is(err, storagex.ErrTimeout))
+	}
+	assert.Equal(t, storagex.BreakerOpen, storage.State(storagex.OpClassRead))
+
+	// Open: calls fail fast without reaching the backend
+	_, err = storage.Head(ctx, "a.txt")
+	assert.True(t, errors.Is(err, storagex.ErrCircuitOpen))
+	assert.False(t, storagex.IsRetryableError(err))
+	assert.Equal(t, 3, faults.Fired("down"))
+
+	// Other classes are unaffected
+	_, err = storage.List(ctx, storagex.ListOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, storagex.BreakerClosed, storage.State(storagex.OpClassList))
+
+	// Half-open: a failed probe reopens the breaker
+	clock.Advance(time.Minute)
+	assert.Equal(t, storagex.BreakerHalfOpen, storage.State(storagex.OpClassRead))
+	_, err = storage.Head(ctx, "a.txt")
+	assert.True(t, errors.Is(err, storagex.ErrTimeout))
+	assert.Equal(t, storagex.BreakerOpen, storage.State(storagex.OpClassRead))
+
+	// A successful probe closes it
+	faults.ClearRules()
+	clock.Advance(time.Minute)
+	_, err = storage.Head(ctx, "a.txt")
+	require.NoError(t, err)
+	assert.Equal(t, storagex.BreakerClosed, storage.State(storagex.OpClassRead))
+}
+
+func TestCircuitBreaker_IgnoresCallsAdmittedBeforeHalfOpen(t *testing.T) {
+	ctx := context.Background()
+	storage, faults, clock := newBreakerStorage(storagex.BreakerOptions{
+		CircuitBreaker: storagex.CircuitBreakerConfig{Enabled: true, FailureThreshold: 1, OpenTimeout: time.Minute},
+	})
+	_, err := storage.PutBytes(ctx, "a.txt", []byte("alpha"), nil)
+	require.NoError(t, err)
+
+	// A read admitted while closed is still running when the breaker opens
+	reader, _, err := storage.Get(ctx, "a.txt")
+	require.NoError(t, err)
+	faults.AddRule(faultstore.Rule{Name: "down", Ops: []faultstore.Op{faultstore.OpHead}, Err: faultstore.ErrThrottled, Count: 1})
+	_, err = storage.Head(ctx, "a.txt")
+	require.Error(t, err)
+	assert.Equal(t, storagex.BreakerOpen, storage.State(storagex.OpClassRead))
+
+	// It finishes once half-open, but is not counted as a probe
+	clock.Advance(time.Minute)
+	assert.Equal(t, storagex.BreakerHalfOpen, storage.State(storagex.OpClassRead))
+	require.NoError(t, reader.Close())
+	assert.Equal(t, storagex.BreakerHalfOpen, storage.State(storagex.OpClassRead))
+
+	// A real probe still closes it
+	_, err = storage.Head(ctx, "a.txt")
+	require.NoError(t, err)
+	assert.Equal(t, storagex.BreakerClosed, storage.State(storagex.OpClassRead))
+}
+
+func TestCircuitBreaker_PermanentErrorsDoNotTrip(t *testing.T) {
+	ctx := context.Background()
+	storage, _, _ := newBreakerStorage(storagex.BreakerOptions{
+		CircuitBreaker: storagex.CircuitBreakerConfig{Enabled: true, FailureThreshold: 1},
+	})
+
+	for i := 0; i < 3; i++ {
+		_, err := storage.Head(ctx, "missing.txt")
+		assert.True(t, storagex.IsNotFound(err))
+	}
+	assert.Equal(t, storagex.BreakerClosed, storage.State(storagex.OpClassRead))
+}
+
+func TestBulkhead_LimitsInFlightReads(t *testing.T) {
+	ctx := context.Background()
+	storage, _, _ := newBreakerStorage(storagex.BreakerOptions{
+		Bulkhead: storagex.BulkheadConfig{MaxReads: 1},
+	})
+	_, err := storage.PutBytes(ctx, "a.txt", []byte("alpha"), nil)
+	require.NoError(t, err)
+
+	// An open body holds the only read slot
+	reader, _, err := storage.Get(ctx, "a.txt")
+	require.NoError(t, err)
+	assert.Equal(t, 1, storage.InFlight(storagex.OpClassRead))
+
+	_, err = storage.Head(ctx, "a.txt")
+	assert.True(t, errors.Is(err, storagex.ErrBulkheadFull))
+
+	// Writes have no limit
+	_, err = storage.PutBytes(ctx, "b.txt", []byte("bravo"), nil)
+	require.NoError(t, err)
+
+	require.NoError(t, reader.Close())
+	assert.Equal(t, 0, storage.InFlight(storagex.OpClassRead))
+	_, err = storage.Head(ctx, "a.txt")
+	require.NoError(t, err)
+}
+
+func TestBulkhead_WaitsForSlot(t *testing.T) {
+	ctx := context.Background()
+	storage, _, _ := newBreakerStorage(storagex.BreakerOptions{
+		Bulkhead: storagex.BulkheadConfig{MaxReads: 1, MaxWait: time.Second},
+	})
+	_, err := storage.PutBytes(ctx, "a.txt", []byte("alpha"), nil)
+	require.NoError(t, err)
+
+	reader, _, err := storage.Get(ctx, "a.txt")
+	require.NoError(t, err)
+	time.AfterFunc(10*time.Millisecond, func() { reader.Close() })
+
+	_, err = storage.Head(ctx, "a.txt")
+	require.NoError(t, err)
+}
+
+func TestBreakerHealthCheck(t *testing.T) {
+	ctx := context.Background()
+	breakers, faults, _ := newBreakerStorage(storagex.BreakerOptions{
+		CircuitBreaker: storagex.CircuitBreakerConfig{Enabled: true, FailureThreshold: 1},
+	})
+
+	// The check finds the breaker through other decorators
+	storage := storagex.NewRetryStorage(breakers, storagex.RetryPolicy{})
+	check := storagex.NewBreakerHealthCheck(storage)
+	require.NoError(t, check.Check(ctx))
+
+	faults.AddRule(faultstore.Rule{Ops: []faultstore.Op{faultstore.OpList}, Err: storagex.ErrTimeout})
+	_, err := storage.List(ctx, storagex.ListOptions{})
+	require.Error(t, err)
+
+	err = check.Check(ctx)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "list")
+
+	// Storage without breakers is always ready
+	require.NoError(t, storagex.NewBreakerHealthCheck(testutil.NewMockStorage()).Check(ctx))
+}
+
+func TestDecorateStorage(t *testing.T) {
+	base := testutil.NewMockStorage()
+
+	cfg := storagex.DefaultConfig()
+	assert.Same(t, base, storagex.DecorateStorage(base, cfg, storagex.DecorateOptions{}))
+
+	cfg.RetryMode = storagex.RetryModeStorageX
+	cfg.CircuitBreaker.Enabled = true
+	decorated := storagex.DecorateStorage(base, cfg, storagex.DecorateOptions{})
+
+	retry, ok := decorated.(*storagex.RetryStorage)
+	require.True(t, ok)
+	breakers, ok := retry.Unwrap().(*storagex.CircuitBreakerStorage)
+	require.True(t, ok)
+	assert.Same(t, base, breakers.Unwrap())
+}
+
+func TestDecorateStorage_ConditionalWritesGoThroughDecorators(t *testing.T) {
+	ctx := context.Background()
+	faults := faultstore.New(testutil.NewMockStorage(), faultstore.Options{})
+
+	cfg := storagex.DefaultConfig()
+	cfg.RetryMode = storagex.RetryModeStorageX
+	cfg.MaxRetries = 1
+	cfg.BackoffInitial = time.Millisecond
+	cfg.CircuitBreaker = storagex.CircuitBreakerConfig{Enabled: true, FailureThreshold: 1, OpenTimeout: time.Hour}
+	storage := storagex.DecorateStorage(faults, cfg, storagex.DecorateOptions{})
+
+	locker, err := lock.New(storage, lock.Options{TTL: time.Minute})
+	require.NoError(t, err)
+	writer, ok := storagex.Capability[storagex.ConditionalWriter](storage)
+	require.True(t, ok)
+	assert.Same(t, storage, writer)
+
+	// Trip the write breaker
+	faults.AddRule(faultstore.Rule{Name: "down", Ops: []faultstore.Op{faultstore.OpPut}, Err: faultstore.ErrThrottled})
+	_, err = storage.PutBytes(ctx, "a.txt", []byte("alpha"), nil)
+	require.Error(t, err)
+	require.Equal(t, storagex.BreakerOpen, storage.(*storagex.RetryStorage).Unwrap().(*storagex.CircuitBreakerStorage).State(storagex.OpClassWrite))
+
+	// Lock writes are rejected by the open breaker instead of reaching the
+	// backend
+	_, err = locker.TryAcquire(ctx, "locks/job")
+	assert.ErrorIs(t, err, storagex.ErrCircuitOpen)
+	_, err = faults.Head(ctx, "locks/job")
+	assert.True(t, storagex.IsNotFound(err))
+}
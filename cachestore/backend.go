@@ -0,0 +1,156 @@
+package cachestore
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/gostratum/storagex"
+)
+
+// Entry is a cached object
+type Entry struct {
+	// Stat is the object metadata
+	Stat storagex.Stat
+
+	// Body is the object content; nil for entries cached by Head or for
+	// objects above the body size threshold
+	Body []byte
+
+	// HasBody distinguishes an empty object from a metadata-only entry
+	HasBody bool
+
+	// ValidatedAt is when the entry was last fetched or revalidated
+	ValidatedAt time.Time
+}
+
+// cost is the number of bytes an entry counts against a byte budget
+func (e *Entry) cost(key string) int64 {
+	return int64(len(key) + len(e.Body))
+}
+
+// Backend stores cache entries. Implementations must be safe for
+// concurrent use and may drop entries at any time (e.g., to stay within a
+// byte budget).
+type Backend interface {
+	// Get returns the entry for key
+	Get(key string) (*Entry, bool)
+
+	// Set stores the entry for key, replacing any previous one
+	Set(key string, entry *Entry)
+
+	// Delete removes the entry for key
+	Delete(key string)
+}
+
+// lru tracks keys in least-recently-used order within a byte budget
+type lru struct {
+	maxBytes int64
+	size     int64
+	order    *list.List
+	items    map[string]*list.Element
+}
+
+type lruItem struct {
+	key  string
+	cost int64
+}
+
+func newLRU(maxBytes int64) *lru {
+	return &lru{maxBytes: maxBytes, order: list.New(), items: make(map[string]*list.Element)}
+}
+
+// touch marks key as most recently used
+func (l *lru) touch(key string) {
+	if el, ok := l.items[key]; ok {
+		l.order.MoveToFront(el)
+	}
+}
+
+// add records key with its cost and returns the keys evicted to make room
+func (l *lru) add(key string, cost int64) []string {
+	l.remove(key)
+	l.items[key] = l.order.PushFront(&lruItem{key: key, cost: cost})
+	l.size += cost
+
+	var evicted []string
+	for l.maxBytes > 0 && l.size > l.maxBytes && l.order.Len() > 1 {
+		oldest := l.order.Back().Value.(*lruItem)
+		l.remove(oldest.key)
+		evicted = append(evicted, oldest.key)
+	}
+	return evicted
+}
+
+// remove forgets key
+func (l *lru) remove(key string) bool {
+	el, ok := l.items[key]
+	if !ok {
+		return false
+	}
+	l.order.Remove(el)
+	delete(l.items, key)
+	l.size -= el.Value.(*lruItem).cost
+	return true
+}
+
+// MemoryBackend is an in-memory LRU Backend bounded by a byte budget
+type MemoryBackend struct {
+	mu      sync.Mutex
+	lru     *lru
+	entries map[string]*Entry
+}
+
+// NewMemoryBackend creates an in-memory backend that evicts least recently
+// used entries once bodies and keys exceed maxBytes (0: unbounded)
+func NewMemoryBackend(maxBytes int64) *MemoryBackend {
+	return &MemoryBackend{lru: newLRU(maxBytes), entries: make(map[string]*Entry)}
+}
+
+// Get returns the entry for key
+func (b *MemoryBackend) Get(key string) (*Entry, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	entry, ok := b.entries[key]
+	if ok {
+		b.lru.touch(key)
+	}
+	return entry, ok
+}
+
+// Set stores the entry for key
+func (b *MemoryBackend) Set(key string, entry *Entry) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.entries[key] = entry
+	for _, evicted := range b.lru.add(key, entry.cost(key)) {
+		delete(b.entries, evicted)
+	}
+}
+
+// Delete removes the entry for key
+func (b *MemoryBackend) Delete(key string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lru.remove(key)
+	delete(b.entries, key)
+}
+
+// Size returns the bytes currently counted against the budget
+func (b *MemoryBackend) Size() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.lru.size
+}
+
+// Len returns the number of cached entries
+func (b *MemoryBackend) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.entries)
+}
+
+var _ Backend = (*MemoryBackend)(nil)
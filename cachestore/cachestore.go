@@ -0,0 +1,389 @@
+// Package cachestore provides a read-through cache for storagex.Storage.
+//
+// Get bodies up to a size threshold and Head results are kept in a pluggable
+// Backend: an in-memory LRU bounded by a byte budget or a local directory.
+// Entries are served without contacting the backend for a TTL, then
+// revalidated by ETag: with an If-None-Match Get when the wrapped storage (or
+// one it wraps) implements storagex.ConditionalGetter, otherwise with a Head. Writes and
+// deletes made through the same Store, including conditional writes,
+// invalidate the affected keys; changes made by other clients are picked up
+// at the next revalidation.
+//
+// Example usage:
+//
+//	cached := cachestore.New(storage, cachestore.Options{
+//	    Backend:       cachestore.NewMemoryBackend(256 << 20),
+//	    MaxObjectSize: 1 << 20,
+//	    TTL:           30 * time.Second,
+//	    Instrumenter:  instrumenter,
+//	})
+package cachestore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"time"
+
+	"github.com/gostratum/storagex"
+)
+
+// Cache results recorded through the Instrumenter
+const (
+	// ResultHit is a fresh entry served from the cache
+	ResultHit = "hit"
+
+	// ResultRevalidated is a stale entry the backend confirmed unchanged
+	ResultRevalidated = "revalidated"
+
+	// ResultMiss is a call answered by the backend
+	ResultMiss = "miss"
+)
+
+// Default option values
+const (
+	DefaultMaxObjectSize = 1 << 20
+	DefaultTTL           = time.Minute
+	DefaultMemoryBytes   = 64 << 20
+)
+
+// Options configures a Store
+type Options struct {
+	// Backend holds the entries (default: a 64 MiB MemoryBackend)
+	Backend Backend
+
+	// MaxObjectSize is the largest body cached; larger objects are
+	// streamed from the backend and only their metadata is cached
+	// (default: 1 MiB)
+	MaxObjectSize int64
+
+	// TTL is how long an entry is served without revalidation
+	// (default: 1 minute)
+	TTL time.Duration
+
+	// Instrumenter optionally records hits and misses
+	Instrumenter *storagex.Instrumenter
+
+	// Clock is an optional time source (useful for testing)
+	Clock func() time.Time
+}
+
+// Store is a storagex.Storage decorator caching Get and Head results
+type Store struct {
+	next storagex.Storage
+	opts Options
+}
+
+// New wraps next with a read-through cache
+func New(next storagex.Storage, opts Options) *Store {
+	if opts.Backend == nil {
+		opts.Backend = NewMemoryBackend(DefaultMemoryBytes)
+	}
+	if opts.MaxObjectSize <= 0 {
+		opts.MaxObjectSize = DefaultMaxObjectSize
+	}
+	if opts.TTL <= 0 {
+		opts.TTL = DefaultTTL
+	}
+	if opts.Clock == nil {
+		opts.Clock = time.Now
+	}
+	return &Store{next: next, opts: opts}
+}
+
+// Unwrap returns the wrapped storage
+func (s *Store) Unwrap() storagex.Storage {
+	return s.next
+}
+
+// ForwardsTo reports that conditional writes are forwarded to the wrapped
+// storage, so a Store supports them only if that storage does
+func (s *Store) ForwardsTo(iface reflect.Type) (storagex.Storage, bool) {
+	return s.next, iface == reflect.TypeFor[storagex.ConditionalWriter]()
+}
+
+// Invalidate drops the cached entry for key, e.g. after another process
+// changed the object
+func (s *Store) Invalidate(key string) {
+	s.opts.Backend.Delete(key)
+}
+
+func (s *Store) record(op, result string) {
+	if s.opts.Instrumenter != nil {
+		s.opts.Instrumenter.RecordCacheResult(op, result)
+	}
+}
+
+func (s *Store) fresh(entry *Entry) bool {
+	return s.opts.Clock().Sub(entry.ValidatedAt) < s.opts.TTL
+}
+
+// revalidated stores a copy of entry marked as validated now, with stat
+// when the backend returned newer metadata
+func (s *Store) revalidated(key string, entry *Entry, stat *storagex.Stat) *Entry {
+	refreshed := *entry
+	refreshed.ValidatedAt = s.opts.Clock()
+	if stat != nil {
+		refreshed.Stat = *stat
+	}
+	s.opts.Backend.Set(key, &refreshed)
+	return &refreshed
+}
+
+// Get retrieves an object, from the cache when possible
+func (s *Store) Get(ctx context.Context, key string) (storagex.ReaderAtCloser, storagex.Stat, error) {
+	entry, ok := s.opts.Backend.Get(key)
+	if !ok || !entry.HasBody {
+		s.record("get", ResultMiss)
+		reader, stat, err := s.next.Get(ctx, key)
+		return s.fill(key, reader, stat, err)
+	}
+
+	if s.fresh(entry) {
+		s.record("get", ResultHit)
+		return newBodyReader(entry.Body), copyStat(entry.Stat), nil
+	}
+
+	// Stale: ask the backend whether the object changed
+	if getter, ok := storagex.Capability[storagex.ConditionalGetter](s.next); ok && entry.Stat.ETag != "" {
+		reader, stat, err := getter.GetIfNoneMatch(ctx, key, entry.Stat.ETag)
+		if errors.Is(err, storagex.ErrNotModified) {
+			s.record("get", ResultRevalidated)
+			entry = s.revalidated(key, entry, nil)
+			return newBodyReader(entry.Body), copyStat(entry.Stat), nil
+		}
+		s.record("get", ResultMiss)
+		return s.fill(key, reader, stat, err)
+	}
+
+	stat, err := s.next.Head(ctx, key)
+	if err == nil && stat.ETag != "" && stat.ETag == entry.Stat.ETag {
+		s.record("get", ResultRevalidated)
+		entry = s.revalidated(key, entry, &stat)
+		return newBodyReader(entry.Body), copyStat(entry.Stat), nil
+	}
+	if storagex.IsNotFound(err) {
+		s.Invalidate(key)
+		return nil, storagex.Stat{}, err
+	}
+	s.record("get", ResultMiss)
+	reader, stat, err := s.next.Get(ctx, key)
+	return s.fill(key, reader, stat, err)
+}
+
+// fill caches the result of a Get from the backend. Small bodies are read
+// into the cache and served from memory; larger ones are passed through and
+// only their metadata is cached.
+func (s *Store) fill(key string, reader storagex.ReaderAtCloser, stat storagex.Stat, err error) (storagex.ReaderAtCloser, storagex.Stat, error) {
+	if err != nil {
+		if storagex.IsNotFound(err) {
+			s.Invalidate(key)
+		}
+		return reader, stat, err
+	}
+
+	entry := &Entry{Stat: copyStat(stat), ValidatedAt: s.opts.Clock()}
+	if stat.Size < 0 || stat.Size > s.opts.MaxObjectSize {
+		s.opts.Backend.Set(key, entry)
+		return reader, stat, nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(reader, s.opts.MaxObjectSize+1))
+	reader.Close()
+	if err != nil {
+		return nil, storagex.Stat{}, &storagex.StorageError{Op: "get", Key: key, Err: err}
+	}
+	if int64(len(body)) != stat.Size {
+		// The body does not match its metadata; serve it but do not keep it
+		return newBodyReader(body), stat, nil
+	}
+
+	entry.Body, entry.HasBody = body, true
+	s.opts.Backend.Set(key, entry)
+	return newBodyReader(body), stat, nil
+}
+
+// Head retrieves object metadata, from the cache when possible
+func (s *Store) Head(ctx context.Context, key string) (storagex.Stat, error) {
+	entry, ok := s.opts.Backend.Get(key)
+	if ok && s.fresh(entry) {
+		s.record("head", ResultHit)
+		return copyStat(entry.Stat), nil
+	}
+
+	stat, err := s.next.Head(ctx, key)
+	if err != nil {
+		if storagex.IsNotFound(err) {
+			s.Invalidate(key)
+		}
+		s.record("head", ResultMiss)
+		return stat, err
+	}
+
+	if ok && entry.HasBody && stat.ETag != "" && stat.ETag == entry.Stat.ETag {
+		// Unchanged: keep the cached body too
+		s.record("head", ResultRevalidated)
+		s.revalidated(key, entry, &stat)
+		return stat, nil
+	}
+
+	s.record("head", ResultMiss)
+	s.opts.Backend.Set(key, &Entry{Stat: copyStat(stat), ValidatedAt: s.opts.Clock()})
+	return stat, nil
+}
+
+// Put stores an object and invalidates its cache entry
+func (s *Store) Put(ctx context.Context, key string, r io.Reader, opts *storagex.PutOptions) (storagex.Stat, error) {
+	defer s.Invalidate(key)
+	return s.next.Put(ctx, key, r, opts)
+}
+
+// PutBytes stores an object and invalidates its cache entry
+func (s *Store) PutBytes(ctx context.Context, key string, data []byte, opts *storagex.PutOptions) (storagex.Stat, error) {
+	defer s.Invalidate(key)
+	return s.next.PutBytes(ctx, key, data, opts)
+}
+
+// PutFile stores an object and invalidates its cache entry
+func (s *Store) PutFile(ctx context.Context, key string, path string, opts *storagex.PutOptions) (storagex.Stat, error) {
+	defer s.Invalidate(key)
+	return s.next.PutFile(ctx, key, path, opts)
+}
+
+// List retrieves objects; listings are not cached
+func (s *Store) List(ctx context.Context, opts storagex.ListOptions) (storagex.ListPage, error) {
+	return s.next.List(ctx, opts)
+}
+
+// Delete removes an object and invalidates its cache entry
+func (s *Store) Delete(ctx context.Context, key string) error {
+	defer s.Invalidate(key)
+	return s.next.Delete(ctx, key)
+}
+
+// DeleteBatch removes objects and invalidates their cache entries
+func (s *Store) DeleteBatch(ctx context.Context, keys []string) ([]string, error) {
+	defer func() {
+		for _, key := range keys {
+			s.Invalidate(key)
+		}
+	}()
+	return s.next.DeleteBatch(ctx, keys)
+}
+
+// MultipartUpload uploads an object and invalidates its cache entry
+func (s *Store) MultipartUpload(ctx context.Context, key string, src io.Reader, cfg *storagex.MultipartConfig, putOpts *storagex.PutOptions) (storagex.Stat, error) {
+	defer s.Invalidate(key)
+	return s.next.MultipartUpload(ctx, key, src, cfg, putOpts)
+}
+
+// CreateMultipart initiates a multipart upload session
+func (s *Store) CreateMultipart(ctx context.Context, key string, putOpts *storagex.PutOptions) (string, error) {
+	return s.next.CreateMultipart(ctx, key, putOpts)
+}
+
+// UploadPart uploads a single part in a multipart upload
+func (s *Store) UploadPart(ctx context.Context, key, uploadID string, partNumber int32, part io.Reader, size int64) (string, error) {
+	return s.next.UploadPart(ctx, key, uploadID, partNumber, part, size)
+}
+
+// CompleteMultipart finalizes a multipart upload and invalidates its cache
+// entry
+func (s *Store) CompleteMultipart(ctx context.Context, key, uploadID string, etags []string) (storagex.Stat, error) {
+	defer s.Invalidate(key)
+	return s.next.CompleteMultipart(ctx, key, uploadID, etags)
+}
+
+// AbortMultipart cancels a multipart upload
+func (s *Store) AbortMultipart(ctx context.Context, key, uploadID string) error {
+	return s.next.AbortMultipart(ctx, key, uploadID)
+}
+
+// PresignGet generates a presigned download URL
+func (s *Store) PresignGet(ctx context.Context, key string, opts *storagex.PresignOptions) (string, error) {
+	return s.next.PresignGet(ctx, key, opts)
+}
+
+// PresignPut generates a presigned upload URL
+func (s *Store) PresignPut(ctx context.Context, key string, opts *storagex.PresignOptions) (string, error) {
+	return s.next.PresignPut(ctx, key, opts)
+}
+
+// conditionalWriter returns the ConditionalWriter of the wrapped storage
+func (s *Store) conditionalWriter(op, key string) (storagex.ConditionalWriter, error) {
+	writer, ok := storagex.Capability[storagex.ConditionalWriter](s.next)
+	if !ok {
+		return nil, &storagex.StorageError{Op: op, Key: key, Err: fmt.Errorf("wrapped storage does not support conditional writes: %w", storagex.ErrInvalidConfig)}
+	}
+	return writer, nil
+}
+
+// PutIfAbsent stores an object if the key does not exist and invalidates its
+// cache entry. It fails with ErrInvalidConfig if the wrapped storage does not
+// implement storagex.ConditionalWriter.
+func (s *Store) PutIfAbsent(ctx context.Context, key string, r io.Reader, opts *storagex.PutOptions) (storagex.Stat, error) {
+	writer, err := s.conditionalWriter("put_if_absent", key)
+	if err != nil {
+		return storagex.Stat{}, err
+	}
+	defer s.Invalidate(key)
+	return writer.PutIfAbsent(ctx, key, r, opts)
+}
+
+// PutIfMatch replaces an object if its ETag is etag and invalidates its
+// cache entry, also when the precondition fails, so the next read returns
+// the current ETag. See PutIfAbsent.
+func (s *Store) PutIfMatch(ctx context.Context, key string, r io.Reader, etag string, opts *storagex.PutOptions) (storagex.Stat, error) {
+	writer, err := s.conditionalWriter("put_if_match", key)
+	if err != nil {
+		return storagex.Stat{}, err
+	}
+	defer s.Invalidate(key)
+	return writer.PutIfMatch(ctx, key, r, etag, opts)
+}
+
+// DeleteIfMatch removes an object if its ETag is etag and invalidates its
+// cache entry. See PutIfMatch.
+func (s *Store) DeleteIfMatch(ctx context.Context, key, etag string) error {
+	writer, err := s.conditionalWriter("delete_if_match", key)
+	if err != nil {
+		return err
+	}
+	defer s.Invalidate(key)
+	return writer.DeleteIfMatch(ctx, key, etag)
+}
+
+var (
+	_ storagex.Storage             = (*Store)(nil)
+	_ storagex.ConditionalWriter   = (*Store)(nil)
+	_ storagex.CapabilityForwarder = (*Store)(nil)
+)
+
+// bodyReader serves a cached body
+type bodyReader struct {
+	*bytes.Reader
+	size int64
+}
+
+func newBodyReader(body []byte) *bodyReader {
+	return &bodyReader{Reader: bytes.NewReader(body), size: int64(len(body))}
+}
+
+func (r *bodyReader) Size() int64  { return r.size }
+func (r *bodyReader) Close() error { return nil }
+
+// copyStat returns stat with its own metadata map, so callers cannot change
+// cached entries
+func copyStat(stat storagex.Stat) storagex.Stat {
+	if stat.Metadata != nil {
+		metadata := make(map[string]string, len(stat.Metadata))
+		for k, v := range stat.Metadata {
+			metadata[k] = v
+		}
+		stat.Metadata = metadata
+	}
+	return stat
+}
@@ -0,0 +1,343 @@
+package cachestore_test
+
+import (
+	"context"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/gostratum/storagex"
+	"github.com/gostratum/storagex/cachestore"
+	"github.com/gostratum/storagex/internal/testutil"
+	"github.com/gostratum/storagex/lock"
+	"github.com/gostratum/storagex/storagextest"
+)
+
+// countingStorage counts the reads that reach the backend
+type countingStorage struct {
+	*testutil.MockStorage
+
+	mu          sync.Mutex
+	gets        int
+	heads       int
+	conditional int
+}
+
+func (c *countingStorage) Get(ctx context.Context, key string) (storagex.ReaderAtCloser, storagex.Stat, error) {
+	c.mu.Lock()
+	c.gets++
+	c.mu.Unlock()
+	return c.MockStorage.Get(ctx, key)
+}
+
+func (c *countingStorage) Head(ctx context.Context, key string) (storagex.Stat, error) {
+	c.mu.Lock()
+	c.heads++
+	c.mu.Unlock()
+	return c.MockStorage.Head(ctx, key)
+}
+
+func (c *countingStorage) GetIfNoneMatch(ctx context.Context, key, etag string) (storagex.ReaderAtCloser, storagex.Stat, error) {
+	c.mu.Lock()
+	c.conditional++
+	c.mu.Unlock()
+	return c.MockStorage.GetIfNoneMatch(ctx, key, etag)
+}
+
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
+func newStore(t *testing.T, opts cachestore.Options) (*cachestore.Store, *countingStorage, *fakeClock) {
+	t.Helper()
+	backend := &countingStorage{MockStorage: testutil.NewMockStorage()}
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	opts.Clock = clock.Now
+	if opts.TTL == 0 {
+		opts.TTL = time.Minute
+	}
+	return cachestore.New(backend, opts), backend, clock
+}
+
+func read(t *testing.T, storage storagex.Storage, key string) string {
+	t.Helper()
+	reader, stat, err := storage.Get(context.Background(), key)
+	require.NoError(t, err)
+	defer reader.Close()
+	data, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(data)), stat.Size)
+	return string(data)
+}
+
+func TestStore_GetHitsAndRevalidation(t *testing.T) {
+	ctx := context.Background()
+	store, backend, clock := newStore(t, cachestore.Options{})
+	_, err := backend.PutBytes(ctx, "config.json", []byte(`{"v":1}`), nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, `{"v":1}`, read(t, store, "config.json"))
+	assert.Equal(t, `{"v":1}`, read(t, store, "config.json"))
+	assert.Equal(t, 1, backend.gets)
+
+	// After the TTL an unchanged object is revalidated without a transfer
+	clock.Advance(2 * time.Minute)
+	assert.Equal(t, `{"v":1}`, read(t, store, "config.json"))
+	assert.Equal(t, 1, backend.conditional)
+	assert.Equal(t, 1, backend.gets)
+
+	// ... and a revalidated entry is fresh again
+	assert.Equal(t, `{"v":1}`, read(t, store, "config.json"))
+	assert.Equal(t, 1, backend.conditional)
+
+	// A change made by another client shows up at the next revalidation
+	_, err = backend.PutBytes(ctx, "config.json", []byte(`{"v":2}`), &storagex.PutOptions{Overwrite: true})
+	require.NoError(t, err)
+	assert.Equal(t, `{"v":1}`, read(t, store, "config.json"))
+	clock.Advance(2 * time.Minute)
+	assert.Equal(t, `{"v":2}`, read(t, store, "config.json"))
+
+	// Deleted objects are dropped
+	require.NoError(t, backend.Delete(ctx, "config.json"))
+	clock.Advance(2 * time.Minute)
+	_, _, err = store.Get(ctx, "config.json")
+	assert.True(t, storagex.IsNotFound(err))
+}
+
+func TestStore_RevalidatesWithHead(t *testing.T) {
+	ctx := context.Background()
+	backend := &countingStorage{MockStorage: testutil.NewMockStorage()}
+	clock := &fakeClock{now: time.Unix(0, 0)}
+
+	store := cachestore.New(testutil.PlainStorage{Storage: backend}, cachestore.Options{
+		TTL:   time.Minute,
+		Clock: clock.Now,
+	})
+	_, err := store.PutBytes(ctx, "a.txt", []byte("alpha"), nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, "alpha", read(t, store, "a.txt"))
+	clock.Advance(2 * time.Minute)
+	assert.Equal(t, "alpha", read(t, store, "a.txt"))
+	assert.Equal(t, 1, backend.gets)
+	assert.Equal(t, 1, backend.heads)
+	assert.Equal(t, 0, backend.conditional)
+}
+
+func TestStore_RevalidatesThroughDecorators(t *testing.T) {
+	ctx := context.Background()
+	backend := &countingStorage{MockStorage: testutil.NewMockStorage()}
+	clock := &fakeClock{now: time.Unix(0, 0)}
+
+	// GetIfNoneMatch is found through RetryStorage
+	store := cachestore.New(storagex.NewRetryStorage(backend, storagex.RetryPolicy{}), cachestore.Options{
+		TTL:   time.Minute,
+		Clock: clock.Now,
+	})
+	_, err := store.PutBytes(ctx, "a.txt", []byte("alpha"), nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, "alpha", read(t, store, "a.txt"))
+	clock.Advance(2 * time.Minute)
+	assert.Equal(t, "alpha", read(t, store, "a.txt"))
+	assert.Equal(t, 1, backend.gets)
+	assert.Equal(t, 0, backend.heads)
+	assert.Equal(t, 1, backend.conditional)
+}
+
+func TestStore_HeadAndLargeObjects(t *testing.T) {
+	ctx := context.Background()
+	store, backend, _ := newStore(t, cachestore.Options{MaxObjectSize: 4})
+	_, err := backend.PutBytes(ctx, "small.txt", []byte("abc"), nil)
+	require.NoError(t, err)
+	_, err = backend.PutBytes(ctx, "large.txt", []byte("abcdefgh"), nil)
+	require.NoError(t, err)
+
+	// Head results are cached, but a Head entry has no body
+	for i := 0; i < 2; i++ {
+		stat, err := store.Head(ctx, "small.txt")
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), stat.Size)
+	}
+	assert.Equal(t, 1, backend.heads)
+	assert.Equal(t, "abc", read(t, store, "small.txt"))
+	assert.Equal(t, 1, backend.gets)
+
+	// Bodies above MaxObjectSize are streamed each time; their metadata is cached
+	assert.Equal(t, "abcdefgh", read(t, store, "large.txt"))
+	assert.Equal(t, "abcdefgh", read(t, store, "large.txt"))
+	assert.Equal(t, 3, backend.gets)
+	_, err = store.Head(ctx, "large.txt")
+	require.NoError(t, err)
+	assert.Equal(t, 1, backend.heads)
+
+	// Cached stats are copies
+	stat, err := store.Head(ctx, "small.txt")
+	require.NoError(t, err)
+	stat.Metadata["x"] = "y"
+	stat, err = store.Head(ctx, "small.txt")
+	require.NoError(t, err)
+	assert.NotContains(t, stat.Metadata, "x")
+}
+
+func TestStore_InvalidatesOnWrites(t *testing.T) {
+	ctx := context.Background()
+	store, backend, _ := newStore(t, cachestore.Options{})
+	overwrite := &storagex.PutOptions{Overwrite: true}
+
+	_, err := store.PutBytes(ctx, "a.txt", []byte("one"), overwrite)
+	require.NoError(t, err)
+	assert.Equal(t, "one", read(t, store, "a.txt"))
+
+	_, err = store.PutBytes(ctx, "a.txt", []byte("two"), overwrite)
+	require.NoError(t, err)
+	assert.Equal(t, "two", read(t, store, "a.txt"))
+
+	require.NoError(t, store.Delete(ctx, "a.txt"))
+	_, err = store.Head(ctx, "a.txt")
+	assert.True(t, storagex.IsNotFound(err))
+
+	_, err = store.PutBytes(ctx, "b.txt", []byte("bravo"), overwrite)
+	require.NoError(t, err)
+	assert.Equal(t, "bravo", read(t, store, "b.txt"))
+	_, err = store.DeleteBatch(ctx, []string{"b.txt"})
+	require.NoError(t, err)
+	_, _, err = store.Get(ctx, "b.txt")
+	assert.True(t, storagex.IsNotFound(err))
+	assert.Equal(t, 4, backend.gets)
+}
+
+func TestStore_ConditionalWritesInvalidate(t *testing.T) {
+	ctx := context.Background()
+	store, backend, _ := newStore(t, cachestore.Options{})
+
+	writer, ok := storagex.Capability[storagex.ConditionalWriter](store)
+	require.True(t, ok)
+	assert.Same(t, store, writer)
+
+	_, err := storagex.UpdateJSON(ctx, store, "counter.json", 1, "", nil)
+	require.NoError(t, err)
+	value, stale, err := storagex.GetJSON[int](ctx, store, "counter.json")
+	require.NoError(t, err)
+	assert.Equal(t, 1, value)
+
+	// Another client changes the object behind the cache
+	_, err = storagex.UpdateJSON(ctx, backend, "counter.json", 5, stale.ETag, nil)
+	require.NoError(t, err)
+
+	// The stale ETag fails once; the failure drops the cached entry, so the
+	// retry reads the current value instead of spinning until the TTL
+	_, err = storagex.UpdateJSON(ctx, store, "counter.json", 2, stale.ETag, nil)
+	assert.True(t, storagex.IsPreconditionFailed(err))
+	value, current, err := storagex.GetJSON[int](ctx, store, "counter.json")
+	require.NoError(t, err)
+	assert.Equal(t, 5, value)
+	_, err = storagex.UpdateJSON(ctx, store, "counter.json", 6, current.ETag, nil)
+	require.NoError(t, err)
+
+	value, current, err = storagex.GetJSON[int](ctx, store, "counter.json")
+	require.NoError(t, err)
+	assert.Equal(t, 6, value)
+	require.NoError(t, store.DeleteIfMatch(ctx, "counter.json", current.ETag))
+	_, err = store.Head(ctx, "counter.json")
+	assert.True(t, storagex.IsNotFound(err))
+
+	// Without conditional writes underneath, the calls fail rather than
+	// writing around anything
+	plain := cachestore.New(testutil.PlainStorage{Storage: testutil.NewMockStorage()}, cachestore.Options{})
+	_, err = storagex.UpdateJSON(ctx, plain, "counter.json", 1, "", nil)
+	assert.ErrorIs(t, err, storagex.ErrInvalidConfig)
+	_, err = lock.New(plain, lock.Options{})
+	assert.ErrorIs(t, err, storagex.ErrInvalidConfig)
+	_, err = lock.New(store, lock.Options{})
+	assert.NoError(t, err)
+}
+
+func TestMemoryBackend_ByteBudget(t *testing.T) {
+	backend := cachestore.NewMemoryBackend(20)
+	entry := func(body string) *cachestore.Entry {
+		return &cachestore.Entry{Body: []byte(body), HasBody: true}
+	}
+
+	backend.Set("a", entry("123456789"))
+	backend.Set("b", entry("123456789"))
+	_, ok := backend.Get("a") // a is now the most recently used
+	require.True(t, ok)
+
+	backend.Set("c", entry("123456789"))
+	_, ok = backend.Get("b")
+	assert.False(t, ok, "least recently used entry should be evicted")
+	_, ok = backend.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, 2, backend.Len())
+	assert.Equal(t, int64(20), backend.Size())
+
+	backend.Delete("a")
+	assert.Equal(t, int64(10), backend.Size())
+}
+
+func TestDiskBackend(t *testing.T) {
+	dir := t.TempDir()
+	backend, err := cachestore.NewDiskBackend(dir, 40)
+	require.NoError(t, err)
+
+	validated := time.Unix(100, 0).UTC()
+	backend.Set("docs/a.txt", &cachestore.Entry{
+		Stat:        storagex.Stat{Key: "docs/a.txt", Size: 5, ETag: "e1", Metadata: map[string]string{"k": "v"}},
+		Body:        []byte("alpha"),
+		HasBody:     true,
+		ValidatedAt: validated,
+	})
+	backend.Set("docs/b.txt", &cachestore.Entry{Stat: storagex.Stat{Key: "docs/b.txt", Size: 100}})
+
+	entry, ok := backend.Get("docs/a.txt")
+	require.True(t, ok)
+	assert.Equal(t, "alpha", string(entry.Body))
+	assert.Equal(t, "v", entry.Stat.Metadata["k"])
+	assert.True(t, validated.Equal(entry.ValidatedAt))
+
+	entry, ok = backend.Get("docs/b.txt")
+	require.True(t, ok)
+	assert.False(t, entry.HasBody)
+
+	// Entries survive a restart
+	reopened, err := cachestore.NewDiskBackend(dir, 40)
+	require.NoError(t, err)
+	assert.Equal(t, backend.Size(), reopened.Size())
+	_, ok = reopened.Get("docs/a.txt")
+	assert.True(t, ok)
+
+	// The byte budget evicts the least recently used entry
+	reopened.Set("docs/c.txt", &cachestore.Entry{Body: []byte("0123456789"), HasBody: true})
+	_, ok = reopened.Get("docs/b.txt")
+	assert.False(t, ok)
+	_, ok = reopened.Get("docs/a.txt")
+	assert.True(t, ok)
+
+	reopened.Delete("docs/a.txt")
+	_, ok = reopened.Get("docs/a.txt")
+	assert.False(t, ok)
+}
+
+func TestStore_Conformance(t *testing.T) {
+	storagextest.RunConformance(t, func(t *testing.T) storagex.Storage {
+		return cachestore.New(testutil.NewMockStorage(), cachestore.Options{TTL: time.Hour})
+	})
+}
@@ -0,0 +1,200 @@
+package cachestore
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gostratum/storagex"
+)
+
+// diskEntryExt is the file extension of entries written by DiskBackend
+const diskEntryExt = ".entry"
+
+// diskHeader is the metadata line written ahead of the body of an entry file
+type diskHeader struct {
+	Key         string        `json:"key"`
+	Stat        storagex.Stat `json:"stat"`
+	HasBody     bool          `json:"has_body"`
+	ValidatedAt time.Time     `json:"validated_at"`
+}
+
+// DiskBackend is a Backend that keeps entries as files in a local directory,
+// so they survive restarts, evicting least recently used entries once bodies
+// and keys exceed a byte budget.
+//
+// Each entry is a single file holding a JSON header line followed by the
+// body, replaced atomically by rename.
+type DiskBackend struct {
+	dir string
+
+	mu  sync.Mutex
+	lru *lru
+}
+
+// NewDiskBackend opens (creating if needed) a disk cache in dir bounded by
+// maxBytes (0: unbounded). Entries left by a previous process are kept,
+// oldest first in eviction order.
+func NewDiskBackend(dir string, maxBytes int64) (*DiskBackend, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("cachestore: create cache directory: %w", err)
+	}
+
+	b := &DiskBackend{dir: dir, lru: newLRU(maxBytes)}
+	if err := b.load(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// load indexes existing entries by modification time
+func (b *DiskBackend) load() error {
+	files, err := os.ReadDir(b.dir)
+	if err != nil {
+		return fmt.Errorf("cachestore: read cache directory: %w", err)
+	}
+
+	type existing struct {
+		key     string
+		cost    int64
+		modTime time.Time
+	}
+	var found []existing
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+		if strings.HasPrefix(f.Name(), "tmp-") {
+			// Left by a write interrupted by a crash
+			os.Remove(filepath.Join(b.dir, f.Name()))
+			continue
+		}
+		if !strings.HasSuffix(f.Name(), diskEntryExt) {
+			continue
+		}
+		path := filepath.Join(b.dir, f.Name())
+		header, body, err := readEntryFile(path)
+		info, statErr := f.Info()
+		if err != nil || statErr != nil {
+			os.Remove(path)
+			continue
+		}
+		found = append(found, existing{header.Key, int64(len(header.Key) + len(body)), info.ModTime()})
+	}
+
+	sort.Slice(found, func(i, j int) bool { return found[i].modTime.Before(found[j].modTime) })
+	for _, e := range found {
+		for _, evicted := range b.lru.add(e.key, e.cost) {
+			os.Remove(b.path(evicted))
+		}
+	}
+	return nil
+}
+
+// path returns the file of key's entry
+func (b *DiskBackend) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(b.dir, hex.EncodeToString(sum[:])+diskEntryExt)
+}
+
+func readEntryFile(path string) (diskHeader, []byte, error) {
+	var header diskHeader
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return header, nil, err
+	}
+	line, body, ok := bytes.Cut(data, []byte("\n"))
+	if !ok {
+		return header, nil, fmt.Errorf("cachestore: malformed cache entry %s", path)
+	}
+	if err := json.Unmarshal(line, &header); err != nil {
+		return header, nil, fmt.Errorf("cachestore: malformed cache entry %s: %w", path, err)
+	}
+	return header, body, nil
+}
+
+// Get returns the entry for key. Unreadable entries are dropped.
+func (b *DiskBackend) Get(key string) (*Entry, bool) {
+	path := b.path(key)
+	header, body, err := readEntryFile(path)
+	if err != nil || header.Key != key {
+		if !os.IsNotExist(err) {
+			b.Delete(key)
+		}
+		return nil, false
+	}
+
+	b.mu.Lock()
+	b.lru.touch(key)
+	b.mu.Unlock()
+
+	entry := &Entry{Stat: header.Stat, HasBody: header.HasBody, ValidatedAt: header.ValidatedAt}
+	if header.HasBody {
+		entry.Body = body
+	}
+	return entry, true
+}
+
+// Set stores the entry for key. Write failures leave the key uncached.
+func (b *DiskBackend) Set(key string, entry *Entry) {
+	header, err := json.Marshal(diskHeader{
+		Key:         key,
+		Stat:        entry.Stat,
+		HasBody:     entry.HasBody,
+		ValidatedAt: entry.ValidatedAt,
+	})
+	if err != nil {
+		return
+	}
+
+	tmp, err := os.CreateTemp(b.dir, "tmp-*")
+	if err != nil {
+		return
+	}
+	_, err = tmp.Write(append(append(header, '\n'), entry.Body...))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+
+	// Rename and evict under the lock so a concurrent eviction cannot
+	// remove a file the index still counts
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err == nil {
+		err = os.Rename(tmp.Name(), b.path(key))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		b.lru.remove(key)
+		os.Remove(b.path(key))
+		return
+	}
+	for _, k := range b.lru.add(key, entry.cost(key)) {
+		os.Remove(b.path(k))
+	}
+}
+
+// Delete removes the entry for key
+func (b *DiskBackend) Delete(key string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.lru.remove(key)
+	os.Remove(b.path(key))
+}
+
+// Size returns the bytes currently counted against the budget
+func (b *DiskBackend) Size() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.lru.size
+}
+
+var _ Backend = (*DiskBackend)(nil)
@@ -0,0 +1,440 @@
+// Package cas stores blobs by content address, so identical content (e.g.,
+// build artifacts produced by several pipelines) is uploaded and stored once.
+//
+// A blob's key is its SHA-256 digest under a sharded prefix, such as
+// "sha256/ab/cd/abcd…". Put skips the upload when the blob already exists,
+// checked with Head and, on storages implementing
+// storagex.ConditionalWriter, enforced with a conditional create. Get
+// verifies the content against the digest while it is read.
+//
+// Blobs are never overwritten or deleted by Put, so stores built on top keep
+// their own references (tags, manifests) and call GC with the digests still
+// in use to remove everything else.
+//
+// Example usage:
+//
+//	store := cas.New(storage, cas.Options{})
+//	res, err := store.Put(ctx, artifact, nil)
+//	// record res.Digest in a manifest, then later:
+//	body, _, err := store.Get(ctx, res.Digest)
+//	report, err := store.GC(ctx, cas.GCOptions{Roots: liveDigests})
+package cas
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gostratum/storagex"
+)
+
+const (
+	// DefaultPrefix is the default key prefix of blobs
+	DefaultPrefix = "sha256/"
+
+	// DefaultMultipartThreshold is the default size above which blobs are
+	// uploaded with multipart
+	DefaultMultipartThreshold = 64 << 20
+
+	// DefaultGracePeriod is the default age below which GC keeps
+	// unreferenced blobs
+	DefaultGracePeriod = time.Hour
+)
+
+// ErrDigestMismatch indicates that the content read for a blob does not
+// match its digest
+var ErrDigestMismatch = errors.New("cas: content does not match digest")
+
+// Digest is the lowercase hex SHA-256 of a blob
+type Digest string
+
+// ParseDigest validates a hex SHA-256 digest, optionally prefixed with
+// "sha256:", and returns it in lowercase. It fails with
+// storagex.ErrInvalidKey for anything else.
+func ParseDigest(s string) (Digest, error) {
+	h := strings.ToLower(strings.TrimPrefix(s, "sha256:"))
+	if len(h) != sha256.Size*2 {
+		return "", fmt.Errorf("%w: invalid sha256 digest %q", storagex.ErrInvalidKey, s)
+	}
+	if _, err := hex.DecodeString(h); err != nil {
+		return "", fmt.Errorf("%w: invalid sha256 digest %q", storagex.ErrInvalidKey, s)
+	}
+	return Digest(h), nil
+}
+
+// DigestOf returns the digest of data
+func DigestOf(data []byte) Digest {
+	sum := sha256.Sum256(data)
+	return Digest(hex.EncodeToString(sum[:]))
+}
+
+// String returns the digest as "sha256:<hex>"
+func (d Digest) String() string {
+	return "sha256:" + string(d)
+}
+
+// Options configures a Store
+type Options struct {
+	// Prefix is the key prefix of blobs (default: "sha256/")
+	Prefix string
+
+	// MultipartThreshold is the size above which blobs are uploaded with
+	// multipart (default: 64MB). Multipart uploads are not conditional; a
+	// concurrent upload of the same blob writes identical content.
+	MultipartThreshold int64
+
+	// PartSize is the multipart part size (default: the storage's)
+	PartSize int64
+
+	// TempDir is where Put spools content while hashing it (default:
+	// os.TempDir())
+	TempDir string
+
+	// Clock is an optional time source for GC (useful for testing)
+	Clock func() time.Time
+}
+
+// Store is a content-addressable blob store on top of a storagex.Storage
+type Store struct {
+	storage storagex.Storage
+	writer  storagex.ConditionalWriter
+	opts    Options
+}
+
+// New creates a Store. Conditional creates are used when storage (or a
+// storage it wraps) implements storagex.ConditionalWriter.
+func New(storage storagex.Storage, opts Options) *Store {
+	if opts.Prefix == "" {
+		opts.Prefix = DefaultPrefix
+	}
+	if !strings.HasSuffix(opts.Prefix, "/") {
+		opts.Prefix += "/"
+	}
+	if opts.MultipartThreshold <= 0 {
+		opts.MultipartThreshold = DefaultMultipartThreshold
+	}
+	if opts.Clock == nil {
+		opts.Clock = time.Now
+	}
+	writer, _ := storagex.Capability[storagex.ConditionalWriter](storage)
+	return &Store{storage: storage, writer: writer, opts: opts}
+}
+
+// Key returns the storage key of a blob, e.g. "sha256/ab/cd/abcd…". d must
+// be a valid digest.
+func (s *Store) Key(d Digest) string {
+	return s.opts.Prefix + string(d[:2]) + "/" + string(d[2:4]) + "/" + string(d)
+}
+
+// key validates d and returns its storage key
+func (s *Store) key(op string, d Digest) (string, error) {
+	if parsed, err := ParseDigest(string(d)); err != nil || parsed != d {
+		return "", &storagex.StorageError{Op: op, Key: string(d), Err: fmt.Errorf("%w: invalid sha256 digest", storagex.ErrInvalidKey)}
+	}
+	return s.Key(d), nil
+}
+
+// parseKey returns the digest stored at key, or false for keys outside the
+// blob layout
+func (s *Store) parseKey(key string) (Digest, bool) {
+	parts := strings.Split(strings.TrimPrefix(key, s.opts.Prefix), "/")
+	if !strings.HasPrefix(key, s.opts.Prefix) || len(parts) != 3 {
+		return "", false
+	}
+	d, err := ParseDigest(parts[2])
+	if err != nil || string(d) != parts[2] || parts[0] != parts[2][:2] || parts[1] != parts[2][2:4] {
+		return "", false
+	}
+	return d, true
+}
+
+// PutResult describes a stored blob
+type PutResult struct {
+	// Digest is the blob's SHA-256
+	Digest Digest
+
+	// Size is the blob size in bytes
+	Size int64
+
+	// Deduplicated reports that the blob already existed and nothing was
+	// uploaded
+	Deduplicated bool
+}
+
+// Put stores the content of r. It is spooled to a temporary file while its
+// digest is computed, then uploaded unless a blob with that digest exists.
+// opts may set the content type, cache control and metadata of new blobs;
+// Overwrite is ignored.
+func (s *Store) Put(ctx context.Context, r io.Reader, opts *storagex.PutOptions) (PutResult, error) {
+	tmp, err := os.CreateTemp(s.opts.TempDir, "tmp-cas-*")
+	if err != nil {
+		return PutResult{}, &storagex.StorageError{Op: "cas_put", Err: fmt.Errorf("spool content: %w", err)}
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, h), r)
+	if err != nil {
+		return PutResult{}, &storagex.StorageError{Op: "cas_put", Err: fmt.Errorf("spool content: %w", err)}
+	}
+	d := Digest(hex.EncodeToString(h.Sum(nil)))
+
+	return s.put(ctx, d, size, opts, func() (io.Reader, error) {
+		_, err := tmp.Seek(0, io.SeekStart)
+		return tmp, err
+	})
+}
+
+// PutBytes stores data. See Put.
+func (s *Store) PutBytes(ctx context.Context, data []byte, opts *storagex.PutOptions) (PutResult, error) {
+	return s.put(ctx, DigestOf(data), int64(len(data)), opts, func() (io.Reader, error) {
+		return bytes.NewReader(data), nil
+	})
+}
+
+// put uploads a blob unless it exists
+func (s *Store) put(ctx context.Context, d Digest, size int64, opts *storagex.PutOptions, open func() (io.Reader, error)) (PutResult, error) {
+	key := s.Key(d)
+	res := PutResult{Digest: d, Size: size}
+
+	if _, err := s.storage.Head(ctx, key); err == nil {
+		res.Deduplicated = true
+		return res, nil
+	} else if !storagex.IsNotFound(err) {
+		return res, err
+	}
+
+	putOpts := storagex.PutOptions{}
+	if opts != nil {
+		putOpts = *opts
+	}
+	putOpts.Overwrite = true
+	if putOpts.ContentType == "" {
+		putOpts.ContentType = "application/octet-stream"
+	}
+
+	r, err := open()
+	if err != nil {
+		return res, &storagex.StorageError{Op: "cas_put", Key: key, Err: err}
+	}
+	switch {
+	case size > s.opts.MultipartThreshold:
+		_, err = s.storage.MultipartUpload(ctx, key, r, &storagex.MultipartConfig{PartSizeBytes: s.opts.PartSize}, &putOpts)
+	case s.writer != nil:
+		// Another writer may have stored the blob since the Head
+		_, err = s.writer.PutIfAbsent(ctx, key, r, &putOpts)
+		if storagex.IsPreconditionFailed(err) {
+			res.Deduplicated = true
+			return res, nil
+		}
+	default:
+		// The content at key is the same whoever writes it
+		_, err = s.storage.Put(ctx, key, r, &putOpts)
+	}
+	return res, err
+}
+
+// Has reports whether a blob exists
+func (s *Store) Has(ctx context.Context, d Digest) (bool, error) {
+	key, err := s.key("cas_has", d)
+	if err != nil {
+		return false, err
+	}
+	_, err = s.storage.Head(ctx, key)
+	if storagex.IsNotFound(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Get opens a blob. The content is hashed as it is read; the read that
+// reaches the end returns ErrDigestMismatch instead of io.EOF if it does not
+// match d, so callers must read to the end before trusting the content.
+func (s *Store) Get(ctx context.Context, d Digest) (io.ReadCloser, storagex.Stat, error) {
+	key, err := s.key("cas_get", d)
+	if err != nil {
+		return nil, storagex.Stat{}, err
+	}
+	body, stat, err := s.storage.Get(ctx, key)
+	if err != nil {
+		return nil, stat, err
+	}
+	return &verifyingReader{body: body, hash: sha256.New(), digest: d, key: key}, stat, nil
+}
+
+// GetBytes reads and verifies a blob
+func (s *Store) GetBytes(ctx context.Context, d Digest) ([]byte, error) {
+	body, _, err := s.Get(ctx, d)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return io.ReadAll(body)
+}
+
+// verifyingReader checks the digest of a blob at EOF
+type verifyingReader struct {
+	body   io.ReadCloser
+	hash   hash.Hash
+	digest Digest
+	key    string
+}
+
+func (r *verifyingReader) Read(p []byte) (int, error) {
+	n, err := r.body.Read(p)
+	r.hash.Write(p[:n])
+	if err == io.EOF && hex.EncodeToString(r.hash.Sum(nil)) != string(r.digest) {
+		return n, &storagex.StorageError{Op: "cas_get", Key: r.key, Err: ErrDigestMismatch}
+	}
+	return n, err
+}
+
+func (r *verifyingReader) Close() error {
+	return r.body.Close()
+}
+
+// GCOptions configures GC
+type GCOptions struct {
+	// Roots are the digests in use
+	Roots []Digest
+
+	// References optionally returns the digests a blob refers to, for blobs
+	// such as manifests that keep other blobs alive. It is called once for
+	// every reachable blob; a storagex.ErrNotFound error marks the blob
+	// missing, any other error aborts GC.
+	References func(ctx context.Context, d Digest) ([]Digest, error)
+
+	// GracePeriod keeps unreferenced blobs younger than it, so blobs
+	// uploaded for a root that is not recorded yet survive (default: 1h,
+	// negative: none)
+	GracePeriod time.Duration
+
+	// DryRun reports what would be deleted without deleting it
+	DryRun bool
+}
+
+// GCReport summarizes a GC run
+type GCReport struct {
+	// RefCounts is the number of references to each reachable blob, from
+	// roots and from other reachable blobs
+	RefCounts map[Digest]int
+
+	// Scanned is the number of blobs listed
+	Scanned int
+
+	// Deleted lists the unreferenced blobs removed (or, with DryRun, that
+	// would be removed), sorted
+	Deleted []Digest
+
+	// Freed is the total size of the deleted blobs in bytes
+	Freed int64
+
+	// Missing lists referenced blobs that do not exist, sorted
+	Missing []Digest
+}
+
+// GC removes blobs that are not reachable from opts.Roots. It counts the
+// references to every blob reachable from the roots, then lists the store
+// and deletes the blobs with no references that are older than the grace
+// period. Blobs uploaded and rooted while GC runs are protected only by the
+// grace period, so keep it well above the time between uploading a blob and
+// recording its root.
+func (s *Store) GC(ctx context.Context, opts GCOptions) (GCReport, error) {
+	if opts.GracePeriod == 0 {
+		opts.GracePeriod = DefaultGracePeriod
+	}
+	report := GCReport{RefCounts: make(map[Digest]int)}
+
+	// Mark: count references breadth-first, expanding each blob once
+	missing := make(map[Digest]bool)
+	queue := append([]Digest(nil), opts.Roots...)
+	for len(queue) > 0 {
+		d := queue[0]
+		queue = queue[1:]
+		// An invalid reference would otherwise leave its blob unmarked
+		if _, err := s.key("cas_gc", d); err != nil {
+			return report, err
+		}
+		report.RefCounts[d]++
+		if report.RefCounts[d] > 1 || opts.References == nil {
+			continue
+		}
+		refs, err := opts.References(ctx, d)
+		if storagex.IsNotFound(err) {
+			missing[d] = true
+			continue
+		}
+		if err != nil {
+			return report, &storagex.StorageError{Op: "cas_gc", Key: s.Key(d), Err: err}
+		}
+		queue = append(queue, refs...)
+	}
+
+	// Sweep
+	cutoff := s.opts.Clock().Add(-opts.GracePeriod)
+	seen := make(map[Digest]bool)
+	var garbage []string
+	var errs []error
+	flush := func() {
+		if opts.DryRun || len(garbage) == 0 {
+			garbage = garbage[:0]
+			return
+		}
+		failed, err := s.storage.DeleteBatch(ctx, garbage)
+		if err != nil {
+			errs = append(errs, err)
+		} else if len(failed) > 0 {
+			errs = append(errs, &storagex.StorageError{Op: "cas_gc", Key: failed[0], Err: fmt.Errorf("%d blobs could not be deleted", len(failed))})
+		}
+		garbage = garbage[:0]
+	}
+
+	token := ""
+	for {
+		page, err := s.storage.List(ctx, storagex.ListOptions{Prefix: s.opts.Prefix, ContinuationToken: token})
+		if err != nil {
+			return report, err
+		}
+		for _, stat := range page.Keys {
+			d, ok := s.parseKey(stat.Key)
+			if !ok {
+				continue
+			}
+			report.Scanned++
+			seen[d] = true
+			if report.RefCounts[d] > 0 || (opts.GracePeriod > 0 && stat.LastModified.After(cutoff)) {
+				continue
+			}
+			report.Deleted = append(report.Deleted, d)
+			report.Freed += stat.Size
+			garbage = append(garbage, stat.Key)
+			if len(garbage) == storagex.DeleteBatchSize {
+				flush()
+			}
+		}
+		if page.NextToken == "" {
+			break
+		}
+		token = page.NextToken
+	}
+	flush()
+
+	for d := range report.RefCounts {
+		if missing[d] || !seen[d] {
+			report.Missing = append(report.Missing, d)
+		}
+	}
+	sort.Slice(report.Missing, func(i, j int) bool { return report.Missing[i] < report.Missing[j] })
+	sort.Slice(report.Deleted, func(i, j int) bool { return report.Deleted[i] < report.Deleted[j] })
+	return report, errors.Join(errs...)
+}
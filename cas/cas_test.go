@@ -0,0 +1,218 @@
+package cas_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/gostratum/storagex"
+	"github.com/gostratum/storagex/cas"
+	"github.com/gostratum/storagex/internal/testutil"
+)
+
+func TestParseDigest(t *testing.T) {
+	d := cas.DigestOf([]byte("hello"))
+	assert.Equal(t, cas.Digest("2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"), d)
+	assert.Equal(t, "sha256:"+string(d), d.String())
+
+	parsed, err := cas.ParseDigest("sha256:" + strings.ToUpper(string(d)))
+	require.NoError(t, err)
+	assert.Equal(t, d, parsed)
+
+	for _, bad := range []string{"", "abc", strings.Repeat("z", 64), "md5:" + string(d)} {
+		_, err := cas.ParseDigest(bad)
+		assert.ErrorIs(t, err, storagex.ErrInvalidKey, bad)
+	}
+}
+
+func TestStore_PutDeduplicates(t *testing.T) {
+	ctx := context.Background()
+	mock := testutil.NewMockStorage()
+	store := cas.New(mock, cas.Options{TempDir: t.TempDir()})
+
+	first, err := store.PutBytes(ctx, []byte("artifact"), &storagex.PutOptions{ContentType: "application/zip"})
+	require.NoError(t, err)
+	assert.False(t, first.Deduplicated)
+	assert.Equal(t, int64(len("artifact")), first.Size)
+
+	d := string(first.Digest)
+	key := "sha256/" + d[:2] + "/" + d[2:4] + "/" + d
+	assert.Equal(t, key, store.Key(first.Digest))
+	head, err := mock.Head(ctx, key)
+	require.NoError(t, err)
+	assert.Equal(t, "application/zip", head.ContentType)
+
+	// The same content from a stream is not uploaded again
+	second, err := store.Put(ctx, strings.NewReader("artifact"), nil)
+	require.NoError(t, err)
+	assert.True(t, second.Deduplicated)
+	assert.Equal(t, first.Digest, second.Digest)
+
+	ok, err := store.Has(ctx, first.Digest)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = store.Has(ctx, cas.DigestOf([]byte("other")))
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	data, err := store.GetBytes(ctx, first.Digest)
+	require.NoError(t, err)
+	assert.Equal(t, "artifact", string(data))
+}
+
+func TestStore_ConcurrentPutsUploadOnce(t *testing.T) {
+	ctx := context.Background()
+	mock := testutil.NewMockStorage()
+	store := cas.New(mock, cas.Options{})
+
+	var uploaded atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := store.PutBytes(ctx, []byte("shared layer"), nil)
+			assert.NoError(t, err)
+			if !res.Deduplicated {
+				uploaded.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), uploaded.Load())
+}
+
+func TestStore_WithoutConditionalWrites(t *testing.T) {
+	ctx := context.Background()
+	mock := testutil.NewMockStorage()
+	store := cas.New(testutil.PlainStorage{Storage: mock}, cas.Options{MultipartThreshold: 8})
+
+	// Above the threshold, blobs are uploaded with multipart
+	large := bytes.Repeat([]byte("x"), 64)
+	res, err := store.PutBytes(ctx, large, nil)
+	require.NoError(t, err)
+	assert.False(t, res.Deduplicated)
+	res, err = store.PutBytes(ctx, large, nil)
+	require.NoError(t, err)
+	assert.True(t, res.Deduplicated)
+
+	data, err := store.GetBytes(ctx, res.Digest)
+	require.NoError(t, err)
+	assert.Equal(t, large, data)
+}
+
+func TestStore_GetVerifiesDigest(t *testing.T) {
+	ctx := context.Background()
+	mock := testutil.NewMockStorage()
+	store := cas.New(mock, cas.Options{})
+
+	res, err := store.PutBytes(ctx, []byte("original"), nil)
+	require.NoError(t, err)
+
+	// Corrupt the blob behind the store's back
+	_, err = mock.PutBytes(ctx, store.Key(res.Digest), []byte("tampered"), nil)
+	require.NoError(t, err)
+
+	_, err = store.GetBytes(ctx, res.Digest)
+	assert.ErrorIs(t, err, cas.ErrDigestMismatch)
+
+	_, _, err = store.Get(ctx, "not-a-digest")
+	assert.ErrorIs(t, err, storagex.ErrInvalidKey)
+	_, err = store.GetBytes(ctx, cas.DigestOf([]byte("absent")))
+	assert.True(t, storagex.IsNotFound(err))
+}
+
+func TestStore_GC(t *testing.T) {
+	ctx := context.Background()
+	mock := testutil.NewMockStorage()
+	now := time.Now()
+	store := cas.New(mock, cas.Options{Clock: func() time.Time { return now }})
+
+	put := func(data string) cas.Digest {
+		res, err := store.PutBytes(ctx, []byte(data), nil)
+		require.NoError(t, err)
+		return res.Digest
+	}
+	a, b, shared, orphan := put("a"), put("b"), put("shared"), put("orphan")
+	absent := cas.DigestOf([]byte("never stored"))
+
+	// Manifests are blobs listing other blobs
+	manifest := func(refs ...cas.Digest) cas.Digest {
+		data, err := json.Marshal(refs)
+		require.NoError(t, err)
+		return put(string(data))
+	}
+	m1 := manifest(a, shared)
+	m2 := manifest(b, shared, absent)
+	oldManifest := manifest(orphan)
+
+	// Keys under the prefix outside the blob layout are left alone
+	_, err := mock.PutBytes(ctx, "sha256/README", []byte("not a blob"), nil)
+	require.NoError(t, err)
+
+	references := func(ctx context.Context, d cas.Digest) ([]cas.Digest, error) {
+		if d != m1 && d != m2 && d != oldManifest {
+			return nil, nil
+		}
+		data, err := store.GetBytes(ctx, d)
+		if err != nil {
+			return nil, err
+		}
+		var refs []cas.Digest
+		return refs, json.Unmarshal(data, &refs)
+	}
+	opts := cas.GCOptions{Roots: []cas.Digest{m1, m2}, References: references}
+
+	// Everything is within the grace period
+	report, err := store.GC(ctx, opts)
+	require.NoError(t, err)
+	assert.Empty(t, report.Deleted)
+
+	now = now.Add(2 * time.Hour)
+	opts.DryRun = true
+	report, err = store.GC(ctx, opts)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []cas.Digest{orphan, oldManifest}, report.Deleted)
+	ok, err := store.Has(ctx, orphan)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	opts.DryRun = false
+	report, err = store.GC(ctx, opts)
+	require.NoError(t, err)
+	assert.Equal(t, 7, report.Scanned)
+	assert.ElementsMatch(t, []cas.Digest{orphan, oldManifest}, report.Deleted)
+	assert.Equal(t, int64(len("orphan"))+int64(len(`["`+string(orphan)+`"]`)), report.Freed)
+	assert.Equal(t, []cas.Digest{absent}, report.Missing)
+	assert.Equal(t, 2, report.RefCounts[shared])
+	assert.Equal(t, 1, report.RefCounts[a])
+	assert.Equal(t, 1, report.RefCounts[m1])
+
+	for _, d := range []cas.Digest{a, b, shared, m1, m2} {
+		ok, err := store.Has(ctx, d)
+		require.NoError(t, err)
+		assert.True(t, ok, d)
+	}
+	for _, d := range []cas.Digest{orphan, oldManifest} {
+		ok, err := store.Has(ctx, d)
+		require.NoError(t, err)
+		assert.False(t, ok, d)
+	}
+	_, err = mock.Head(ctx, "sha256/README")
+	assert.NoError(t, err)
+
+	// An invalid root aborts GC before anything is deleted
+	_, err = store.GC(ctx, cas.GCOptions{Roots: []cas.Digest{"bogus"}})
+	assert.ErrorIs(t, err, storagex.ErrInvalidKey)
+	ok, err = store.Has(ctx, a)
+	require.NoError(t, err)
+	assert.True(t, ok)
+}
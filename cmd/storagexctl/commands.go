@@ -0,0 +1,637 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gostratum/storagex"
+	"github.com/gostratum/storagex/sync"
+)
+
+// cli holds the storage and output streams shared by all commands
+type cli struct {
+	storage  storagex.Storage
+	stdout   io.Writer
+	stderr   io.Writer
+	partSize int64
+
+	// instance opens a named storage instance (storage.instances.<name>)
+	instance func(ctx context.Context, name string) (storagex.Storage, error)
+}
+
+// dispatch runs the named command
+func (c *cli) dispatch(ctx context.Context, name string, args []string) error {
+	commands := map[string]func(context.Context, []string) error{
+		"ls":        c.ls,
+		"stat":      c.stat,
+		"cat":       c.cat,
+		"cp":        c.cp,
+		"mv":        c.mv,
+		"rm":        c.rm,
+		"presign":   c.presign,
+		"multipart": c.multipart,
+		"sync":      c.sync,
+		"reconcile": c.reconcile,
+	}
+
+	cmd, ok := commands[name]
+	if !ok {
+		return fmt.Errorf("%w: unknown command %q", errUsage, name)
+	}
+	return cmd(ctx, args)
+}
+
+func (c *cli) flags(name, usage string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(c.stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(c.stderr, "Usage: storagexctl %s %s\n", name, usage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parseArgs parses flags and checks the positional argument count
+func parseArgs(fs *flag.FlagSet, args []string, min, max int) error {
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() < min || fs.NArg() > max {
+		fs.Usage()
+		return errUsage
+	}
+	return nil
+}
+
+func (c *cli) ls(ctx context.Context, args []string) error {
+	fs := c.flags("ls", "[-r] [remote:prefix]")
+	recursive := fs.Bool("r", false, "list recursively instead of one level")
+	if err := parseArgs(fs, args, 0, 1); err != nil {
+		return err
+	}
+
+	prefix := ""
+	if fs.NArg() == 1 {
+		var err error
+		if prefix, err = remoteArg(fs.Arg(0)); err != nil {
+			return err
+		}
+	}
+
+	opts := storagex.ListOptions{Prefix: prefix}
+	if !*recursive {
+		opts.Delimiter = "/"
+	}
+
+	for {
+		page, err := c.storage.List(ctx, opts)
+		if err != nil {
+			return err
+		}
+		for _, p := range page.CommonPrefixes {
+			fmt.Fprintf(c.stdout, "%25s %12s  %s\n", "", "PRE", p)
+		}
+		for _, obj := range page.Keys {
+			fmt.Fprintf(c.stdout, "%25s %12d  %s\n", obj.LastModified.UTC().Format(time.RFC3339), obj.Size, obj.Key)
+		}
+		if !page.IsTruncated || page.NextToken == "" {
+			return nil
+		}
+		opts.ContinuationToken = page.NextToken
+	}
+}
+
+func (c *cli) stat(ctx context.Context, args []string) error {
+	fs := c.flags("stat", "remote:key")
+	if err := parseArgs(fs, args, 1, 1); err != nil {
+		return err
+	}
+	key, err := remoteArg(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	stat, err := c.storage.Head(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(c.stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(stat)
+}
+
+func (c *cli) cat(ctx context.Context, args []string) error {
+	fs := c.flags("cat", "remote:key")
+	if err := parseArgs(fs, args, 1, 1); err != nil {
+		return err
+	}
+	key, err := remoteArg(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	reader, _, err := c.storage.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	_, err = io.Copy(c.stdout, reader)
+	return err
+}
+
+func (c *cli) cp(ctx context.Context, args []string) error {
+	fs := c.flags("cp", "<src> <dst>")
+	if err := parseArgs(fs, args, 2, 2); err != nil {
+		return err
+	}
+	_, err := c.copy(ctx, parseLocation(fs.Arg(0)), parseLocation(fs.Arg(1)))
+	return err
+}
+
+func (c *cli) mv(ctx context.Context, args []string) error {
+	fs := c.flags("mv", "<src> <dst>")
+	if err := parseArgs(fs, args, 2, 2); err != nil {
+		return err
+	}
+
+	src := parseLocation(fs.Arg(0))
+	if _, err := c.copy(ctx, src, parseLocation(fs.Arg(1))); err != nil {
+		return err
+	}
+	if src.remote {
+		return c.storage.Delete(ctx, src.path)
+	}
+	return os.Remove(src.path)
+}
+
+// copy copies a single object or file and returns the resolved destination.
+// A destination ending in "/" (or an existing local directory) receives the
+// source's base name.
+func (c *cli) copy(ctx context.Context, src, dst location) (location, error) {
+	if !src.remote && !dst.remote {
+		return dst, fmt.Errorf("%w: at least one of src and dst must be %s<key>", errUsage, remoteScheme)
+	}
+	if src.path == "" {
+		return dst, fmt.Errorf("%w: empty source path", errUsage)
+	}
+
+	dst = resolveDestination(src, dst)
+
+	var err error
+	switch {
+	case !src.remote:
+		err = c.upload(ctx, src.path, dst.path)
+	case !dst.remote:
+		err = c.download(ctx, src.path, dst.path)
+	default:
+		err = c.copyRemote(ctx, src.path, dst.path)
+	}
+	if err != nil {
+		return dst, err
+	}
+
+	fmt.Fprintf(c.stdout, "%s -> %s\n", src, dst)
+	return dst, nil
+}
+
+func resolveDestination(src, dst location) location {
+	base := path.Base(src.path)
+	if !src.remote {
+		base = filepath.Base(src.path)
+	}
+
+	if dst.remote {
+		if dst.path == "" || strings.HasSuffix(dst.path, "/") {
+			dst.path += base
+		}
+		return dst
+	}
+
+	if info, err := os.Stat(dst.path); (err == nil && info.IsDir()) || strings.HasSuffix(dst.path, string(os.PathSeparator)) {
+		dst.path = filepath.Join(dst.path, base)
+	}
+	return dst
+}
+
+// upload stores a local file, switching to multipart above the part size
+func (c *cli) upload(ctx context.Context, localPath, key string) error {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%w: %s is a directory (use sync)", errUsage, localPath)
+	}
+
+	opts := &storagex.PutOptions{
+		ContentType: mime.TypeByExtension(filepath.Ext(localPath)),
+		Overwrite:   true,
+	}
+	return c.put(ctx, key, f, info.Size(), opts)
+}
+
+func (c *cli) put(ctx context.Context, key string, r io.Reader, size int64, opts *storagex.PutOptions) error {
+	var err error
+	if size > c.partSize {
+		_, err = c.storage.MultipartUpload(ctx, key, r, &storagex.MultipartConfig{PartSizeBytes: c.partSize}, opts)
+	} else {
+		_, err = c.storage.Put(ctx, key, r, opts)
+	}
+	return err
+}
+
+// download writes an object to a local file via a temporary file, so an
+// interrupted download never leaves a truncated file behind
+func (c *cli) download(ctx context.Context, key, localPath string) error {
+	reader, _, err := c.storage.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	if dir := filepath.Dir(localPath); dir != "." {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(localPath), "."+filepath.Base(localPath)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, reader); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), localPath)
+}
+
+func (c *cli) copyRemote(ctx context.Context, srcKey, dstKey string) error {
+	reader, stat, err := c.storage.Get(ctx, srcKey)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	return c.put(ctx, dstKey, reader, stat.Size, &storagex.PutOptions{
+		ContentType: stat.ContentType,
+		Metadata:    stat.Metadata,
+		Overwrite:   true,
+	})
+}
+
+func (c *cli) rm(ctx context.Context, args []string) error {
+	fs := c.flags("rm", "[-r] [-dry-run] remote:key-or-prefix")
+	recursive := fs.Bool("r", false, "delete every object under the prefix")
+	dryRun := fs.Bool("dry-run", false, "print what would be deleted without deleting")
+	if err := parseArgs(fs, args, 1, 1); err != nil {
+		return err
+	}
+	key, err := remoteArg(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if key == "" {
+		return fmt.Errorf("%w: refusing to delete the whole base prefix; name a key or sub-prefix", errUsage)
+	}
+
+	if !*recursive {
+		if *dryRun {
+			fmt.Fprintf(c.stdout, "would delete %s\n", key)
+			return nil
+		}
+		return c.storage.Delete(ctx, key)
+	}
+
+	objects, err := c.listAll(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(objects))
+	for _, obj := range objects {
+		keys = append(keys, obj.Key)
+	}
+	return c.deleteKeys(ctx, keys, *dryRun)
+}
+
+// deleteKeys removes keys in DeleteBatch-sized chunks and reports failures
+func (c *cli) deleteKeys(ctx context.Context, keys []string, dryRun bool) error {
+	if dryRun {
+		for _, key := range keys {
+			fmt.Fprintf(c.stdout, "would delete %s\n", key)
+		}
+		return nil
+	}
+
+	var failed []string
+	for start := 0; start < len(keys); start += storagex.DeleteBatchSize {
+		end := min(start+storagex.DeleteBatchSize, len(keys))
+		batchFailed, err := c.storage.DeleteBatch(ctx, keys[start:end])
+		if err != nil {
+			return err
+		}
+		failed = append(failed, batchFailed...)
+	}
+
+	for _, key := range failed {
+		fmt.Fprintf(c.stderr, "failed to delete %s\n", key)
+	}
+	fmt.Fprintf(c.stdout, "deleted %d objects\n", len(keys)-len(failed))
+	if len(failed) > 0 {
+		return fmt.Errorf("%d deletes failed", len(failed))
+	}
+	return nil
+}
+
+// listAll returns every object under prefix
+func (c *cli) listAll(ctx context.Context, prefix string) ([]storagex.Stat, error) {
+	var objects []storagex.Stat
+	opts := storagex.ListOptions{Prefix: prefix}
+	for {
+		page, err := c.storage.List(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, page.Keys...)
+		if !page.IsTruncated || page.NextToken == "" {
+			return objects, nil
+		}
+		opts.ContinuationToken = page.NextToken
+	}
+}
+
+func (c *cli) presign(ctx context.Context, args []string) error {
+	fs := c.flags("presign", "[-method get|put] [-expiry 15m] [-filename name] remote:key")
+	method := fs.String("method", "get", "HTTP method to presign (get or put)")
+	expiry := fs.Duration("expiry", 15*time.Minute, "URL lifetime")
+	filename := fs.String("filename", "", "download filename (get only)")
+	contentType := fs.String("content-type", "", "required Content-Type (put) or response Content-Type (get)")
+	if err := parseArgs(fs, args, 1, 1); err != nil {
+		return err
+	}
+	key, err := remoteArg(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	opts := &storagex.PresignOptions{
+		Expiry:      *expiry,
+		ContentType: *contentType,
+	}
+
+	var url string
+	switch strings.ToLower(*method) {
+	case "get":
+		if *filename != "" {
+			opts.ResponseContentDisposition = storagex.ContentDispositionAttachment(*filename)
+		}
+		url, err = c.storage.PresignGet(ctx, key, opts)
+	case "put":
+		url, err = c.storage.PresignPut(ctx, key, opts)
+	default:
+		return fmt.Errorf("%w: unsupported method %q", errUsage, *method)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(c.stdout, url)
+	return nil
+}
+
+func (c *cli) multipart(ctx context.Context, args []string) error {
+	lister, ok := c.storage.(storagex.MultipartLister)
+	if !ok {
+		return fmt.Errorf("storage does not support listing multipart uploads")
+	}
+	if len(args) == 0 {
+		return fmt.Errorf("%w: multipart requires list or abort", errUsage)
+	}
+
+	switch args[0] {
+	case "list":
+		fs := c.flags("multipart list", "[remote:prefix]")
+		if err := parseArgs(fs, args[1:], 0, 1); err != nil {
+			return err
+		}
+		prefix, err := optionalRemoteArg(fs)
+		if err != nil {
+			return err
+		}
+
+		uploads, err := lister.ListMultipartUploads(ctx, prefix)
+		if err != nil {
+			return err
+		}
+		for _, upload := range uploads {
+			fmt.Fprintf(c.stdout, "%25s  %s  %s\n", upload.Initiated.UTC().Format(time.RFC3339), upload.UploadID, upload.Key)
+		}
+		return nil
+
+	case "abort":
+		fs := c.flags("multipart abort", "remote:key <upload-id> | -older-than 24h [remote:prefix]")
+		olderThan := fs.Duration("older-than", 0, "abort every upload initiated longer ago than this")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+
+		if *olderThan == 0 {
+			if fs.NArg() != 2 {
+				fs.Usage()
+				return errUsage
+			}
+			key, err := remoteArg(fs.Arg(0))
+			if err != nil {
+				return err
+			}
+			return c.storage.AbortMultipart(ctx, key, fs.Arg(1))
+		}
+
+		if fs.NArg() > 1 {
+			fs.Usage()
+			return errUsage
+		}
+		prefix, err := optionalRemoteArg(fs)
+		if err != nil {
+			return err
+		}
+
+		uploads, err := lister.ListMultipartUploads(ctx, prefix)
+		if err != nil {
+			return err
+		}
+		cutoff := time.Now().Add(-*olderThan)
+		for _, upload := range uploads {
+			if upload.Initiated.After(cutoff) {
+				continue
+			}
+			if err := c.storage.AbortMultipart(ctx, upload.Key, upload.UploadID); err != nil {
+				return err
+			}
+			fmt.Fprintf(c.stdout, "aborted %s %s\n", upload.UploadID, upload.Key)
+		}
+		return nil
+
+	default:
+		return fmt.Errorf("%w: unknown multipart command %q", errUsage, args[0])
+	}
+}
+
+func optionalRemoteArg(fs *flag.FlagSet) (string, error) {
+	if fs.NArg() == 0 {
+		return "", nil
+	}
+	return remoteArg(fs.Arg(0))
+}
+
+// sync mirrors a source to a destination with the sync package
+func (c *cli) sync(ctx context.Context, args []string) error {
+	fs := c.flags("sync", "[flags] <src> <dst>")
+	deleteExtra := fs.Bool("delete", false, "delete destination entries missing from the source")
+	dryRun := fs.Bool("dry-run", false, "print the plan without applying it")
+	checksum := fs.Bool("checksum", false, "compare MD5 checksums instead of size and modification time")
+	concurrency := fs.Int("concurrency", sync.DefaultConcurrency, "files copied in parallel")
+	manifest := fs.String("manifest", "", "local progress file that lets an interrupted sync resume")
+	var include, exclude globList
+	fs.Var(&include, "include", "only sync paths matching this glob (repeatable)")
+	fs.Var(&exclude, "exclude", "skip paths matching this glob (repeatable)")
+	if err := parseArgs(fs, args, 2, 2); err != nil {
+		return err
+	}
+
+	src, dst := parseLocation(fs.Arg(0)), parseLocation(fs.Arg(1))
+	if !src.remote && !dst.remote {
+		return fmt.Errorf("%w: at least one of src and dst must be %s<prefix>", errUsage, remoteScheme)
+	}
+
+	opts := sync.Options{
+		Delete:             *deleteExtra,
+		Include:            include,
+		Exclude:            exclude,
+		DryRun:             *dryRun,
+		Concurrency:        *concurrency,
+		MultipartThreshold: c.partSize,
+		PartSize:           c.partSize,
+		ManifestPath:       *manifest,
+	}
+	if *checksum {
+		opts.Compare = sync.CompareChecksum
+	}
+
+	result, err := sync.Sync(ctx, c.endpoint(src), c.endpoint(dst), opts)
+	if result != nil && *dryRun {
+		if planErr := result.WritePlan(c.stdout); planErr != nil {
+			return planErr
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	if !*dryRun {
+		fmt.Fprintf(c.stdout, "copied %d (%d bytes), deleted %d, unchanged %d\n",
+			result.Copied, result.BytesCopied, result.Deleted, result.Skipped)
+	}
+	return nil
+}
+
+func (c *cli) endpoint(loc location) sync.Endpoint {
+	if loc.remote {
+		return sync.Remote(c.storage, loc.path)
+	}
+	return sync.Local(loc.path)
+}
+
+// globList is a repeatable string flag
+type globList []string
+
+func (g *globList) String() string {
+	return strings.Join(*g, ",")
+}
+
+func (g *globList) Set(value string) error {
+	*g = append(*g, value)
+	return nil
+}
+
+// reconcile diffs two storages by size and ETag and repairs the second
+func (c *cli) reconcile(ctx context.Context, args []string) error {
+	fs := c.flags("reconcile", "-to instance [flags] [remote:prefix]")
+	from := fs.String("from", "", "primary storage instance (default: the top-level storage)")
+	to := fs.String("to", "", "secondary storage instance to repair")
+	deleteExtra := fs.Bool("delete", false, "delete secondary objects missing from the primary")
+	dryRun := fs.Bool("dry-run", false, "print the differences without repairing them")
+	ignoreETag := fs.Bool("ignore-etag", false, "compare sizes only (for providers with different ETags)")
+	concurrency := fs.Int("concurrency", 4, "objects repaired in parallel")
+	if err := parseArgs(fs, args, 0, 1); err != nil {
+		return err
+	}
+	if *to == "" {
+		fs.Usage()
+		return fmt.Errorf("%w: -to is required", errUsage)
+	}
+	prefix, err := optionalRemoteArg(fs)
+	if err != nil {
+		return err
+	}
+
+	primary := c.storage
+	if *from != "" {
+		if primary, err = c.instance(ctx, *from); err != nil {
+			return err
+		}
+	}
+	secondary, err := c.instance(ctx, *to)
+	if err != nil {
+		return err
+	}
+
+	report, err := storagex.Reconcile(ctx, primary, secondary, storagex.ReconcileOptions{
+		Prefix:      prefix,
+		Delete:      *deleteExtra,
+		IgnoreETag:  *ignoreETag,
+		DryRun:      *dryRun,
+		Concurrency: *concurrency,
+	})
+	if report == nil {
+		return err
+	}
+
+	if *dryRun {
+		for _, key := range report.Missing {
+			fmt.Fprintf(c.stdout, "missing  %s\n", key)
+		}
+		for _, key := range report.Changed {
+			fmt.Fprintf(c.stdout, "changed  %s\n", key)
+		}
+		for _, key := range report.Extra {
+			fmt.Fprintf(c.stdout, "extra    %s\n", key)
+		}
+	}
+	fmt.Fprintf(c.stdout, "missing %d, changed %d, extra %d, unchanged %d; copied %d, deleted %d\n",
+		len(report.Missing), len(report.Changed), len(report.Extra), report.Unchanged, report.Copied, report.Deleted)
+	return err
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/gostratum/storagex"
+	"github.com/gostratum/storagex/internal/testutil"
+)
+
+func newTestCLI(storage storagex.Storage) (*cli, *bytes.Buffer) {
+	var stdout bytes.Buffer
+	return &cli{
+		storage:  storage,
+		stdout:   &stdout,
+		stderr:   &bytes.Buffer{},
+		partSize: 5 << 20,
+	}, &stdout
+}
+
+func seed(t *testing.T, storage *testutil.MockStorage, objects map[string]string) {
+	t.Helper()
+	for key, body := range objects {
+		_, err := storage.PutBytes(context.Background(), key, []byte(body), &storagex.PutOptions{Overwrite: true})
+		require.NoError(t, err)
+	}
+}
+
+func exists(t *testing.T, storage storagex.Storage, key string) bool {
+	t.Helper()
+	_, err := storage.Head(context.Background(), key)
+	if storagex.IsNotFound(err) {
+		return false
+	}
+	require.NoError(t, err)
+	return true
+}
+
+func objectCount(t *testing.T, storage storagex.Storage) int {
+	t.Helper()
+	page, err := storage.List(context.Background(), storagex.ListOptions{})
+	require.NoError(t, err)
+	return len(page.Keys)
+}
+
+func TestCLI_Ls(t *testing.T) {
+	storage := testutil.NewMockStorage()
+	seed(t, storage, map[string]string{"a.txt": "a", "dir/b.txt": "bb", "dir/sub/c.txt": "ccc"})
+	c, out := newTestCLI(storage)
+	ctx := context.Background()
+
+	require.NoError(t, c.dispatch(ctx, "ls", nil))
+	assert.Contains(t, out.String(), "PRE  dir/")
+	assert.Contains(t, out.String(), "a.txt")
+	assert.NotContains(t, out.String(), "dir/b.txt")
+
+	out.Reset()
+	require.NoError(t, c.dispatch(ctx, "ls", []string{"-r", "remote:dir/"}))
+	assert.Contains(t, out.String(), "dir/b.txt")
+	assert.Contains(t, out.String(), "dir/sub/c.txt")
+
+	assert.ErrorIs(t, c.dispatch(ctx, "ls", []string{"dir/"}), errUsage)
+}
+
+func TestCLI_StatAndCat(t *testing.T) {
+	storage := testutil.NewMockStorage()
+	seed(t, storage, map[string]string{"hello.txt": "hello world"})
+	c, out := newTestCLI(storage)
+	ctx := context.Background()
+
+	require.NoError(t, c.dispatch(ctx, "cat", []string{"remote:hello.txt"}))
+	assert.Equal(t, "hello world", out.String())
+
+	out.Reset()
+	require.NoError(t, c.dispatch(ctx, "stat", []string{"remote:hello.txt"}))
+	assert.Contains(t, out.String(), `"Size": 11`)
+
+	assert.True(t, storagex.IsNotFound(c.dispatch(ctx, "stat", []string{"remote:missing"})))
+}
+
+func TestCLI_CopyAndMove(t *testing.T) {
+	storage := testutil.NewMockStorage()
+	c, _ := newTestCLI(storage)
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	local := filepath.Join(dir, "report.json")
+	require.NoError(t, os.WriteFile(local, []byte(`{"ok":true}`), 0o644))
+
+	// local -> remote prefix keeps the file name
+	require.NoError(t, c.dispatch(ctx, "cp", []string{local, "remote:reports/"}))
+	stat, err := storage.Head(ctx, "reports/report.json")
+	require.NoError(t, err)
+	assert.Equal(t, "application/json", stat.ContentType)
+
+	// remote -> remote
+	require.NoError(t, c.dispatch(ctx, "cp", []string{"remote:reports/report.json", "remote:archive/r.json"}))
+	assert.True(t, exists(t, storage, "archive/r.json"))
+
+	// remote -> local directory
+	downloads := filepath.Join(dir, "downloads")
+	require.NoError(t, os.Mkdir(downloads, 0o755))
+	require.NoError(t, c.dispatch(ctx, "mv", []string{"remote:archive/r.json", downloads}))
+	data, err := os.ReadFile(filepath.Join(downloads, "r.json"))
+	require.NoError(t, err)
+	assert.Equal(t, `{"ok":true}`, string(data))
+	assert.False(t, exists(t, storage, "archive/r.json"))
+
+	assert.ErrorIs(t, c.dispatch(ctx, "cp", []string{local, filepath.Join(dir, "x")}), errUsage)
+}
+
+func TestCLI_CopyLargeFileUsesMultipart(t *testing.T) {
+	storage := testutil.NewMockStorage()
+	c, _ := newTestCLI(storage)
+	ctx := context.Background()
+
+	local := filepath.Join(t.TempDir(), "big.bin")
+	require.NoError(t, os.WriteFile(local, bytes.Repeat([]byte("x"), 6<<20), 0o644))
+
+	require.NoError(t, c.dispatch(ctx, "cp", []string{local, "remote:big.bin"}))
+	stat, err := storage.Head(ctx, "big.bin")
+	require.NoError(t, err)
+	assert.Equal(t, int64(6<<20), stat.Size)
+}
+
+func TestCLI_Rm(t *testing.T) {
+	storage := testutil.NewMockStorage()
+	seed(t, storage, map[string]string{"logs/1": "1", "logs/2": "2", "keep": "k"})
+	c, out := newTestCLI(storage)
+	ctx := context.Background()
+
+	require.NoError(t, c.dispatch(ctx, "rm", []string{"-r", "-dry-run", "remote:logs/"}))
+	assert.Contains(t, out.String(), "would delete logs/1")
+	assert.Equal(t, 3, objectCount(t, storage))
+
+	require.NoError(t, c.dispatch(ctx, "rm", []string{"-r", "remote:logs/"}))
+	assert.Equal(t, 1, objectCount(t, storage))
+
+	require.NoError(t, c.dispatch(ctx, "rm", []string{"remote:keep"}))
+	assert.Equal(t, 0, objectCount(t, storage))
+
+	assert.ErrorIs(t, c.dispatch(ctx, "rm", []string{"-r", "remote:"}), errUsage)
+}
+
+func TestCLI_Presign(t *testing.T) {
+	c, out := newTestCLI(testutil.NewMockStorage())
+
+	require.NoError(t, c.dispatch(context.Background(), "presign", []string{"-filename", "Q1 report.pdf", "remote:reports/q1.pdf"}))
+	assert.Contains(t, out.String(), "response-content-disposition=attachment")
+
+	assert.ErrorIs(t, c.dispatch(context.Background(), "presign", []string{"-method", "delete", "remote:x"}), errUsage)
+}
+
+func TestCLI_Multipart(t *testing.T) {
+	storage := testutil.NewMockStorage()
+	c, out := newTestCLI(storage)
+	ctx := context.Background()
+
+	first, err := storage.CreateMultipart(ctx, "videos/a.mp4", nil)
+	require.NoError(t, err)
+	_, err = storage.CreateMultipart(ctx, "videos/b.mp4", nil)
+	require.NoError(t, err)
+
+	require.NoError(t, c.dispatch(ctx, "multipart", []string{"list", "remote:videos/"}))
+	assert.Contains(t, out.String(), first)
+
+	require.NoError(t, c.dispatch(ctx, "multipart", []string{"abort", "remote:videos/a.mp4", first}))
+	uploads, err := storage.ListMultipartUploads(ctx, "")
+	require.NoError(t, err)
+	require.Len(t, uploads, 1)
+
+	require.NoError(t, c.dispatch(ctx, "multipart", []string{"abort", "-older-than", "1ns"}))
+	uploads, err = storage.ListMultipartUploads(ctx, "")
+	require.NoError(t, err)
+	assert.Empty(t, uploads)
+}
+
+func TestCLI_Sync(t *testing.T) {
+	storage := testutil.NewMockStorage()
+	seed(t, storage, map[string]string{"backup/stale.txt": "old", "backup/same.txt": "same"})
+	c, out := newTestCLI(storage)
+	ctx := context.Background()
+
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "nested"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "same.txt"), []byte("same"), 0o644))
+	past := time.Now().Add(-time.Hour)
+	require.NoError(t, os.Chtimes(filepath.Join(dir, "same.txt"), past, past))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "nested", "new.txt"), []byte("new"), 0o644))
+
+	require.NoError(t, c.dispatch(ctx, "sync", []string{"-delete", "-dry-run", dir, "remote:backup"}))
+	assert.Contains(t, out.String(), "copy nested/new.txt (3 bytes, new)")
+	assert.Contains(t, out.String(), "delete stale.txt (extraneous)")
+	assert.Equal(t, 2, objectCount(t, storage))
+
+	out.Reset()
+	require.NoError(t, c.dispatch(ctx, "sync", []string{"-delete", "-exclude", "*.tmp", dir, "remote:backup"}))
+	assert.Contains(t, out.String(), "copied 1 (3 bytes), deleted 1, unchanged 1")
+	assert.True(t, exists(t, storage, "backup/nested/new.txt"))
+	assert.True(t, exists(t, storage, "backup/same.txt"))
+	assert.False(t, exists(t, storage, "backup/stale.txt"))
+
+	restore := filepath.Join(t.TempDir(), "restore")
+	require.NoError(t, c.dispatch(ctx, "sync", []string{"remote:backup/", restore}))
+	data, err := os.ReadFile(filepath.Join(restore, "nested", "new.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "new", string(data))
+}
+
+func TestCLI_Reconcile(t *testing.T) {
+	primary := testutil.NewMockStorage()
+	secondary := testutil.NewMockStorage()
+	seed(t, primary, map[string]string{"docs/a.txt": "alpha", "docs/b.txt": "bravo", "other.txt": "other"})
+	seed(t, secondary, map[string]string{"docs/a.txt": "alpha", "docs/b.txt": "bravo-old", "docs/stale.txt": "stale"})
+	c, out := newTestCLI(primary)
+	c.instance = func(_ context.Context, name string) (storagex.Storage, error) {
+		if name != "dr" {
+			return nil, storagex.ErrUnknownInstance
+		}
+		return secondary, nil
+	}
+	ctx := context.Background()
+
+	assert.ErrorIs(t, c.dispatch(ctx, "reconcile", []string{"remote:docs/"}), errUsage)
+	assert.ErrorIs(t, c.dispatch(ctx, "reconcile", []string{"-to", "nope"}), storagex.ErrUnknownInstance)
+
+	require.NoError(t, c.dispatch(ctx, "reconcile", []string{"-to", "dr", "-dry-run", "-delete", "remote:docs/"}))
+	assert.Contains(t, out.String(), "changed  docs/b.txt")
+	assert.Contains(t, out.String(), "extra    docs/stale.txt")
+	assert.NotContains(t, out.String(), "other.txt")
+	assert.True(t, exists(t, secondary, "docs/stale.txt"))
+
+	out.Reset()
+	require.NoError(t, c.dispatch(ctx, "reconcile", []string{"-to", "dr", "-delete", "remote:docs/"}))
+	assert.Contains(t, out.String(), "missing 0, changed 1, extra 1, unchanged 1; copied 1, deleted 1")
+	assert.False(t, exists(t, secondary, "docs/stale.txt"))
+	assert.False(t, exists(t, secondary, "other.txt"))
+}
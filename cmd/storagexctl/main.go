@@ -0,0 +1,158 @@
+// Command storagexctl is an operator CLI for storagex buckets.
+//
+// It loads the same storage.* configuration as services (via configx, so
+// base.yaml/{APP_ENV}.yaml and STRATUM_STORAGE_* environment variables apply)
+// and routes every key through the configured BasePrefix, so operators only
+// ever see and touch keys inside their own tenant's layout.
+//
+// Remote paths are written as "remote:<key>"; anything else is a local path.
+//
+// Usage:
+//
+//	storagexctl [global flags] <command> [flags] [args]
+//
+//	storagexctl ls [-r] [remote:prefix]
+//	storagexctl stat remote:key
+//	storagexctl cat remote:key
+//	storagexctl cp <src> <dst>
+//	storagexctl mv <src> <dst>
+//	storagexctl rm [-r] [-dry-run] remote:key-or-prefix
+//	storagexctl presign [-method get|put] [-expiry 15m] [-filename name] remote:key
+//	storagexctl multipart list [remote:prefix]
+//	storagexctl multipart abort remote:key <upload-id>
+//	storagexctl sync [-delete] [-dry-run] [-checksum] [-include glob] [-exclude glob] [-manifest file] <src> <dst>
+//	storagexctl reconcile -to instance [-from instance] [-delete] [-dry-run] [-ignore-etag] [remote:prefix]
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/gostratum/core/configx"
+	"github.com/gostratum/storagex"
+	"github.com/gostratum/storagex/adapters/s3"
+)
+
+// errUsage marks command-line usage errors (exit code 2)
+var errUsage = errors.New("usage error")
+
+func main() {
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	err := run(ctx, os.Args[1:], os.Stdout, os.Stderr)
+	switch {
+	case err == nil:
+	case errors.Is(err, errUsage), errors.Is(err, flag.ErrHelp):
+		os.Exit(2)
+	default:
+		fmt.Fprintf(os.Stderr, "storagexctl: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// run parses global flags, builds the storage and dispatches the command
+func run(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+	global := flag.NewFlagSet("storagexctl", flag.ContinueOnError)
+	global.SetOutput(stderr)
+	global.Usage = func() { printUsage(stderr, global) }
+
+	configPaths := global.String("config", "", "comma-separated config directories (default: CONFIG_PATHS or ./configs)")
+	envPrefix := global.String("env-prefix", "", "environment variable prefix (default: STRATUM)")
+	tenant := global.String("tenant", "", "tenant ID substituted into a templated base_prefix")
+
+	if err := global.Parse(args); err != nil {
+		return err
+	}
+	if global.NArg() == 0 {
+		global.Usage()
+		return errUsage
+	}
+
+	var opts []configx.Option
+	if *configPaths != "" {
+		opts = append(opts, configx.WithConfigPaths(strings.Split(*configPaths, ",")...))
+	}
+	if *envPrefix != "" {
+		opts = append(opts, configx.WithEnvPrefix(*envPrefix))
+	}
+
+	loader := configx.New(opts...)
+	cfg, err := storagex.NewConfig(loader)
+	if err != nil {
+		return err
+	}
+
+	kb, err := newTenantScope(cfg.BasePrefix, *tenant)
+	if err != nil {
+		return err
+	}
+
+	storage, err := s3.NewS3Storage(ctx, cfg, storagex.WithKeyBuilder(kb))
+	if err != nil {
+		return err
+	}
+	defer storage.Close()
+
+	// Named instances opened by commands are closed on return
+	var closers []func() error
+	defer func() {
+		for _, closeFn := range closers {
+			closeFn()
+		}
+	}()
+
+	c := &cli{
+		storage:  storage,
+		stdout:   stdout,
+		stderr:   stderr,
+		partSize: cfg.DefaultPartSize,
+	}
+	c.instance = func(ctx context.Context, name string) (storagex.Storage, error) {
+		icfg, err := storagex.NewInstanceConfig(loader, name)
+		if err != nil {
+			return nil, err
+		}
+		ikb, err := newTenantScope(icfg.BasePrefix, *tenant)
+		if err != nil {
+			return nil, err
+		}
+		istorage, err := s3.NewS3Storage(ctx, icfg, storagex.WithKeyBuilder(ikb))
+		if err != nil {
+			return nil, err
+		}
+		closers = append(closers, istorage.Close)
+		return istorage, nil
+	}
+	return c.dispatch(ctx, global.Arg(0), global.Args()[1:])
+}
+
+func printUsage(w io.Writer, global *flag.FlagSet) {
+	fmt.Fprint(w, `Usage: storagexctl [global flags] <command> [flags] [args]
+
+Commands:
+  ls         list objects under a prefix
+  stat       show object metadata
+  cat        write an object to stdout
+  cp         copy local<->remote or remote<->remote
+  mv         move (copy, then delete the source)
+  rm         delete an object, or every object under a prefix with -r
+  presign    generate a presigned GET or PUT URL
+  multipart  list or abort in-progress multipart uploads
+  sync       mirror a directory or prefix to another location
+  reconcile  diff two storage instances by size and ETag and repair the second
+
+Remote paths are written as "remote:<key>"; keys are relative to the
+configured base_prefix.
+
+Global flags:
+`)
+	global.PrintDefaults()
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// remoteScheme marks a command-line path as a storage key rather than a local path
+const remoteScheme = "remote:"
+
+// tenantScope is the KeyBuilder used by storagexctl. It resolves BasePrefix
+// once up front and then maps keys in both directions with a plain prefix, so
+// every listing, read and delete stays inside the resolved prefix.
+type tenantScope struct {
+	prefix string
+}
+
+// newTenantScope resolves basePrefix for the given tenant. A templated
+// prefix (containing {tenant_id}, {org_id} or %s) requires a tenant, since
+// running unscoped would expose every tenant's objects.
+func newTenantScope(basePrefix, tenant string) (*tenantScope, error) {
+	templated := strings.Contains(basePrefix, "{") || strings.Contains(basePrefix, "%s")
+
+	switch {
+	case templated && tenant == "":
+		return nil, fmt.Errorf("%w: base_prefix %q is templated; pass -tenant", errUsage, basePrefix)
+	case !templated && tenant != "":
+		return nil, fmt.Errorf("%w: -tenant given but base_prefix %q has no tenant placeholder", errUsage, basePrefix)
+	}
+
+	prefix := basePrefix
+	if templated {
+		prefix = strings.NewReplacer("{tenant_id}", tenant, "{org_id}", tenant, "%s", tenant).Replace(prefix)
+		if strings.Contains(prefix, "{") || strings.Contains(prefix, "%") {
+			return nil, fmt.Errorf("%w: base_prefix %q has placeholders storagexctl cannot resolve", errUsage, basePrefix)
+		}
+	}
+
+	prefix = strings.Trim(prefix, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+	return &tenantScope{prefix: prefix}, nil
+}
+
+// BuildKey prepends the resolved tenant prefix
+func (s *tenantScope) BuildKey(originalKey string, _ map[string]string) string {
+	return s.prefix + strings.TrimPrefix(originalKey, "/")
+}
+
+// StripKey removes the resolved tenant prefix
+func (s *tenantScope) StripKey(fullKey string) string {
+	return strings.TrimPrefix(fullKey, s.prefix)
+}
+
+// location is a parsed command-line path
+type location struct {
+	remote bool
+	path   string
+}
+
+func parseLocation(arg string) location {
+	if key, ok := strings.CutPrefix(arg, remoteScheme); ok {
+		return location{remote: true, path: strings.TrimPrefix(key, "/")}
+	}
+	return location{path: arg}
+}
+
+func (l location) String() string {
+	if l.remote {
+		return remoteScheme + l.path
+	}
+	return l.path
+}
+
+// remoteArg parses arg and requires it to be a remote path
+func remoteArg(arg string) (string, error) {
+	loc := parseLocation(arg)
+	if !loc.remote {
+		return "", fmt.Errorf("%w: expected %s<key>, got %q", errUsage, remoteScheme, arg)
+	}
+	return loc.path, nil
+}
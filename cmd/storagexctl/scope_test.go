@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewTenantScope(t *testing.T) {
+	tests := []struct {
+		name       string
+		basePrefix string
+		tenant     string
+		wantPrefix string
+		wantErr    bool
+	}{
+		{name: "no prefix", wantPrefix: ""},
+		{name: "static prefix", basePrefix: "app/data/", wantPrefix: "app/data/"},
+		{name: "braced template", basePrefix: "tenants/{tenant_id}", tenant: "acme", wantPrefix: "tenants/acme/"},
+		{name: "printf template", basePrefix: "org/%s", tenant: "acme", wantPrefix: "org/acme/"},
+		{name: "template without tenant", basePrefix: "org/{org_id}", wantErr: true},
+		{name: "tenant without template", basePrefix: "app", tenant: "acme", wantErr: true},
+		{name: "unresolvable placeholder", basePrefix: "org/{org_id}/ws/{workspace_id}", tenant: "acme", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scope, err := newTenantScope(tt.basePrefix, tt.tenant)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, errUsage)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantPrefix, scope.prefix)
+		})
+	}
+}
+
+func TestTenantScope_RoundTrip(t *testing.T) {
+	scope, err := newTenantScope("tenants/{tenant_id}", "acme")
+	require.NoError(t, err)
+
+	full := scope.BuildKey("reports/2024/q1.csv", nil)
+	assert.Equal(t, "tenants/acme/reports/2024/q1.csv", full)
+	assert.Equal(t, "reports/2024/q1.csv", scope.StripKey(full))
+	assert.Equal(t, "tenants/acme/", scope.BuildKey("", nil))
+}
+
+func TestParseLocation(t *testing.T) {
+	assert.Equal(t, location{remote: true, path: "a/b.txt"}, parseLocation("remote:/a/b.txt"))
+	assert.Equal(t, location{path: "./a/b.txt"}, parseLocation("./a/b.txt"))
+	assert.Equal(t, "remote:a/b.txt", parseLocation("remote:a/b.txt").String())
+}
@@ -0,0 +1,225 @@
+package storagex
+
+import (
+	"context"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"strings"
+	"sync"
+)
+
+// Codec encodes values to and decodes them from object content. Codecs for
+// formats outside the standard library (e.g., protobuf or msgpack) are
+// plugged in with RegisterCodec:
+//
+//	type protoCodec struct{}
+//
+//	func (protoCodec) ContentType() string { return "application/x-protobuf" }
+//
+//	func (protoCodec) Encode(w io.Writer, v any) error {
+//	    data, err := proto.Marshal(v.(proto.Message))
+//	    if err == nil {
+//	        _, err = w.Write(data)
+//	    }
+//	    return err
+//	}
+//
+//	func (protoCodec) Decode(r io.Reader, v any) error {
+//	    data, err := io.ReadAll(r)
+//	    if err == nil {
+//	        err = proto.Unmarshal(data, v.(proto.Message))
+//	    }
+//	    return err
+//	}
+//
+//	storagex.RegisterCodec(protoCodec{})
+type Codec interface {
+	// ContentType is the content type of encoded objects
+	ContentType() string
+
+	// Encode writes v to w
+	Encode(w io.Writer, v any) error
+
+	// Decode reads the value in r into v, a non-nil pointer
+	Decode(r io.Reader, v any) error
+}
+
+var (
+	// JSONCodec encodes values as JSON (application/json)
+	JSONCodec Codec = jsonCodec{}
+
+	// GobCodec encodes values with encoding/gob (application/x-gob)
+	GobCodec Codec = gobCodec{}
+)
+
+type jsonCodec struct{}
+
+func (jsonCodec) ContentType() string             { return "application/json" }
+func (jsonCodec) Encode(w io.Writer, v any) error { return json.NewEncoder(w).Encode(v) }
+func (jsonCodec) Decode(r io.Reader, v any) error { return json.NewDecoder(r).Decode(v) }
+
+type gobCodec struct{}
+
+func (gobCodec) ContentType() string             { return "application/x-gob" }
+func (gobCodec) Encode(w io.Writer, v any) error { return gob.NewEncoder(w).Encode(v) }
+func (gobCodec) Decode(r io.Reader, v any) error { return gob.NewDecoder(r).Decode(v) }
+
+var codecs = struct {
+	sync.RWMutex
+	byType map[string]Codec
+}{byType: map[string]Codec{
+	"application/json":  JSONCodec,
+	"application/x-gob": GobCodec,
+}}
+
+// RegisterCodec makes a codec available to GetValue by its content type,
+// replacing any codec registered for the same type. JSONCodec and GobCodec
+// are registered by default.
+func RegisterCodec(codec Codec) {
+	codecs.Lock()
+	defer codecs.Unlock()
+	codecs.byType[mediaType(codec.ContentType())] = codec
+}
+
+// CodecFor returns the codec registered for a content type. Parameters such
+// as charset are ignored.
+func CodecFor(contentType string) (Codec, bool) {
+	codecs.RLock()
+	defer codecs.RUnlock()
+	codec, ok := codecs.byType[mediaType(contentType)]
+	return codec, ok
+}
+
+func mediaType(contentType string) string {
+	if t, _, err := mime.ParseMediaType(contentType); err == nil {
+		return t
+	}
+	return strings.ToLower(strings.TrimSpace(contentType))
+}
+
+// PutValue encodes v with codec (JSONCodec if nil) and stores it at key.
+// The encoding is streamed to Storage.Put rather than buffered here, and
+// opts.ContentType defaults to the codec's content type. The returned
+// Stat.ETag can be passed to UpdateValue to replace the object only if
+// nobody changed it since.
+func PutValue[T any](ctx context.Context, s Storage, codec Codec, key string, v T, opts *PutOptions) (Stat, error) {
+	codec, opts = codecPutOptions(codec, opts)
+	return encodeTo(codec, "put_value", key, v, func(r io.Reader) (Stat, error) {
+		return s.Put(ctx, key, r, opts)
+	})
+}
+
+// UpdateValue is like PutValue but writes only if the object's current ETag
+// is etag, or, with an empty etag, only if the object does not exist. It
+// fails with ErrPreconditionFailed if the object changed, which callers
+// handle by reading it again and retrying:
+//
+//	for {
+//	    counter, stat, err := storagex.GetJSON[Counter](ctx, storage, key)
+//	    if err != nil {
+//	        return err
+//	    }
+//	    counter.Value++
+//	    _, err = storagex.UpdateJSON(ctx, storage, key, counter, stat.ETag, nil)
+//	    if !storagex.IsPreconditionFailed(err) {
+//	        return err
+//	    }
+//	}
+//
+// s (or a storage it wraps) must implement ConditionalWriter. Decorators
+// that change writes implement it themselves (cachestore invalidates,
+// MirrorStorage replicates), and count as supporting it only if the storage
+// they forward to does (see CapabilityForwarder), or do not expose the
+// storage they wrap (TieredStorage). Otherwise UpdateValue fails with
+// ErrInvalidConfig instead of writing around them.
+func UpdateValue[T any](ctx context.Context, s Storage, codec Codec, key string, v T, etag string, opts *PutOptions) (Stat, error) {
+	writer, ok := Capability[ConditionalWriter](s)
+	if !ok {
+		return Stat{}, &StorageError{Op: "update_value", Key: key, Err: fmt.Errorf("storage does not support conditional writes: %w", ErrInvalidConfig)}
+	}
+	codec, opts = codecPutOptions(codec, opts)
+	return encodeTo(codec, "update_value", key, v, func(r io.Reader) (Stat, error) {
+		if etag == "" {
+			return writer.PutIfAbsent(ctx, key, r, opts)
+		}
+		return writer.PutIfMatch(ctx, key, r, etag, opts)
+	})
+}
+
+// GetValue reads the object at key and decodes it with codec. With a nil
+// codec, the codec registered for the object's content type is used. The
+// returned Stat.ETag can be passed to UpdateValue.
+func GetValue[T any](ctx context.Context, s Storage, codec Codec, key string) (T, Stat, error) {
+	var v T
+	body, stat, err := s.Get(ctx, key)
+	if err != nil {
+		return v, stat, err
+	}
+	defer body.Close()
+
+	if codec == nil {
+		var ok bool
+		if codec, ok = CodecFor(stat.ContentType); !ok {
+			return v, stat, &StorageError{Op: "get_value", Key: key, Err: fmt.Errorf("no codec registered for content type %q: %w", stat.ContentType, ErrInvalidConfig)}
+		}
+	}
+	if err := codec.Decode(body, &v); err != nil {
+		return v, stat, &StorageError{Op: "get_value", Key: key, Err: fmt.Errorf("decode %s: %w", codec.ContentType(), err)}
+	}
+	return v, stat, nil
+}
+
+// PutJSON stores v as JSON at key. See PutValue.
+func PutJSON[T any](ctx context.Context, s Storage, key string, v T, opts *PutOptions) (Stat, error) {
+	return PutValue(ctx, s, JSONCodec, key, v, opts)
+}
+
+// UpdateJSON stores v as JSON at key if the object's ETag is still etag.
+// See UpdateValue.
+func UpdateJSON[T any](ctx context.Context, s Storage, key string, v T, etag string, opts *PutOptions) (Stat, error) {
+	return UpdateValue(ctx, s, JSONCodec, key, v, etag, opts)
+}
+
+// GetJSON reads the JSON object at key into a T. See GetValue.
+func GetJSON[T any](ctx context.Context, s Storage, key string) (T, Stat, error) {
+	return GetValue[T](ctx, s, JSONCodec, key)
+}
+
+// codecPutOptions defaults codec to JSONCodec and the content type of a copy
+// of opts to the codec's
+func codecPutOptions(codec Codec, opts *PutOptions) (Codec, *PutOptions) {
+	if codec == nil {
+		codec = JSONCodec
+	}
+	o := PutOptions{Overwrite: true}
+	if opts != nil {
+		o = *opts
+	}
+	if o.ContentType == "" {
+		o.ContentType = codec.ContentType()
+	}
+	return codec, &o
+}
+
+// encodeTo calls put with a reader streaming the encoding of v
+func encodeTo(codec Codec, op, key string, v any, put func(r io.Reader) (Stat, error)) (Stat, error) {
+	pr, pw := io.Pipe()
+	encoded := make(chan error, 1)
+	go func() {
+		err := codec.Encode(pw, v)
+		pw.CloseWithError(err)
+		encoded <- err
+	}()
+
+	stat, err := put(pr)
+	// Unblock the encoder if put stopped reading early
+	pr.Close()
+	if encodeErr := <-encoded; encodeErr != nil && (err == nil || !errors.Is(encodeErr, io.ErrClosedPipe)) {
+		return Stat{}, &StorageError{Op: op, Key: key, Err: fmt.Errorf("encode %s: %w", codec.ContentType(), encodeErr)}
+	}
+	return stat, err
+}
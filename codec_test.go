@@ -0,0 +1,181 @@
+package storagex_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/gostratum/storagex"
+	"github.com/gostratum/storagex/internal/testutil"
+)
+
+type settings struct {
+	Name    string
+	Retries int
+	Tags    []string
+}
+
+func TestPutGetJSON(t *testing.T) {
+	ctx := context.Background()
+	mock := testutil.NewMockStorage()
+
+	want := settings{Name: "ingest", Retries: 3, Tags: []string{"a", "b"}}
+	stat, err := storagex.PutJSON(ctx, mock, "config/ingest.json", want, nil)
+	require.NoError(t, err)
+	assert.NotEmpty(t, stat.ETag)
+
+	head, err := mock.Head(ctx, "config/ingest.json")
+	require.NoError(t, err)
+	assert.Equal(t, "application/json", head.ContentType)
+
+	got, getStat, err := storagex.GetJSON[settings](ctx, mock, "config/ingest.json")
+	require.NoError(t, err)
+	assert.Equal(t, want, got)
+	assert.Equal(t, stat.ETag, getStat.ETag)
+
+	_, _, err = storagex.GetJSON[settings](ctx, mock, "config/missing.json")
+	assert.True(t, storagex.IsNotFound(err))
+}
+
+func TestGetValue_CodecFromContentType(t *testing.T) {
+	ctx := context.Background()
+	mock := testutil.NewMockStorage()
+
+	want := settings{Name: "gob", Retries: 1}
+	_, err := storagex.PutValue(ctx, mock, storagex.GobCodec, "config/gob.bin", want, &storagex.PutOptions{Metadata: map[string]string{"schema": "1"}})
+	require.NoError(t, err)
+
+	head, err := mock.Head(ctx, "config/gob.bin")
+	require.NoError(t, err)
+	assert.Equal(t, "application/x-gob", head.ContentType)
+	assert.Equal(t, "1", head.Metadata["schema"])
+
+	got, _, err := storagex.GetValue[settings](ctx, mock, nil, "config/gob.bin")
+	require.NoError(t, err)
+	assert.Equal(t, want, got)
+
+	_, err = mock.PutBytes(ctx, "config/plain.txt", []byte("hello"), &storagex.PutOptions{ContentType: "text/plain"})
+	require.NoError(t, err)
+	_, _, err = storagex.GetValue[settings](ctx, mock, nil, "config/plain.txt")
+	assert.ErrorIs(t, err, storagex.ErrInvalidConfig)
+
+	// A decoding error names the key
+	_, _, err = storagex.GetJSON[settings](ctx, mock, "config/plain.txt")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "config/plain.txt")
+}
+
+// upperCodec is a custom codec for strings
+type upperCodec struct{}
+
+func (upperCodec) ContentType() string { return "text/x-upper" }
+
+func (upperCodec) Encode(w io.Writer, v any) error {
+	s, ok := v.(string)
+	if !ok {
+		return errors.New("upper codec encodes strings only")
+	}
+	_, err := io.WriteString(w, strings.ToUpper(s))
+	return err
+}
+
+func (upperCodec) Decode(r io.Reader, v any) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	*v.(*string) = strings.ToLower(string(data))
+	return nil
+}
+
+func TestRegisterCodec(t *testing.T) {
+	ctx := context.Background()
+	mock := testutil.NewMockStorage()
+	storagex.RegisterCodec(upperCodec{})
+
+	codec, ok := storagex.CodecFor("text/x-upper; charset=utf-8")
+	require.True(t, ok)
+	assert.Equal(t, "text/x-upper", codec.ContentType())
+	codec, ok = storagex.CodecFor("application/json")
+	require.True(t, ok)
+	assert.Equal(t, storagex.JSONCodec, codec)
+
+	_, err := storagex.PutValue(ctx, mock, upperCodec{}, "greeting", "hello", nil)
+	require.NoError(t, err)
+	body, _, err := mock.Get(ctx, "greeting")
+	require.NoError(t, err)
+	data, err := io.ReadAll(body)
+	body.Close()
+	require.NoError(t, err)
+	assert.Equal(t, "HELLO", string(data))
+
+	got, _, err := storagex.GetValue[string](ctx, mock, nil, "greeting")
+	require.NoError(t, err)
+	assert.Equal(t, "hello", got)
+
+	// Encoding errors are reported and nothing is stored
+	_, err = storagex.PutValue(ctx, mock, upperCodec{}, "number", 42, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "strings only")
+	_, err = mock.Head(ctx, "number")
+	assert.True(t, storagex.IsNotFound(err))
+}
+
+func TestUpdateJSON_OptimisticConcurrency(t *testing.T) {
+	ctx := context.Background()
+	mock := testutil.NewMockStorage()
+
+	// An empty ETag creates the object only if it is absent
+	created, err := storagex.UpdateJSON(ctx, mock, "counter.json", 1, "", nil)
+	require.NoError(t, err)
+	_, err = storagex.UpdateJSON(ctx, mock, "counter.json", 1, "", nil)
+	assert.True(t, storagex.IsPreconditionFailed(err))
+
+	updated, err := storagex.UpdateJSON(ctx, mock, "counter.json", 2, created.ETag, nil)
+	require.NoError(t, err)
+
+	// A writer holding the old ETag loses
+	_, err = storagex.UpdateJSON(ctx, mock, "counter.json", 3, created.ETag, nil)
+	assert.True(t, storagex.IsPreconditionFailed(err))
+
+	got, stat, err := storagex.GetJSON[int](ctx, mock, "counter.json")
+	require.NoError(t, err)
+	assert.Equal(t, 2, got)
+	assert.Equal(t, updated.ETag, stat.ETag)
+
+	_, err = storagex.UpdateJSON(ctx, testutil.PlainStorage{Storage: mock}, "counter.json", 4, stat.ETag, nil)
+	assert.ErrorIs(t, err, storagex.ErrInvalidConfig)
+}
+
+func TestUpdateJSON_ThroughDecorators(t *testing.T) {
+	ctx := context.Background()
+
+	// Found through pass-through decorators
+	mock := testutil.NewMockStorage()
+	retry := storagex.NewRetryStorage(mock, storagex.RetryPolicy{})
+	_, err := storagex.UpdateJSON(ctx, retry, "a.json", 1, "", nil)
+	require.NoError(t, err)
+
+	// Tiered storage would have its pointers overwritten, so it refuses
+	tiered, err := storagex.NewTieredStorage(testutil.NewMockStorage(), testutil.NewMockStorage(), storagex.TieredOptions{})
+	require.NoError(t, err)
+	defer tiered.Close()
+	_, err = storagex.UpdateJSON(ctx, tiered, "a.json", 1, "", nil)
+	assert.ErrorIs(t, err, storagex.ErrInvalidConfig)
+
+	// Mirrored writes are replicated
+	secondary := testutil.NewMockStorage()
+	mirror, err := storagex.NewMirrorStorage(testutil.NewMockStorage(), []storagex.NamedStorage{{Name: "dr", Storage: secondary}}, storagex.MirrorOptions{})
+	require.NoError(t, err)
+	defer mirror.Close()
+	_, err = storagex.UpdateJSON(ctx, mirror, "a.json", 1, "", nil)
+	require.NoError(t, err)
+	value, _, err := storagex.GetJSON[int](ctx, secondary, "a.json")
+	require.NoError(t, err)
+	assert.Equal(t, 1, value)
+}
@@ -65,6 +65,34 @@ type Config struct {
 	// BackoffMax is the maximum backoff delay
 	BackoffMax time.Duration `mapstructure:"backoff_max" yaml:"backoff_max" default:"5s"`
 
+	// RetryMode selects where retries happen: "sdk" (default) lets the
+	// adapter's client retry; "storagex" disables client retries and wraps
+	// the storage in a RetryStorage
+	RetryMode string `mapstructure:"retry_mode" yaml:"retry_mode" default:"sdk"`
+
+	// HedgeDelay sends a second Get when the first has not answered within
+	// this delay (RetryMode "storagex" only; 0 disables hedging)
+	HedgeDelay time.Duration `mapstructure:"hedge_delay" yaml:"hedge_delay"`
+
+	// CircuitBreaker configures per-operation-class circuit breakers
+	CircuitBreaker CircuitBreakerConfig `mapstructure:"circuit_breaker" yaml:"circuit_breaker"`
+
+	// Bulkhead limits in-flight operations per operation class
+	Bulkhead BulkheadConfig `mapstructure:"bulkhead" yaml:"bulkhead"`
+
+	// RateLimit configures client-side rate limiting
+	RateLimit RateLimitConfig `mapstructure:"rate_limit" yaml:"rate_limit"`
+
+	// Provisioning declares the bucket and its bucket-level settings
+	Provisioning ProvisioningConfig `mapstructure:"provisioning" yaml:"provisioning"`
+
+	// BrowserUploads describes presigned browser uploads; the bucket's
+	// CORS rules are checked against it at startup
+	BrowserUploads BrowserUploadConfig `mapstructure:"browser_uploads" yaml:"browser_uploads"`
+
+	// Lifecycle declares the lifecycle rules of the bucket
+	Lifecycle BucketLifecycleConfig `mapstructure:"lifecycle" yaml:"lifecycle"`
+
 	// DefaultPartSize is the default multipart upload part size
 	DefaultPartSize int64 `mapstructure:"default_part_size" yaml:"default_part_size" default:"8388608"` // 8MB
 
@@ -87,13 +115,27 @@ func (Config) Prefix() string { return "storage" }
 // DefaultConfig returns a configuration with sensible defaults
 func DefaultConfig() *Config {
 	return &Config{
-		Provider:        "s3",
-		Region:          "us-east-1",
-		UsePathStyle:    false,
-		RequestTimeout:  30 * time.Second,
-		MaxRetries:      3,
-		BackoffInitial:  200 * time.Millisecond,
-		BackoffMax:      5 * time.Second,
+		Provider:       "s3",
+		Region:         "us-east-1",
+		UsePathStyle:   false,
+		RequestTimeout: 30 * time.Second,
+		MaxRetries:     3,
+		BackoffInitial: 200 * time.Millisecond,
+		BackoffMax:     5 * time.Second,
+		RetryMode:      RetryModeSDK,
+		CircuitBreaker: CircuitBreakerConfig{
+			FailureThreshold: 5,
+			OpenTimeout:      30 * time.Second,
+			HalfOpenProbes:   1,
+		},
+		RateLimit: RateLimitConfig{
+			PrefixDepth:      1,
+			TenantKey:        "tenant_id",
+			Adaptive:         true,
+			MinFactor:        0.1,
+			RecoveryInterval: time.Second,
+			RecoveryStep:     0.05,
+		},
 		DefaultPartSize: 8 << 20, // 8MB
 		DefaultParallel: 4,
 		DisableSSL:      false,
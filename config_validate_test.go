@@ -2,6 +2,7 @@ package storagex
 
 import (
 	"testing"
+	"time"
 )
 
 func TestValidateConfig(t *testing.T) {
@@ -59,6 +60,48 @@ func TestValidateConfig(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "storagex retry mode",
+			cfg: &Config{
+				Provider:       "s3",
+				Bucket:         "my-bucket",
+				UseSDKDefaults: true,
+				RetryMode:      RetryModeStorageX,
+				HedgeDelay:     50 * time.Millisecond,
+			},
+			wantErr: false,
+		},
+		{
+			name: "unknown retry mode",
+			cfg: &Config{
+				Provider:       "s3",
+				Bucket:         "my-bucket",
+				UseSDKDefaults: true,
+				RetryMode:      "adaptive",
+			},
+			wantErr: true,
+		},
+		{
+			name: "circuit breaker and bulkhead",
+			cfg: &Config{
+				Provider:       "s3",
+				Bucket:         "my-bucket",
+				UseSDKDefaults: true,
+				CircuitBreaker: CircuitBreakerConfig{Enabled: true},
+				Bulkhead:       BulkheadConfig{MaxReads: 64, MaxWait: time.Second},
+			},
+			wantErr: false,
+		},
+		{
+			name: "negative bulkhead limit",
+			cfg: &Config{
+				Provider:       "s3",
+				Bucket:         "my-bucket",
+				UseSDKDefaults: true,
+				Bulkhead:       BulkheadConfig{MaxWrites: -1},
+			},
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
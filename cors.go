@@ -0,0 +1,182 @@
+package storagex
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// BrowserUploadConfig describes how browsers upload to the bucket with
+// presigned requests, so the bucket's CORS rules can be derived and checked
+type BrowserUploadConfig struct {
+	// AllowedOrigins are the web origins that upload, e.g.
+	// "https://app.example.com". Empty disables the CORS check.
+	AllowedOrigins []string `mapstructure:"allowed_origins" yaml:"allowed_origins"`
+
+	// Methods are the upload methods in use: "PUT" (PresignPut) and
+	// "POST" (PresignPostPolicy). Default: both.
+	Methods []string `mapstructure:"methods" yaml:"methods"`
+
+	// Headers are further request headers the browser sends, e.g.
+	// "x-amz-meta-owner" for metadata signed into presigned PUTs
+	Headers []string `mapstructure:"headers" yaml:"headers"`
+
+	// ChecksumAlgorithm is the PresignOptions.ChecksumAlgorithm used for
+	// presigned PUTs, if any
+	ChecksumAlgorithm string `mapstructure:"checksum_algorithm" yaml:"checksum_algorithm"`
+}
+
+// RequiredCORSRule returns the CORS rule the configured upload flow needs
+func (c BrowserUploadConfig) RequiredCORSRule() CORSRule {
+	rule := UploadCORSRule(c.AllowedOrigins, c.Methods, &PresignOptions{ChecksumAlgorithm: c.ChecksumAlgorithm})
+	rule.AllowedHeaders = mergeHeaders(rule.AllowedHeaders, c.Headers)
+	return rule
+}
+
+// UploadCORSRule derives the CORS rule that lets browsers on origins upload
+// with presigned requests made with opts: the methods (default PUT and
+// POST), the headers presigned PUTs require (Content-Type, x-amz-meta-*,
+// SSE-C and checksum headers) and the ETag response header, which browsers
+// need to complete multipart uploads.
+func UploadCORSRule(origins, methods []string, opts *PresignOptions) CORSRule {
+	if len(methods) == 0 {
+		methods = []string{"PUT", "POST"}
+	}
+
+	rule := CORSRule{
+		ID:             "storagex-uploads",
+		AllowedOrigins: append([]string(nil), origins...),
+		AllowedMethods: make([]string, len(methods)),
+		ExposeHeaders:  []string{"ETag"},
+		MaxAgeSeconds:  3600,
+	}
+	for i, method := range methods {
+		rule.AllowedMethods[i] = strings.ToUpper(method)
+	}
+
+	headers := []string{"content-type"}
+	if opts != nil {
+		for k := range opts.Metadata {
+			headers = append(headers, "x-amz-meta-"+strings.ToLower(k))
+		}
+		if len(opts.SSECustomerKey) > 0 {
+			headers = append(headers,
+				"x-amz-server-side-encryption-customer-algorithm",
+				"x-amz-server-side-encryption-customer-key",
+				"x-amz-server-side-encryption-customer-key-md5",
+			)
+		}
+		if opts.ChecksumAlgorithm != "" {
+			headers = append(headers,
+				"x-amz-checksum-"+strings.ToLower(opts.ChecksumAlgorithm),
+				"x-amz-sdk-checksum-algorithm",
+			)
+		}
+	}
+	rule.AllowedHeaders = mergeHeaders(nil, headers)
+	return rule
+}
+
+// CheckUploadCORS reports how rules would block the uploads required
+// describes: for every origin and method it needs a rule, evaluated like
+// S3 evaluates preflight requests, that allows the origin, the method and
+// all of the headers, and exposes the required response headers. It
+// returns one problem per blocked origin and method; none means the rules
+// allow the uploads.
+func CheckUploadCORS(rules []CORSRule, required CORSRule) []string {
+	var problems []string
+	for _, origin := range required.AllowedOrigins {
+		for _, method := range required.AllowedMethods {
+			matched := false
+			var missingHeaders []string
+			for _, rule := range rules {
+				if !corsAllows(rule.AllowedOrigins, origin, false) || !containsFold(rule.AllowedMethods, method) {
+					continue
+				}
+				missing := missingCORSHeaders(rule, required.AllowedHeaders)
+				if len(missing) > 0 {
+					if missingHeaders == nil {
+						missingHeaders = missing
+					}
+					continue
+				}
+				matched = true
+				for _, header := range required.ExposeHeaders {
+					if !containsFold(rule.ExposeHeaders, header) {
+						problems = append(problems, fmt.Sprintf("%s %s: response header %s is not exposed", method, origin, header))
+					}
+				}
+				break
+			}
+
+			switch {
+			case matched:
+			case missingHeaders != nil:
+				problems = append(problems, fmt.Sprintf("%s %s: request headers not allowed: %s", method, origin, strings.Join(missingHeaders, ", ")))
+			default:
+				problems = append(problems, fmt.Sprintf("%s %s: no CORS rule allows the origin and method", method, origin))
+			}
+		}
+	}
+	return problems
+}
+
+// missingCORSHeaders returns the headers a rule does not allow
+func missingCORSHeaders(rule CORSRule, headers []string) []string {
+	var missing []string
+	for _, header := range headers {
+		if !corsAllows(rule.AllowedHeaders, header, true) {
+			missing = append(missing, header)
+		}
+	}
+	return missing
+}
+
+// corsAllows matches value against CORS patterns, each of which may hold
+// one "*" wildcard
+func corsAllows(patterns []string, value string, foldCase bool) bool {
+	if foldCase {
+		value = strings.ToLower(value)
+	}
+	for _, pattern := range patterns {
+		if foldCase {
+			pattern = strings.ToLower(pattern)
+		}
+		prefix, suffix, wildcard := strings.Cut(pattern, "*")
+		if !wildcard {
+			if pattern == value {
+				return true
+			}
+			continue
+		}
+		if len(value) >= len(prefix)+len(suffix) && strings.HasPrefix(value, prefix) && strings.HasSuffix(value, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeHeaders returns the lowercased union of header names, sorted
+func mergeHeaders(headers, more []string) []string {
+	seen := make(map[string]bool, len(headers)+len(more))
+	var merged []string
+	for _, header := range append(append([]string(nil), headers...), more...) {
+		header = strings.ToLower(strings.TrimSpace(header))
+		if header == "" || seen[header] {
+			continue
+		}
+		seen[header] = true
+		merged = append(merged, header)
+	}
+	sort.Strings(merged)
+	return merged
+}
@@ -0,0 +1,67 @@
+package storagex_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/gostratum/storagex"
+)
+
+func TestUploadCORSRule(t *testing.T) {
+	rule := storagex.UploadCORSRule([]string{"https://app.example.com"}, nil, &storagex.PresignOptions{
+		Metadata:          map[string]string{"Owner": "ops"},
+		SSECustomerKey:    make([]byte, 32),
+		ChecksumAlgorithm: "SHA256",
+	})
+
+	assert.Equal(t, []string{"PUT", "POST"}, rule.AllowedMethods)
+	assert.Equal(t, []string{
+		"content-type",
+		"x-amz-checksum-sha256",
+		"x-amz-meta-owner",
+		"x-amz-sdk-checksum-algorithm",
+		"x-amz-server-side-encryption-customer-algorithm",
+		"x-amz-server-side-encryption-customer-key",
+		"x-amz-server-side-encryption-customer-key-md5",
+	}, rule.AllowedHeaders)
+	assert.Equal(t, []string{"ETag"}, rule.ExposeHeaders)
+
+	uploads := storagex.BrowserUploadConfig{
+		AllowedOrigins: []string{"https://app.example.com"},
+		Methods:        []string{"put"},
+		Headers:        []string{"X-Amz-Meta-Owner", "content-type"},
+	}
+	rule = uploads.RequiredCORSRule()
+	assert.Equal(t, []string{"PUT"}, rule.AllowedMethods)
+	assert.Equal(t, []string{"content-type", "x-amz-meta-owner"}, rule.AllowedHeaders)
+}
+
+func TestCheckUploadCORS(t *testing.T) {
+	required := storagex.BrowserUploadConfig{
+		AllowedOrigins: []string{"https://app.example.com", "https://admin.example.com"},
+		Headers:        []string{"x-amz-meta-owner"},
+	}.RequiredCORSRule()
+
+	// Rules built from the same flow allow it
+	assert.Empty(t, storagex.CheckUploadCORS([]storagex.CORSRule{required}, required))
+
+	// Wildcards match like S3 does
+	assert.Empty(t, storagex.CheckUploadCORS([]storagex.CORSRule{{
+		AllowedOrigins: []string{"https://*.example.com"},
+		AllowedMethods: []string{"PUT", "POST"},
+		AllowedHeaders: []string{"Content-Type", "x-amz-meta-*"},
+		ExposeHeaders:  []string{"ETag"},
+	}}, required))
+
+	problems := storagex.CheckUploadCORS([]storagex.CORSRule{
+		{AllowedOrigins: []string{"https://app.example.com"}, AllowedMethods: []string{"PUT"}, AllowedHeaders: []string{"content-type"}},
+		{AllowedOrigins: []string{"*"}, AllowedMethods: []string{"POST"}, AllowedHeaders: []string{"*"}},
+	}, required)
+	assert.Equal(t, []string{
+		"PUT https://app.example.com: request headers not allowed: x-amz-meta-owner",
+		"POST https://app.example.com: response header ETag is not exposed",
+		"PUT https://admin.example.com: no CORS rule allows the origin and method",
+		"POST https://admin.example.com: response header ETag is not exposed",
+	}, problems)
+}
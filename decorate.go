@@ -0,0 +1,48 @@
+package storagex
+
+// DecorateOptions configures DecorateStorage
+type DecorateOptions struct {
+	// Retryable classifies errors for retries and circuit breakers
+	// (default: IsRetryableError). Adapters pass their own classifier so
+	// backend-specific codes are recognised.
+	Retryable func(error) bool
+
+	// Instrumenter optionally records resilience metrics
+	Instrumenter *Instrumenter
+}
+
+// DecorateStorage wraps an adapter's storage with the resilience decorators
+// enabled in cfg. Circuit breakers and bulkheads sit closest to the backend,
+// then the rate limiter, so every retry attempt counts against them and
+// calls waiting for a token hold no bulkhead slot; retries
+// (RetryModeStorageX) wrap the result. s is returned unchanged when nothing
+// is enabled.
+func DecorateStorage(s Storage, cfg *Config, opts DecorateOptions) Storage {
+	if opts.Retryable == nil {
+		opts.Retryable = IsRetryableError
+	}
+
+	if cfg.CircuitBreaker.Enabled || cfg.Bulkhead.enabled() {
+		s = NewCircuitBreakerStorage(s, BreakerOptions{
+			CircuitBreaker: cfg.CircuitBreaker,
+			Bulkhead:       cfg.Bulkhead,
+			IsFailure:      opts.Retryable,
+			Instrumenter:   opts.Instrumenter,
+		})
+	}
+
+	if cfg.RateLimit.enabled() {
+		s = NewRateLimitStorage(s, RateLimitOptions{
+			RateLimit:    cfg.RateLimit,
+			Instrumenter: opts.Instrumenter,
+		})
+	}
+
+	if cfg.RetryMode == RetryModeStorageX {
+		policy := RetryPolicyFromConfig(cfg)
+		policy.Retryable = opts.Retryable
+		s = NewRetryStorage(s, policy)
+	}
+
+	return s
+}
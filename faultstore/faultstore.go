@@ -0,0 +1,665 @@
+// Package faultstore wraps a storagex.Storage and injects failures for chaos
+// and resilience testing.
+//
+// Faults are described by rules that select operations, keys (by glob) and a
+// firing probability, and inject latency, errors, truncated reads, partial
+// DeleteBatch failures or multipart part failures. Random decisions come from
+// a seeded source, so a sequential test sees the same faults on every run.
+// Rules can be added, removed and toggled while the store is in use.
+//
+// Example usage:
+//
+//	store := faultstore.New(storage, faultstore.Options{Seed: 42})
+//	store.AddRule(faultstore.Rule{
+//	    Name:        "slow-uploads",
+//	    Ops:         []faultstore.Op{faultstore.OpPut},
+//	    Key:         "uploads/**",
+//	    Probability: 0.2,
+//	    Latency:     2 * time.Second,
+//	    Err:         faultstore.ErrThrottled,
+//	})
+package faultstore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"path"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gostratum/storagex"
+)
+
+// Op identifies a Storage operation. Values match the Op field of the
+// StorageErrors returned by the S3 adapter.
+type Op string
+
+const (
+	OpPut               Op = "put"
+	OpGet               Op = "get"
+	OpHead              Op = "head"
+	OpList              Op = "list"
+	OpDelete            Op = "delete"
+	OpDeleteBatch       Op = "delete_batch"
+	OpCreateMultipart   Op = "create_multipart"
+	OpUploadPart        Op = "upload_part"
+	OpCompleteMultipart Op = "complete_multipart"
+	OpAbortMultipart    Op = "abort_multipart"
+	OpPresignGet        Op = "presign_get"
+	OpPresignPut        Op = "presign_put"
+	OpPutIfAbsent       Op = "put_if_absent"
+	OpPutIfMatch        Op = "put_if_match"
+	OpDeleteIfMatch     Op = "delete_if_match"
+)
+
+// Errors commonly injected by rules
+var (
+	// ErrThrottled simulates an S3 503 SlowDown response. Like the S3
+	// adapter's mapping of that response, it wraps storagex.ErrThrottled
+	// (and so storagex.ErrTimeout).
+	ErrThrottled = fmt.Errorf("server error (503): SlowDown: please reduce your request rate: %w", storagex.ErrThrottled)
+
+	// ErrTimeout is storagex.ErrTimeout, for use in rules
+	ErrTimeout = storagex.ErrTimeout
+
+	// ErrAborted is storagex.ErrAborted, for use in rules
+	ErrAborted = storagex.ErrAborted
+)
+
+// Rule describes a fault and when to inject it
+type Rule struct {
+	// Name identifies the rule for RemoveRule and Fired. Rules without a
+	// name are given one ("rule-1", "rule-2", ...).
+	Name string
+
+	// Ops limits the rule to these operations (default: all operations).
+	// PutBytes and PutFile count as OpPut; the parts of MultipartUpload
+	// count as OpCreateMultipart, OpUploadPart and OpCompleteMultipart.
+	// Conditional writes have operations of their own (OpPutIfAbsent,
+	// OpPutIfMatch, OpDeleteIfMatch).
+	Ops []Op
+
+	// Key limits the rule to keys matching a glob (default: all keys).
+	// Patterns use path.Match syntax; a trailing "/**" matches everything
+	// below a prefix and "**" alone matches every key. List matches
+	// against ListOptions.Prefix; DeleteBatch ignores Key unless FailKeys
+	// is set.
+	Key string
+
+	// Probability is the chance that a matching call fires the rule, in
+	// (0, 1]. Zero means the rule always fires.
+	Probability float64
+
+	// Count limits how many times the rule fires (default: unlimited)
+	Count int
+
+	// Latency delays the call before it is forwarded (or failed)
+	Latency time.Duration
+
+	// Err fails the call with this error, wrapped in a *FaultError
+	Err error
+
+	// TruncateAfter makes Get return a reader that fails with
+	// io.ErrUnexpectedEOF after this many bytes (Get only, must be > 0).
+	// Without Err, the rule fires only when it truncates a body: Gets of
+	// objects no longer than TruncateAfter do not count towards Count.
+	TruncateAfter int64
+
+	// FailKeys makes DeleteBatch report the matching keys as failed
+	// without deleting them instead of failing the whole call. Key and
+	// Probability are evaluated per key (DeleteBatch only).
+	FailKeys bool
+
+	// Parts limits an OpUploadPart rule to these part numbers
+	// (default: every part)
+	Parts []int32
+}
+
+// FaultError is returned (wrapped in a *storagex.StorageError) for injected
+// errors
+type FaultError struct {
+	Rule string // name of the rule that fired
+	Err  error  // the rule's error
+}
+
+func (e *FaultError) Error() string {
+	return fmt.Sprintf("%v (injected by faultstore rule %q)", e.Err, e.Rule)
+}
+
+func (e *FaultError) Unwrap() error {
+	return e.Err
+}
+
+// IsInjected reports whether err was injected by a faultstore rule
+func IsInjected(err error) bool {
+	var faultErr *FaultError
+	return errors.As(err, &faultErr)
+}
+
+// Options configures a Store
+type Options struct {
+	// Seed seeds the random source used for probabilities (default: 1)
+	Seed int64
+
+	// Rules are the initial rules
+	Rules []Rule
+
+	// Disabled starts the store with fault injection turned off
+	Disabled bool
+}
+
+// Store is a storagex.Storage that injects faults into calls to the wrapped
+// storage. It is safe for concurrent use.
+type Store struct {
+	next storagex.Storage
+
+	mu       sync.Mutex
+	rng      *rand.Rand
+	rules    []*ruleState
+	enabled  bool
+	nextName int
+}
+
+type ruleState struct {
+	Rule
+	fired int
+}
+
+// New wraps next with fault injection
+func New(next storagex.Storage, opts Options) *Store {
+	seed := opts.Seed
+	if seed == 0 {
+		seed = 1
+	}
+	s := &Store{
+		next:    next,
+		rng:     rand.New(rand.NewSource(seed)),
+		enabled: !opts.Disabled,
+	}
+	for _, rule := range opts.Rules {
+		s.AddRule(rule)
+	}
+	return s
+}
+
+// Unwrap returns the wrapped storage
+func (s *Store) Unwrap() storagex.Storage {
+	return s.next
+}
+
+// ForwardsTo reports that conditional writes go through fault injection
+// and are forwarded to the wrapped storage
+func (s *Store) ForwardsTo(iface reflect.Type) (storagex.Storage, bool) {
+	return s.next, iface == reflect.TypeFor[storagex.ConditionalWriter]()
+}
+
+// AddRule appends a rule and returns its name. Rules are evaluated in the
+// order they were added.
+func (s *Store) AddRule(rule Rule) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if rule.Name == "" {
+		s.nextName++
+		rule.Name = fmt.Sprintf("rule-%d", s.nextName)
+	}
+	s.rules = append(s.rules, &ruleState{Rule: rule})
+	return rule.Name
+}
+
+// RemoveRule removes the rules with the given name and reports whether any
+// existed
+func (s *Store) RemoveRule(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := len(s.rules)
+	s.rules = slices.DeleteFunc(s.rules, func(r *ruleState) bool { return r.Name == name })
+	return len(s.rules) != n
+}
+
+// ClearRules removes every rule
+func (s *Store) ClearRules() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rules = nil
+}
+
+// SetEnabled turns fault injection on or off without removing rules
+func (s *Store) SetEnabled(enabled bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.enabled = enabled
+}
+
+// Reseed resets the random source, e.g. between test cases
+func (s *Store) Reseed(seed int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rng = rand.New(rand.NewSource(seed))
+}
+
+// Fired returns how many times the named rule has fired
+func (s *Store) Fired(name string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	total := 0
+	for _, r := range s.rules {
+		if r.Name == name {
+			total += r.fired
+		}
+	}
+	return total
+}
+
+// fault is the combined effect of the rules that fired for a call
+type fault struct {
+	latency       time.Duration
+	rule          string
+	err           error
+	truncateAfter int64
+	truncate      *ruleState // recorded as fired once Get truncates
+}
+
+// evaluate decides which rules fire for a call. Latencies of all firing
+// rules add up; the first firing rule with an error or truncation decides
+// the failure.
+func (s *Store) evaluate(op Op, key string, partNumber int32) fault {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var f fault
+	if !s.enabled {
+		return f
+	}
+	for _, r := range s.rules {
+		if r.FailKeys || !r.matches(op, key, partNumber) {
+			continue
+		}
+		if r.Err == nil && r.TruncateAfter > 0 {
+			if op != OpGet || f.rule != "" || !s.roll(r) {
+				continue
+			}
+			f.latency += r.Latency
+			f.rule, f.truncateAfter, f.truncate = r.Name, r.TruncateAfter, r
+			continue
+		}
+		if !s.fire(r) {
+			continue
+		}
+		f.latency += r.Latency
+		if f.rule == "" && r.Err != nil {
+			f.rule, f.err = r.Name, r.Err
+		}
+	}
+	return f
+}
+
+// failedKeys returns the keys FailKeys rules reject from a DeleteBatch
+func (s *Store) failedKeys(keys []string) map[string]bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	failed := make(map[string]bool)
+	if !s.enabled {
+		return failed
+	}
+	for _, r := range s.rules {
+		if !r.FailKeys || !r.matchesOp(OpDeleteBatch) {
+			continue
+		}
+		for _, key := range keys {
+			if !failed[key] && matchKey(r.Key, key) && s.fire(r) {
+				failed[key] = true
+			}
+		}
+	}
+	return failed
+}
+
+// fire rolls the rule's probability and records a hit. Callers hold s.mu.
+func (s *Store) fire(r *ruleState) bool {
+	if !s.roll(r) {
+		return false
+	}
+	r.fired++
+	return true
+}
+
+// roll reports whether the rule fires for a call without recording a hit.
+// Callers hold s.mu.
+func (s *Store) roll(r *ruleState) bool {
+	if r.Count > 0 && r.fired >= r.Count {
+		return false
+	}
+	return r.Probability <= 0 || r.Probability >= 1 || s.rng.Float64() < r.Probability
+}
+
+// record records a hit of a rule that rolled earlier, unless its Count ran
+// out in the meantime
+func (s *Store) record(r *ruleState) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r.Count > 0 && r.fired >= r.Count {
+		return false
+	}
+	r.fired++
+	return true
+}
+
+func (r *ruleState) matches(op Op, key string, partNumber int32) bool {
+	if !r.matchesOp(op) || (op != OpDeleteBatch && !matchKey(r.Key, key)) {
+		return false
+	}
+	if len(r.Parts) > 0 && (op != OpUploadPart || !slices.Contains(r.Parts, partNumber)) {
+		return false
+	}
+	return true
+}
+
+func (r *ruleState) matchesOp(op Op) bool {
+	return len(r.Ops) == 0 || slices.Contains(r.Ops, op)
+}
+
+// matchKey matches a key against a rule's glob
+func matchKey(pattern, key string) bool {
+	if pattern == "" || pattern == "**" {
+		return true
+	}
+	if dir, ok := strings.CutSuffix(pattern, "/**"); ok {
+		return strings.HasPrefix(key, dir+"/")
+	}
+	ok, _ := path.Match(pattern, key)
+	return ok
+}
+
+// inject applies a call's latency and returns its injected error, if any
+func (s *Store) inject(ctx context.Context, op Op, key string, partNumber int32) (fault, error) {
+	f := s.evaluate(op, key, partNumber)
+	if f.latency > 0 {
+		timer := time.NewTimer(f.latency)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return f, &storagex.StorageError{Op: string(op), Key: key, Err: contextError(ctx.Err())}
+		}
+	}
+	if f.err != nil {
+		return f, &storagex.StorageError{Op: string(op), Key: key, Err: &FaultError{Rule: f.rule, Err: f.err}}
+	}
+	return f, nil
+}
+
+// contextError maps context errors the way the S3 adapter does
+func contextError(err error) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return storagex.ErrTimeout
+	}
+	return storagex.ErrAborted
+}
+
+// Put stores an object from an io.Reader
+func (s *Store) Put(ctx context.Context, key string, r io.Reader, opts *storagex.PutOptions) (storagex.Stat, error) {
+	if _, err := s.inject(ctx, OpPut, key, 0); err != nil {
+		return storagex.Stat{}, err
+	}
+	return s.next.Put(ctx, key, r, opts)
+}
+
+// PutBytes stores an object from a byte slice
+func (s *Store) PutBytes(ctx context.Context, key string, data []byte, opts *storagex.PutOptions) (storagex.Stat, error) {
+	if _, err := s.inject(ctx, OpPut, key, 0); err != nil {
+		return storagex.Stat{}, err
+	}
+	return s.next.PutBytes(ctx, key, data, opts)
+}
+
+// PutFile stores an object from a local file path
+func (s *Store) PutFile(ctx context.Context, key string, path string, opts *storagex.PutOptions) (storagex.Stat, error) {
+	if _, err := s.inject(ctx, OpPut, key, 0); err != nil {
+		return storagex.Stat{}, err
+	}
+	return s.next.PutFile(ctx, key, path, opts)
+}
+
+// Get retrieves an object, possibly with a truncated body
+func (s *Store) Get(ctx context.Context, key string) (storagex.ReaderAtCloser, storagex.Stat, error) {
+	f, err := s.inject(ctx, OpGet, key, 0)
+	if err != nil {
+		return nil, storagex.Stat{}, err
+	}
+	reader, stat, err := s.next.Get(ctx, key)
+	// Objects no longer than the truncation point are returned intact
+	if err != nil || f.truncate == nil || (stat.Size >= 0 && stat.Size <= f.truncateAfter) || !s.record(f.truncate) {
+		return reader, stat, err
+	}
+	return &truncatedReader{ReaderAtCloser: reader, remaining: f.truncateAfter}, stat, nil
+}
+
+// truncatedReader fails with io.ErrUnexpectedEOF once its budget is spent,
+// like a connection dropped mid-body. Size still reports the full size.
+type truncatedReader struct {
+	storagex.ReaderAtCloser
+	remaining int64
+}
+
+func (r *truncatedReader) Read(p []byte) (int, error) {
+	if r.remaining <= 0 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	if int64(len(p)) > r.remaining {
+		p = p[:r.remaining]
+	}
+	n, err := r.ReaderAtCloser.Read(p)
+	r.remaining -= int64(n)
+	return n, err
+}
+
+// Head retrieves object metadata
+func (s *Store) Head(ctx context.Context, key string) (storagex.Stat, error) {
+	if _, err := s.inject(ctx, OpHead, key, 0); err != nil {
+		return storagex.Stat{}, err
+	}
+	return s.next.Head(ctx, key)
+}
+
+// List retrieves objects; rules match against the listing prefix
+func (s *Store) List(ctx context.Context, opts storagex.ListOptions) (storagex.ListPage, error) {
+	if _, err := s.inject(ctx, OpList, opts.Prefix, 0); err != nil {
+		return storagex.ListPage{}, err
+	}
+	return s.next.List(ctx, opts)
+}
+
+// Delete removes a single object
+func (s *Store) Delete(ctx context.Context, key string) error {
+	if _, err := s.inject(ctx, OpDelete, key, 0); err != nil {
+		return err
+	}
+	return s.next.Delete(ctx, key)
+}
+
+// DeleteBatch removes multiple objects. Keys rejected by FailKeys rules are
+// not forwarded and are reported as failed.
+func (s *Store) DeleteBatch(ctx context.Context, keys []string) ([]string, error) {
+	if _, err := s.inject(ctx, OpDeleteBatch, "", 0); err != nil {
+		return keys, err
+	}
+
+	failed := s.failedKeys(keys)
+	if len(failed) == 0 {
+		return s.next.DeleteBatch(ctx, keys)
+	}
+
+	var forward, rejected []string
+	for _, key := range keys {
+		if failed[key] {
+			rejected = append(rejected, key)
+		} else {
+			forward = append(forward, key)
+		}
+	}
+	if len(forward) == 0 {
+		return rejected, nil
+	}
+	nextFailed, err := s.next.DeleteBatch(ctx, forward)
+	return append(rejected, nextFailed...), err
+}
+
+// MultipartUpload uploads src part by part through the Store's own
+// CreateMultipart, UploadPart and CompleteMultipart, so part rules apply.
+// Parts are uploaded sequentially and the upload is aborted on failure.
+func (s *Store) MultipartUpload(ctx context.Context, key string, src io.Reader, cfg *storagex.MultipartConfig, putOpts *storagex.PutOptions) (storagex.Stat, error) {
+	partSize := int64(8 << 20)
+	if cfg != nil && cfg.PartSizeBytes > 0 {
+		partSize = cfg.PartSizeBytes
+	}
+
+	uploadID, err := s.CreateMultipart(ctx, key, putOpts)
+	if err != nil {
+		return storagex.Stat{}, err
+	}
+
+	var etags []string
+	buf := make([]byte, partSize)
+	for partNumber := int32(1); ; partNumber++ {
+		n, readErr := io.ReadFull(src, buf)
+		if readErr != nil && readErr != io.ErrUnexpectedEOF && readErr != io.EOF {
+			return storagex.Stat{}, s.abort(key, uploadID, &storagex.StorageError{Op: "multipart_upload", Key: key, Err: readErr})
+		}
+		// Always upload at least one (possibly empty) part
+		if n > 0 || partNumber == 1 {
+			etag, err := s.UploadPart(ctx, key, uploadID, partNumber, bytes.NewReader(buf[:n]), int64(n))
+			if err != nil {
+				return storagex.Stat{}, s.abort(key, uploadID, err)
+			}
+			etags = append(etags, etag)
+		}
+		if readErr != nil {
+			break
+		}
+	}
+
+	stat, err := s.CompleteMultipart(ctx, key, uploadID, etags)
+	if err != nil {
+		return storagex.Stat{}, s.abort(key, uploadID, err)
+	}
+	return stat, nil
+}
+
+// abort cleans up a failed MultipartUpload on the wrapped storage, bypassing
+// fault injection, and returns err
+func (s *Store) abort(key, uploadID string, err error) error {
+	_ = s.next.AbortMultipart(context.Background(), key, uploadID)
+	return err
+}
+
+// CreateMultipart initiates a multipart upload session
+func (s *Store) CreateMultipart(ctx context.Context, key string, putOpts *storagex.PutOptions) (string, error) {
+	if _, err := s.inject(ctx, OpCreateMultipart, key, 0); err != nil {
+		return "", err
+	}
+	return s.next.CreateMultipart(ctx, key, putOpts)
+}
+
+// UploadPart uploads a single part; Parts rules select part numbers
+func (s *Store) UploadPart(ctx context.Context, key, uploadID string, partNumber int32, part io.Reader, size int64) (string, error) {
+	if _, err := s.inject(ctx, OpUploadPart, key, partNumber); err != nil {
+		return "", err
+	}
+	return s.next.UploadPart(ctx, key, uploadID, partNumber, part, size)
+}
+
+// CompleteMultipart finalizes a multipart upload
+func (s *Store) CompleteMultipart(ctx context.Context, key, uploadID string, etags []string) (storagex.Stat, error) {
+	if _, err := s.inject(ctx, OpCompleteMultipart, key, 0); err != nil {
+		return storagex.Stat{}, err
+	}
+	return s.next.CompleteMultipart(ctx, key, uploadID, etags)
+}
+
+// AbortMultipart cancels a multipart upload
+func (s *Store) AbortMultipart(ctx context.Context, key, uploadID string) error {
+	if _, err := s.inject(ctx, OpAbortMultipart, key, 0); err != nil {
+		return err
+	}
+	return s.next.AbortMultipart(ctx, key, uploadID)
+}
+
+// PresignGet generates a presigned download URL
+func (s *Store) PresignGet(ctx context.Context, key string, opts *storagex.PresignOptions) (string, error) {
+	if _, err := s.inject(ctx, OpPresignGet, key, 0); err != nil {
+		return "", err
+	}
+	return s.next.PresignGet(ctx, key, opts)
+}
+
+// PresignPut generates a presigned upload URL
+func (s *Store) PresignPut(ctx context.Context, key string, opts *storagex.PresignOptions) (string, error) {
+	if _, err := s.inject(ctx, OpPresignPut, key, 0); err != nil {
+		return "", err
+	}
+	return s.next.PresignPut(ctx, key, opts)
+}
+
+// conditionalWriter returns the ConditionalWriter of the wrapped storage
+func (s *Store) conditionalWriter(op Op, key string) (storagex.ConditionalWriter, error) {
+	writer, ok := storagex.Capability[storagex.ConditionalWriter](s.next)
+	if !ok {
+		return nil, &storagex.StorageError{Op: string(op), Key: key, Err: fmt.Errorf("wrapped storage does not support conditional writes: %w", storagex.ErrInvalidConfig)}
+	}
+	return writer, nil
+}
+
+// PutIfAbsent stores an object if the key does not exist. It fails with
+// ErrInvalidConfig if the wrapped storage does not implement
+// storagex.ConditionalWriter.
+func (s *Store) PutIfAbsent(ctx context.Context, key string, r io.Reader, opts *storagex.PutOptions) (storagex.Stat, error) {
+	writer, err := s.conditionalWriter(OpPutIfAbsent, key)
+	if err != nil {
+		return storagex.Stat{}, err
+	}
+	if _, err := s.inject(ctx, OpPutIfAbsent, key, 0); err != nil {
+		return storagex.Stat{}, err
+	}
+	return writer.PutIfAbsent(ctx, key, r, opts)
+}
+
+// PutIfMatch replaces an object if its ETag is etag. See PutIfAbsent.
+func (s *Store) PutIfMatch(ctx context.Context, key string, r io.Reader, etag string, opts *storagex.PutOptions) (storagex.Stat, error) {
+	writer, err := s.conditionalWriter(OpPutIfMatch, key)
+	if err != nil {
+		return storagex.Stat{}, err
+	}
+	if _, err := s.inject(ctx, OpPutIfMatch, key, 0); err != nil {
+		return storagex.Stat{}, err
+	}
+	return writer.PutIfMatch(ctx, key, r, etag, opts)
+}
+
+// DeleteIfMatch removes an object if its ETag is etag. See PutIfAbsent.
+func (s *Store) DeleteIfMatch(ctx context.Context, key, etag string) error {
+	writer, err := s.conditionalWriter(OpDeleteIfMatch, key)
+	if err != nil {
+		return err
+	}
+	if _, err := s.inject(ctx, OpDeleteIfMatch, key, 0); err != nil {
+		return err
+	}
+	return writer.DeleteIfMatch(ctx, key, etag)
+}
+
+var (
+	_ storagex.Storage           = (*Store)(nil)
+	_ storagex.ConditionalWriter = (*Store)(nil)
+)
@@ -0,0 +1,228 @@
+package faultstore_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/gostratum/storagex"
+	"github.com/gostratum/storagex/faultstore"
+	"github.com/gostratum/storagex/internal/testutil"
+	"github.com/gostratum/storagex/storagextest"
+)
+
+func TestConformance_NoRules(t *testing.T) {
+	storagextest.RunConformance(t, func(t *testing.T) storagex.Storage {
+		return faultstore.New(testutil.NewMockStorage(), faultstore.Options{})
+	})
+}
+
+func TestStore_ErrorByOpAndKey(t *testing.T) {
+	ctx := context.Background()
+	store := faultstore.New(testutil.NewMockStorage(), faultstore.Options{
+		Rules: []faultstore.Rule{{
+			Name: "throttle-uploads",
+			Ops:  []faultstore.Op{faultstore.OpPut},
+			Key:  "uploads/**",
+			Err:  faultstore.ErrThrottled,
+		}},
+	})
+
+	_, err := store.PutBytes(ctx, "uploads/a/b.txt", []byte("x"), nil)
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, faultstore.ErrThrottled))
+	assert.True(t, errors.Is(err, storagex.ErrTimeout))
+	assert.True(t, faultstore.IsInjected(err))
+
+	var storageErr *storagex.StorageError
+	require.True(t, errors.As(err, &storageErr))
+	assert.Equal(t, "put", storageErr.Op)
+	assert.Equal(t, "uploads/a/b.txt", storageErr.Key)
+
+	// Other keys and operations are untouched
+	_, err = store.PutBytes(ctx, "other.txt", []byte("x"), nil)
+	require.NoError(t, err)
+	_, err = store.Head(ctx, "other.txt")
+	require.NoError(t, err)
+	assert.Equal(t, 1, store.Fired("throttle-uploads"))
+
+	// Runtime control
+	store.SetEnabled(false)
+	_, err = store.PutBytes(ctx, "uploads/c.txt", []byte("x"), nil)
+	require.NoError(t, err)
+	store.SetEnabled(true)
+	assert.True(t, store.RemoveRule("throttle-uploads"))
+	_, err = store.PutBytes(ctx, "uploads/c.txt", []byte("x"), nil)
+	require.NoError(t, err)
+}
+
+func TestStore_ProbabilityIsDeterministic(t *testing.T) {
+	run := func(seed int64) []bool {
+		store := faultstore.New(testutil.NewMockStorage(), faultstore.Options{
+			Seed:  seed,
+			Rules: []faultstore.Rule{{Ops: []faultstore.Op{faultstore.OpHead}, Probability: 0.5, Err: faultstore.ErrAborted}},
+		})
+		var failures []bool
+		for i := 0; i < 50; i++ {
+			_, err := store.Head(context.Background(), "missing")
+			failures = append(failures, errors.Is(err, storagex.ErrAborted))
+		}
+		return failures
+	}
+
+	first := run(7)
+	assert.Equal(t, first, run(7))
+	assert.Contains(t, first, true)
+	assert.Contains(t, first, false)
+}
+
+func TestStore_CountAndLatency(t *testing.T) {
+	store := faultstore.New(testutil.NewMockStorage(), faultstore.Options{})
+	store.AddRule(faultstore.Rule{Name: "once", Count: 1, Err: faultstore.ErrTimeout})
+	store.AddRule(faultstore.Rule{Name: "slow", Ops: []faultstore.Op{faultstore.OpList}, Latency: time.Second})
+
+	_, err := store.Head(context.Background(), "k")
+	assert.True(t, faultstore.IsInjected(err))
+	_, err = store.Head(context.Background(), "k")
+	assert.True(t, storagex.IsNotFound(err))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = store.List(ctx, storagex.ListOptions{})
+	assert.True(t, errors.Is(err, storagex.ErrTimeout))
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestStore_TruncatedRead(t *testing.T) {
+	ctx := context.Background()
+	store := faultstore.New(testutil.NewMockStorage(), faultstore.Options{
+		Rules: []faultstore.Rule{{Name: "cut", TruncateAfter: 4, Count: 1}},
+	})
+	_, err := store.PutBytes(ctx, "big.txt", []byte("0123456789"), nil)
+	require.NoError(t, err)
+	_, err = store.PutBytes(ctx, "small.txt", []byte("012"), nil)
+	require.NoError(t, err)
+
+	// Objects no longer than the truncation point do not use up the rule
+	reader, _, err := store.Get(ctx, "small.txt")
+	require.NoError(t, err)
+	defer reader.Close()
+	data, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "012", string(data))
+	assert.Equal(t, 0, store.Fired("cut"))
+
+	reader, stat, err := store.Get(ctx, "big.txt")
+	require.NoError(t, err)
+	defer reader.Close()
+	assert.Equal(t, int64(10), stat.Size)
+	data, err = io.ReadAll(reader)
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	assert.Equal(t, "0123", string(data))
+	assert.Equal(t, 1, store.Fired("cut"))
+
+	reader, _, err = store.Get(ctx, "big.txt")
+	require.NoError(t, err)
+	defer reader.Close()
+	data, err = io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "0123456789", string(data))
+}
+
+func TestStore_ConditionalWrites(t *testing.T) {
+	ctx := context.Background()
+	mock := testutil.NewMockStorage()
+	store := faultstore.New(mock, faultstore.Options{
+		Rules: []faultstore.Rule{{
+			Name:  "throttle-locks",
+			Ops:   []faultstore.Op{faultstore.OpPutIfAbsent},
+			Key:   "locks/**",
+			Err:   faultstore.ErrThrottled,
+			Count: 1,
+		}},
+	})
+	writer, ok := storagex.Capability[storagex.ConditionalWriter](store)
+	require.True(t, ok)
+	assert.Same(t, store, writer)
+
+	_, err := writer.PutIfAbsent(ctx, "locks/job", bytes.NewReader([]byte("x")), nil)
+	assert.True(t, faultstore.IsInjected(err))
+	var storageErr *storagex.StorageError
+	require.True(t, errors.As(err, &storageErr))
+	assert.Equal(t, "put_if_absent", storageErr.Op)
+	_, err = mock.Head(ctx, "locks/job")
+	assert.True(t, storagex.IsNotFound(err))
+
+	created, err := writer.PutIfAbsent(ctx, "locks/job", bytes.NewReader([]byte("x")), nil)
+	require.NoError(t, err)
+	require.NoError(t, writer.DeleteIfMatch(ctx, "locks/job", created.ETag))
+
+	// Over storage without conditional writes, the Store has none either
+	plain := faultstore.New(testutil.PlainStorage{Storage: mock}, faultstore.Options{})
+	_, ok = storagex.Capability[storagex.ConditionalWriter](plain)
+	assert.False(t, ok)
+	_, err = plain.PutIfAbsent(ctx, "locks/job", bytes.NewReader([]byte("x")), nil)
+	assert.ErrorIs(t, err, storagex.ErrInvalidConfig)
+}
+
+func TestStore_PartialDeleteBatch(t *testing.T) {
+	ctx := context.Background()
+	mock := testutil.NewMockStorage()
+	store := faultstore.New(mock, faultstore.Options{
+		Rules: []faultstore.Rule{{Key: "keep/*", FailKeys: true}},
+	})
+	for _, key := range []string{"keep/a", "keep/b", "drop/c"} {
+		_, err := mock.PutBytes(ctx, key, []byte("x"), nil)
+		require.NoError(t, err)
+	}
+
+	failed, err := store.DeleteBatch(ctx, []string{"keep/a", "drop/c", "keep/b"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"keep/a", "keep/b"}, failed)
+
+	_, err = mock.Head(ctx, "keep/a")
+	require.NoError(t, err)
+	_, err = mock.Head(ctx, "drop/c")
+	assert.True(t, storagex.IsNotFound(err))
+}
+
+func TestStore_MultipartPartFailure(t *testing.T) {
+	ctx := context.Background()
+	mock := testutil.NewMockStorage()
+	store := faultstore.New(mock, faultstore.Options{
+		Rules: []faultstore.Rule{{
+			Name:  "part-2",
+			Ops:   []faultstore.Op{faultstore.OpUploadPart},
+			Parts: []int32{2},
+			Err:   faultstore.ErrAborted,
+		}},
+	})
+
+	data := bytes.Repeat([]byte("a"), 25)
+	_, err := store.MultipartUpload(ctx, "large.bin", bytes.NewReader(data), &storagex.MultipartConfig{PartSizeBytes: 10}, nil)
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, storagex.ErrAborted))
+	assert.Equal(t, 1, store.Fired("part-2"))
+
+	// The failed upload was aborted on the wrapped storage
+	uploads, err := mock.ListMultipartUploads(ctx, "")
+	require.NoError(t, err)
+	assert.Empty(t, uploads)
+
+	store.ClearRules()
+	_, err = store.MultipartUpload(ctx, "large.bin", bytes.NewReader(data), &storagex.MultipartConfig{PartSizeBytes: 10}, nil)
+	require.NoError(t, err)
+	reader, _, err := store.Get(ctx, "large.bin")
+	require.NoError(t, err)
+	defer reader.Close()
+	got, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Equal(t, data, got)
+}
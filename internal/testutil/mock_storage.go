@@ -3,13 +3,20 @@ package testutil
 import (
 	"bytes"
 	"context"
-	"errors"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
 	"io"
+	"net/url"
+	"os"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/gostratum/storagex"
 )
 
@@ -17,6 +24,10 @@ import (
 type MockStorage struct {
 	mu      sync.RWMutex
 	objects map[string]*mockObject // key -> object
+	uploads map[string]*mockUpload // uploadID -> in-progress multipart upload
+
+	events        []storagex.Event // change feed, oldest first; Cursor is the index + 1
+	eventsChanged chan struct{}    // closed and replaced when an event is added
 }
 
 type mockObject struct {
@@ -26,17 +37,35 @@ type mockObject struct {
 	lastModified time.Time
 	etag         string
 	storageClass string
+	restore      *storagex.RestoreStatus
+	retention    storagex.Retention
+}
+
+type mockUpload struct {
+	key       string
+	putOpts   *storagex.PutOptions
+	parts     map[int32][]byte
+	initiated time.Time
 }
 
 // NewMockStorage creates a new in-memory mock storage
 func NewMockStorage() *MockStorage {
 	return &MockStorage{
-		objects: make(map[string]*mockObject),
+		objects:       make(map[string]*mockObject),
+		uploads:       make(map[string]*mockUpload),
+		eventsChanged: make(chan struct{}),
 	}
 }
 
 // Put stores an object from an io.Reader
 func (m *MockStorage) Put(ctx context.Context, key string, r io.Reader, opts *storagex.PutOptions) (storagex.Stat, error) {
+	return m.put(ctx, "put", key, r, opts, nil)
+}
+
+// put stores an object once precondition, if set, accepts the current
+// object (nil if there is none). It runs under m.mu, so the check and the
+// write are atomic.
+func (m *MockStorage) put(ctx context.Context, op, key string, r io.Reader, opts *storagex.PutOptions, precondition func(*mockObject) error) (storagex.Stat, error) {
 	if opts == nil {
 		opts = &storagex.PutOptions{Overwrite: true}
 	}
@@ -44,7 +73,15 @@ func (m *MockStorage) Put(ctx context.Context, key string, r io.Reader, opts *st
 	// Check context
 	if err := ctx.Err(); err != nil {
 		return storagex.Stat{}, &storagex.StorageError{
-			Op:  "put",
+			Op:  op,
+			Key: key,
+			Err: err,
+		}
+	}
+
+	if err := storagex.ValidateRetention(opts.LockMode, opts.RetainUntil); err != nil {
+		return storagex.Stat{}, &storagex.StorageError{
+			Op:  op,
 			Key: key,
 			Err: err,
 		}
@@ -54,7 +91,7 @@ func (m *MockStorage) Put(ctx context.Context, key string, r io.Reader, opts *st
 	data, err := io.ReadAll(r)
 	if err != nil {
 		return storagex.Stat{}, &storagex.StorageError{
-			Op:  "put",
+			Op:  op,
 			Key: key,
 			Err: err,
 		}
@@ -67,13 +104,32 @@ func (m *MockStorage) Put(ctx context.Context, key string, r io.Reader, opts *st
 	if !opts.Overwrite {
 		if _, exists := m.objects[key]; exists {
 			return storagex.Stat{}, &storagex.StorageError{
-				Op:  "put",
+				Op:  op,
 				Key: key,
 				Err: storagex.ErrConflict,
 			}
 		}
 	}
 
+	if precondition != nil {
+		if err := precondition(m.objects[key]); err != nil {
+			return storagex.Stat{}, &storagex.StorageError{
+				Op:  op,
+				Key: key,
+				Err: err,
+			}
+		}
+	}
+
+	// Without versions, a locked object cannot be replaced
+	if existing, exists := m.objects[key]; exists && existing.retention.Locked(time.Now()) {
+		return storagex.Stat{}, &storagex.StorageError{
+			Op:  op,
+			Key: key,
+			Err: storagex.ErrRetained,
+		}
+	}
+
 	// Generate simple ETag (MD5-like hash simulation)
 	etag := generateETag(data)
 
@@ -83,6 +139,11 @@ func (m *MockStorage) Put(ctx context.Context, key string, r io.Reader, opts *st
 		metadata[k] = v
 	}
 
+	storageClass := opts.StorageClass
+	if storageClass == "" {
+		storageClass = storagex.StorageClassStandard
+	}
+
 	// Store object
 	m.objects[key] = &mockObject{
 		data:         data,
@@ -90,18 +151,26 @@ func (m *MockStorage) Put(ctx context.Context, key string, r io.Reader, opts *st
 		metadata:     metadata,
 		lastModified: time.Now().UTC(),
 		etag:         etag,
-		storageClass: "STANDARD",
+		storageClass: storageClass,
+		retention: storagex.Retention{
+			Mode:        opts.LockMode,
+			RetainUntil: opts.RetainUntil,
+			LegalHold:   opts.LegalHold,
+		},
 	}
 
-	return storagex.Stat{
+	stat := storagex.Stat{
 		Key:          key,
 		Size:         int64(len(data)),
 		ETag:         etag,
 		ContentType:  opts.ContentType,
 		Metadata:     metadata,
 		LastModified: m.objects[key].lastModified,
-		StorageClass: "STANDARD",
-	}, nil
+		StorageClass: storageClass,
+		Retention:    m.objects[key].retentionStatus(),
+	}
+	m.recordEvent(storagex.ObjectCreated, stat)
+	return stat, nil
 }
 
 // PutBytes stores an object from a byte slice
@@ -111,7 +180,74 @@ func (m *MockStorage) PutBytes(ctx context.Context, key string, data []byte, opt
 
 // PutFile stores an object from a local file path
 func (m *MockStorage) PutFile(ctx context.Context, key string, path string, opts *storagex.PutOptions) (storagex.Stat, error) {
-	return storagex.Stat{}, errors.New("PutFile not implemented in mock")
+	f, err := os.Open(path)
+	if err != nil {
+		return storagex.Stat{}, &storagex.StorageError{
+			Op:  "put_file",
+			Key: key,
+			Err: err,
+		}
+	}
+	defer f.Close()
+
+	return m.Put(ctx, key, f, opts)
+}
+
+// PutIfAbsent stores an object only if the key does not exist
+func (m *MockStorage) PutIfAbsent(ctx context.Context, key string, r io.Reader, opts *storagex.PutOptions) (storagex.Stat, error) {
+	return m.put(ctx, "put_if_absent", key, r, conditionalPutOptions(opts), func(existing *mockObject) error {
+		if existing != nil {
+			return storagex.ErrPreconditionFailed
+		}
+		return nil
+	})
+}
+
+// PutIfMatch replaces an object only if its current ETag is etag
+func (m *MockStorage) PutIfMatch(ctx context.Context, key string, r io.Reader, etag string, opts *storagex.PutOptions) (storagex.Stat, error) {
+	return m.put(ctx, "put_if_match", key, r, conditionalPutOptions(opts), func(existing *mockObject) error {
+		if existing == nil {
+			return storagex.ErrNotFound
+		}
+		if existing.etag != etag {
+			return storagex.ErrPreconditionFailed
+		}
+		return nil
+	})
+}
+
+// conditionalPutOptions copies opts with Overwrite set, as conditional
+// writes replace Overwrite with their own condition
+func conditionalPutOptions(opts *storagex.PutOptions) *storagex.PutOptions {
+	conditional := storagex.PutOptions{}
+	if opts != nil {
+		conditional = *opts
+	}
+	conditional.Overwrite = true
+	return &conditional
+}
+
+// DeleteIfMatch removes an object only if its current ETag is etag
+func (m *MockStorage) DeleteIfMatch(ctx context.Context, key, etag string) error {
+	if err := ctx.Err(); err != nil {
+		return &storagex.StorageError{Op: "delete_if_match", Key: key, Err: err}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	obj, exists := m.objects[key]
+	switch {
+	case !exists:
+		return &storagex.StorageError{Op: "delete_if_match", Key: key, Err: storagex.ErrNotFound}
+	case obj.etag != etag:
+		return &storagex.StorageError{Op: "delete_if_match", Key: key, Err: storagex.ErrPreconditionFailed}
+	case obj.locked(ctx):
+		return &storagex.StorageError{Op: "delete_if_match", Key: key, Err: storagex.ErrRetained}
+	}
+	delete(m.objects, key)
+	m.recordEvent(storagex.ObjectRemoved, storagex.Stat{Key: key})
+	return nil
 }
 
 // Get retrieves an object as a streaming reader with metadata
@@ -136,6 +272,13 @@ func (m *MockStorage) Get(ctx context.Context, key string) (storagex.ReaderAtClo
 			Err: storagex.ErrNotFound,
 		}
 	}
+	if obj.archived() {
+		return nil, storagex.Stat{}, &storagex.StorageError{
+			Op:  "get",
+			Key: key,
+			Err: storagex.ErrArchived,
+		}
+	}
 
 	// Copy metadata
 	metadata := make(map[string]string)
@@ -151,6 +294,8 @@ func (m *MockStorage) Get(ctx context.Context, key string) (storagex.ReaderAtClo
 		Metadata:     metadata,
 		LastModified: obj.lastModified,
 		StorageClass: obj.storageClass,
+		Restore:      obj.restoreStatus(),
+		Retention:    obj.retentionStatus(),
 	}
 
 	// Create reader from copy of data
@@ -164,6 +309,23 @@ func (m *MockStorage) Get(ctx context.Context, key string) (storagex.ReaderAtClo
 	return reader, stat, nil
 }
 
+// GetIfNoneMatch retrieves an object unless its ETag equals etag, in which
+// case it returns storagex.ErrNotModified
+func (m *MockStorage) GetIfNoneMatch(ctx context.Context, key, etag string) (storagex.ReaderAtCloser, storagex.Stat, error) {
+	m.mu.RLock()
+	obj, exists := m.objects[key]
+	m.mu.RUnlock()
+
+	if exists && etag != "" && obj.etag == etag {
+		return nil, storagex.Stat{}, &storagex.StorageError{
+			Op:  "get",
+			Key: key,
+			Err: storagex.ErrNotModified,
+		}
+	}
+	return m.Get(ctx, key)
+}
+
 // Head retrieves object metadata without the payload
 func (m *MockStorage) Head(ctx context.Context, key string) (storagex.Stat, error) {
 	// Check context
@@ -201,6 +363,8 @@ func (m *MockStorage) Head(ctx context.Context, key string) (storagex.Stat, erro
 		Metadata:     metadata,
 		LastModified: obj.lastModified,
 		StorageClass: obj.storageClass,
+		Restore:      obj.restoreStatus(),
+		Retention:    obj.retentionStatus(),
 	}, nil
 }
 
@@ -340,8 +504,19 @@ func (m *MockStorage) Delete(ctx context.Context, key string) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
+	if obj, exists := m.objects[key]; exists && obj.locked(ctx) {
+		return &storagex.StorageError{
+			Op:  "delete",
+			Key: key,
+			Err: storagex.ErrRetained,
+		}
+	}
+
 	// S3 delete is idempotent - doesn't error if key doesn't exist
-	delete(m.objects, key)
+	if _, exists := m.objects[key]; exists {
+		delete(m.objects, key)
+		m.recordEvent(storagex.ObjectRemoved, storagex.Stat{Key: key})
+	}
 	return nil
 }
 
@@ -359,11 +534,19 @@ func (m *MockStorage) DeleteBatch(ctx context.Context, keys []string) ([]string,
 	defer m.mu.Unlock()
 
 	// S3 delete is idempotent - doesn't error if keys don't exist
+	var failed []string
 	for _, key := range keys {
-		delete(m.objects, key)
+		if obj, exists := m.objects[key]; exists && obj.locked(ctx) {
+			failed = append(failed, key)
+			continue
+		}
+		if _, exists := m.objects[key]; exists {
+			delete(m.objects, key)
+			m.recordEvent(storagex.ObjectRemoved, storagex.Stat{Key: key})
+		}
 	}
 
-	return nil, nil
+	return failed, nil
 }
 
 // MultipartUpload uploads large objects using multipart upload
@@ -377,36 +560,154 @@ func (m *MockStorage) MultipartUpload(ctx context.Context, key string, src io.Re
 
 // CreateMultipart initiates a multipart upload session
 func (m *MockStorage) CreateMultipart(ctx context.Context, key string, putOpts *storagex.PutOptions) (uploadID string, err error) {
-	return "mock-upload-id-" + key, nil
+	if err := ctx.Err(); err != nil {
+		return "", &storagex.StorageError{
+			Op:  "create_multipart",
+			Key: key,
+			Err: err,
+		}
+	}
+
+	if putOpts != nil {
+		if err := storagex.ValidateRetention(putOpts.LockMode, putOpts.RetainUntil); err != nil {
+			return "", &storagex.StorageError{
+				Op:  "create_multipart",
+				Key: key,
+				Err: err,
+			}
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	uploadID = "mock-upload-id-" + uuid.New().String()
+	m.uploads[uploadID] = &mockUpload{
+		key:       key,
+		putOpts:   putOpts,
+		parts:     make(map[int32][]byte),
+		initiated: time.Now().UTC(),
+	}
+	return uploadID, nil
 }
 
 // UploadPart uploads a single part in a multipart upload
 func (m *MockStorage) UploadPart(ctx context.Context, key, uploadID string, partNumber int32, part io.Reader, size int64) (etag string, err error) {
+	if err := ctx.Err(); err != nil {
+		return "", &storagex.StorageError{
+			Op:  "upload_part",
+			Key: key,
+			Err: err,
+		}
+	}
+
 	data, err := io.ReadAll(part)
 	if err != nil {
 		return "", err
 	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	upload, exists := m.uploads[uploadID]
+	if !exists || upload.key != key {
+		return "", &storagex.StorageError{
+			Op:  "upload_part",
+			Key: key,
+			Err: storagex.ErrAborted,
+		}
+	}
+	upload.parts[partNumber] = data
+
 	return generateETag(data), nil
 }
 
 // CompleteMultipart finalizes a multipart upload
 func (m *MockStorage) CompleteMultipart(ctx context.Context, key, uploadID string, etags []string) (storagex.Stat, error) {
-	// For mock, just return a basic stat
-	return storagex.Stat{
-		Key:          key,
-		Size:         0,
-		ETag:         "mock-etag",
-		LastModified: time.Now().UTC(),
-	}, nil
+	if err := ctx.Err(); err != nil {
+		return storagex.Stat{}, &storagex.StorageError{
+			Op:  "complete_multipart",
+			Key: key,
+			Err: err,
+		}
+	}
+
+	m.mu.Lock()
+	upload, exists := m.uploads[uploadID]
+	if !exists || upload.key != key {
+		m.mu.Unlock()
+		return storagex.Stat{}, &storagex.StorageError{
+			Op:  "complete_multipart",
+			Key: key,
+			Err: storagex.ErrAborted,
+		}
+	}
+
+	// Parts are numbered from 1 in the order of the supplied ETags, matching
+	// the S3 adapter's CompleteMultipart behavior.
+	var buf bytes.Buffer
+	for i, etag := range etags {
+		data, ok := upload.parts[int32(i+1)]
+		if !ok || generateETag(data) != etag {
+			m.mu.Unlock()
+			return storagex.Stat{}, &storagex.StorageError{
+				Op:  "complete_multipart",
+				Key: key,
+				Err: fmt.Errorf("invalid part %d: %w", i+1, storagex.ErrAborted),
+			}
+		}
+		buf.Write(data)
+	}
+	delete(m.uploads, uploadID)
+	m.mu.Unlock()
+
+	opts := storagex.PutOptions{Overwrite: true}
+	if upload.putOpts != nil {
+		opts = *upload.putOpts
+		opts.Overwrite = true
+	}
+	return m.Put(ctx, key, &buf, &opts)
 }
 
 // AbortMultipart cancels a multipart upload and cleans up parts
 func (m *MockStorage) AbortMultipart(ctx context.Context, key, uploadID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.uploads, uploadID)
 	return nil
 }
 
+// ListMultipartUploads returns the in-progress multipart uploads whose key
+// starts with prefix, mirroring the information S3 exposes for dangling uploads.
+func (m *MockStorage) ListMultipartUploads(ctx context.Context, prefix string) ([]storagex.MultipartUploadInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, &storagex.StorageError{
+			Op:  "list_multipart",
+			Err: err,
+		}
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	uploads := make([]storagex.MultipartUploadInfo, 0, len(m.uploads))
+	for id, upload := range m.uploads {
+		if !strings.HasPrefix(upload.key, prefix) {
+			continue
+		}
+		uploads = append(uploads, storagex.MultipartUploadInfo{
+			Key:       upload.key,
+			UploadID:  id,
+			Initiated: upload.initiated,
+		})
+	}
+	sort.Slice(uploads, func(i, j int) bool { return uploads[i].UploadID < uploads[j].UploadID })
+	return uploads, nil
+}
+
 // PresignGet generates a presigned URL for downloading an object
-func (m *MockStorage) PresignGet(ctx context.Context, key string, opts *storagex.PresignOptions) (url string, err error) {
+func (m *MockStorage) PresignGet(ctx context.Context, key string, opts *storagex.PresignOptions) (string, error) {
 	// Check context
 	if err := ctx.Err(); err != nil {
 		return "", &storagex.StorageError{
@@ -417,12 +718,25 @@ func (m *MockStorage) PresignGet(ctx context.Context, key string, opts *storagex
 	}
 
 	// For presign get, don't require the object to exist (similar to S3 behavior)
-	// Return a mock URL
-	return "https://mock-storage.example.com/" + key + "?signature=mock", nil
+	// Return a mock URL that encodes the requested overrides
+	query := url.Values{}
+	query.Set("signature", "mock")
+	if opts != nil {
+		setIfNotEmpty(query, "response-content-disposition", opts.ResponseContentDisposition)
+		if opts.ResponseContentType != "" {
+			query.Set("response-content-type", opts.ResponseContentType)
+		} else {
+			setIfNotEmpty(query, "response-content-type", opts.ContentType)
+		}
+		setIfNotEmpty(query, "response-cache-control", opts.ResponseCacheControl)
+		setIfNotEmpty(query, "versionId", opts.VersionID)
+		encodePresignCommon(query, opts)
+	}
+	return "https://mock-storage.example.com/" + key + "?" + query.Encode(), nil
 }
 
 // PresignPut generates a presigned URL for uploading an object
-func (m *MockStorage) PresignPut(ctx context.Context, key string, opts *storagex.PresignOptions) (url string, err error) {
+func (m *MockStorage) PresignPut(ctx context.Context, key string, opts *storagex.PresignOptions) (string, error) {
 	// Check context
 	if err := ctx.Err(); err != nil {
 		return "", &storagex.StorageError{
@@ -432,10 +746,271 @@ func (m *MockStorage) PresignPut(ctx context.Context, key string, opts *storagex
 		}
 	}
 
-	// Return a mock URL
-	return "https://mock-storage.example.com/" + key + "?signature=mock&upload=true", nil
+	// Return a mock URL that encodes the upload requirements
+	query := url.Values{}
+	query.Set("signature", "mock")
+	query.Set("upload", "true")
+	if opts != nil {
+		setIfNotEmpty(query, "content-type", opts.ContentType)
+		if opts.ChecksumAlgorithm != "" {
+			algorithm := strings.ToLower(opts.ChecksumAlgorithm)
+			query.Set("x-amz-checksum-algorithm", strings.ToUpper(algorithm))
+			setIfNotEmpty(query, "x-amz-checksum-"+algorithm, opts.Checksum)
+		}
+		encodePresignCommon(query, opts)
+	}
+	return "https://mock-storage.example.com/" + key + "?" + query.Encode(), nil
+}
+
+// encodePresignCommon adds the expiry and SSE-C parameters shared by GET and
+// PUT presigns. The SSE-C key itself is never placed in the URL.
+func encodePresignCommon(query url.Values, opts *storagex.PresignOptions) {
+	if opts.Expiry > 0 {
+		query.Set("X-Amz-Expires", strconv.Itoa(int(opts.Expiry.Seconds())))
+	}
+	if len(opts.SSECustomerKey) > 0 {
+		algorithm := opts.SSECustomerAlgorithm
+		if algorithm == "" {
+			algorithm = "AES256"
+		}
+		sum := md5.Sum(opts.SSECustomerKey)
+		query.Set("x-amz-server-side-encryption-customer-algorithm", algorithm)
+		query.Set("x-amz-server-side-encryption-customer-key-MD5", base64.StdEncoding.EncodeToString(sum[:]))
+	}
+}
+
+func setIfNotEmpty(query url.Values, key, value string) {
+	if value != "" {
+		query.Set(key, value)
+	}
+}
+
+// Transition changes the storage class of an object. Archived objects must
+// be restored first, as on S3.
+func (m *MockStorage) Transition(ctx context.Context, key, class string) (storagex.Stat, error) {
+	if err := ctx.Err(); err != nil {
+		return storagex.Stat{}, &storagex.StorageError{Op: "transition", Key: key, Err: err}
+	}
+
+	m.mu.Lock()
+	obj, exists := m.objects[key]
+	switch {
+	case !exists:
+		m.mu.Unlock()
+		return storagex.Stat{}, &storagex.StorageError{Op: "transition", Key: key, Err: storagex.ErrNotFound}
+	case obj.archived():
+		m.mu.Unlock()
+		return storagex.Stat{}, &storagex.StorageError{Op: "transition", Key: key, Err: storagex.ErrArchived}
+	}
+	obj.storageClass = class
+	obj.restore = nil
+	m.mu.Unlock()
+
+	return m.Head(ctx, key)
+}
+
+// RestoreObject starts a restore of an archived object. The restore stays
+// in progress until CompleteRestore is called.
+func (m *MockStorage) RestoreObject(ctx context.Context, key string, days int, tier storagex.RestoreTier) error {
+	if err := ctx.Err(); err != nil {
+		return &storagex.StorageError{Op: "restore", Key: key, Err: err}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	obj, exists := m.objects[key]
+	if !exists {
+		return &storagex.StorageError{Op: "restore", Key: key, Err: storagex.ErrNotFound}
+	}
+	if !storagex.IsArchiveClass(obj.storageClass) {
+		return &storagex.StorageError{
+			Op:  "restore",
+			Key: key,
+			Err: fmt.Errorf("%w: object is not archived", storagex.ErrConflict),
+		}
+	}
+	if obj.restore == nil || !obj.restore.InProgress {
+		obj.restore = &storagex.RestoreStatus{
+			InProgress: true,
+			ExpiresAt:  time.Now().UTC().AddDate(0, 0, days),
+		}
+	}
+	return nil
+}
+
+// CompleteRestore finishes a restore started by RestoreObject, making the
+// object readable
+func (m *MockStorage) CompleteRestore(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if obj, exists := m.objects[key]; exists && obj.restore != nil {
+		obj.restore.InProgress = false
+	}
+}
+
+// archived reports whether the object needs a restore before it can be read
+func (o *mockObject) archived() bool {
+	return storagex.IsArchiveClass(o.storageClass) && (o.restore == nil || o.restore.InProgress)
+}
+
+func (o *mockObject) restoreStatus() *storagex.RestoreStatus {
+	if o.restore == nil {
+		return nil
+	}
+	status := *o.restore
+	return &status
+}
+
+// GetRetention returns the retention and legal hold of an object
+func (m *MockStorage) GetRetention(ctx context.Context, key string) (storagex.Retention, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	obj, exists := m.objects[key]
+	if !exists {
+		return storagex.Retention{}, &storagex.StorageError{Op: "get_retention", Key: key, Err: storagex.ErrNotFound}
+	}
+	return obj.retention, nil
+}
+
+// SetRetention sets the retention of an object with S3 Object Lock rules:
+// compliance retention can only be extended, governance retention can be
+// shortened or removed with storagex.ContextWithGovernanceBypass.
+func (m *MockStorage) SetRetention(ctx context.Context, key string, mode storagex.LockMode, retainUntil time.Time) error {
+	if err := storagex.ValidateRetention(mode, retainUntil); err != nil {
+		return &storagex.StorageError{Op: "set_retention", Key: key, Err: err}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	obj, exists := m.objects[key]
+	if !exists {
+		return &storagex.StorageError{Op: "set_retention", Key: key, Err: storagex.ErrNotFound}
+	}
+
+	current := obj.retention
+	if current.Mode != "" && time.Now().Before(current.RetainUntil) {
+		weakened := retainUntil.Before(current.RetainUntil) || mode != current.Mode
+		switch {
+		case !weakened:
+		case current.Mode == storagex.LockModeGovernance && storagex.GovernanceBypassFromContext(ctx):
+		default:
+			return &storagex.StorageError{Op: "set_retention", Key: key, Err: storagex.ErrRetained}
+		}
+	}
+
+	obj.retention.Mode = mode
+	obj.retention.RetainUntil = retainUntil
+	return nil
 }
 
+// SetLegalHold places or releases a legal hold on an object
+func (m *MockStorage) SetLegalHold(ctx context.Context, key string, on bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	obj, exists := m.objects[key]
+	if !exists {
+		return &storagex.StorageError{Op: "set_legal_hold", Key: key, Err: storagex.ErrNotFound}
+	}
+	obj.retention.LegalHold = on
+	return nil
+}
+
+// locked reports whether retention forbids deleting the object. Governance
+// retention can be bypassed; legal holds cannot.
+func (o *mockObject) locked(ctx context.Context) bool {
+	if !o.retention.Locked(time.Now()) {
+		return false
+	}
+	return o.retention.LegalHold || o.retention.Mode != storagex.LockModeGovernance ||
+		!storagex.GovernanceBypassFromContext(ctx)
+}
+
+func (o *mockObject) retentionStatus() *storagex.Retention {
+	if o.retention.Mode == "" && !o.retention.LegalHold {
+		return nil
+	}
+	retention := o.retention
+	return &retention
+}
+
+// recordEvent appends a change to the feed and wakes watchers. Callers hold
+// m.mu.
+func (m *MockStorage) recordEvent(eventType storagex.EventType, stat storagex.Stat) {
+	cursor := strconv.Itoa(len(m.events) + 1)
+	m.events = append(m.events, storagex.Event{
+		ID:     cursor,
+		Type:   eventType,
+		Key:    stat.Key,
+		Stat:   stat,
+		Time:   time.Now().UTC(),
+		Cursor: cursor,
+	})
+	close(m.eventsChanged)
+	m.eventsChanged = make(chan struct{})
+}
+
+// Watch delivers changes made through the mock. The feed keeps every event
+// since the mock was created, so a checkpoint can resume from any point.
+func (m *MockStorage) Watch(ctx context.Context, opts storagex.WatchOptions, handler storagex.EventHandler) error {
+	m.mu.RLock()
+	next := len(m.events)
+	m.mu.RUnlock()
+
+	if opts.Checkpoint != nil {
+		cursor, err := opts.Checkpoint.Load()
+		if err != nil {
+			return &storagex.StorageError{Op: "watch", Err: err}
+		}
+		if cursor != "" {
+			n, err := strconv.Atoi(cursor)
+			if err != nil || n < 0 {
+				return &storagex.StorageError{Op: "watch", Err: fmt.Errorf("invalid checkpoint %q: %w", cursor, storagex.ErrInvalidConfig)}
+			}
+			next = n
+		}
+	}
+
+	for {
+		m.mu.RLock()
+		pending := m.events[min(next, len(m.events)):]
+		changed := m.eventsChanged
+		m.mu.RUnlock()
+
+		for _, event := range pending {
+			if opts.Accepts(event) {
+				if err := storagex.Deliver(ctx, opts, handler, event); err != nil {
+					return err
+				}
+			}
+			if opts.Checkpoint != nil {
+				if err := opts.Checkpoint.Save(event.Cursor); err != nil {
+					return &storagex.StorageError{Op: "watch", Key: event.Key, Err: err}
+				}
+			}
+			next++
+		}
+		if len(pending) > 0 {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+var _ storagex.StorageClassManager = (*MockStorage)(nil)
+var _ storagex.RetentionManager = (*MockStorage)(nil)
+var _ storagex.Watcher = (*MockStorage)(nil)
+var _ storagex.ConditionalWriter = (*MockStorage)(nil)
+
 // mockReader implements storagex.ReaderAtCloser
 type mockReader struct {
 	*bytes.Reader
@@ -450,16 +1025,15 @@ func (r *mockReader) Size() int64 {
 	return r.size
 }
 
-// generateETag creates a simple hash-like ETag for testing
+// generateETag returns the quoted MD5 hex digest of data, like S3 does for
+// single-part uploads. Conditional writes rely on different contents
+// getting different ETags.
 func generateETag(data []byte) string {
-	// Simple length-based ETag for testing
-	// In real S3, this would be an MD5 hash
-	sum := len(data)
-	for i, b := range data {
-		if i >= 100 {
-			break
-		}
-		sum += int(b)
-	}
-	return `"` + strings.Repeat("a", 32-len(string(rune(sum)))) + string(rune(sum)) + `"`
+	sum := md5.Sum(data)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
 }
+
+// PlainStorage hides the optional interfaces (ConditionalWriter,
+// ConditionalGetter, ...) of the storage it embeds, so tests can exercise
+// the fallbacks for storages without them
+type PlainStorage struct{ storagex.Storage }
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"io"
+	"net/url"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -223,6 +224,40 @@ func TestMockStorage_PresignedURLs(t *testing.T) {
 		assert.Contains(t, url, "test/presign.txt")
 		assert.Contains(t, url, "mock-storage.example.com")
 	})
+
+	t.Run("PresignGet encodes response overrides", func(t *testing.T) {
+		raw, err := storage.PresignGet(ctx, "test/uuid.bin", &storagex.PresignOptions{
+			ResponseContentDisposition: storagex.ContentDispositionAttachment("report.pdf"),
+			ResponseContentType:        "application/pdf",
+			ResponseCacheControl:       "no-cache",
+			VersionID:                  "v1",
+			SSECustomerKey:             bytes.Repeat([]byte("k"), 32),
+		})
+		require.NoError(t, err)
+
+		parsed, err := url.Parse(raw)
+		require.NoError(t, err)
+		query := parsed.Query()
+		assert.Equal(t, `attachment; filename="report.pdf"`, query.Get("response-content-disposition"))
+		assert.Equal(t, "application/pdf", query.Get("response-content-type"))
+		assert.Equal(t, "no-cache", query.Get("response-cache-control"))
+		assert.Equal(t, "v1", query.Get("versionId"))
+		assert.Equal(t, "AES256", query.Get("x-amz-server-side-encryption-customer-algorithm"))
+		assert.NotEmpty(t, query.Get("x-amz-server-side-encryption-customer-key-MD5"))
+	})
+
+	t.Run("PresignPut encodes checksum requirements", func(t *testing.T) {
+		raw, err := storage.PresignPut(ctx, "test/upload.bin", &storagex.PresignOptions{
+			ChecksumAlgorithm: "SHA256",
+			Checksum:          "n4bQgYhMfWWaL+qgxVrQFaO/TxsrC4Is0V1sFbDwCgg=",
+		})
+		require.NoError(t, err)
+
+		parsed, err := url.Parse(raw)
+		require.NoError(t, err)
+		assert.Equal(t, "SHA256", parsed.Query().Get("x-amz-checksum-algorithm"))
+		assert.Equal(t, "n4bQgYhMfWWaL+qgxVrQFaO/TxsrC4Is0V1sFbDwCgg=", parsed.Query().Get("x-amz-checksum-sha256"))
+	})
 }
 
 func TestMockStorage_ConflictHandling(t *testing.T) {
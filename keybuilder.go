@@ -1,6 +1,7 @@
 package storagex
 
 import (
+	"context"
 	"fmt"
 	"strings"
 )
@@ -14,6 +15,23 @@ type KeyBuilder interface {
 	StripKey(fullKey string) string
 }
 
+// keyContextKey is the context.Context key of a request's KeyBuilder context
+type keyContextKey struct{}
+
+// ContextWithKeyContext attaches the KeyBuilder context of a request (e.g.
+// {"tenant_id": "acme"}) to ctx, so decorators such as RateLimitStorage can
+// tell tenants apart.
+func ContextWithKeyContext(ctx context.Context, keyContext map[string]string) context.Context {
+	return context.WithValue(ctx, keyContextKey{}, keyContext)
+}
+
+// KeyContextFromContext returns the KeyBuilder context attached to ctx by
+// ContextWithKeyContext, or nil
+func KeyContextFromContext(ctx context.Context) map[string]string {
+	keyContext, _ := ctx.Value(keyContextKey{}).(map[string]string)
+	return keyContext
+}
+
 // PrefixKeyBuilder implements KeyBuilder with configurable prefix templates
 type PrefixKeyBuilder struct {
 	// BasePrefix is a template string that can contain placeholders like %s
@@ -50,21 +68,23 @@ func (kb *PrefixKeyBuilder) BuildKey(originalKey string, context map[string]stri
 	return fmt.Sprintf("%s%s%s", prefix, kb.Separator, originalKey)
 }
 
-// StripKey removes the prefix to return the original key
+// StripKey removes the prefix BuildKey adds without context, so keys listed
+// from storage round-trip to the keys they were written with. Keys outside
+// the prefix are returned unchanged.
 func (kb *PrefixKeyBuilder) StripKey(fullKey string) string {
-	if kb.BasePrefix == "" {
-		return fullKey
-	}
+	return kb.stripPrefix(fullKey, kb.buildPrefix(nil))
+}
 
-	// For simplicity, we'll look for the last separator and take everything after it
-	// In a production implementation, you might want more sophisticated logic
-	parts := strings.Split(fullKey, kb.Separator)
-	if len(parts) <= 1 {
+// stripPrefix removes prefix, as joined to keys by BuildKey, from fullKey
+func (kb *PrefixKeyBuilder) stripPrefix(fullKey, prefix string) string {
+	prefix = strings.TrimSuffix(prefix, kb.Separator)
+	if prefix == "" {
 		return fullKey
 	}
-
-	// Return the last part as the original key
-	return parts[len(parts)-1]
+	if rest, ok := strings.CutPrefix(fullKey, prefix+kb.Separator); ok {
+		return rest
+	}
+	return fullKey
 }
 
 // buildPrefix constructs the prefix from the template and context
@@ -143,6 +163,16 @@ func (tkb *TenantKeyBuilder) BuildKey(originalKey string, context map[string]str
 	return tkb.PrefixKeyBuilder.BuildKey(originalKey, context)
 }
 
+// StripKey removes the tenant's prefix
+func (tkb *TenantKeyBuilder) StripKey(fullKey string) string {
+	context := make(map[string]string)
+	if tkb.TenantID != "" {
+		context["tenant_id"] = tkb.TenantID
+		context["org_id"] = tkb.TenantID
+	}
+	return tkb.stripPrefix(fullKey, tkb.buildPrefix(context))
+}
+
 // DatePartitionedKeyBuilder adds date-based partitioning to keys
 type DatePartitionedKeyBuilder struct {
 	*PrefixKeyBuilder
@@ -15,3 +15,20 @@ func TestPrefixKeyBuilder(t *testing.T) {
 		t.Fatalf("expected %s, got %s", "base/file.txt", got)
 	}
 }
+
+func TestPrefixKeyBuilder_StripKey(t *testing.T) {
+	kb := NewPrefixKeyBuilder("base/")
+	for _, key := range []string{"file.txt", "dir/a.txt", "dir/sub/b.txt"} {
+		if got := kb.StripKey(kb.BuildKey(key, nil)); got != key {
+			t.Fatalf("expected %s, got %s", key, got)
+		}
+	}
+	if got := kb.StripKey("other/a.txt"); got != "other/a.txt" {
+		t.Fatalf("expected %s, got %s", "other/a.txt", got)
+	}
+
+	tenant := NewTenantKeyBuilder("acme", "tenants/{tenant_id}")
+	if got := tenant.StripKey(tenant.BuildKey("dir/a.txt", nil)); got != "dir/a.txt" {
+		t.Fatalf("expected %s, got %s", "dir/a.txt", got)
+	}
+}
@@ -0,0 +1,22 @@
+package storagex
+
+import (
+	"hash/fnv"
+	"sync"
+)
+
+// keyLockStripes is the number of locks keys are spread over
+const keyLockStripes = 64
+
+// keyLocks serializes work on the same key within a process with a fixed
+// set of striped mutexes
+type keyLocks [keyLockStripes]sync.Mutex
+
+// lock locks the stripe of key and returns its unlock function
+func (l *keyLocks) lock(key string) func() {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	mu := &l[h.Sum32()%keyLockStripes]
+	mu.Lock()
+	return mu.Unlock
+}
@@ -0,0 +1,202 @@
+package storagex
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// BucketLifecycleConfig declares the lifecycle rules of a bucket. The
+// declared rules are the complete set: applying them removes rules the
+// bucket has that are not declared.
+type BucketLifecycleConfig struct {
+	// Apply diffs the declared rules against the bucket when the storage
+	// starts and applies the differences
+	Apply bool `mapstructure:"apply" yaml:"apply" default:"false"`
+
+	// DryRun only logs the planned changes
+	DryRun bool `mapstructure:"dry_run" yaml:"dry_run" default:"false"`
+
+	// Rules are the lifecycle rules of the bucket
+	Rules []LifecycleRule `mapstructure:"rules" yaml:"rules"`
+}
+
+// LifecycleRule is one bucket lifecycle rule. Days count from object
+// creation; zero disables an action.
+type LifecycleRule struct {
+	// ID names the rule; it must be unique within the bucket
+	ID string `mapstructure:"id" yaml:"id"`
+
+	// Prefix limits the rule to keys under a prefix (empty: whole bucket).
+	// It is a bucket key prefix, so it includes any base_prefix.
+	Prefix string `mapstructure:"prefix" yaml:"prefix"`
+
+	// Disabled keeps the rule without running it
+	Disabled bool `mapstructure:"disabled" yaml:"disabled"`
+
+	// ExpirationDays deletes objects this many days after creation
+	ExpirationDays int `mapstructure:"expiration_days" yaml:"expiration_days"`
+
+	// Transitions move objects to other storage classes over time
+	Transitions []LifecycleTransition `mapstructure:"transitions" yaml:"transitions"`
+
+	// AbortIncompleteMultipartDays aborts multipart uploads that were not
+	// completed within this many days of being started
+	AbortIncompleteMultipartDays int `mapstructure:"abort_incomplete_multipart_days" yaml:"abort_incomplete_multipart_days"`
+
+	// NoncurrentExpirationDays deletes object versions this many days after
+	// they were replaced or deleted (versioned buckets)
+	NoncurrentExpirationDays int `mapstructure:"noncurrent_expiration_days" yaml:"noncurrent_expiration_days"`
+}
+
+// LifecycleTransition moves objects to a storage class a number of days
+// after creation
+type LifecycleTransition struct {
+	Days         int    `mapstructure:"days" yaml:"days"`
+	StorageClass string `mapstructure:"storage_class" yaml:"storage_class"`
+}
+
+// Lifecycle change operations
+const (
+	LifecycleAdd    = "add"
+	LifecycleUpdate = "update"
+	LifecycleRemove = "remove"
+)
+
+// LifecycleChange is one difference between the declared and the current
+// lifecycle rules of a bucket
+type LifecycleChange struct {
+	// Op is LifecycleAdd, LifecycleUpdate or LifecycleRemove
+	Op string
+
+	// ID is the rule ID
+	ID string
+
+	// Current is the rule in the bucket (nil for LifecycleAdd)
+	Current *LifecycleRule
+
+	// Desired is the declared rule (nil for LifecycleRemove)
+	Desired *LifecycleRule
+}
+
+func (c LifecycleChange) String() string {
+	switch c.Op {
+	case LifecycleAdd:
+		return fmt.Sprintf("add rule %q: %s", c.ID, c.Desired)
+	case LifecycleRemove:
+		return fmt.Sprintf("remove rule %q: %s", c.ID, c.Current)
+	default:
+		return fmt.Sprintf("update rule %q: %s -> %s", c.ID, c.Current, c.Desired)
+	}
+}
+
+func (r *LifecycleRule) String() string {
+	var parts []string
+	prefix := r.Prefix
+	if prefix == "" {
+		prefix = "*"
+	}
+	parts = append(parts, "prefix="+prefix)
+	if r.Disabled {
+		parts = append(parts, "disabled")
+	}
+	if r.ExpirationDays > 0 {
+		parts = append(parts, fmt.Sprintf("expire=%dd", r.ExpirationDays))
+	}
+	for _, t := range r.Transitions {
+		parts = append(parts, fmt.Sprintf("%s=%dd", t.StorageClass, t.Days))
+	}
+	if r.AbortIncompleteMultipartDays > 0 {
+		parts = append(parts, fmt.Sprintf("abort_multipart=%dd", r.AbortIncompleteMultipartDays))
+	}
+	if r.NoncurrentExpirationDays > 0 {
+		parts = append(parts, fmt.Sprintf("noncurrent_expire=%dd", r.NoncurrentExpirationDays))
+	}
+	return strings.Join(parts, " ")
+}
+
+// DiffLifecycleRules compares the current rules of a bucket with the
+// desired ones by ID and returns the changes, ordered by ID. The order of
+// transitions within a rule does not matter.
+func DiffLifecycleRules(current, desired []LifecycleRule) []LifecycleChange {
+	existing := make(map[string]LifecycleRule, len(current))
+	for _, rule := range current {
+		existing[rule.ID] = rule
+	}
+
+	var changes []LifecycleChange
+	declared := make(map[string]bool, len(desired))
+	for _, rule := range desired {
+		rule := rule
+		declared[rule.ID] = true
+		old, ok := existing[rule.ID]
+		switch {
+		case !ok:
+			changes = append(changes, LifecycleChange{Op: LifecycleAdd, ID: rule.ID, Desired: &rule})
+		case !sameLifecycleRule(old, rule):
+			changes = append(changes, LifecycleChange{Op: LifecycleUpdate, ID: rule.ID, Current: &old, Desired: &rule})
+		}
+	}
+	for _, rule := range current {
+		rule := rule
+		if !declared[rule.ID] {
+			changes = append(changes, LifecycleChange{Op: LifecycleRemove, ID: rule.ID, Current: &rule})
+		}
+	}
+
+	sort.SliceStable(changes, func(i, j int) bool { return changes[i].ID < changes[j].ID })
+	return changes
+}
+
+func sameLifecycleRule(a, b LifecycleRule) bool {
+	a.Transitions, b.Transitions = sortedTransitions(a.Transitions), sortedTransitions(b.Transitions)
+	return reflect.DeepEqual(a, b)
+}
+
+func sortedTransitions(transitions []LifecycleTransition) []LifecycleTransition {
+	if len(transitions) == 0 {
+		return nil
+	}
+	sorted := append([]LifecycleTransition(nil), transitions...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Days < sorted[j].Days })
+	return sorted
+}
+
+// validateLifecycle returns the problems of a lifecycle configuration
+func validateLifecycle(cfg BucketLifecycleConfig) []string {
+	var problems []string
+	ids := make(map[string]bool, len(cfg.Rules))
+	for i, rule := range cfg.Rules {
+		field := fmt.Sprintf("lifecycle.rules[%d]", i)
+		switch {
+		case rule.ID == "":
+			problems = append(problems, field+".id cannot be empty")
+		case len(rule.ID) > 255:
+			problems = append(problems, field+".id must not exceed 255 characters")
+		case ids[rule.ID]:
+			problems = append(problems, fmt.Sprintf("%s.id %q is not unique", field, rule.ID))
+		}
+		ids[rule.ID] = true
+
+		if rule.ExpirationDays < 0 || rule.AbortIncompleteMultipartDays < 0 || rule.NoncurrentExpirationDays < 0 {
+			problems = append(problems, field+" days cannot be negative")
+		}
+		if rule.ExpirationDays == 0 && len(rule.Transitions) == 0 &&
+			rule.AbortIncompleteMultipartDays == 0 && rule.NoncurrentExpirationDays == 0 {
+			problems = append(problems, field+" has no action")
+		}
+		for j, t := range rule.Transitions {
+			if t.StorageClass == "" {
+				problems = append(problems, fmt.Sprintf("%s.transitions[%d].storage_class cannot be empty", field, j))
+			}
+			if t.Days < 0 {
+				problems = append(problems, fmt.Sprintf("%s.transitions[%d].days cannot be negative", field, j))
+			}
+			if rule.ExpirationDays > 0 && t.Days >= rule.ExpirationDays {
+				problems = append(problems, fmt.Sprintf("%s.transitions[%d] must happen before expiration", field, j))
+			}
+		}
+	}
+	return problems
+}
@@ -0,0 +1,68 @@
+package storagex_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/gostratum/storagex"
+)
+
+func TestDiffLifecycleRules(t *testing.T) {
+	current := []storagex.LifecycleRule{
+		{ID: "logs", Prefix: "logs/", ExpirationDays: 90, Transitions: []storagex.LifecycleTransition{
+			{Days: 60, StorageClass: storagex.StorageClassGlacier},
+			{Days: 30, StorageClass: storagex.StorageClassStandardIA},
+		}},
+		{ID: "old", ExpirationDays: 1},
+		{ID: "tmp", Prefix: "tmp/", ExpirationDays: 1},
+	}
+	desired := []storagex.LifecycleRule{
+		// Same transitions in another order
+		{ID: "logs", Prefix: "logs/", ExpirationDays: 90, Transitions: []storagex.LifecycleTransition{
+			{Days: 30, StorageClass: storagex.StorageClassStandardIA},
+			{Days: 60, StorageClass: storagex.StorageClassGlacier},
+		}},
+		{ID: "tmp", Prefix: "tmp/", ExpirationDays: 2},
+		{ID: "multipart", AbortIncompleteMultipartDays: 7},
+	}
+
+	changes := storagex.DiffLifecycleRules(current, desired)
+	require.Len(t, changes, 3)
+	assert.Equal(t, storagex.LifecycleAdd, changes[0].Op)
+	assert.Equal(t, "multipart", changes[0].ID)
+	assert.Equal(t, storagex.LifecycleRemove, changes[1].Op)
+	assert.Equal(t, "old", changes[1].ID)
+	assert.Equal(t, storagex.LifecycleUpdate, changes[2].Op)
+	assert.Equal(t, `update rule "tmp": prefix=tmp/ expire=1d -> prefix=tmp/ expire=2d`, changes[2].String())
+
+	assert.Empty(t, storagex.DiffLifecycleRules(desired, desired))
+}
+
+func TestValidateConfig_Lifecycle(t *testing.T) {
+	cfg := storagex.DefaultConfig()
+	cfg.Bucket = "lifecycle"
+	cfg.Lifecycle.Rules = []storagex.LifecycleRule{
+		{ID: "logs", ExpirationDays: 30},
+		{ID: "logs", ExpirationDays: 30},
+		{ID: "noop"},
+		{ID: "late", ExpirationDays: 30, Transitions: []storagex.LifecycleTransition{{Days: 60, StorageClass: storagex.StorageClassGlacier}}},
+		{ExpirationDays: 1},
+	}
+
+	err := storagex.ValidateConfig(cfg)
+	require.Error(t, err)
+	for _, problem := range []string{
+		`lifecycle.rules[1].id "logs" is not unique`,
+		"lifecycle.rules[2] has no action",
+		"lifecycle.rules[3].transitions[0] must happen before expiration",
+		"lifecycle.rules[4].id cannot be empty",
+	} {
+		assert.True(t, strings.Contains(err.Error(), problem), "missing %q in %v", problem, err)
+	}
+
+	cfg.Lifecycle.Rules = cfg.Lifecycle.Rules[:1]
+	assert.NoError(t, storagex.ValidateConfig(cfg))
+}
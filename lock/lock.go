@@ -0,0 +1,386 @@
+// Package lock provides distributed locks stored as objects, for jobs that
+// must not run on two replicas at once, without a separate lock service.
+//
+// A lock is an object holding its owner and an expiry time. It is acquired
+// by creating the object with a conditional write (If-None-Match: *),
+// renewed in the background by replacing it only if its ETag is unchanged
+// (If-Match), and released by deleting it the same way. A lease that is not
+// renewed before it expires can be taken over by another owner, again with
+// an If-Match write, so only one contender wins. The storage must implement
+// storagex.ConditionalWriter (the S3 adapter and MockStorage do).
+//
+// Expiry compares the embedded expiry time with the local clock of the
+// contender, so clocks must be roughly in sync; keep TTL well above the
+// expected clock skew.
+//
+// Example usage:
+//
+//	locker, err := lock.New(storage, lock.Options{TTL: 30 * time.Second})
+//	err = locker.Do(ctx, "locks/nightly-report", func(ctx context.Context) error {
+//	    return buildReport(ctx) // ctx is cancelled if the lease is lost
+//	})
+package lock
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gostratum/storagex"
+)
+
+var (
+	// ErrLocked indicates the lock is held by another owner and has not
+	// expired. It wraps storagex.ErrConflict.
+	ErrLocked = fmt.Errorf("lock: held by another owner: %w", storagex.ErrConflict)
+
+	// ErrLost indicates a lease expired and was taken over, or its object
+	// was removed, before it was renewed or released
+	ErrLost = errors.New("lock: lease lost")
+)
+
+// Options configures a Locker
+type Options struct {
+	// TTL is how long a lease stays valid without renewal (default: 30s)
+	TTL time.Duration
+
+	// RenewInterval is how often held leases are renewed (default: TTL/3)
+	RenewInterval time.Duration
+
+	// RetryInterval is how long Acquire waits between attempts
+	// (default: 1s)
+	RetryInterval time.Duration
+
+	// Owner identifies this process in lock objects (default: host name
+	// and process ID)
+	Owner string
+
+	// Clock is an optional time source (useful for testing)
+	Clock func() time.Time
+}
+
+// Locker acquires leases on keys of a storage
+type Locker struct {
+	writer storagex.ConditionalWriter
+	reader storagex.Storage
+	opts   Options
+}
+
+// New creates a Locker. It fails with storagex.ErrInvalidConfig if storage
+// (or a storage it wraps) does not implement storagex.ConditionalWriter.
+func New(storage storagex.Storage, opts Options) (*Locker, error) {
+	writer, ok := storagex.Capability[storagex.ConditionalWriter](storage)
+	if !ok {
+		return nil, fmt.Errorf("lock: storage does not support conditional writes: %w", storagex.ErrInvalidConfig)
+	}
+	// Read through the same storage that writes, so a read cache that
+	// implements ConditionalWriter sees its own invalidations
+	reader, ok := writer.(storagex.Storage)
+	if !ok {
+		reader = storage
+	}
+
+	if opts.TTL <= 0 {
+		opts.TTL = 30 * time.Second
+	}
+	if opts.RenewInterval <= 0 || opts.RenewInterval >= opts.TTL {
+		opts.RenewInterval = opts.TTL / 3
+	}
+	if opts.RetryInterval <= 0 {
+		opts.RetryInterval = time.Second
+	}
+	if opts.Owner == "" {
+		host, _ := os.Hostname()
+		opts.Owner = fmt.Sprintf("%s:%d", host, os.Getpid())
+	}
+	if opts.Clock == nil {
+		opts.Clock = time.Now
+	}
+	return &Locker{writer: writer, reader: reader, opts: opts}, nil
+}
+
+// record is the content of a lock object
+type record struct {
+	Owner    string    `json:"owner"`
+	Token    string    `json:"token"`
+	Acquired time.Time `json:"acquired"`
+	Expires  time.Time `json:"expires"`
+}
+
+func (r record) reader() io.Reader {
+	data, _ := json.Marshal(r)
+	return bytes.NewReader(data)
+}
+
+var putOptions = &storagex.PutOptions{ContentType: "application/json"}
+
+func newToken() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// TryAcquire takes the lock on key if it is free or its lease expired, and
+// fails with ErrLocked otherwise. The lease is renewed in the background
+// until it is released or ctx is done; cancelling ctx releases it.
+func (l *Locker) TryAcquire(ctx context.Context, key string) (*Lease, error) {
+	// A lock released between the create and the read is retried once
+	for attempt := 0; attempt < 2; attempt++ {
+		now := l.opts.Clock()
+		rec := record{Owner: l.opts.Owner, Token: newToken(), Acquired: now, Expires: now.Add(l.opts.TTL)}
+
+		stat, err := l.writer.PutIfAbsent(ctx, key, rec.reader(), putOptions)
+		if err == nil {
+			return l.start(ctx, key, rec, stat.ETag), nil
+		}
+		if !errors.Is(err, storagex.ErrConflict) {
+			return nil, err
+		}
+
+		current, etag, err := l.read(ctx, key)
+		if storagex.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if now.Before(current.Expires) {
+			return nil, fmt.Errorf("%w: %q is held by %s until %s", ErrLocked, key, current.Owner, current.Expires.Format(time.RFC3339))
+		}
+
+		// Take over the expired lease; of several contenders only the
+		// first If-Match write succeeds
+		stat, err = l.writer.PutIfMatch(ctx, key, rec.reader(), etag, putOptions)
+		switch {
+		case err == nil:
+			return l.start(ctx, key, rec, stat.ETag), nil
+		case storagex.IsNotFound(err):
+			continue
+		case storagex.IsPreconditionFailed(err):
+			return nil, fmt.Errorf("%w: %q was taken over by another owner", ErrLocked, key)
+		default:
+			return nil, err
+		}
+	}
+	return nil, fmt.Errorf("%w: %q", ErrLocked, key)
+}
+
+// Acquire waits until it takes the lock on key or ctx is done. See
+// TryAcquire.
+func (l *Locker) Acquire(ctx context.Context, key string) (*Lease, error) {
+	for {
+		lease, err := l.TryAcquire(ctx, key)
+		if !errors.Is(err, ErrLocked) {
+			return lease, err
+		}
+		timer := time.NewTimer(l.opts.RetryInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// Do runs fn while holding the lock on key, waiting for it like Acquire.
+// The context passed to fn is cancelled if the lease is lost. The lease is
+// released when fn returns; Do returns ErrLost if it was lost meanwhile.
+func (l *Locker) Do(ctx context.Context, key string, fn func(ctx context.Context) error) error {
+	lease, err := l.Acquire(ctx, key)
+	if err != nil {
+		return err
+	}
+	err = fn(lease.Context())
+	if releaseErr := lease.Release(context.WithoutCancel(ctx)); releaseErr != nil {
+		err = errors.Join(err, releaseErr)
+	}
+	return err
+}
+
+// read returns the record and ETag of a lock object. A record that cannot
+// be decoded expires a TTL after it was written.
+func (l *Locker) read(ctx context.Context, key string) (record, string, error) {
+	body, stat, err := l.reader.Get(ctx, key)
+	if err != nil {
+		return record{}, "", err
+	}
+	defer body.Close()
+
+	var rec record
+	if err := json.NewDecoder(io.LimitReader(body, 64<<10)).Decode(&rec); err != nil || rec.Expires.IsZero() {
+		rec = record{Owner: "unknown", Expires: stat.LastModified.Add(l.opts.TTL)}
+	}
+	return rec, stat.ETag, nil
+}
+
+// start returns a held lease and begins renewing it
+func (l *Locker) start(ctx context.Context, key string, rec record, etag string) *Lease {
+	leaseCtx, cancel := context.WithCancelCause(ctx)
+	lease := &Lease{
+		locker:  l,
+		key:     key,
+		record:  rec,
+		etag:    etag,
+		ctx:     leaseCtx,
+		cancel:  cancel,
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go lease.renew(ctx)
+	return lease
+}
+
+// Lease is a held lock
+type Lease struct {
+	locker *Locker
+	key    string
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+
+	stopOnce sync.Once
+	stop     chan struct{}
+	stopped  chan struct{}
+
+	mu     sync.Mutex
+	record record
+	etag   string
+	state  error // nil while held, then ErrLost or errReleased
+}
+
+// errReleased marks a released lease
+var errReleased = errors.New("lock: lease released")
+
+// Key returns the locked key
+func (l *Lease) Key() string {
+	return l.key
+}
+
+// Expires returns when the lease expires unless it is renewed
+func (l *Lease) Expires() time.Time {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.record.Expires
+}
+
+// Context returns a context that is done once the lease is lost or
+// released, or the context it was acquired with is done.
+// context.Cause reports ErrLost for a lost lease.
+func (l *Lease) Context() context.Context {
+	return l.ctx
+}
+
+// Renew extends the lease by the TTL. It fails with ErrLost if the lease
+// was taken over or removed. Leases are renewed automatically; Renew is for
+// callers about to start a long step.
+func (l *Lease) Renew(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.state != nil {
+		return l.stateError()
+	}
+
+	rec := l.record
+	rec.Expires = l.locker.opts.Clock().Add(l.locker.opts.TTL)
+	stat, err := l.locker.writer.PutIfMatch(ctx, l.key, rec.reader(), l.etag, putOptions)
+	if storagex.IsPreconditionFailed(err) || storagex.IsNotFound(err) {
+		l.lose()
+		return ErrLost
+	}
+	if err != nil {
+		return err
+	}
+	l.record = rec
+	l.etag = stat.ETag
+	return nil
+}
+
+// Release stops renewing the lease and deletes the lock object. It returns
+// ErrLost if the lease was lost before; releasing twice is not an error.
+func (l *Lease) Release(ctx context.Context) error {
+	l.stopOnce.Do(func() { close(l.stop) })
+	<-l.stopped
+	return l.release(ctx)
+}
+
+// release deletes the lock object unless the lease is no longer held
+func (l *Lease) release(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.state != nil {
+		return l.stateError()
+	}
+
+	err := l.locker.writer.DeleteIfMatch(ctx, l.key, l.etag)
+	if storagex.IsPreconditionFailed(err) || storagex.IsNotFound(err) {
+		l.lose()
+		return ErrLost
+	}
+	if err != nil {
+		// The lock expires by itself
+		l.state = errReleased
+		l.cancel(nil)
+		return err
+	}
+	l.state = errReleased
+	l.cancel(nil)
+	return nil
+}
+
+// lose marks the lease lost. Callers hold l.mu.
+func (l *Lease) lose() {
+	l.state = ErrLost
+	l.cancel(ErrLost)
+}
+
+// stateError returns the error for a lease that is no longer held. Callers
+// hold l.mu.
+func (l *Lease) stateError() error {
+	if l.state == ErrLost {
+		return ErrLost
+	}
+	return nil
+}
+
+// renew renews the lease every RenewInterval until it is released, lost or
+// parent is done, in which case it releases the lease
+func (l *Lease) renew(parent context.Context) {
+	defer close(l.stopped)
+	ticker := time.NewTicker(l.locker.opts.RenewInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-parent.Done():
+			ctx, cancel := context.WithTimeout(context.WithoutCancel(parent), l.locker.opts.RenewInterval)
+			l.release(ctx)
+			cancel()
+			return
+		case <-ticker.C:
+			err := l.Renew(l.ctx)
+			if errors.Is(err, ErrLost) {
+				return
+			}
+			if err != nil && !l.locker.opts.Clock().Before(l.Expires()) {
+				// Renewals failed until the lease expired, so another
+				// owner may hold the lock now
+				l.mu.Lock()
+				if l.state == nil {
+					l.lose()
+				}
+				l.mu.Unlock()
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package lock_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/gostratum/storagex"
+	"github.com/gostratum/storagex/internal/testutil"
+	"github.com/gostratum/storagex/lock"
+)
+
+// fakeClock is a settable time source
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func exists(t *testing.T, storage storagex.Storage, key string) bool {
+	t.Helper()
+	_, err := storage.Head(context.Background(), key)
+	if storagex.IsNotFound(err) {
+		return false
+	}
+	require.NoError(t, err)
+	return true
+}
+
+func TestTryAcquire_OneWinner(t *testing.T) {
+	ctx := context.Background()
+	mock := testutil.NewMockStorage()
+
+	var wins, locked atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			locker, err := lock.New(mock, lock.Options{TTL: time.Minute})
+			require.NoError(t, err)
+			lease, err := locker.TryAcquire(ctx, "locks/job")
+			switch {
+			case err == nil:
+				wins.Add(1)
+				t.Cleanup(func() { lease.Release(ctx) })
+			case errors.Is(err, lock.ErrLocked):
+				locked.Add(1)
+				assert.ErrorIs(t, err, storagex.ErrConflict)
+			default:
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), wins.Load())
+	assert.Equal(t, int32(9), locked.Load())
+}
+
+func TestTryAcquire_TakesOverExpiredLease(t *testing.T) {
+	ctx := context.Background()
+	mock := testutil.NewMockStorage()
+	clock := &fakeClock{now: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+
+	first, err := lock.New(mock, lock.Options{TTL: 10 * time.Second, Owner: "first", Clock: clock.Now})
+	require.NoError(t, err)
+	second, err := lock.New(mock, lock.Options{TTL: 10 * time.Second, Owner: "second", Clock: clock.Now})
+	require.NoError(t, err)
+
+	held, err := first.TryAcquire(ctx, "locks/job")
+	require.NoError(t, err)
+	assert.Equal(t, clock.Now().Add(10*time.Second), held.Expires())
+
+	_, err = second.TryAcquire(ctx, "locks/job")
+	assert.ErrorIs(t, err, lock.ErrLocked)
+	assert.Contains(t, err.Error(), "held by first")
+
+	// The first owner stalls past its TTL
+	clock.Advance(11 * time.Second)
+	taken, err := second.TryAcquire(ctx, "locks/job")
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, held.Renew(ctx), lock.ErrLost)
+	<-held.Context().Done()
+	assert.ErrorIs(t, context.Cause(held.Context()), lock.ErrLost)
+	assert.ErrorIs(t, held.Release(ctx), lock.ErrLost)
+	// The lost lease did not remove the new owner's lock
+	assert.True(t, exists(t, mock, "locks/job"))
+
+	require.NoError(t, taken.Release(ctx))
+	assert.False(t, exists(t, mock, "locks/job"))
+	require.NoError(t, taken.Release(ctx))
+}
+
+func TestLease_RenewsInBackground(t *testing.T) {
+	ctx := context.Background()
+	mock := testutil.NewMockStorage()
+
+	locker, err := lock.New(mock, lock.Options{TTL: 200 * time.Millisecond, RenewInterval: 20 * time.Millisecond})
+	require.NoError(t, err)
+	lease, err := locker.TryAcquire(ctx, "locks/job")
+	require.NoError(t, err)
+	defer lease.Release(ctx)
+	acquiredUntil := lease.Expires()
+
+	time.Sleep(400 * time.Millisecond)
+	assert.True(t, lease.Expires().After(acquiredUntil))
+	assert.NoError(t, lease.Context().Err())
+
+	other, err := lock.New(mock, lock.Options{TTL: time.Second})
+	require.NoError(t, err)
+	_, err = other.TryAcquire(ctx, "locks/job")
+	assert.ErrorIs(t, err, lock.ErrLocked)
+}
+
+func TestLease_ReleasedOnCancellation(t *testing.T) {
+	mock := testutil.NewMockStorage()
+	locker, err := lock.New(mock, lock.Options{TTL: time.Minute})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	lease, err := locker.TryAcquire(ctx, "locks/job")
+	require.NoError(t, err)
+	assert.True(t, exists(t, mock, "locks/job"))
+
+	cancel()
+	require.Eventually(t, func() bool { return !exists(t, mock, "locks/job") }, time.Second, 5*time.Millisecond)
+	assert.NoError(t, lease.Release(context.Background()))
+}
+
+func TestLocker_DoSerializes(t *testing.T) {
+	ctx := context.Background()
+	mock := testutil.NewMockStorage()
+
+	var running, overlaps, runs atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			locker, err := lock.New(mock, lock.Options{TTL: time.Minute, RetryInterval: 5 * time.Millisecond})
+			require.NoError(t, err)
+			err = locker.Do(ctx, "locks/job", func(ctx context.Context) error {
+				if running.Add(1) > 1 {
+					overlaps.Add(1)
+				}
+				time.Sleep(20 * time.Millisecond)
+				running.Add(-1)
+				runs.Add(1)
+				return nil
+			})
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(3), runs.Load())
+	assert.Zero(t, overlaps.Load())
+	assert.False(t, exists(t, mock, "locks/job"))
+}
+
+func TestAcquire_WaitsForContext(t *testing.T) {
+	mock := testutil.NewMockStorage()
+	locker, err := lock.New(mock, lock.Options{TTL: time.Minute, RetryInterval: 5 * time.Millisecond})
+	require.NoError(t, err)
+	lease, err := locker.TryAcquire(context.Background(), "locks/job")
+	require.NoError(t, err)
+	defer lease.Release(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	_, err = locker.Acquire(ctx, "locks/job")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestNew_RequiresConditionalWrites(t *testing.T) {
+	_, err := lock.New(testutil.PlainStorage{Storage: testutil.NewMockStorage()}, lock.Options{})
+	assert.ErrorIs(t, err, storagex.ErrInvalidConfig)
+
+	// Found through decorators
+	_, err = lock.New(storagex.NewRetryStorage(testutil.NewMockStorage(), storagex.RetryPolicy{}), lock.Options{})
+	assert.NoError(t, err)
+	_, err = lock.New(storagex.NewRetryStorage(testutil.PlainStorage{Storage: testutil.NewMockStorage()}, storagex.RetryPolicy{}), lock.Options{})
+	assert.ErrorIs(t, err, storagex.ErrInvalidConfig)
+}
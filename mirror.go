@@ -0,0 +1,588 @@
+package storagex
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// ErrReplication indicates a write succeeded on the primary but could not be
+// replicated to (or queued for) a secondary
+var ErrReplication = errors.New("storagex: replication failed")
+
+// MirrorMode selects when a MirrorStorage replicates writes
+type MirrorMode int
+
+const (
+	// MirrorSync replicates a write to every secondary before the call
+	// returns. Failed secondary writes are queued and retried.
+	MirrorSync MirrorMode = iota
+
+	// MirrorAsync queues a write for replication and returns once the
+	// primary has it; a background worker replicates it
+	MirrorAsync
+)
+
+// String returns the name of the mode
+func (m MirrorMode) String() string {
+	switch m {
+	case MirrorSync:
+		return "sync"
+	case MirrorAsync:
+		return "async"
+	default:
+		return "unknown"
+	}
+}
+
+// Replication results recorded through the Instrumenter
+const (
+	ReplicationReplicated = "replicated"
+	ReplicationFailed     = "failed"
+)
+
+// MirrorOptions configures a MirrorStorage
+type MirrorOptions struct {
+	// Mode selects synchronous or asynchronous replication
+	// (default: MirrorSync)
+	Mode MirrorMode
+
+	// Queue holds writes waiting for replication or for a retry
+	// (default: NewMemoryReplicationQueue). Use NewFileReplicationQueue
+	// so pending writes survive restarts.
+	Queue ReplicationQueue
+
+	// RequireReplication makes synchronous writes fail with ErrReplication
+	// when a secondary write fails. The primary keeps the object and the
+	// secondary write is still queued for retry.
+	RequireReplication bool
+
+	// Fallback decides which primary read errors are retried against the
+	// secondaries, in order (default: ErrNotFound and ErrTimeout, which
+	// includes ErrThrottled)
+	Fallback func(error) bool
+
+	// RetryInitial is the delay before a failed secondary write is retried.
+	// Later delays double up to RetryMax. (default: 1s)
+	RetryInitial time.Duration
+
+	// RetryMax caps the delay between retries (default: 5m)
+	RetryMax time.Duration
+
+	// PollInterval is how often the worker looks for due retries
+	// (default: 1s)
+	PollInterval time.Duration
+
+	// BatchSize is the number of tasks the worker takes from the queue at
+	// a time (default: 100)
+	BatchSize int
+
+	// Instrumenter optionally records replication results, queue depth
+	// and read fallbacks
+	Instrumenter *Instrumenter
+
+	// Clock is an optional time source (useful for testing)
+	Clock func() time.Time
+}
+
+// MirrorStorage is a Storage that writes to a primary and replicates every
+// write to one or more secondaries, possibly on different providers, for
+// disaster recovery.
+//
+// Writes go to the primary first; its result is the call's result.
+// Replication then copies the object from the primary to each secondary
+// (or deletes it there if the primary no longer has it), so secondaries
+// converge on the primary's current state however writes interleave.
+// Multipart sessions run on the primary and are replicated on completion.
+//
+// Reads, listings and presigning use the primary. Get, Head and List fall
+// back to the secondaries when the primary fails with an error accepted by
+// MirrorOptions.Fallback. With asynchronous replication, a fallback read
+// may return an object the primary has already replaced or deleted.
+//
+// NewMirrorStorage starts a worker that replicates queued writes; Close
+// stops it. Use Reconcile to repair secondaries that drifted anyway (e.g.,
+// after losing an in-memory queue).
+type MirrorStorage struct {
+	primary     Storage
+	secondaries []NamedStorage
+	opts        MirrorOptions
+
+	// locks serialize replication of a key, so an older copy cannot
+	// finish after a newer one
+	locks keyLocks
+
+	wake      chan struct{}
+	cancel    context.CancelFunc
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewMirrorStorage composes primary with secondaries, whose names identify
+// them in queued tasks and metrics, and starts the replication worker
+func NewMirrorStorage(primary Storage, secondaries []NamedStorage, opts MirrorOptions) (*MirrorStorage, error) {
+	if primary == nil || len(secondaries) == 0 {
+		return nil, fmt.Errorf("%w: mirror needs a primary and at least one secondary", ErrInvalidConfig)
+	}
+	seen := make(map[string]bool, len(secondaries))
+	for _, s := range secondaries {
+		if s.Name == "" || s.Storage == nil || seen[s.Name] {
+			return nil, fmt.Errorf("%w: mirror secondaries need unique names and a storage", ErrInvalidConfig)
+		}
+		seen[s.Name] = true
+	}
+
+	if opts.Queue == nil {
+		opts.Queue = NewMemoryReplicationQueue()
+	}
+	if opts.Fallback == nil {
+		opts.Fallback = func(err error) bool {
+			return errors.Is(err, ErrNotFound) || errors.Is(err, ErrTimeout)
+		}
+	}
+	if opts.RetryInitial <= 0 {
+		opts.RetryInitial = time.Second
+	}
+	if opts.RetryMax <= 0 {
+		opts.RetryMax = 5 * time.Minute
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = time.Second
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 100
+	}
+	if opts.Clock == nil {
+		opts.Clock = time.Now
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	m := &MirrorStorage{
+		primary:     primary,
+		secondaries: secondaries,
+		opts:        opts,
+		wake:        make(chan struct{}, 1),
+		cancel:      cancel,
+		done:        make(chan struct{}),
+	}
+	go m.run(ctx)
+	return m, nil
+}
+
+// Close stops the replication worker. Queued tasks stay in the queue.
+func (m *MirrorStorage) Close() error {
+	m.closeOnce.Do(func() {
+		m.cancel()
+		<-m.done
+	})
+	return nil
+}
+
+// Pending returns the number of writes waiting for replication
+func (m *MirrorStorage) Pending() (int, error) {
+	return m.opts.Queue.Len()
+}
+
+// Drain attempts every queued task once, ignoring retry schedules, and
+// returns the errors of the tasks that still fail
+func (m *MirrorStorage) Drain(ctx context.Context) error {
+	tasks, err := m.opts.Queue.Due(time.Unix(1<<62, 0), 0)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, task := range tasks {
+		if err := m.process(ctx, task); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// run replicates due tasks until the worker is stopped
+func (m *MirrorStorage) run(ctx context.Context) {
+	defer close(m.done)
+	ticker := time.NewTicker(m.opts.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-m.wake:
+		case <-ticker.C:
+		}
+
+		for ctx.Err() == nil {
+			tasks, err := m.opts.Queue.Due(m.opts.Clock(), m.opts.BatchSize)
+			if err != nil || len(tasks) == 0 {
+				break
+			}
+			failed := 0
+			for _, task := range tasks {
+				if m.process(ctx, task) != nil {
+					failed++
+				}
+			}
+			if failed == len(tasks) {
+				// Nothing progressed; wait for the next tick
+				break
+			}
+		}
+	}
+}
+
+// process replicates a queued task and removes or reschedules it
+func (m *MirrorStorage) process(ctx context.Context, task ReplicationTask) error {
+	// Tasks of a secondary no longer in the mirror are dropped
+	var err error
+	if secondary, ok := m.secondary(task.Secondary); ok {
+		err = m.replicate(ctx, secondary, task.Key)
+	}
+
+	if err == nil {
+		if qerr := m.opts.Queue.Remove(task); qerr != nil {
+			return qerr
+		}
+		m.recordQueue()
+		return nil
+	}
+
+	task.Attempts++
+	task.LastError = err.Error()
+	task.NextAttempt = m.opts.Clock().Add(m.backoff(task.Attempts))
+	if qerr := m.opts.Queue.Reschedule(task); qerr != nil {
+		return errors.Join(err, qerr)
+	}
+	return err
+}
+
+// backoff returns the delay before retry number attempts
+func (m *MirrorStorage) backoff(attempts int) time.Duration {
+	delay := m.opts.RetryInitial
+	for i := 1; i < attempts && delay < m.opts.RetryMax; i++ {
+		delay *= 2
+	}
+	if delay > m.opts.RetryMax {
+		return m.opts.RetryMax
+	}
+	return delay
+}
+
+func (m *MirrorStorage) secondary(name string) (NamedStorage, bool) {
+	for _, s := range m.secondaries {
+		if s.Name == name {
+			return s, true
+		}
+	}
+	return NamedStorage{}, false
+}
+
+// replicate brings key on secondary in line with the primary
+func (m *MirrorStorage) replicate(ctx context.Context, secondary NamedStorage, key string) error {
+	defer m.locks.lock(key)()
+
+	err := copyObject(ctx, m.primary, secondary.Storage, key)
+	if IsNotFound(err) {
+		err = secondary.Storage.Delete(ctx, key)
+	}
+
+	result := ReplicationReplicated
+	if err != nil {
+		result = ReplicationFailed
+		err = fmt.Errorf("replicate %q to %s: %w", key, secondary.Name, err)
+	}
+	if m.opts.Instrumenter != nil {
+		m.opts.Instrumenter.RecordReplication(secondary.Name, result)
+	}
+	return err
+}
+
+// copyObject copies key from src to dst, keeping its content type and
+// metadata. It returns src's ErrNotFound if src has no such object.
+func copyObject(ctx context.Context, src, dst Storage, key string) error {
+	reader, stat, err := src.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	_, err = dst.Put(ctx, key, reader, &PutOptions{
+		ContentType: stat.ContentType,
+		Metadata:    stat.Metadata,
+		Overwrite:   true,
+	})
+	return err
+}
+
+func (m *MirrorStorage) enqueue(secondary, key string) error {
+	now := m.opts.Clock()
+	return m.opts.Queue.Push(ReplicationTask{
+		Secondary:   secondary,
+		Key:         key,
+		Enqueued:    now,
+		NextAttempt: now,
+	})
+}
+
+func (m *MirrorStorage) recordQueue() {
+	if m.opts.Instrumenter == nil {
+		return
+	}
+	if n, err := m.opts.Queue.Len(); err == nil {
+		m.opts.Instrumenter.RecordReplicationQueueDepth(n)
+	}
+}
+
+// replicateWrite replicates keys written by a successful primary call of op
+func (m *MirrorStorage) replicateWrite(ctx context.Context, op string, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	defer m.recordQueue()
+
+	if m.opts.Mode == MirrorAsync {
+		var errs []error
+		for _, s := range m.secondaries {
+			for _, key := range keys {
+				if err := m.enqueue(s.Name, key); err != nil {
+					errs = append(errs, err)
+				}
+			}
+		}
+		select {
+		case m.wake <- struct{}{}:
+		default:
+		}
+		if len(errs) > 0 {
+			return &StorageError{Op: op, Key: keys[0], Err: fmt.Errorf("%w: %w", ErrReplication, errors.Join(errs...))}
+		}
+		return nil
+	}
+
+	var (
+		mu   sync.Mutex
+		errs []error
+		wg   sync.WaitGroup
+	)
+	for _, s := range m.secondaries {
+		wg.Add(1)
+		go func(s NamedStorage) {
+			defer wg.Done()
+			for _, key := range keys {
+				err := m.replicate(ctx, s, key)
+				if err == nil {
+					continue
+				}
+				if qerr := m.enqueue(s.Name, key); qerr != nil {
+					err = errors.Join(err, qerr)
+				}
+				mu.Lock()
+				errs = append(errs, err)
+				mu.Unlock()
+			}
+		}(s)
+	}
+	wg.Wait()
+
+	if len(errs) > 0 && m.opts.RequireReplication {
+		return &StorageError{Op: op, Key: keys[0], Err: fmt.Errorf("%w: %w", ErrReplication, errors.Join(errs...))}
+	}
+	return nil
+}
+
+// withFallback runs a read against the primary and, if it fails with an
+// error accepted by Fallback, against each secondary in turn. The primary's
+// error is returned when every secondary fails too.
+func withFallback[T any](m *MirrorStorage, op string, fn func(Storage) (T, error)) (T, error) {
+	v, err := fn(m.primary)
+	if err == nil || !m.opts.Fallback(err) {
+		return v, err
+	}
+	for _, s := range m.secondaries {
+		if sv, serr := fn(s.Storage); serr == nil {
+			if m.opts.Instrumenter != nil {
+				m.opts.Instrumenter.RecordReadFallback(op, s.Name)
+			}
+			return sv, nil
+		}
+	}
+	return v, err
+}
+
+// written replicates key after a successful primary write
+func (m *MirrorStorage) written(ctx context.Context, op, key string, stat Stat, err error) (Stat, error) {
+	if err != nil {
+		return stat, err
+	}
+	return stat, m.replicateWrite(ctx, op, key)
+}
+
+// Put stores an object on the primary and replicates it
+func (m *MirrorStorage) Put(ctx context.Context, key string, r io.Reader, opts *PutOptions) (Stat, error) {
+	stat, err := m.primary.Put(ctx, key, r, opts)
+	return m.written(ctx, "put", key, stat, err)
+}
+
+// PutBytes stores an object on the primary and replicates it
+func (m *MirrorStorage) PutBytes(ctx context.Context, key string, data []byte, opts *PutOptions) (Stat, error) {
+	stat, err := m.primary.PutBytes(ctx, key, data, opts)
+	return m.written(ctx, "put", key, stat, err)
+}
+
+// PutFile stores an object on the primary and replicates it
+func (m *MirrorStorage) PutFile(ctx context.Context, key string, path string, opts *PutOptions) (Stat, error) {
+	stat, err := m.primary.PutFile(ctx, key, path, opts)
+	return m.written(ctx, "put_file", key, stat, err)
+}
+
+// ForwardsTo reports that conditional writes are forwarded to the primary,
+// so a MirrorStorage supports them only if the primary does
+func (m *MirrorStorage) ForwardsTo(iface reflect.Type) (Storage, bool) {
+	return m.primary, iface == conditionalWriterType
+}
+
+// conditionalWriter returns the ConditionalWriter of the primary
+func (m *MirrorStorage) conditionalWriter(op, key string) (ConditionalWriter, error) {
+	writer, ok := Capability[ConditionalWriter](m.primary)
+	if !ok {
+		return nil, &StorageError{Op: op, Key: key, Err: fmt.Errorf("primary does not support conditional writes: %w", ErrInvalidConfig)}
+	}
+	return writer, nil
+}
+
+// PutIfAbsent stores an object on the primary if the key does not exist
+// there, and replicates it. The condition is checked on the primary only.
+// It fails with ErrInvalidConfig if the primary does not implement
+// ConditionalWriter.
+func (m *MirrorStorage) PutIfAbsent(ctx context.Context, key string, r io.Reader, opts *PutOptions) (Stat, error) {
+	writer, err := m.conditionalWriter("put_if_absent", key)
+	if err != nil {
+		return Stat{}, err
+	}
+	stat, err := writer.PutIfAbsent(ctx, key, r, opts)
+	return m.written(ctx, "put_if_absent", key, stat, err)
+}
+
+// PutIfMatch replaces an object on the primary if its ETag there is etag,
+// and replicates it. See PutIfAbsent.
+func (m *MirrorStorage) PutIfMatch(ctx context.Context, key string, r io.Reader, etag string, opts *PutOptions) (Stat, error) {
+	writer, err := m.conditionalWriter("put_if_match", key)
+	if err != nil {
+		return Stat{}, err
+	}
+	stat, err := writer.PutIfMatch(ctx, key, r, etag, opts)
+	return m.written(ctx, "put_if_match", key, stat, err)
+}
+
+// DeleteIfMatch removes an object from the primary if its ETag there is
+// etag, and replicates the deletion. See PutIfAbsent.
+func (m *MirrorStorage) DeleteIfMatch(ctx context.Context, key, etag string) error {
+	writer, err := m.conditionalWriter("delete_if_match", key)
+	if err != nil {
+		return err
+	}
+	if err := writer.DeleteIfMatch(ctx, key, etag); err != nil {
+		return err
+	}
+	return m.replicateWrite(ctx, "delete_if_match", key)
+}
+
+// Get retrieves an object, falling back to the secondaries
+func (m *MirrorStorage) Get(ctx context.Context, key string) (ReaderAtCloser, Stat, error) {
+	res, err := withFallback(m, "get", func(s Storage) (getResult, error) {
+		reader, stat, err := s.Get(ctx, key)
+		return getResult{reader: reader, stat: stat, err: err}, err
+	})
+	return res.reader, res.stat, err
+}
+
+// Head retrieves object metadata, falling back to the secondaries
+func (m *MirrorStorage) Head(ctx context.Context, key string) (Stat, error) {
+	return withFallback(m, "head", func(s Storage) (Stat, error) {
+		return s.Head(ctx, key)
+	})
+}
+
+// List retrieves objects from the primary, falling back to the secondaries
+func (m *MirrorStorage) List(ctx context.Context, opts ListOptions) (ListPage, error) {
+	return withFallback(m, "list", func(s Storage) (ListPage, error) {
+		return s.List(ctx, opts)
+	})
+}
+
+// Delete removes an object from the primary and replicates the deletion
+func (m *MirrorStorage) Delete(ctx context.Context, key string) error {
+	if err := m.primary.Delete(ctx, key); err != nil {
+		return err
+	}
+	return m.replicateWrite(ctx, "delete", key)
+}
+
+// DeleteBatch removes objects from the primary and replicates the
+// deletions of the keys it removed
+func (m *MirrorStorage) DeleteBatch(ctx context.Context, keys []string) ([]string, error) {
+	failed, err := m.primary.DeleteBatch(ctx, keys)
+	if err != nil {
+		return failed, err
+	}
+
+	skip := make(map[string]bool, len(failed))
+	for _, key := range failed {
+		skip[key] = true
+	}
+	deleted := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if !skip[key] {
+			deleted = append(deleted, key)
+		}
+	}
+	return failed, m.replicateWrite(ctx, "delete_batch", deleted...)
+}
+
+// MultipartUpload uploads an object to the primary and replicates it
+func (m *MirrorStorage) MultipartUpload(ctx context.Context, key string, src io.Reader, cfg *MultipartConfig, putOpts *PutOptions) (Stat, error) {
+	stat, err := m.primary.MultipartUpload(ctx, key, src, cfg, putOpts)
+	return m.written(ctx, "multipart_upload", key, stat, err)
+}
+
+// CreateMultipart initiates a multipart upload session on the primary
+func (m *MirrorStorage) CreateMultipart(ctx context.Context, key string, putOpts *PutOptions) (string, error) {
+	return m.primary.CreateMultipart(ctx, key, putOpts)
+}
+
+// UploadPart uploads a single part to the primary
+func (m *MirrorStorage) UploadPart(ctx context.Context, key, uploadID string, partNumber int32, part io.Reader, size int64) (string, error) {
+	return m.primary.UploadPart(ctx, key, uploadID, partNumber, part, size)
+}
+
+// CompleteMultipart finalizes a multipart upload on the primary and
+// replicates the object
+func (m *MirrorStorage) CompleteMultipart(ctx context.Context, key, uploadID string, etags []string) (Stat, error) {
+	stat, err := m.primary.CompleteMultipart(ctx, key, uploadID, etags)
+	return m.written(ctx, "complete_multipart", key, stat, err)
+}
+
+// AbortMultipart cancels a multipart upload on the primary
+func (m *MirrorStorage) AbortMultipart(ctx context.Context, key, uploadID string) error {
+	return m.primary.AbortMultipart(ctx, key, uploadID)
+}
+
+// PresignGet generates a presigned download URL for the primary
+func (m *MirrorStorage) PresignGet(ctx context.Context, key string, opts *PresignOptions) (string, error) {
+	return m.primary.PresignGet(ctx, key, opts)
+}
+
+// PresignPut generates a presigned upload URL for the primary. Objects
+// uploaded with it bypass the mirror and are only replicated by Reconcile.
+func (m *MirrorStorage) PresignPut(ctx context.Context, key string, opts *PresignOptions) (string, error) {
+	return m.primary.PresignPut(ctx, key, opts)
+}
+
+var (
+	_ Storage           = (*MirrorStorage)(nil)
+	_ ConditionalWriter = (*MirrorStorage)(nil)
+)
@@ -0,0 +1,238 @@
+package storagex
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ReplicationTask asks for one key of a secondary to be brought in line with
+// the primary: copied if the primary has the object, deleted if it does not.
+// Tasks carry no object data, so a task may be retried at any time and a
+// newer task for the same key supersedes an older one.
+type ReplicationTask struct {
+	// ID identifies this version of the task. Pushing a task for a
+	// secondary and key that is already queued replaces it with a new ID.
+	ID string `json:"id"`
+
+	// Secondary is the name of the secondary to replicate to
+	Secondary string `json:"secondary"`
+
+	// Key is the object key
+	Key string `json:"key"`
+
+	// Enqueued is when the task was pushed
+	Enqueued time.Time `json:"enqueued"`
+
+	// Attempts counts failed replication attempts
+	Attempts int `json:"attempts"`
+
+	// NextAttempt is when the task is due
+	NextAttempt time.Time `json:"next_attempt"`
+
+	// LastError describes the last failed attempt
+	LastError string `json:"last_error,omitempty"`
+}
+
+// ReplicationQueue holds the replication tasks of a MirrorStorage.
+// Implementations must be safe for concurrent use.
+type ReplicationQueue interface {
+	// Push queues a task, replacing any task for the same secondary and
+	// key. Push assigns the task a new ID.
+	Push(task ReplicationTask) error
+
+	// Due returns up to limit tasks whose NextAttempt is not after now,
+	// earliest first. The tasks stay queued until removed.
+	Due(now time.Time, limit int) ([]ReplicationTask, error)
+
+	// Reschedule stores a failed task's new attempt count and schedule.
+	// It does nothing if the task was removed or replaced since Due.
+	Reschedule(task ReplicationTask) error
+
+	// Remove deletes a completed task. It does nothing if the task was
+	// replaced since Due.
+	Remove(task ReplicationTask) error
+
+	// Len returns the number of queued tasks
+	Len() (int, error)
+}
+
+// NewMemoryReplicationQueue creates a replication queue that lives in
+// memory. Tasks are lost when the process exits; use
+// NewFileReplicationQueue when secondary writes must survive restarts.
+func NewMemoryReplicationQueue() ReplicationQueue {
+	return &localQueue{tasks: make(map[string]ReplicationTask)}
+}
+
+// NewFileReplicationQueue opens (creating if needed) a durable replication
+// queue in dir. Each task is a JSON file replaced atomically by rename, so
+// tasks survive crashes and restarts.
+func NewFileReplicationQueue(dir string) (ReplicationQueue, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("storagex: create replication queue directory: %w", err)
+	}
+
+	q := &localQueue{dir: dir, tasks: make(map[string]ReplicationTask)}
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("storagex: read replication queue directory: %w", err)
+	}
+	for _, f := range files {
+		path := filepath.Join(dir, f.Name())
+		if strings.HasPrefix(f.Name(), "tmp-") {
+			// Left by a write interrupted by a crash
+			os.Remove(path)
+			continue
+		}
+		if f.IsDir() || !strings.HasSuffix(f.Name(), ".json") {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("storagex: read replication task: %w", err)
+		}
+		var task ReplicationTask
+		if err := json.Unmarshal(data, &task); err != nil {
+			return nil, fmt.Errorf("storagex: malformed replication task %s: %w", path, err)
+		}
+		q.tasks[taskSlot(task.Secondary, task.Key)] = task
+	}
+	return q, nil
+}
+
+// localQueue is a replication queue in memory, optionally mirrored to one
+// file per task in dir
+type localQueue struct {
+	dir string
+
+	mu    sync.Mutex
+	tasks map[string]ReplicationTask
+}
+
+// taskSlot identifies the queue entry of a secondary and key
+func taskSlot(secondary, key string) string {
+	sum := sha256.Sum256([]byte(secondary + "\x00" + key))
+	return hex.EncodeToString(sum[:])
+}
+
+func newTaskID() string {
+	var b [8]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// write persists a task. Callers hold q.mu.
+func (q *localQueue) write(slot string, task ReplicationTask) error {
+	if q.dir == "" {
+		return nil
+	}
+	data, err := json.Marshal(task)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(q.dir, "tmp-*")
+	if err != nil {
+		return fmt.Errorf("storagex: write replication task: %w", err)
+	}
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), filepath.Join(q.dir, slot+".json"))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("storagex: write replication task: %w", err)
+	}
+	return nil
+}
+
+// Push queues a task, replacing any task for the same secondary and key
+func (q *localQueue) Push(task ReplicationTask) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	task.ID = newTaskID()
+	slot := taskSlot(task.Secondary, task.Key)
+	if err := q.write(slot, task); err != nil {
+		return err
+	}
+	q.tasks[slot] = task
+	return nil
+}
+
+// Due returns up to limit due tasks, earliest first
+func (q *localQueue) Due(now time.Time, limit int) ([]ReplicationTask, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var due []ReplicationTask
+	for _, task := range q.tasks {
+		if !task.NextAttempt.After(now) {
+			due = append(due, task)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		if !due[i].NextAttempt.Equal(due[j].NextAttempt) {
+			return due[i].NextAttempt.Before(due[j].NextAttempt)
+		}
+		return due[i].Enqueued.Before(due[j].Enqueued)
+	})
+	if limit > 0 && len(due) > limit {
+		due = due[:limit]
+	}
+	return due, nil
+}
+
+// Reschedule stores a failed task's new schedule unless it was replaced
+func (q *localQueue) Reschedule(task ReplicationTask) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	slot := taskSlot(task.Secondary, task.Key)
+	if current, ok := q.tasks[slot]; !ok || current.ID != task.ID {
+		return nil
+	}
+	if err := q.write(slot, task); err != nil {
+		return err
+	}
+	q.tasks[slot] = task
+	return nil
+}
+
+// Remove deletes a completed task unless it was replaced
+func (q *localQueue) Remove(task ReplicationTask) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	slot := taskSlot(task.Secondary, task.Key)
+	if current, ok := q.tasks[slot]; !ok || current.ID != task.ID {
+		return nil
+	}
+	if q.dir != "" {
+		if err := os.Remove(filepath.Join(q.dir, slot+".json")); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("storagex: remove replication task: %w", err)
+		}
+	}
+	delete(q.tasks, slot)
+	return nil
+}
+
+// Len returns the number of queued tasks
+func (q *localQueue) Len() (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.tasks), nil
+}
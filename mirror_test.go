@@ -0,0 +1,300 @@
+package storagex_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/gostratum/storagex"
+	"github.com/gostratum/storagex/faultstore"
+	"github.com/gostratum/storagex/internal/testutil"
+	"github.com/gostratum/storagex/lock"
+	"github.com/gostratum/storagex/storagextest"
+)
+
+func newMirror(t *testing.T, opts storagex.MirrorOptions) (*storagex.MirrorStorage, *testutil.MockStorage, *faultstore.Store) {
+	t.Helper()
+	primary := testutil.NewMockStorage()
+	secondary := faultstore.New(testutil.NewMockStorage(), faultstore.Options{})
+	if opts.PollInterval == 0 {
+		// Keep the worker out of the way; tests drain the queue themselves
+		opts.PollInterval = time.Hour
+	}
+	mirror, err := storagex.NewMirrorStorage(primary, []storagex.NamedStorage{{Name: "dr", Storage: secondary}}, opts)
+	require.NoError(t, err)
+	t.Cleanup(func() { mirror.Close() })
+	return mirror, primary, secondary
+}
+
+func readString(t *testing.T, storage storagex.Storage, key string) string {
+	t.Helper()
+	reader, _, err := storage.Get(context.Background(), key)
+	require.NoError(t, err)
+	defer reader.Close()
+	data, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func pending(t *testing.T, mirror *storagex.MirrorStorage) int {
+	t.Helper()
+	n, err := mirror.Pending()
+	require.NoError(t, err)
+	return n
+}
+
+func TestMirror_SyncReplication(t *testing.T) {
+	ctx := context.Background()
+	mirror, _, secondary := newMirror(t, storagex.MirrorOptions{})
+
+	_, err := mirror.PutBytes(ctx, "a.txt", []byte("alpha"), &storagex.PutOptions{
+		ContentType: "text/plain",
+		Metadata:    map[string]string{"owner": "ops"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "alpha", readString(t, secondary, "a.txt"))
+	stat, err := secondary.Head(ctx, "a.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "text/plain", stat.ContentType)
+	assert.Equal(t, "ops", stat.Metadata["owner"])
+
+	id, err := mirror.CreateMultipart(ctx, "big.bin", nil)
+	require.NoError(t, err)
+	etag, err := mirror.UploadPart(ctx, "big.bin", id, 1, strings.NewReader("part"), 4)
+	require.NoError(t, err)
+	_, err = secondary.Head(ctx, "big.bin")
+	assert.True(t, storagex.IsNotFound(err), "parts are not replicated")
+	_, err = mirror.CompleteMultipart(ctx, "big.bin", id, []string{etag})
+	require.NoError(t, err)
+	assert.Equal(t, "part", readString(t, secondary, "big.bin"))
+
+	require.NoError(t, mirror.Delete(ctx, "a.txt"))
+	_, err = secondary.Head(ctx, "a.txt")
+	assert.True(t, storagex.IsNotFound(err))
+
+	_, err = mirror.DeleteBatch(ctx, []string{"big.bin"})
+	require.NoError(t, err)
+	_, err = secondary.Head(ctx, "big.bin")
+	assert.True(t, storagex.IsNotFound(err))
+	assert.Equal(t, 0, pending(t, mirror))
+}
+
+func TestMirror_ConditionalWritesAreReplicated(t *testing.T) {
+	ctx := context.Background()
+	mirror, primary, secondary := newMirror(t, storagex.MirrorOptions{})
+
+	// Conditional writes go through the mirror, not around it
+	writer, ok := storagex.Capability[storagex.ConditionalWriter](mirror)
+	require.True(t, ok)
+	assert.Same(t, mirror, writer)
+	_, ok = storagex.Capability[storagex.StorageClassManager](mirror)
+	assert.False(t, ok)
+
+	created, err := writer.PutIfAbsent(ctx, "lock.json", strings.NewReader("v1"), nil)
+	require.NoError(t, err)
+	assert.Equal(t, "v1", readString(t, secondary, "lock.json"))
+
+	_, err = writer.PutIfMatch(ctx, "lock.json", strings.NewReader("stale"), `"stale"`, nil)
+	assert.True(t, storagex.IsPreconditionFailed(err))
+	updated, err := writer.PutIfMatch(ctx, "lock.json", strings.NewReader("v2"), created.ETag, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "v2", readString(t, secondary, "lock.json"))
+
+	require.NoError(t, writer.DeleteIfMatch(ctx, "lock.json", updated.ETag))
+	assert.False(t, exists(t, primary, "lock.json"))
+	assert.False(t, exists(t, secondary, "lock.json"))
+	assert.Equal(t, 0, pending(t, mirror))
+
+	// Without conditional writes on the primary, the mirror has none either
+	plain, err := storagex.NewMirrorStorage(testutil.PlainStorage{Storage: primary}, []storagex.NamedStorage{{Name: "dr", Storage: secondary}}, storagex.MirrorOptions{PollInterval: time.Hour})
+	require.NoError(t, err)
+	defer plain.Close()
+	_, ok = storagex.Capability[storagex.ConditionalWriter](plain)
+	assert.False(t, ok)
+	_, err = lock.New(plain, lock.Options{})
+	assert.ErrorIs(t, err, storagex.ErrInvalidConfig)
+}
+
+func TestMirror_FailedWritesAreQueued(t *testing.T) {
+	ctx := context.Background()
+	mirror, _, secondary := newMirror(t, storagex.MirrorOptions{})
+	secondary.AddRule(faultstore.Rule{Name: "down", Ops: []faultstore.Op{faultstore.OpPut}, Err: faultstore.ErrTimeout})
+
+	// The primary write stands; the secondary write waits in the queue
+	_, err := mirror.PutBytes(ctx, "a.txt", []byte("alpha"), nil)
+	require.NoError(t, err)
+	assert.Equal(t, 1, pending(t, mirror))
+
+	assert.Error(t, mirror.Drain(ctx))
+	assert.Equal(t, 1, pending(t, mirror))
+
+	secondary.RemoveRule("down")
+	require.NoError(t, mirror.Drain(ctx))
+	assert.Equal(t, 0, pending(t, mirror))
+	assert.Equal(t, "alpha", readString(t, secondary, "a.txt"))
+}
+
+func TestMirror_RequireReplication(t *testing.T) {
+	ctx := context.Background()
+	mirror, primary, secondary := newMirror(t, storagex.MirrorOptions{RequireReplication: true})
+	secondary.AddRule(faultstore.Rule{Ops: []faultstore.Op{faultstore.OpPut}, Err: faultstore.ErrTimeout})
+
+	_, err := mirror.PutBytes(ctx, "a.txt", []byte("alpha"), nil)
+	assert.True(t, errors.Is(err, storagex.ErrReplication))
+	assert.Equal(t, "alpha", readString(t, primary, "a.txt"))
+	assert.Equal(t, 1, pending(t, mirror))
+}
+
+func TestMirror_AsyncReplication(t *testing.T) {
+	ctx := context.Background()
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	mirror, _, secondary := newMirror(t, storagex.MirrorOptions{
+		Mode:         storagex.MirrorAsync,
+		PollInterval: 10 * time.Millisecond,
+		RetryInitial: time.Minute,
+		Clock:        clock.Now,
+	})
+
+	_, err := mirror.PutBytes(ctx, "a.txt", []byte("alpha"), nil)
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool { return pending(t, mirror) == 0 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, "alpha", readString(t, secondary, "a.txt"))
+
+	// Failed attempts are retried once their backoff elapses
+	secondary.AddRule(faultstore.Rule{Name: "down", Ops: []faultstore.Op{faultstore.OpPut}, Count: 1, Err: faultstore.ErrTimeout})
+	_, err = mirror.PutBytes(ctx, "b.txt", []byte("bravo"), nil)
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool { return secondary.Fired("down") == 1 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, 1, pending(t, mirror))
+
+	clock.Advance(2 * time.Minute)
+	assert.Eventually(t, func() bool { return pending(t, mirror) == 0 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, "bravo", readString(t, secondary, "b.txt"))
+}
+
+func TestMirror_ReadFallback(t *testing.T) {
+	ctx := context.Background()
+	primary := faultstore.New(testutil.NewMockStorage(), faultstore.Options{})
+	secondary := testutil.NewMockStorage()
+	mirror, err := storagex.NewMirrorStorage(primary, []storagex.NamedStorage{{Name: "dr", Storage: secondary}}, storagex.MirrorOptions{})
+	require.NoError(t, err)
+	defer mirror.Close()
+
+	// Only the secondary has the object, e.g. after restoring the primary
+	_, err = secondary.PutBytes(ctx, "restored.txt", []byte("restored"), nil)
+	require.NoError(t, err)
+	assert.Equal(t, "restored", readString(t, mirror, "restored.txt"))
+
+	_, err = mirror.PutBytes(ctx, "a.txt", []byte("alpha"), nil)
+	require.NoError(t, err)
+	primary.AddRule(faultstore.Rule{Name: "slow", Ops: []faultstore.Op{faultstore.OpGet, faultstore.OpHead}, Err: faultstore.ErrTimeout})
+	assert.Equal(t, "alpha", readString(t, mirror, "a.txt"))
+	_, err = mirror.Head(ctx, "a.txt")
+	assert.NoError(t, err)
+
+	// Other errors are not retried on the secondary
+	primary.ClearRules()
+	primary.AddRule(faultstore.Rule{Ops: []faultstore.Op{faultstore.OpGet}, Err: storagex.ErrAborted})
+	_, _, err = mirror.Get(ctx, "a.txt")
+	assert.True(t, errors.Is(err, storagex.ErrAborted))
+
+	// Keys missing everywhere report the primary's error
+	primary.ClearRules()
+	_, _, err = mirror.Get(ctx, "missing.txt")
+	assert.True(t, storagex.IsNotFound(err))
+}
+
+func TestFileReplicationQueue_SurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	queue, err := storagex.NewFileReplicationQueue(dir)
+	require.NoError(t, err)
+
+	now := time.Unix(100, 0)
+	require.NoError(t, queue.Push(storagex.ReplicationTask{Secondary: "dr", Key: "a.txt", Enqueued: now, NextAttempt: now}))
+	require.NoError(t, queue.Push(storagex.ReplicationTask{Secondary: "dr", Key: "b.txt", Enqueued: now, NextAttempt: now.Add(time.Hour)}))
+
+	reopened, err := storagex.NewFileReplicationQueue(dir)
+	require.NoError(t, err)
+	n, err := reopened.Len()
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	due, err := reopened.Due(now, 0)
+	require.NoError(t, err)
+	require.Len(t, due, 1)
+	assert.Equal(t, "a.txt", due[0].Key)
+
+	// A task replaced after Due is not removed by its older version
+	require.NoError(t, reopened.Push(storagex.ReplicationTask{Secondary: "dr", Key: "a.txt", Enqueued: now, NextAttempt: now}))
+	require.NoError(t, reopened.Remove(due[0]))
+	n, _ = reopened.Len()
+	assert.Equal(t, 2, n)
+
+	due, err = reopened.Due(now, 0)
+	require.NoError(t, err)
+	require.NoError(t, reopened.Remove(due[0]))
+
+	reopened, err = storagex.NewFileReplicationQueue(dir)
+	require.NoError(t, err)
+	n, _ = reopened.Len()
+	assert.Equal(t, 1, n)
+}
+
+func TestReconcile(t *testing.T) {
+	ctx := context.Background()
+	primary := testutil.NewMockStorage()
+	secondary := testutil.NewMockStorage()
+	put := func(s storagex.Storage, key, body string) {
+		_, err := s.PutBytes(ctx, key, []byte(body), &storagex.PutOptions{Overwrite: true})
+		require.NoError(t, err)
+	}
+	put(primary, "same.txt", "same")
+	put(secondary, "same.txt", "same")
+	put(primary, "missing.txt", "missing")
+	put(primary, "changed.txt", "new")
+	put(secondary, "changed.txt", "old")
+	put(secondary, "extra.txt", "extra")
+
+	report, err := storagex.Reconcile(ctx, primary, secondary, storagex.ReconcileOptions{DryRun: true})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"missing.txt"}, report.Missing)
+	assert.Equal(t, []string{"changed.txt"}, report.Changed)
+	assert.Equal(t, []string{"extra.txt"}, report.Extra)
+	assert.Equal(t, 1, report.Unchanged)
+	assert.Equal(t, 0, report.Copied)
+
+	// Same size, different content: only the ETag tells them apart
+	report, err = storagex.Reconcile(ctx, primary, secondary, storagex.ReconcileOptions{DryRun: true, IgnoreETag: true})
+	require.NoError(t, err)
+	assert.Empty(t, report.Changed)
+
+	report, err = storagex.Reconcile(ctx, primary, secondary, storagex.ReconcileOptions{Delete: true})
+	require.NoError(t, err)
+	assert.Equal(t, 2, report.Copied)
+	assert.Equal(t, 1, report.Deleted)
+	assert.Equal(t, "new", readString(t, secondary, "changed.txt"))
+	assert.Equal(t, "missing", readString(t, secondary, "missing.txt"))
+	_, err = secondary.Head(ctx, "extra.txt")
+	assert.True(t, storagex.IsNotFound(err))
+
+	report, err = storagex.Reconcile(ctx, primary, secondary, storagex.ReconcileOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 3, report.Unchanged)
+}
+
+func TestMirror_Conformance(t *testing.T) {
+	storagextest.RunConformance(t, func(t *testing.T) storagex.Storage {
+		mirror, err := storagex.NewMirrorStorage(testutil.NewMockStorage(), []storagex.NamedStorage{
+			{Name: "dr", Storage: testutil.NewMockStorage()},
+		}, storagex.MirrorOptions{})
+		require.NoError(t, err)
+		t.Cleanup(func() { mirror.Close() })
+		return mirror
+	})
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/gostratum/core"
 	"github.com/gostratum/core/configx"
 	"github.com/gostratum/core/logx"
 	"github.com/gostratum/metricsx"
@@ -32,6 +33,15 @@ func Module() fx.Option {
 			NewKeyBuilder,
 			NewObservabilityInstrumenter, // Provide optional observability
 		),
+		// Readiness fails while a circuit breaker is open
+		fx.Provide(
+			fx.Annotated{
+				Target: newBreakerHealthCheck,
+				Group:  "health_checkers",
+			},
+		),
+		// Named lookup of every storage instance
+		fx.Provide(provideRegistry),
 	}
 
 	// Only register lifecycle if storage is available
@@ -87,6 +97,43 @@ func NewObservabilityInstrumenter(deps ObservabilityDeps) *Instrumenter {
 	return NewInstrumenter(deps.Metrics, deps.Tracer)
 }
 
+// breakerCheckParams defines the optional storage watched by the circuit
+// breaker health check
+type breakerCheckParams struct {
+	fx.In
+
+	Storage Storage `optional:"true"`
+}
+
+func newBreakerHealthCheck(params breakerCheckParams) core.Check {
+	return NewBreakerHealthCheck(params.Storage)
+}
+
+// registryParams defines the storage instances collected into the Registry
+type registryParams struct {
+	fx.In
+
+	Default Storage        `optional:"true"`
+	Named   []NamedStorage `group:"storagex_instances"`
+}
+
+// provideRegistry registers the unnamed Storage (as DefaultInstance) and
+// every named instance contributed by adapter modules
+func provideRegistry(params registryParams) (*Registry, error) {
+	registry := NewRegistry()
+	if params.Default != nil {
+		if err := registry.Register(DefaultInstance, params.Default); err != nil {
+			return nil, err
+		}
+	}
+	for _, named := range params.Named {
+		if err := registry.Register(named.Name, named.Storage); err != nil {
+			return nil, err
+		}
+	}
+	return registry, nil
+}
+
 // LifecycleParams defines parameters for lifecycle management
 type LifecycleParams struct {
 	fx.In
@@ -148,6 +148,115 @@ func (i *Instrumenter) RecordPresignOperation(operation string) {
 	}
 }
 
+// RecordBreakerState records the state of an operation class's circuit
+// breaker (0: closed, 1: half-open, 2: open)
+func (i *Instrumenter) RecordBreakerState(class string, state int) {
+	if i.metrics != nil {
+		i.metrics.Gauge("storage_circuit_breaker_state",
+			metricsx.WithHelp("Circuit breaker state per operation class (0=closed, 1=half-open, 2=open)"),
+			metricsx.WithLabels("class"),
+		).Set(float64(state), class)
+	}
+}
+
+// RecordBulkheadInFlight records the number of in-flight operations of a
+// class limited by a bulkhead
+func (i *Instrumenter) RecordBulkheadInFlight(class string, inFlight int) {
+	if i.metrics != nil {
+		i.metrics.Gauge("storage_bulkhead_in_flight",
+			metricsx.WithHelp("In-flight storage operations per bulkhead-limited class"),
+			metricsx.WithLabels("class"),
+		).Set(float64(inFlight), class)
+	}
+}
+
+// RecordResilienceRejection records a call rejected by a circuit breaker or
+// bulkhead
+func (i *Instrumenter) RecordResilienceRejection(reason, class string) {
+	if i.metrics != nil {
+		i.metrics.Counter("storage_rejections_total",
+			metricsx.WithHelp("Storage operations rejected before reaching the backend"),
+			metricsx.WithLabels("reason", "class"),
+		).Inc(reason, class)
+	}
+}
+
+// RecordRateLimitWait records how long a call waited for the client-side
+// rate limiter
+func (i *Instrumenter) RecordRateLimitWait(operation string, wait time.Duration) {
+	if i.metrics != nil {
+		i.metrics.Histogram("storage_rate_limit_wait_seconds",
+			metricsx.WithHelp("Time storage operations waited for the client-side rate limiter"),
+			metricsx.WithLabels("operation"),
+			metricsx.WithBuckets(.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10),
+		).Observe(wait.Seconds(), operation)
+	}
+}
+
+// RecordThrottled records a call the backend throttled (e.g., S3 SlowDown)
+func (i *Instrumenter) RecordThrottled(operation string) {
+	if i.metrics != nil {
+		i.metrics.Counter("storage_throttled_total",
+			metricsx.WithHelp("Storage operations throttled by the backend"),
+			metricsx.WithLabels("operation"),
+		).Inc(operation)
+	}
+}
+
+// RecordCacheResult records whether a cached read was a hit, a
+// revalidated hit or a miss
+func (i *Instrumenter) RecordCacheResult(operation, result string) {
+	if i.metrics != nil {
+		i.metrics.Counter("storage_cache_requests_total",
+			metricsx.WithHelp("Cached storage reads by result (hit, revalidated, miss)"),
+			metricsx.WithLabels("operation", "result"),
+		).Inc(operation, result)
+	}
+}
+
+// RecordReplication records the result of replicating a write to a
+// mirror secondary
+func (i *Instrumenter) RecordReplication(secondary, result string) {
+	if i.metrics != nil {
+		i.metrics.Counter("storage_replication_total",
+			metricsx.WithHelp("Writes replicated to mirror secondaries by result (replicated, failed)"),
+			metricsx.WithLabels("secondary", "result"),
+		).Inc(secondary, result)
+	}
+}
+
+// RecordReplicationQueueDepth records the number of writes waiting for
+// replication or a retry
+func (i *Instrumenter) RecordReplicationQueueDepth(depth int) {
+	if i.metrics != nil {
+		i.metrics.Gauge("storage_replication_queue_depth",
+			metricsx.WithHelp("Writes waiting for replication to mirror secondaries"),
+		).Set(float64(depth))
+	}
+}
+
+// RecordReadFallback records a read served by a mirror secondary after the
+// primary failed
+func (i *Instrumenter) RecordReadFallback(operation, secondary string) {
+	if i.metrics != nil {
+		i.metrics.Counter("storage_read_fallbacks_total",
+			metricsx.WithHelp("Reads served by a mirror secondary after the primary failed"),
+			metricsx.WithLabels("operation", "secondary"),
+		).Inc(operation, secondary)
+	}
+}
+
+// RecordTierMigration records the outcome of migrating an object to the
+// cold tier
+func (i *Instrumenter) RecordTierMigration(result string) {
+	if i.metrics != nil {
+		i.metrics.Counter("storage_tier_migrations_total",
+			metricsx.WithHelp("Objects examined for migration to the cold tier by result (migrated, skipped, failed)"),
+			metricsx.WithLabels("result"),
+		).Inc(result)
+	}
+}
+
 // AddSpanAttribute adds an attribute to the current span if tracing is enabled
 func (i *Instrumenter) AddSpanAttribute(ctx context.Context, key string, value any) {
 	if i.tracer == nil {
@@ -0,0 +1,684 @@
+package storagex
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// PollOptions configures a Poller
+type PollOptions struct {
+	// Interval is the time between two passes of Watch (default: 1m)
+	Interval time.Duration
+
+	// SnapshotDir stores the snapshots of the watched prefixes, so changes
+	// made while the process is down are reported after a restart. When
+	// empty, snapshots are kept in memory.
+	SnapshotDir string
+
+	// Shards lists sub-prefixes (appended to the watched prefix) that are
+	// listed and snapshotted independently, e.g. "0" to "f" for keys that
+	// start with a hex digest. Keys outside every shard are not reported.
+	// When empty, the prefix is split at its first Delimiter: objects
+	// directly under the prefix form one shard and every common prefix
+	// another.
+	Shards []string
+
+	// Delimiter splits the watched prefix into shards when Shards is empty
+	// (default: "/")
+	Delimiter string
+
+	// Concurrency is the number of shards polled at once (default: 4).
+	// Memory use grows with Concurrency times the size of a shard.
+	Concurrency int
+
+	// PageSize is the List page size (default: the backend default)
+	PageSize int32
+}
+
+// PollReport summarizes one pass of a Poller
+type PollReport struct {
+	// Baseline is true for the first pass over a prefix, which records the
+	// snapshot without reporting events
+	Baseline bool
+
+	// Shards is the number of shards polled
+	Shards int
+
+	// Scanned is the number of objects listed
+	Scanned int
+
+	// Created, Modified and Removed count the changes found
+	Created  int
+	Modified int
+	Removed  int
+}
+
+// Poller detects changes on any Storage by listing a prefix periodically
+// and diffing it against a snapshot of key, size, ETag and last-modified
+// time. It implements Watcher for backends without notifications.
+//
+// Events of a shard are delivered before its new snapshot is saved, so a
+// pass that is interrupted is repeated: delivery is at least once. Changes
+// between two passes are collapsed (an object created and removed between
+// them is not reported). WatchOptions.Checkpoint is not used; the snapshots
+// are the checkpoint.
+type Poller struct {
+	storage Storage
+	opts    PollOptions
+
+	// deliverMu serializes handler calls of concurrently polled shards
+	deliverMu sync.Mutex
+
+	// memory holds snapshots and manifests when SnapshotDir is empty
+	mu     sync.Mutex
+	memory map[string][]byte
+}
+
+// NewPoller creates a poller for storage
+func NewPoller(storage Storage, opts PollOptions) *Poller {
+	if opts.Interval <= 0 {
+		opts.Interval = time.Minute
+	}
+	if opts.Delimiter == "" {
+		opts.Delimiter = "/"
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 4
+	}
+	return &Poller{storage: storage, opts: opts, memory: make(map[string][]byte)}
+}
+
+// PollChanges lists prefix every interval and calls handler with the
+// objects created, modified and removed since the previous pass, until ctx
+// is done. Snapshots are kept in memory; use NewPoller with SnapshotDir to
+// resume across restarts.
+func PollChanges(ctx context.Context, storage Storage, prefix string, interval time.Duration, handler EventHandler) error {
+	return NewPoller(storage, PollOptions{Interval: interval}).Watch(ctx, WatchOptions{Prefix: prefix}, handler)
+}
+
+// Watch polls opts.Prefix every Interval until ctx is done. Passes that
+// fail with a transient error (ErrTimeout, which includes ErrThrottled)
+// are retried at the next interval; other errors end the watch.
+func (p *Poller) Watch(ctx context.Context, opts WatchOptions, handler EventHandler) error {
+	for {
+		if _, err := p.Poll(ctx, opts, handler); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if !errors.Is(err, ErrTimeout) {
+				return err
+			}
+		}
+
+		timer := time.NewTimer(p.opts.Interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// pollShard is one independently listed part of a watched prefix
+type pollShard struct {
+	// prefix is the List prefix of the shard
+	prefix string
+
+	// direct is set for the shard of the objects directly under the
+	// watched prefix, which is listed with the delimiter
+	direct bool
+}
+
+// shardStats counts the result of polling one shard
+type shardStats struct {
+	scanned, created, modified, removed int
+}
+
+// pollManifest records the shards of a watched prefix. Its presence marks
+// the prefix as baselined.
+type pollManifest struct {
+	Prefix string   `json:"prefix"`
+	Shards []string `json:"shards"`
+}
+
+// Poll makes one pass over opts.Prefix and delivers the changes since the
+// previous pass. The first pass over a prefix only records its snapshot.
+// Shards that fail keep their previous snapshot and are diffed again by the
+// next pass; Poll returns the errors of all of them.
+func (p *Poller) Poll(ctx context.Context, opts WatchOptions, handler EventHandler) (*PollReport, error) {
+	report := &PollReport{}
+	base := snapshotName(opts.Prefix)
+
+	manifest, found, err := p.loadManifest(base)
+	if err != nil {
+		return report, &StorageError{Op: "poll", Key: opts.Prefix, Err: err}
+	}
+	report.Baseline = !found
+
+	shards, direct, err := p.discover(ctx, opts.Prefix)
+	if err != nil {
+		return report, &StorageError{Op: "poll", Key: opts.Prefix, Err: err}
+	}
+
+	// Shards that disappeared are diffed against an empty listing, so
+	// their objects are reported as removed
+	listed := make(map[string]bool, len(shards))
+	for _, shard := range shards {
+		listed[shard.prefix] = true
+	}
+	var vanished []pollShard
+	for _, prefix := range manifest.Shards {
+		if !listed[prefix] {
+			vanished = append(vanished, pollShard{prefix: prefix})
+		}
+	}
+	report.Shards = len(shards) + len(vanished)
+
+	type result struct {
+		shard pollShard
+		stats shardStats
+		err   error
+	}
+	results := make(chan result)
+	sem := make(chan struct{}, p.opts.Concurrency)
+	var wg sync.WaitGroup
+	all := append(append([]pollShard(nil), shards...), vanished...)
+	for i, shard := range all {
+		wg.Add(1)
+		go func(shard pollShard, gone bool) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			var entries []snapshotEntry
+			var err error
+			switch {
+			case gone:
+			case shard.direct:
+				entries = direct
+			default:
+				entries, err = p.list(ctx, shard.prefix)
+			}
+			var stats shardStats
+			if err == nil {
+				stats, err = p.pollShard(ctx, base, shard, entries, gone, report.Baseline, opts, handler)
+			}
+			results <- result{shard: shard, stats: stats, err: err}
+		}(shard, i >= len(shards))
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	var errs []error
+	failed := make(map[string]bool)
+	for r := range results {
+		report.Scanned += r.stats.scanned
+		report.Created += r.stats.created
+		report.Modified += r.stats.modified
+		report.Removed += r.stats.removed
+		if r.err != nil {
+			failed[r.shard.prefix] = true
+			errs = append(errs, &StorageError{Op: "poll", Key: r.shard.prefix, Err: r.err})
+		}
+	}
+
+	// A baseline only counts once every shard was recorded, and a vanished
+	// shard is forgotten once its removals were delivered
+	if report.Baseline && len(errs) > 0 {
+		return report, errors.Join(errs...)
+	}
+	next := pollManifest{Prefix: opts.Prefix}
+	for _, shard := range all {
+		if listed[shard.prefix] || failed[shard.prefix] {
+			next.Shards = append(next.Shards, shard.prefix)
+		}
+	}
+	sort.Strings(next.Shards)
+	if err := p.saveManifest(base, next); err != nil {
+		errs = append(errs, &StorageError{Op: "poll", Key: opts.Prefix, Err: err})
+	}
+	return report, errors.Join(errs...)
+}
+
+// discover returns the shards of a prefix and, when it is split at the
+// delimiter, the objects directly under it
+func (p *Poller) discover(ctx context.Context, prefix string) ([]pollShard, []snapshotEntry, error) {
+	if len(p.opts.Shards) > 0 {
+		shards := make([]pollShard, 0, len(p.opts.Shards))
+		for _, shard := range p.opts.Shards {
+			shards = append(shards, pollShard{prefix: prefix + shard})
+		}
+		return shards, nil, nil
+	}
+
+	shards := []pollShard{{prefix: prefix, direct: true}}
+	var direct []snapshotEntry
+	seen := make(map[string]bool)
+	opts := ListOptions{Prefix: prefix, Delimiter: p.opts.Delimiter, PageSize: p.opts.PageSize}
+	for {
+		page, err := p.storage.List(ctx, opts)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, stat := range page.Keys {
+			direct = append(direct, newSnapshotEntry(stat))
+		}
+		for _, common := range page.CommonPrefixes {
+			if !seen[common] {
+				seen[common] = true
+				shards = append(shards, pollShard{prefix: common})
+			}
+		}
+		if !page.IsTruncated || page.NextToken == "" {
+			break
+		}
+		opts.ContinuationToken = page.NextToken
+	}
+	sortEntries(direct)
+	return shards, direct, nil
+}
+
+// list returns the objects of a shard sorted by key
+func (p *Poller) list(ctx context.Context, prefix string) ([]snapshotEntry, error) {
+	var entries []snapshotEntry
+	opts := ListOptions{Prefix: prefix, PageSize: p.opts.PageSize}
+	for {
+		page, err := p.storage.List(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, stat := range page.Keys {
+			entries = append(entries, newSnapshotEntry(stat))
+		}
+		if !page.IsTruncated || page.NextToken == "" {
+			break
+		}
+		opts.ContinuationToken = page.NextToken
+	}
+	sortEntries(entries)
+	return entries, nil
+}
+
+// pollShard diffs the listing of a shard against its snapshot, delivers
+// the changes and saves the listing as the new snapshot
+func (p *Poller) pollShard(ctx context.Context, base string, shard pollShard, current []snapshotEntry, gone, baseline bool, opts WatchOptions, handler EventHandler) (shardStats, error) {
+	stats := shardStats{scanned: len(current)}
+	name := base + "-" + snapshotName(shard.prefix)
+
+	if !baseline {
+		previous, err := p.loadSnapshot(name)
+		if err != nil {
+			return stats, err
+		}
+		var events []Event
+		diffSnapshots(previous, current, func(event Event) {
+			switch event.Type {
+			case ObjectCreated:
+				stats.created++
+			case ObjectModified:
+				stats.modified++
+			case ObjectRemoved:
+				stats.removed++
+			}
+			if opts.Accepts(event) {
+				events = append(events, event)
+			}
+		})
+		if err := p.deliver(ctx, opts, handler, events); err != nil {
+			return stats, err
+		}
+	}
+
+	if gone {
+		return stats, p.removeSnapshot(name)
+	}
+	return stats, p.saveSnapshot(name, current)
+}
+
+// deliver hands the events of a shard to the handler, one at a time across
+// all shards
+func (p *Poller) deliver(ctx context.Context, opts WatchOptions, handler EventHandler, events []Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+	p.deliverMu.Lock()
+	defer p.deliverMu.Unlock()
+	for _, event := range events {
+		if err := Deliver(ctx, opts, handler, event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// snapshotEntry is the state of one object in a snapshot
+type snapshotEntry struct {
+	Key          string
+	Size         int64
+	ETag         string
+	LastModified int64 // Unix nanoseconds
+}
+
+func newSnapshotEntry(stat Stat) snapshotEntry {
+	entry := snapshotEntry{Key: stat.Key, Size: stat.Size, ETag: stat.ETag}
+	if !stat.LastModified.IsZero() {
+		entry.LastModified = stat.LastModified.UnixNano()
+	}
+	return entry
+}
+
+func sortEntries(entries []snapshotEntry) {
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Key < entries[j].Key })
+}
+
+// version identifies the content of an entry in event IDs
+func (e snapshotEntry) version() string {
+	if e.ETag != "" {
+		return e.ETag
+	}
+	return strconv.FormatInt(e.LastModified, 10) + "/" + strconv.FormatInt(e.Size, 10)
+}
+
+// stat returns the Stat of an entry
+func (e snapshotEntry) stat() Stat {
+	stat := Stat{Key: e.Key, Size: e.Size, ETag: e.ETag}
+	if e.LastModified != 0 {
+		stat.LastModified = time.Unix(0, e.LastModified).UTC()
+	}
+	return stat
+}
+
+// changed reports whether an object differs from its previous entry. The
+// ETag decides when both have one; otherwise size and last-modified time.
+func (e snapshotEntry) changed(previous snapshotEntry) bool {
+	if e.ETag != "" && previous.ETag != "" {
+		return e.ETag != previous.ETag
+	}
+	return e.Size != previous.Size || e.LastModified != previous.LastModified
+}
+
+// diffSnapshots merges two key-sorted snapshots and emits their differences
+// in key order
+func diffSnapshots(previous, current []snapshotEntry, emit func(Event)) {
+	now := time.Now().UTC()
+	i, j := 0, 0
+	for i < len(previous) || j < len(current) {
+		switch {
+		case j == len(current) || (i < len(previous) && previous[i].Key < current[j].Key):
+			old := previous[i]
+			emit(Event{
+				ID:   old.Key + "@" + old.version() + ":removed",
+				Type: ObjectRemoved,
+				Key:  old.Key,
+				Stat: Stat{Key: old.Key},
+				Time: now,
+			})
+			i++
+		case i == len(previous) || current[j].Key < previous[i].Key:
+			emit(changeEvent(ObjectCreated, current[j], now))
+			j++
+		default:
+			if current[j].changed(previous[i]) {
+				emit(changeEvent(ObjectModified, current[j], now))
+			}
+			i++
+			j++
+		}
+	}
+}
+
+func changeEvent(eventType EventType, entry snapshotEntry, now time.Time) Event {
+	stat := entry.stat()
+	eventTime := stat.LastModified
+	if eventTime.IsZero() {
+		eventTime = now
+	}
+	return Event{
+		ID:   entry.Key + "@" + entry.version(),
+		Type: eventType,
+		Key:  entry.Key,
+		Stat: stat,
+		Time: eventTime,
+	}
+}
+
+// snapshotName derives a file name from a prefix
+func snapshotName(prefix string) string {
+	sum := sha256.Sum256([]byte(prefix))
+	return hex.EncodeToString(sum[:8])
+}
+
+// snapshotMagic starts every snapshot file
+const snapshotMagic = "SXSNAP1\n"
+
+// encodeSnapshot writes entries in the compact snapshot format: after the
+// magic line, a gzip stream of the entry count and, for every entry in key
+// order, the length of the prefix shared with the previous key, the rest
+// of the key, the size, the last-modified time and the ETag, as varints and
+// length-prefixed bytes. The gzip checksum detects truncated files.
+func encodeSnapshot(w io.Writer, entries []snapshotEntry) error {
+	if _, err := io.WriteString(w, snapshotMagic); err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(w)
+	bw := bufio.NewWriter(zw)
+
+	var buf [binary.MaxVarintLen64]byte
+	putUvarint := func(v uint64) {
+		n := binary.PutUvarint(buf[:], v)
+		bw.Write(buf[:n])
+	}
+	putUvarint(uint64(len(entries)))
+	previous := ""
+	for _, e := range entries {
+		shared := 0
+		for shared < len(previous) && shared < len(e.Key) && previous[shared] == e.Key[shared] {
+			shared++
+		}
+		putUvarint(uint64(shared))
+		putUvarint(uint64(len(e.Key) - shared))
+		bw.WriteString(e.Key[shared:])
+		putUvarint(uint64(e.Size))
+		n := binary.PutVarint(buf[:], e.LastModified)
+		bw.Write(buf[:n])
+		putUvarint(uint64(len(e.ETag)))
+		bw.WriteString(e.ETag)
+		previous = e.Key
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// decodeSnapshot reads a snapshot written by encodeSnapshot
+func decodeSnapshot(r io.Reader) ([]snapshotEntry, error) {
+	magic := make([]byte, len(snapshotMagic))
+	if _, err := io.ReadFull(r, magic); err != nil || string(magic) != snapshotMagic {
+		return nil, errors.New("not a snapshot file")
+	}
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	br := bufio.NewReader(zr)
+
+	count, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]snapshotEntry, 0, min(int(count), 1<<20))
+	previous := ""
+	for i := uint64(0); i < count; i++ {
+		shared, err := binary.ReadUvarint(br)
+		if err != nil {
+			return nil, err
+		}
+		if shared > uint64(len(previous)) {
+			return nil, errors.New("corrupt snapshot entry")
+		}
+		suffix, err := readSnapshotBytes(br)
+		if err != nil {
+			return nil, err
+		}
+		size, err := binary.ReadUvarint(br)
+		if err != nil {
+			return nil, err
+		}
+		modified, err := binary.ReadVarint(br)
+		if err != nil {
+			return nil, err
+		}
+		etag, err := readSnapshotBytes(br)
+		if err != nil {
+			return nil, err
+		}
+		key := previous[:shared] + string(suffix)
+		entries = append(entries, snapshotEntry{Key: key, Size: int64(size), ETag: string(etag), LastModified: modified})
+		previous = key
+	}
+
+	// Reading to the end verifies the gzip checksum
+	if _, err := io.Copy(io.Discard, br); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func readSnapshotBytes(r *bufio.Reader) ([]byte, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	if n > 1<<20 {
+		return nil, errors.New("corrupt snapshot entry")
+	}
+	b := make([]byte, n)
+	_, err = io.ReadFull(r, b)
+	return b, err
+}
+
+// loadSnapshot returns a stored snapshot, or nil if there is none
+func (p *Poller) loadSnapshot(name string) ([]snapshotEntry, error) {
+	data, found, err := p.read(name + ".snap")
+	if err != nil || !found {
+		return nil, err
+	}
+	entries, err := decodeSnapshot(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("storagex: read snapshot %s: %w", name, err)
+	}
+	return entries, nil
+}
+
+func (p *Poller) saveSnapshot(name string, entries []snapshotEntry) error {
+	var buf bytes.Buffer
+	if err := encodeSnapshot(&buf, entries); err != nil {
+		return fmt.Errorf("storagex: encode snapshot: %w", err)
+	}
+	return p.write(name+".snap", buf.Bytes())
+}
+
+func (p *Poller) removeSnapshot(name string) error {
+	if p.opts.SnapshotDir == "" {
+		p.mu.Lock()
+		delete(p.memory, name+".snap")
+		p.mu.Unlock()
+		return nil
+	}
+	err := os.Remove(filepath.Join(p.opts.SnapshotDir, name+".snap"))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("storagex: remove snapshot: %w", err)
+	}
+	return nil
+}
+
+func (p *Poller) loadManifest(base string) (pollManifest, bool, error) {
+	var manifest pollManifest
+	data, found, err := p.read(base + ".json")
+	if err != nil || !found {
+		return manifest, false, err
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return manifest, false, fmt.Errorf("storagex: malformed poll manifest %s: %w", base, err)
+	}
+	return manifest, true, nil
+}
+
+func (p *Poller) saveManifest(base string, manifest pollManifest) error {
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+	return p.write(base+".json", data)
+}
+
+// read returns a file of the snapshot directory (or of memory)
+func (p *Poller) read(name string) ([]byte, bool, error) {
+	if p.opts.SnapshotDir == "" {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		data, ok := p.memory[name]
+		return data, ok, nil
+	}
+	data, err := os.ReadFile(filepath.Join(p.opts.SnapshotDir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("storagex: read %s: %w", name, err)
+	}
+	return data, true, nil
+}
+
+// write replaces a file of the snapshot directory atomically by rename
+func (p *Poller) write(name string, data []byte) error {
+	if p.opts.SnapshotDir == "" {
+		p.mu.Lock()
+		p.memory[name] = data
+		p.mu.Unlock()
+		return nil
+	}
+	if err := os.MkdirAll(p.opts.SnapshotDir, 0o755); err != nil {
+		return fmt.Errorf("storagex: create snapshot directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(p.opts.SnapshotDir, "tmp-*")
+	if err != nil {
+		return fmt.Errorf("storagex: write %s: %w", name, err)
+	}
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), filepath.Join(p.opts.SnapshotDir, name))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("storagex: write %s: %w", name, err)
+	}
+	return nil
+}
+
+var _ Watcher = (*Poller)(nil)
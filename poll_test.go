@@ -0,0 +1,220 @@
+package storagex_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/gostratum/storagex"
+	"github.com/gostratum/storagex/internal/testutil"
+)
+
+// collect returns a handler appending events to *events
+func collect(events *[]storagex.Event) storagex.EventHandler {
+	return func(ctx context.Context, event storagex.Event) error {
+		*events = append(*events, event)
+		return nil
+	}
+}
+
+// changes summarizes events as "type key", sorted
+func changes(events []storagex.Event) []string {
+	var out []string
+	for _, event := range events {
+		out = append(out, string(event.Type)+" "+event.Key)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func TestPoller_DetectsChanges(t *testing.T) {
+	ctx := context.Background()
+	mock := testutil.NewMockStorage()
+	for _, key := range []string{"data/top.txt", "data/docs/a.txt", "data/docs/b.txt", "data/img/logo.png", "other/x.txt"} {
+		_, err := mock.PutBytes(ctx, key, []byte(key), nil)
+		require.NoError(t, err)
+	}
+
+	dir := t.TempDir()
+	opts := storagex.WatchOptions{Prefix: "data/"}
+	var events []storagex.Event
+
+	// The first pass records the baseline
+	report, err := storagex.NewPoller(mock, storagex.PollOptions{SnapshotDir: dir}).Poll(ctx, opts, collect(&events))
+	require.NoError(t, err)
+	assert.True(t, report.Baseline)
+	assert.Equal(t, 3, report.Shards)
+	assert.Equal(t, 4, report.Scanned)
+	assert.Empty(t, events)
+
+	_, err = mock.PutBytes(ctx, "data/docs/a.txt", []byte("changed"), nil)
+	require.NoError(t, err)
+	_, err = mock.PutBytes(ctx, "data/docs/c.txt", []byte("new"), nil)
+	require.NoError(t, err)
+	_, err = mock.PutBytes(ctx, "data/video/clip.mp4", []byte("new shard"), nil)
+	require.NoError(t, err)
+	_, err = mock.PutBytes(ctx, "other/y.txt", []byte("outside"), nil)
+	require.NoError(t, err)
+	require.NoError(t, mock.Delete(ctx, "data/top.txt"))
+	require.NoError(t, mock.Delete(ctx, "data/img/logo.png"))
+
+	// A new poller on the same directory picks up where the first stopped
+	report, err = storagex.NewPoller(mock, storagex.PollOptions{SnapshotDir: dir}).Poll(ctx, opts, collect(&events))
+	require.NoError(t, err)
+	assert.False(t, report.Baseline)
+	assert.Equal(t, 2, report.Created)
+	assert.Equal(t, 1, report.Modified)
+	assert.Equal(t, 2, report.Removed)
+	assert.Equal(t, []string{
+		"ObjectCreated data/docs/c.txt",
+		"ObjectCreated data/video/clip.mp4",
+		"ObjectModified data/docs/a.txt",
+		"ObjectRemoved data/img/logo.png",
+		"ObjectRemoved data/top.txt",
+	}, changes(events))
+
+	for _, event := range events {
+		if event.Type == storagex.ObjectModified {
+			assert.Equal(t, int64(len("changed")), event.Stat.Size)
+			assert.NotEmpty(t, event.Stat.ETag)
+			assert.Equal(t, event.Stat.LastModified, event.Time)
+		}
+	}
+
+	// Nothing changed since
+	events = nil
+	report, err = storagex.NewPoller(mock, storagex.PollOptions{SnapshotDir: dir}).Poll(ctx, opts, collect(&events))
+	require.NoError(t, err)
+	assert.Empty(t, events)
+	assert.Equal(t, 3, report.Shards)
+}
+
+func TestPoller_ExplicitShardsAndFilters(t *testing.T) {
+	ctx := context.Background()
+	mock := testutil.NewMockStorage()
+	poller := storagex.NewPoller(mock, storagex.PollOptions{Shards: []string{"0", "1", "2"}, Concurrency: 2, PageSize: 2})
+	opts := storagex.WatchOptions{Prefix: "cas/", Types: []storagex.EventType{storagex.ObjectCreated}}
+
+	_, err := poller.Poll(ctx, opts, collect(new([]storagex.Event)))
+	require.NoError(t, err)
+
+	for i := 0; i < 9; i++ {
+		_, err := mock.PutBytes(ctx, fmt.Sprintf("cas/%d%03d", i%3, i), []byte{byte(i)}, nil)
+		require.NoError(t, err)
+	}
+	_, err = mock.PutBytes(ctx, "cas/9999", []byte("not in a shard"), nil)
+	require.NoError(t, err)
+
+	var events []storagex.Event
+	report, err := poller.Poll(ctx, opts, collect(&events))
+	require.NoError(t, err)
+	assert.Equal(t, 3, report.Shards)
+	assert.Equal(t, 9, report.Created)
+	assert.Len(t, events, 9)
+
+	// Removals are counted but filtered out
+	require.NoError(t, mock.Delete(ctx, "cas/0000"))
+	events = nil
+	report, err = poller.Poll(ctx, opts, collect(&events))
+	require.NoError(t, err)
+	assert.Equal(t, 1, report.Removed)
+	assert.Empty(t, events)
+}
+
+func TestPoller_FailedDeliveryIsRepeated(t *testing.T) {
+	ctx := context.Background()
+	mock := testutil.NewMockStorage()
+	poller := storagex.NewPoller(mock, storagex.PollOptions{})
+	_, err := poller.Poll(ctx, storagex.WatchOptions{}, collect(new([]storagex.Event)))
+	require.NoError(t, err)
+
+	_, err = mock.PutBytes(ctx, "a.txt", []byte("a"), nil)
+	require.NoError(t, err)
+
+	// The pass is abandoned before the handler succeeds
+	cancelled, cancel := context.WithCancel(ctx)
+	_, err = poller.Poll(cancelled, storagex.WatchOptions{}, func(context.Context, storagex.Event) error {
+		cancel()
+		return fmt.Errorf("handler failed")
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+
+	var events []storagex.Event
+	_, err = poller.Poll(ctx, storagex.WatchOptions{}, collect(&events))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"ObjectCreated a.txt"}, changes(events))
+}
+
+func TestPoller_SnapshotFormat(t *testing.T) {
+	ctx := context.Background()
+	mock := testutil.NewMockStorage()
+	for i := 0; i < 5000; i++ {
+		_, err := mock.PutBytes(ctx, fmt.Sprintf("logs/2025/01/%02d/event-%06d.json", i%28+1, i), []byte("{}"), nil)
+		require.NoError(t, err)
+	}
+
+	dir := t.TempDir()
+	poller := storagex.NewPoller(mock, storagex.PollOptions{SnapshotDir: dir, Shards: []string{""}})
+	_, err := poller.Poll(ctx, storagex.WatchOptions{Prefix: "logs/"}, collect(new([]storagex.Event)))
+	require.NoError(t, err)
+
+	snapshots, err := filepath.Glob(filepath.Join(dir, "*.snap"))
+	require.NoError(t, err)
+	require.Len(t, snapshots, 1)
+	info, err := os.Stat(snapshots[0])
+	require.NoError(t, err)
+	// Keys alone are over 200 KB; shared prefixes and compression keep the
+	// snapshot a fraction of that
+	assert.Less(t, info.Size(), int64(100_000))
+
+	// A truncated snapshot is detected rather than read as "all removed"
+	data, err := os.ReadFile(snapshots[0])
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(snapshots[0], data[:len(data)/2], 0o644))
+	_, err = storagex.NewPoller(mock, storagex.PollOptions{SnapshotDir: dir, Shards: []string{""}}).Poll(ctx, storagex.WatchOptions{Prefix: "logs/"}, collect(new([]storagex.Event)))
+	require.Error(t, err)
+	assert.True(t, strings.Contains(err.Error(), "snapshot"), "%v", err)
+}
+
+func TestPollChanges(t *testing.T) {
+	mock := testutil.NewMockStorage()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	received := make(chan storagex.Event, 10)
+	done := make(chan error, 1)
+	go func() {
+		done <- storagex.PollChanges(ctx, mock, "in/", 5*time.Millisecond, func(ctx context.Context, event storagex.Event) error {
+			select {
+			case received <- event:
+			case <-ctx.Done():
+			}
+			return nil
+		})
+	}()
+
+	// Keep writing until the baseline pass has run
+	deadline := time.After(5 * time.Second)
+	for i := 0; ; i++ {
+		_, err := mock.PutBytes(ctx, fmt.Sprintf("in/%d.txt", i), []byte("x"), nil)
+		require.NoError(t, err)
+		select {
+		case event := <-received:
+			assert.Equal(t, storagex.ObjectCreated, event.Type)
+			cancel()
+			assert.ErrorIs(t, <-done, context.Canceled)
+			return
+		case <-deadline:
+			t.Fatal("no change detected")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
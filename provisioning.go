@@ -0,0 +1,229 @@
+package storagex
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Versioning states of ProvisioningConfig.Versioning
+const (
+	VersioningEnabled   = "enabled"
+	VersioningSuspended = "suspended"
+)
+
+// ProvisioningConfig declares the bucket and its bucket-level settings.
+// Settings left empty are not managed: provisioning neither reads nor
+// changes them.
+type ProvisioningConfig struct {
+	// Enabled provisions the bucket when the storage starts. Each setting
+	// is compared with the bucket first and only changed if it differs.
+	Enabled bool `mapstructure:"enabled" yaml:"enabled" default:"false"`
+
+	// DryRun only logs the planned changes
+	DryRun bool `mapstructure:"dry_run" yaml:"dry_run" default:"false"`
+
+	// CreateBucket creates the bucket if it does not exist
+	CreateBucket bool `mapstructure:"create_bucket" yaml:"create_bucket" default:"false"`
+
+	// ObjectLock enables Object Lock on a bucket created by provisioning.
+	// It cannot be enabled later on existing buckets.
+	ObjectLock bool `mapstructure:"object_lock" yaml:"object_lock" default:"false"`
+
+	// Versioning is VersioningEnabled or VersioningSuspended
+	Versioning string `mapstructure:"versioning" yaml:"versioning"`
+
+	// Encryption is the default encryption of new objects
+	Encryption *EncryptionConfig `mapstructure:"encryption" yaml:"encryption"`
+
+	// CORS replaces the CORS rules of the bucket
+	CORS []CORSRule `mapstructure:"cors" yaml:"cors"`
+
+	// PublicAccessBlock is the bucket's public access block
+	PublicAccessBlock *PublicAccessBlockConfig `mapstructure:"public_access_block" yaml:"public_access_block"`
+
+	// Tags replaces the tag set of the bucket
+	Tags map[string]string `mapstructure:"tags" yaml:"tags"`
+}
+
+// EncryptionConfig is the default server-side encryption of a bucket
+type EncryptionConfig struct {
+	// Algorithm is "AES256" (SSE-S3) or "aws:kms" (SSE-KMS)
+	Algorithm string `mapstructure:"algorithm" yaml:"algorithm"`
+
+	// KMSKeyID is the KMS key of SSE-KMS (empty: the AWS managed key)
+	KMSKeyID string `mapstructure:"kms_key_id" yaml:"kms_key_id"`
+
+	// BucketKey enables S3 Bucket Keys to reduce SSE-KMS request costs
+	BucketKey bool `mapstructure:"bucket_key" yaml:"bucket_key"`
+}
+
+func (e *EncryptionConfig) String() string {
+	if e == nil || e.Algorithm == "" {
+		return "none"
+	}
+	s := e.Algorithm
+	if e.KMSKeyID != "" {
+		s += " key=" + e.KMSKeyID
+	}
+	if e.BucketKey {
+		s += " bucket_key"
+	}
+	return s
+}
+
+// CORSRule is one CORS rule of a bucket
+type CORSRule struct {
+	// ID optionally names the rule
+	ID string `mapstructure:"id" yaml:"id"`
+
+	// AllowedOrigins are the origins allowed to make requests, e.g.
+	// "https://app.example.com" or "*"
+	AllowedOrigins []string `mapstructure:"allowed_origins" yaml:"allowed_origins"`
+
+	// AllowedMethods are the HTTP methods allowed: GET, PUT, POST, DELETE
+	// and HEAD
+	AllowedMethods []string `mapstructure:"allowed_methods" yaml:"allowed_methods"`
+
+	// AllowedHeaders are the request headers allowed in preflight requests
+	AllowedHeaders []string `mapstructure:"allowed_headers" yaml:"allowed_headers"`
+
+	// ExposeHeaders are the response headers browsers may read
+	ExposeHeaders []string `mapstructure:"expose_headers" yaml:"expose_headers"`
+
+	// MaxAgeSeconds is how long browsers may cache a preflight response
+	MaxAgeSeconds int `mapstructure:"max_age_seconds" yaml:"max_age_seconds"`
+}
+
+func (r CORSRule) String() string {
+	s := fmt.Sprintf("origins=%s methods=%s", strings.Join(r.AllowedOrigins, ","), strings.Join(r.AllowedMethods, ","))
+	if r.ID != "" {
+		s = "id=" + r.ID + " " + s
+	}
+	if len(r.AllowedHeaders) > 0 {
+		s += " headers=" + strings.Join(r.AllowedHeaders, ",")
+	}
+	if len(r.ExposeHeaders) > 0 {
+		s += " expose=" + strings.Join(r.ExposeHeaders, ",")
+	}
+	if r.MaxAgeSeconds > 0 {
+		s += fmt.Sprintf(" max_age=%ds", r.MaxAgeSeconds)
+	}
+	return s
+}
+
+// DescribeCORS describes CORS rules in one line, e.g. for logging or
+// comparing them
+func DescribeCORS(rules []CORSRule) string {
+	if len(rules) == 0 {
+		return "none"
+	}
+	parts := make([]string, len(rules))
+	for i, rule := range rules {
+		parts[i] = "[" + rule.String() + "]"
+	}
+	return strings.Join(parts, " ")
+}
+
+// PublicAccessBlockConfig is the public access block of a bucket
+type PublicAccessBlockConfig struct {
+	BlockPublicACLs       bool `mapstructure:"block_public_acls" yaml:"block_public_acls"`
+	IgnorePublicACLs      bool `mapstructure:"ignore_public_acls" yaml:"ignore_public_acls"`
+	BlockPublicPolicy     bool `mapstructure:"block_public_policy" yaml:"block_public_policy"`
+	RestrictPublicBuckets bool `mapstructure:"restrict_public_buckets" yaml:"restrict_public_buckets"`
+}
+
+func (p *PublicAccessBlockConfig) String() string {
+	if p == nil {
+		return "none"
+	}
+	return fmt.Sprintf("block_public_acls=%t ignore_public_acls=%t block_public_policy=%t restrict_public_buckets=%t",
+		p.BlockPublicACLs, p.IgnorePublicACLs, p.BlockPublicPolicy, p.RestrictPublicBuckets)
+}
+
+// DescribeTags describes a tag set in one line, sorted by key
+func DescribeTags(tags map[string]string) string {
+	if len(tags) == 0 {
+		return "none"
+	}
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = k + "=" + tags[k]
+	}
+	return strings.Join(parts, ",")
+}
+
+// BucketChange is one planned change of a bucket setting
+type BucketChange struct {
+	// Setting is "bucket", "versioning", "encryption", "cors",
+	// "public_access_block" or "tags"
+	Setting string
+
+	// Current and Desired describe the setting before and after the change
+	Current string
+	Desired string
+}
+
+func (c BucketChange) String() string {
+	return fmt.Sprintf("%s: %s -> %s", c.Setting, c.Current, c.Desired)
+}
+
+// validateProvisioning returns the problems of a provisioning configuration
+func validateProvisioning(cfg ProvisioningConfig) []string {
+	var problems []string
+	switch cfg.Versioning {
+	case "", VersioningEnabled, VersioningSuspended:
+	default:
+		problems = append(problems, fmt.Sprintf("provisioning.versioning must be %q or %q", VersioningEnabled, VersioningSuspended))
+	}
+	if cfg.ObjectLock && cfg.Versioning == VersioningSuspended {
+		problems = append(problems, "provisioning.object_lock requires versioning")
+	}
+
+	if e := cfg.Encryption; e != nil {
+		switch e.Algorithm {
+		case "AES256":
+			if e.KMSKeyID != "" {
+				problems = append(problems, "provisioning.encryption.kms_key_id requires algorithm aws:kms")
+			}
+		case "aws:kms", "aws:kms:dsse":
+		default:
+			problems = append(problems, fmt.Sprintf("unsupported provisioning.encryption.algorithm %q", e.Algorithm))
+		}
+	}
+
+	for i, rule := range cfg.CORS {
+		field := fmt.Sprintf("provisioning.cors[%d]", i)
+		if len(rule.AllowedOrigins) == 0 {
+			problems = append(problems, field+".allowed_origins cannot be empty")
+		}
+		if len(rule.AllowedMethods) == 0 {
+			problems = append(problems, field+".allowed_methods cannot be empty")
+		}
+		for _, method := range rule.AllowedMethods {
+			switch method {
+			case "GET", "PUT", "POST", "DELETE", "HEAD":
+			default:
+				problems = append(problems, fmt.Sprintf("%s.allowed_methods: unsupported method %q", field, method))
+			}
+		}
+		if rule.MaxAgeSeconds < 0 {
+			problems = append(problems, field+".max_age_seconds cannot be negative")
+		}
+	}
+
+	if len(cfg.Tags) > 50 {
+		problems = append(problems, "provisioning.tags must not exceed 50 tags")
+	}
+	for k, v := range cfg.Tags {
+		if k == "" || len(k) > 128 || len(v) > 256 {
+			problems = append(problems, fmt.Sprintf("provisioning.tags: invalid tag %q", k))
+		}
+	}
+	return problems
+}
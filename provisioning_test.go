@@ -0,0 +1,57 @@
+package storagex_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/gostratum/storagex"
+)
+
+func TestValidateConfig_Provisioning(t *testing.T) {
+	cfg := storagex.DefaultConfig()
+	cfg.Bucket = "provisioned"
+	cfg.Provisioning = storagex.ProvisioningConfig{
+		ObjectLock: true,
+		Versioning: storagex.VersioningSuspended,
+		Encryption: &storagex.EncryptionConfig{Algorithm: "AES256", KMSKeyID: "alias/key"},
+		CORS:       []storagex.CORSRule{{AllowedMethods: []string{"PATCH"}}},
+		Tags:       map[string]string{"": "empty"},
+	}
+
+	err := storagex.ValidateConfig(cfg)
+	require.Error(t, err)
+	for _, problem := range []string{
+		"provisioning.object_lock requires versioning",
+		"provisioning.encryption.kms_key_id requires algorithm aws:kms",
+		"provisioning.cors[0].allowed_origins cannot be empty",
+		`provisioning.cors[0].allowed_methods: unsupported method "PATCH"`,
+		`provisioning.tags: invalid tag ""`,
+	} {
+		assert.True(t, strings.Contains(err.Error(), problem), "missing %q in %v", problem, err)
+	}
+
+	cfg.Provisioning = storagex.ProvisioningConfig{
+		Enabled:    true,
+		ObjectLock: true,
+		Versioning: storagex.VersioningEnabled,
+		Encryption: &storagex.EncryptionConfig{Algorithm: "aws:kms", KMSKeyID: "alias/key"},
+		CORS:       []storagex.CORSRule{{AllowedOrigins: []string{"*"}, AllowedMethods: []string{"GET"}}},
+	}
+	assert.NoError(t, storagex.ValidateConfig(cfg))
+}
+
+func TestDescribeBucketSettings(t *testing.T) {
+	assert.Equal(t, "none", storagex.DescribeTags(nil))
+	assert.Equal(t, "a=1,b=2", storagex.DescribeTags(map[string]string{"b": "2", "a": "1"}))
+	assert.Equal(t, "none", storagex.DescribeCORS(nil))
+	assert.Equal(t, "[origins=* methods=GET,PUT max_age=60s]", storagex.DescribeCORS([]storagex.CORSRule{
+		{AllowedOrigins: []string{"*"}, AllowedMethods: []string{"GET", "PUT"}, MaxAgeSeconds: 60},
+	}))
+
+	var encryption *storagex.EncryptionConfig
+	assert.Equal(t, "none", encryption.String())
+	assert.Equal(t, "aws:kms key=alias/key bucket_key", (&storagex.EncryptionConfig{Algorithm: "aws:kms", KMSKeyID: "alias/key", BucketKey: true}).String())
+}
@@ -0,0 +1,573 @@
+package storagex
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxScopedBuckets bounds the number of per-prefix and per-tenant buckets
+// kept before idle ones are dropped
+const maxScopedBuckets = 10000
+
+// RateLimitConfig configures client-side rate limiting. Rates are requests
+// per second; a zero rate leaves its scope unlimited. A call waits for a
+// token from every scope that applies to it.
+type RateLimitConfig struct {
+	// Rate limits all calls together
+	Rate float64 `mapstructure:"rate" yaml:"rate"`
+
+	// Burst is the bucket size of every scope (0: one second of the
+	// scope's rate)
+	Burst int `mapstructure:"burst" yaml:"burst"`
+
+	// Operations limits individual operations by name ("get", "put",
+	// "list", ...)
+	Operations map[string]float64 `mapstructure:"operations" yaml:"operations"`
+
+	// PrefixRate limits each key prefix separately, like S3's per-prefix
+	// request limits
+	PrefixRate float64 `mapstructure:"prefix_rate" yaml:"prefix_rate"`
+
+	// PrefixDepth is the number of leading path segments that identify a
+	// prefix ("logs/2024/a.txt" is in "logs/" at depth 1)
+	PrefixDepth int `mapstructure:"prefix_depth" yaml:"prefix_depth" default:"1"`
+
+	// TenantRate limits each tenant separately. The tenant is read from
+	// the KeyBuilder context attached with ContextWithKeyContext.
+	TenantRate float64 `mapstructure:"tenant_rate" yaml:"tenant_rate"`
+
+	// TenantKey is the KeyBuilder context entry naming the tenant
+	TenantKey string `mapstructure:"tenant_key" yaml:"tenant_key" default:"tenant_id"`
+
+	// MaxWait fails calls with ErrThrottled instead of waiting longer than
+	// this for a token (0: wait as long as the context allows)
+	MaxWait time.Duration `mapstructure:"max_wait" yaml:"max_wait"`
+
+	// Adaptive halves the rate of every scope a call went through when the
+	// backend throttles it, and restores it gradually afterwards
+	Adaptive bool `mapstructure:"adaptive" yaml:"adaptive" default:"true"`
+
+	// MinFactor is the lowest fraction of the configured rate adaptation
+	// may reach
+	MinFactor float64 `mapstructure:"min_factor" yaml:"min_factor" default:"0.1"`
+
+	// RecoveryInterval is how often a slowed-down scope regains
+	// RecoveryStep of its rate; throttling within one interval of the
+	// last slow-down does not slow it down further
+	RecoveryInterval time.Duration `mapstructure:"recovery_interval" yaml:"recovery_interval" default:"1s"`
+
+	// RecoveryStep is the fraction of the configured rate regained per
+	// RecoveryInterval
+	RecoveryStep float64 `mapstructure:"recovery_step" yaml:"recovery_step" default:"0.05"`
+}
+
+// enabled reports whether any scope is limited
+func (c RateLimitConfig) enabled() bool {
+	if c.Rate > 0 || c.PrefixRate > 0 || c.TenantRate > 0 {
+		return true
+	}
+	for _, rate := range c.Operations {
+		if rate > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// tokenBucket is the limiter for one scope. Reservations may take it into
+// debt; later callers wait for the debt to be repaid.
+type tokenBucket struct {
+	cfg *RateLimitConfig
+
+	mu           sync.Mutex
+	rate         float64
+	burst        float64
+	factor       float64
+	tokens       float64
+	last         time.Time
+	changed      time.Time
+	lastDecrease time.Time
+}
+
+func newTokenBucket(cfg *RateLimitConfig, rate float64, now time.Time) *tokenBucket {
+	burst := float64(cfg.Burst)
+	if burst <= 0 {
+		burst = math.Max(1, math.Ceil(rate))
+	}
+	return &tokenBucket{
+		cfg:     cfg,
+		rate:    rate,
+		burst:   burst,
+		factor:  1,
+		tokens:  burst,
+		last:    now,
+		changed: now,
+	}
+}
+
+// advance refills tokens and recovers the rate up to now. Callers hold b.mu.
+func (b *tokenBucket) advance(now time.Time) {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = math.Min(b.burst, b.tokens+elapsed.Seconds()*b.rate*b.factor)
+		b.last = now
+	}
+	if b.factor < 1 {
+		if steps := int(now.Sub(b.changed) / b.cfg.RecoveryInterval); steps > 0 {
+			b.factor = math.Min(1, b.factor+float64(steps)*b.cfg.RecoveryStep)
+			b.changed = b.changed.Add(time.Duration(steps) * b.cfg.RecoveryInterval)
+		}
+	}
+}
+
+// reserve takes a token and returns how long to wait before using it
+func (b *tokenBucket) reserve(now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.advance(now)
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / (b.rate * b.factor) * float64(time.Second))
+}
+
+// cancel returns a reserved token
+func (b *tokenBucket) cancel() {
+	b.mu.Lock()
+	b.tokens = math.Min(b.burst, b.tokens+1)
+	b.mu.Unlock()
+}
+
+// throttle slows the bucket down after the backend throttled a call
+func (b *tokenBucket) throttle(now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.advance(now)
+	if !b.lastDecrease.IsZero() && now.Sub(b.lastDecrease) < b.cfg.RecoveryInterval {
+		return
+	}
+	b.factor = math.Max(b.cfg.MinFactor, b.factor/2)
+	b.changed, b.lastDecrease = now, now
+}
+
+// limit returns the current rate
+func (b *tokenBucket) limit(now time.Time) float64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.advance(now)
+	return b.rate * b.factor
+}
+
+// idle reports whether the bucket is full at its configured rate, so
+// dropping it changes nothing
+func (b *tokenBucket) idle(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.advance(now)
+	return b.factor >= 1 && b.tokens >= b.burst
+}
+
+// RateLimitOptions configures a RateLimitStorage
+type RateLimitOptions struct {
+	// RateLimit configures the limits
+	RateLimit RateLimitConfig
+
+	// IsThrottled decides which errors slow the limiter down
+	// (default: IsThrottled)
+	IsThrottled func(error) bool
+
+	// Instrumenter optionally records waits and throttled calls
+	Instrumenter *Instrumenter
+
+	// Clock is an optional time source (useful for testing)
+	Clock func() time.Time
+}
+
+// RateLimitStorage is a Storage decorator that paces calls with token
+// buckets so batch jobs stay under the backend's request limits instead of
+// tripping them.
+//
+// Limits apply globally, per operation, per key prefix and per tenant. With
+// Adaptive set, a throttled response (S3 503 SlowDown, mapped to
+// ErrThrottled) halves the rate of the scopes the call went through, down to
+// MinFactor, and the rate then recovers by RecoveryStep every
+// RecoveryInterval. Each call takes one token; MultipartUpload counts as a
+// single call. Presigning is local and is not limited.
+type RateLimitStorage struct {
+	next Storage
+	opts RateLimitOptions
+	cfg  *RateLimitConfig
+
+	global *tokenBucket
+	ops    map[string]*tokenBucket
+
+	mu       sync.Mutex
+	prefixes map[string]*tokenBucket
+	tenants  map[string]*tokenBucket
+}
+
+// NewRateLimitStorage wraps next with rate limiting
+func NewRateLimitStorage(next Storage, opts RateLimitOptions) *RateLimitStorage {
+	if opts.IsThrottled == nil {
+		opts.IsThrottled = IsThrottled
+	}
+	if opts.Clock == nil {
+		opts.Clock = time.Now
+	}
+	cfg := opts.RateLimit
+	if cfg.PrefixDepth <= 0 {
+		cfg.PrefixDepth = 1
+	}
+	if cfg.TenantKey == "" {
+		cfg.TenantKey = "tenant_id"
+	}
+	if cfg.MinFactor <= 0 || cfg.MinFactor > 1 {
+		cfg.MinFactor = 0.1
+	}
+	if cfg.RecoveryInterval <= 0 {
+		cfg.RecoveryInterval = time.Second
+	}
+	if cfg.RecoveryStep <= 0 {
+		cfg.RecoveryStep = 0.05
+	}
+
+	s := &RateLimitStorage{
+		next:     next,
+		opts:     opts,
+		cfg:      &cfg,
+		ops:      make(map[string]*tokenBucket),
+		prefixes: make(map[string]*tokenBucket),
+		tenants:  make(map[string]*tokenBucket),
+	}
+	now := opts.Clock()
+	if cfg.Rate > 0 {
+		s.global = newTokenBucket(s.cfg, cfg.Rate, now)
+	}
+	for op, rate := range cfg.Operations {
+		if rate > 0 {
+			s.ops[op] = newTokenBucket(s.cfg, rate, now)
+		}
+	}
+	return s
+}
+
+// Unwrap returns the wrapped storage
+func (s *RateLimitStorage) Unwrap() Storage {
+	return s.next
+}
+
+// ForwardsTo reports that conditional writes are rate limited and forwarded
+// to the wrapped storage
+func (s *RateLimitStorage) ForwardsTo(iface reflect.Type) (Storage, bool) {
+	return s.next, iface == conditionalWriterType
+}
+
+// Limit returns the current rate, in requests per second, that applies to
+// a call of op on key: the lowest rate among its scopes, after adaptation.
+// It returns +Inf when no scope limits the call.
+func (s *RateLimitStorage) Limit(ctx context.Context, op, key string) float64 {
+	now := s.opts.Clock()
+	limit := math.Inf(1)
+	for _, b := range s.buckets(ctx, op, key) {
+		limit = math.Min(limit, b.limit(now))
+	}
+	return limit
+}
+
+// prefixOf returns the first PrefixDepth segments of key, with a trailing
+// slash ("" for keys at the root)
+func (s *RateLimitStorage) prefixOf(key string) string {
+	end := 0
+	for depth := 0; depth < s.cfg.PrefixDepth; depth++ {
+		i := strings.Index(key[end:], "/")
+		if i < 0 {
+			break
+		}
+		end += i + 1
+	}
+	return key[:end]
+}
+
+// buckets returns the buckets a call of op on key draws from
+func (s *RateLimitStorage) buckets(ctx context.Context, op, key string) []*tokenBucket {
+	var buckets []*tokenBucket
+	if s.global != nil {
+		buckets = append(buckets, s.global)
+	}
+	if b, ok := s.ops[op]; ok {
+		buckets = append(buckets, b)
+	}
+	if s.cfg.PrefixRate > 0 {
+		buckets = append(buckets, s.scoped(s.prefixes, s.prefixOf(key), s.cfg.PrefixRate))
+	}
+	if s.cfg.TenantRate > 0 {
+		if tenant := KeyContextFromContext(ctx)[s.cfg.TenantKey]; tenant != "" {
+			buckets = append(buckets, s.scoped(s.tenants, tenant, s.cfg.TenantRate))
+		}
+	}
+	return buckets
+}
+
+// scoped returns the bucket of a prefix or tenant, creating it on first use
+func (s *RateLimitStorage) scoped(m map[string]*tokenBucket, name string, rate float64) *tokenBucket {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if b, ok := m[name]; ok {
+		return b
+	}
+	now := s.opts.Clock()
+	if len(m) >= maxScopedBuckets {
+		for n, b := range m {
+			if b.idle(now) {
+				delete(m, n)
+			}
+		}
+	}
+	b := newTokenBucket(s.cfg, rate, now)
+	m[name] = b
+	return b
+}
+
+// acquire waits for a token from every scope of the call and returns a
+// function that reports its outcome
+func (s *RateLimitStorage) acquire(ctx context.Context, op, key, scopeKey string) (func(error), error) {
+	buckets := s.buckets(ctx, op, scopeKey)
+	if len(buckets) == 0 {
+		return func(error) {}, nil
+	}
+
+	var delay time.Duration
+	now := s.opts.Clock()
+	for _, b := range buckets {
+		if d := b.reserve(now); d > delay {
+			delay = d
+		}
+	}
+	cancel := func() {
+		for _, b := range buckets {
+			b.cancel()
+		}
+	}
+
+	if delay > 0 {
+		if s.cfg.MaxWait > 0 && delay > s.cfg.MaxWait {
+			cancel()
+			return nil, &StorageError{Op: op, Key: key, Err: fmt.Errorf("%w: rate limit wait %s exceeds max_wait", ErrThrottled, delay)}
+		}
+		if s.opts.Instrumenter != nil {
+			s.opts.Instrumenter.RecordRateLimitWait(op, delay)
+		}
+
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			cancel()
+			err := ErrAborted
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				err = ErrTimeout
+			}
+			return nil, &StorageError{Op: op, Key: key, Err: err}
+		}
+	}
+
+	return func(err error) {
+		if err == nil || !s.opts.IsThrottled(err) {
+			return
+		}
+		if s.opts.Instrumenter != nil {
+			s.opts.Instrumenter.RecordThrottled(op)
+		}
+		if !s.cfg.Adaptive {
+			return
+		}
+		now := s.opts.Clock()
+		for _, b := range buckets {
+			b.throttle(now)
+		}
+	}, nil
+}
+
+// limited runs fn as a rate-limited call of op
+func limited[T any](ctx context.Context, s *RateLimitStorage, op, key string, fn func() (T, error)) (T, error) {
+	done, err := s.acquire(ctx, op, key, key)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	v, err := fn()
+	done(err)
+	return v, err
+}
+
+// Put stores an object from an io.Reader
+func (s *RateLimitStorage) Put(ctx context.Context, key string, r io.Reader, opts *PutOptions) (Stat, error) {
+	return limited(ctx, s, "put", key, func() (Stat, error) {
+		return s.next.Put(ctx, key, r, opts)
+	})
+}
+
+// PutBytes stores an object from a byte slice
+func (s *RateLimitStorage) PutBytes(ctx context.Context, key string, data []byte, opts *PutOptions) (Stat, error) {
+	return limited(ctx, s, "put", key, func() (Stat, error) {
+		return s.next.PutBytes(ctx, key, data, opts)
+	})
+}
+
+// PutFile stores an object from a local file path
+func (s *RateLimitStorage) PutFile(ctx context.Context, key string, path string, opts *PutOptions) (Stat, error) {
+	return limited(ctx, s, "put_file", key, func() (Stat, error) {
+		return s.next.PutFile(ctx, key, path, opts)
+	})
+}
+
+// Get retrieves an object
+func (s *RateLimitStorage) Get(ctx context.Context, key string) (ReaderAtCloser, Stat, error) {
+	res, err := limited(ctx, s, "get", key, func() (getResult, error) {
+		reader, stat, err := s.next.Get(ctx, key)
+		return getResult{reader, stat, err}, err
+	})
+	return res.reader, res.stat, err
+}
+
+// Head retrieves object metadata
+func (s *RateLimitStorage) Head(ctx context.Context, key string) (Stat, error) {
+	return limited(ctx, s, "head", key, func() (Stat, error) {
+		return s.next.Head(ctx, key)
+	})
+}
+
+// List retrieves objects with optional filtering and pagination. The list
+// prefix selects the prefix scope.
+func (s *RateLimitStorage) List(ctx context.Context, opts ListOptions) (ListPage, error) {
+	done, err := s.acquire(ctx, "list", "", opts.Prefix)
+	if err != nil {
+		return ListPage{}, err
+	}
+	page, err := s.next.List(ctx, opts)
+	done(err)
+	return page, err
+}
+
+// Delete removes a single object
+func (s *RateLimitStorage) Delete(ctx context.Context, key string) error {
+	_, err := limited(ctx, s, "delete", key, func() (struct{}, error) {
+		return struct{}{}, s.next.Delete(ctx, key)
+	})
+	return err
+}
+
+// DeleteBatch removes multiple objects. The first key selects the prefix
+// scope.
+func (s *RateLimitStorage) DeleteBatch(ctx context.Context, keys []string) ([]string, error) {
+	var scopeKey string
+	if len(keys) > 0 {
+		scopeKey = keys[0]
+	}
+	done, err := s.acquire(ctx, "delete_batch", "", scopeKey)
+	if err != nil {
+		return keys, err
+	}
+	failed, err := s.next.DeleteBatch(ctx, keys)
+	done(err)
+	return failed, err
+}
+
+// MultipartUpload uploads a large object using multipart upload
+func (s *RateLimitStorage) MultipartUpload(ctx context.Context, key string, src io.Reader, cfg *MultipartConfig, putOpts *PutOptions) (Stat, error) {
+	return limited(ctx, s, "multipart_upload", key, func() (Stat, error) {
+		return s.next.MultipartUpload(ctx, key, src, cfg, putOpts)
+	})
+}
+
+// CreateMultipart initiates a multipart upload session
+func (s *RateLimitStorage) CreateMultipart(ctx context.Context, key string, putOpts *PutOptions) (string, error) {
+	return limited(ctx, s, "create_multipart", key, func() (string, error) {
+		return s.next.CreateMultipart(ctx, key, putOpts)
+	})
+}
+
+// UploadPart uploads a single part in a multipart upload
+func (s *RateLimitStorage) UploadPart(ctx context.Context, key, uploadID string, partNumber int32, part io.Reader, size int64) (string, error) {
+	return limited(ctx, s, "upload_part", key, func() (string, error) {
+		return s.next.UploadPart(ctx, key, uploadID, partNumber, part, size)
+	})
+}
+
+// CompleteMultipart finalizes a multipart upload
+func (s *RateLimitStorage) CompleteMultipart(ctx context.Context, key, uploadID string, etags []string) (Stat, error) {
+	return limited(ctx, s, "complete_multipart", key, func() (Stat, error) {
+		return s.next.CompleteMultipart(ctx, key, uploadID, etags)
+	})
+}
+
+// AbortMultipart cancels a multipart upload
+func (s *RateLimitStorage) AbortMultipart(ctx context.Context, key, uploadID string) error {
+	_, err := limited(ctx, s, "abort_multipart", key, func() (struct{}, error) {
+		return struct{}{}, s.next.AbortMultipart(ctx, key, uploadID)
+	})
+	return err
+}
+
+// PutIfAbsent stores an object if the key does not exist. It counts as a
+// put and fails with ErrInvalidConfig if the wrapped storage does not
+// implement ConditionalWriter.
+func (s *RateLimitStorage) PutIfAbsent(ctx context.Context, key string, r io.Reader, opts *PutOptions) (Stat, error) {
+	writer, err := conditionalWriterOf(s.next, "put_if_absent", key)
+	if err != nil {
+		return Stat{}, err
+	}
+	return limited(ctx, s, "put", key, func() (Stat, error) {
+		return writer.PutIfAbsent(ctx, key, r, opts)
+	})
+}
+
+// PutIfMatch replaces an object if its ETag is etag. See PutIfAbsent.
+func (s *RateLimitStorage) PutIfMatch(ctx context.Context, key string, r io.Reader, etag string, opts *PutOptions) (Stat, error) {
+	writer, err := conditionalWriterOf(s.next, "put_if_match", key)
+	if err != nil {
+		return Stat{}, err
+	}
+	return limited(ctx, s, "put", key, func() (Stat, error) {
+		return writer.PutIfMatch(ctx, key, r, etag, opts)
+	})
+}
+
+// DeleteIfMatch removes an object if its ETag is etag. It counts as a
+// delete.
+func (s *RateLimitStorage) DeleteIfMatch(ctx context.Context, key, etag string) error {
+	writer, err := conditionalWriterOf(s.next, "delete_if_match", key)
+	if err != nil {
+		return err
+	}
+	_, err = limited(ctx, s, "delete", key, func() (struct{}, error) {
+		return struct{}{}, writer.DeleteIfMatch(ctx, key, etag)
+	})
+	return err
+}
+
+// PresignGet generates a presigned download URL
+func (s *RateLimitStorage) PresignGet(ctx context.Context, key string, opts *PresignOptions) (string, error) {
+	return s.next.PresignGet(ctx, key, opts)
+}
+
+// PresignPut generates a presigned upload URL
+func (s *RateLimitStorage) PresignPut(ctx context.Context, key string, opts *PresignOptions) (string, error) {
+	return s.next.PresignPut(ctx, key, opts)
+}
+
+var (
+	_ Storage           = (*RateLimitStorage)(nil)
+	_ ConditionalWriter = (*RateLimitStorage)(nil)
+)
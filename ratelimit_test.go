@@ -0,0 +1,143 @@
+package storagex_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/gostratum/storagex"
+	"github.com/gostratum/storagex/faultstore"
+	"github.com/gostratum/storagex/internal/testutil"
+)
+
+func TestIsThrottled(t *testing.T) {
+	assert.True(t, storagex.IsThrottled(faultstore.ErrThrottled))
+	assert.True(t, storagex.IsThrottled(&storagex.StorageError{Op: "put", Err: storagex.ErrThrottled}))
+	assert.False(t, storagex.IsThrottled(storagex.ErrTimeout))
+
+	// Throttling is a kind of timeout, so it stays retryable
+	assert.True(t, errors.Is(storagex.ErrThrottled, storagex.ErrTimeout))
+	assert.True(t, storagex.IsRetryableError(storagex.ErrThrottled))
+}
+
+func TestRateLimit_PacesCalls(t *testing.T) {
+	ctx := context.Background()
+	storage := storagex.NewRateLimitStorage(testutil.NewMockStorage(), storagex.RateLimitOptions{
+		RateLimit: storagex.RateLimitConfig{Rate: 50, Burst: 1},
+	})
+
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		_, err := storage.PutBytes(ctx, "a.txt", []byte("alpha"), &storagex.PutOptions{Overwrite: true})
+		require.NoError(t, err)
+	}
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+
+	// A cancelled wait gives its token back
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err := storage.Head(cancelled, "a.txt")
+	assert.True(t, errors.Is(err, storagex.ErrAborted))
+}
+
+func TestRateLimit_Scopes(t *testing.T) {
+	ctx := context.Background()
+	storage := storagex.NewRateLimitStorage(testutil.NewMockStorage(), storagex.RateLimitOptions{
+		RateLimit: storagex.RateLimitConfig{
+			Operations:  map[string]float64{"head": 1},
+			PrefixRate:  1,
+			PrefixDepth: 1,
+			TenantRate:  1,
+			MaxWait:     10 * time.Millisecond,
+		},
+	})
+	put := func(ctx context.Context, key string) error {
+		_, err := storage.PutBytes(ctx, key, []byte("x"), &storagex.PutOptions{Overwrite: true})
+		return err
+	}
+
+	// Each prefix has its own bucket
+	require.NoError(t, put(ctx, "logs/a.txt"))
+	require.NoError(t, put(ctx, "images/a.png"))
+	err := put(ctx, "logs/b.txt")
+	assert.True(t, storagex.IsThrottled(err))
+	assert.Equal(t, 1.0, storage.Limit(ctx, "put", "logs/c.txt"))
+
+	// Each tenant has its own bucket too
+	acme := storagex.ContextWithKeyContext(ctx, map[string]string{"tenant_id": "acme"})
+	beta := storagex.ContextWithKeyContext(ctx, map[string]string{"tenant_id": "beta"})
+	require.NoError(t, put(acme, "a/1"))
+	require.NoError(t, put(beta, "b/1"))
+	assert.True(t, storagex.IsThrottled(put(acme, "c/1")))
+
+	// Per-operation limits apply only to that operation
+	_, err = storage.Head(ctx, "x/a.txt")
+	assert.True(t, storagex.IsNotFound(err))
+	_, err = storage.Head(ctx, "y/a.txt")
+	assert.True(t, storagex.IsThrottled(err))
+	_, err = storage.List(ctx, storagex.ListOptions{Prefix: "z/"})
+	require.NoError(t, err)
+}
+
+func TestRateLimit_AdaptsToThrottling(t *testing.T) {
+	ctx := context.Background()
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	faults := faultstore.New(testutil.NewMockStorage(), faultstore.Options{})
+	storage := storagex.NewRateLimitStorage(faults, storagex.RateLimitOptions{
+		RateLimit: storagex.RateLimitConfig{
+			Rate:             100,
+			Adaptive:         true,
+			MinFactor:        0.2,
+			RecoveryInterval: time.Second,
+			RecoveryStep:     0.1,
+		},
+		Clock: clock.Now,
+	})
+	slowDown := func() {
+		faults.AddRule(faultstore.Rule{Ops: []faultstore.Op{faultstore.OpHead}, Count: 1, Err: faultstore.ErrThrottled})
+		_, err := storage.Head(ctx, "a.txt")
+		require.True(t, storagex.IsThrottled(err))
+	}
+	limit := func() float64 { return storage.Limit(ctx, "head", "a.txt") }
+
+	slowDown()
+	assert.InDelta(t, 50, limit(), 0.001)
+
+	// Throttles within one recovery interval count once
+	slowDown()
+	assert.InDelta(t, 50, limit(), 0.001)
+
+	// The rate recovers gradually
+	clock.Advance(time.Second)
+	assert.InDelta(t, 60, limit(), 0.001)
+	clock.Advance(10 * time.Second)
+	assert.InDelta(t, 100, limit(), 0.001)
+
+	// ... and never drops below MinFactor
+	for i := 0; i < 5; i++ {
+		slowDown()
+		clock.Advance(time.Second)
+	}
+	assert.InDelta(t, 30, limit(), 0.001)
+
+	// Other errors leave the rate alone
+	clock.Advance(time.Minute)
+	_, err := storage.Head(ctx, "missing.txt")
+	assert.True(t, storagex.IsNotFound(err))
+	assert.InDelta(t, 100, limit(), 0.001)
+}
+
+func TestDecorateStorage_RateLimit(t *testing.T) {
+	cfg := storagex.DefaultConfig()
+	cfg.CircuitBreaker.Enabled = true
+	cfg.RateLimit.Rate = 100
+
+	limiter, ok := storagex.DecorateStorage(testutil.NewMockStorage(), cfg, storagex.DecorateOptions{}).(*storagex.RateLimitStorage)
+	require.True(t, ok)
+	_, ok = limiter.Unwrap().(*storagex.CircuitBreakerStorage)
+	assert.True(t, ok)
+}
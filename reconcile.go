@@ -0,0 +1,167 @@
+package storagex
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+)
+
+// ReconcileOptions configures Reconcile
+type ReconcileOptions struct {
+	// Prefix limits reconciliation to keys under a prefix
+	Prefix string
+
+	// Delete removes secondary objects the primary does not have
+	Delete bool
+
+	// IgnoreETag compares sizes only. Set it when the two sides compute
+	// ETags differently, e.g. different providers, or objects uploaded in
+	// multipart with different part sizes.
+	IgnoreETag bool
+
+	// DryRun reports the differences without repairing them
+	DryRun bool
+
+	// Concurrency is the number of objects repaired in parallel
+	// (default: 4)
+	Concurrency int
+}
+
+// ReconcileReport describes the differences Reconcile found and repaired
+type ReconcileReport struct {
+	// Missing lists primary keys the secondary did not have
+	Missing []string
+
+	// Changed lists keys whose size or ETag differed
+	Changed []string
+
+	// Extra lists secondary keys the primary does not have
+	Extra []string
+
+	// Copied counts objects copied to the secondary
+	Copied int
+
+	// Deleted counts objects deleted from the secondary
+	Deleted int
+
+	// Unchanged counts keys that matched
+	Unchanged int
+}
+
+// Reconcile diffs the objects of primary and secondary by size and ETag and
+// repairs the secondary: missing and changed objects are copied from the
+// primary and, with Delete, extra objects are removed. It keeps going after
+// a failed repair and returns the errors of every failure.
+func Reconcile(ctx context.Context, primary, secondary Storage, opts ReconcileOptions) (*ReconcileReport, error) {
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 4
+	}
+
+	source, err := listObjects(ctx, primary, opts.Prefix)
+	if err != nil {
+		return nil, err
+	}
+	target, err := listObjects(ctx, secondary, opts.Prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ReconcileReport{}
+	for key, stat := range source {
+		existing, ok := target[key]
+		switch {
+		case !ok:
+			report.Missing = append(report.Missing, key)
+		case existing.Size != stat.Size || (!opts.IgnoreETag && existing.ETag != stat.ETag):
+			report.Changed = append(report.Changed, key)
+		default:
+			report.Unchanged++
+		}
+	}
+	for key := range target {
+		if _, ok := source[key]; !ok {
+			report.Extra = append(report.Extra, key)
+		}
+	}
+	sort.Strings(report.Missing)
+	sort.Strings(report.Changed)
+	sort.Strings(report.Extra)
+
+	if opts.DryRun {
+		return report, nil
+	}
+
+	var (
+		mu   sync.Mutex
+		errs []error
+		wg   sync.WaitGroup
+		sem  = make(chan struct{}, opts.Concurrency)
+	)
+	repair := func(key string, fn func() error, count *int) {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			err := fn()
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, err)
+				return
+			}
+			*count++
+		}()
+	}
+
+	for _, key := range append(append([]string{}, report.Missing...), report.Changed...) {
+		if ctx.Err() != nil {
+			break
+		}
+		repair(key, func() error {
+			err := copyObject(ctx, primary, secondary, key)
+			if err != nil {
+				return &StorageError{Op: "reconcile", Key: key, Err: err}
+			}
+			return nil
+		}, &report.Copied)
+	}
+	if opts.Delete {
+		for _, key := range report.Extra {
+			if ctx.Err() != nil {
+				break
+			}
+			repair(key, func() error {
+				if err := secondary.Delete(ctx, key); err != nil {
+					return &StorageError{Op: "reconcile", Key: key, Err: err}
+				}
+				return nil
+			}, &report.Deleted)
+		}
+	}
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		errs = append(errs, err)
+	}
+	return report, errors.Join(errs...)
+}
+
+// listObjects lists every object under prefix by key
+func listObjects(ctx context.Context, storage Storage, prefix string) (map[string]Stat, error) {
+	objects := make(map[string]Stat)
+	opts := ListOptions{Prefix: prefix}
+	for {
+		page, err := storage.List(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, stat := range page.Keys {
+			objects[stat.Key] = stat
+		}
+		if !page.IsTruncated || page.NextToken == "" {
+			return objects, nil
+		}
+		opts.ContinuationToken = page.NextToken
+	}
+}
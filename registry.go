@@ -0,0 +1,169 @@
+package storagex
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gostratum/core/configx"
+)
+
+// DefaultInstance is the registry name of the unnamed Storage provided by
+// an adapter module (e.g., s3.Module())
+const DefaultInstance = "default"
+
+// ErrUnknownInstance indicates no storage instance is registered under a name
+var ErrUnknownInstance = errors.New("storagex: unknown storage instance")
+
+// NamedStorage is a storage instance and its name. Adapters contribute them
+// to the "storagex_instances" fx group, from which Module builds the Registry.
+type NamedStorage struct {
+	Name    string
+	Storage Storage
+}
+
+// Registry looks up storage instances by name
+type Registry struct {
+	mu       sync.RWMutex
+	storages map[string]Storage
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{storages: make(map[string]Storage)}
+}
+
+// Register adds a storage instance. Names must be unique.
+func (r *Registry) Register(name string, storage Storage) error {
+	if name == "" || storage == nil {
+		return fmt.Errorf("%w: storage instance needs a name and a storage", ErrInvalidConfig)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.storages[name]; exists {
+		return fmt.Errorf("%w: storage instance %q registered twice", ErrInvalidConfig, name)
+	}
+	r.storages[name] = storage
+	return nil
+}
+
+// Get returns the storage instance registered under name
+func (r *Registry) Get(name string) (Storage, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	storage, ok := r.storages[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownInstance, name)
+	}
+	return storage, nil
+}
+
+// MustGet returns the storage instance registered under name and panics if
+// there is none
+func (r *Registry) MustGet(name string) Storage {
+	storage, err := r.Get(name)
+	if err != nil {
+		panic(err)
+	}
+	return storage
+}
+
+// Names returns the registered names in sorted order
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.storages))
+	for name := range r.storages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// instanceConfig binds a Config under storage.instances.<name>
+type instanceConfig struct {
+	Config `mapstructure:",squash"`
+
+	prefix string
+}
+
+func (c *instanceConfig) Prefix() string { return c.prefix }
+
+// NewInstanceConfig loads the configuration of a named storage instance from
+// storage.instances.<name>. Settings the instance leaves out are inherited
+// from the top-level storage configuration, so instances typically only set
+// their bucket (and perhaps base_prefix):
+//
+//	storage:
+//	  region: eu-west-1
+//	  instances:
+//	    uploads:
+//	      bucket: acme-uploads
+//	    archive:
+//	      bucket: acme-archive
+//	      retry_mode: storagex
+func NewInstanceConfig(loader configx.Loader, name string) (*Config, error) {
+	if name == "" || strings.Contains(name, ".") {
+		return nil, fmt.Errorf("%w: invalid storage instance name %q", ErrInvalidConfig, name)
+	}
+
+	// The top-level config is not validated on its own: it may hold only
+	// shared settings when every storage is a named instance
+	base := DefaultConfig()
+	if err := loader.Bind(base); err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+
+	inst := &instanceConfig{Config: *base.clone(), prefix: base.Prefix() + ".instances." + name}
+	if err := loader.Bind(inst); err != nil {
+		return nil, fmt.Errorf("failed to load config for storage instance %q: %w", name, err)
+	}
+
+	cfg := &inst.Config
+	if err := ValidateConfig(cfg); err != nil {
+		return nil, fmt.Errorf("invalid configuration for storage instance %q: %w", name, err)
+	}
+	return cfg, nil
+}
+
+// clone returns a copy of c that shares no maps with it
+func (c *Config) clone() *Config {
+	clone := *c
+	if c.RateLimit.Operations != nil {
+		clone.RateLimit.Operations = make(map[string]float64, len(c.RateLimit.Operations))
+		for op, rate := range c.RateLimit.Operations {
+			clone.RateLimit.Operations[op] = rate
+		}
+	}
+	if p := c.Provisioning; p.Encryption != nil {
+		encryption := *p.Encryption
+		clone.Provisioning.Encryption = &encryption
+	}
+	if p := c.Provisioning; p.PublicAccessBlock != nil {
+		block := *p.PublicAccessBlock
+		clone.Provisioning.PublicAccessBlock = &block
+	}
+	if c.Provisioning.CORS != nil {
+		clone.Provisioning.CORS = append([]CORSRule(nil), c.Provisioning.CORS...)
+	}
+	if c.Provisioning.Tags != nil {
+		clone.Provisioning.Tags = make(map[string]string, len(c.Provisioning.Tags))
+		for k, v := range c.Provisioning.Tags {
+			clone.Provisioning.Tags[k] = v
+		}
+	}
+	clone.BrowserUploads.AllowedOrigins = append([]string(nil), c.BrowserUploads.AllowedOrigins...)
+	clone.BrowserUploads.Methods = append([]string(nil), c.BrowserUploads.Methods...)
+	clone.BrowserUploads.Headers = append([]string(nil), c.BrowserUploads.Headers...)
+	if c.Lifecycle.Rules != nil {
+		clone.Lifecycle.Rules = make([]LifecycleRule, len(c.Lifecycle.Rules))
+		for i, rule := range c.Lifecycle.Rules {
+			rule.Transitions = append([]LifecycleTransition(nil), rule.Transitions...)
+			clone.Lifecycle.Rules[i] = rule
+		}
+	}
+	return &clone
+}
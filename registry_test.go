@@ -0,0 +1,104 @@
+package storagex_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gostratum/core/configx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+
+	"github.com/gostratum/storagex"
+	"github.com/gostratum/storagex/internal/testutil"
+)
+
+func TestRegistry(t *testing.T) {
+	registry := storagex.NewRegistry()
+	uploads := testutil.NewMockStorage()
+	require.NoError(t, registry.Register("uploads", uploads))
+	require.NoError(t, registry.Register("archive", testutil.NewMockStorage()))
+
+	got, err := registry.Get("uploads")
+	require.NoError(t, err)
+	assert.Same(t, uploads, got)
+	assert.Equal(t, []string{"archive", "uploads"}, registry.Names())
+
+	_, err = registry.Get("missing")
+	assert.ErrorIs(t, err, storagex.ErrUnknownInstance)
+	assert.Panics(t, func() { registry.MustGet("missing") })
+
+	err = registry.Register("uploads", testutil.NewMockStorage())
+	assert.ErrorIs(t, err, storagex.ErrInvalidConfig)
+}
+
+const instancesYAML = `
+storage:
+  region: eu-west-1
+  access_key: AKIAEXAMPLE
+  secret_key: secret
+  max_retries: 5
+  instances:
+    uploads:
+      bucket: acme-uploads
+      base_prefix: incoming
+    archive:
+      bucket: acme-archive
+      max_retries: 1
+    broken:
+      region: eu-west-1
+`
+
+func newLoader(t *testing.T, yaml string) configx.Loader {
+	t.Helper()
+	loader, err := configx.NewWithReader(strings.NewReader(yaml))
+	require.NoError(t, err)
+	return loader
+}
+
+func TestNewInstanceConfig(t *testing.T) {
+	loader := newLoader(t, instancesYAML)
+
+	uploads, err := storagex.NewInstanceConfig(loader, "uploads")
+	require.NoError(t, err)
+	assert.Equal(t, "acme-uploads", uploads.Bucket)
+	assert.Equal(t, "incoming", uploads.BasePrefix)
+	assert.Equal(t, "eu-west-1", uploads.Region, "inherited from storage")
+	assert.Equal(t, "AKIAEXAMPLE", uploads.AccessKey, "inherited from storage")
+	assert.Equal(t, 5, uploads.MaxRetries, "inherited from storage")
+
+	archive, err := storagex.NewInstanceConfig(loader, "archive")
+	require.NoError(t, err)
+	assert.Equal(t, "acme-archive", archive.Bucket)
+	assert.Equal(t, "", archive.BasePrefix)
+	assert.Equal(t, 1, archive.MaxRetries)
+
+	// Instances are validated on their own
+	_, err = storagex.NewInstanceConfig(loader, "broken")
+	assert.ErrorContains(t, err, "bucket")
+	_, err = storagex.NewInstanceConfig(loader, "a.b")
+	assert.ErrorIs(t, err, storagex.ErrInvalidConfig)
+}
+
+func TestModule_Registry(t *testing.T) {
+	defaultStorage := testutil.NewMockStorage()
+	uploads := testutil.NewMockStorage()
+
+	var registry *storagex.Registry
+	app := fxtest.New(t,
+		storagex.Module(),
+		fx.Supply(fx.Annotate(newLoader(t, "storage:\n  bucket: default-bucket\n  use_sdk_defaults: true\n"), fx.As(new(configx.Loader)))),
+		fx.Provide(func() storagex.Storage { return defaultStorage }),
+		fx.Provide(fx.Annotated{
+			Group:  "storagex_instances",
+			Target: func() storagex.NamedStorage { return storagex.NamedStorage{Name: "uploads", Storage: uploads} },
+		}),
+		fx.Populate(&registry),
+	)
+	defer app.RequireStart().RequireStop()
+
+	assert.Equal(t, []string{storagex.DefaultInstance, "uploads"}, registry.Names())
+	assert.Same(t, uploads, registry.MustGet("uploads"))
+	assert.Same(t, defaultStorage, registry.MustGet(storagex.DefaultInstance))
+}
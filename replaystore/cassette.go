@@ -0,0 +1,251 @@
+// Package replaystore records the Storage calls a test makes against a real
+// backend into a golden file ("cassette") and replays them later without the
+// backend, so service tests are hermetic but see realistic responses.
+//
+// Record once against MinIO or S3:
+//
+//	rec := replaystore.NewRecorder(storage, replaystore.RecordOptions{})
+//	runScenario(t, rec)
+//	require.NoError(t, rec.Save("testdata/scenario.json"))
+//
+// Then replay in every test run:
+//
+//	player, err := replaystore.Open(t, "testdata/scenario.json", replaystore.ReplayOptions{})
+//	require.NoError(t, err)
+//	runScenario(t, player)
+//
+// The replayer matches each call against the recorded interactions by
+// operation, key, arguments and request body hash. Calls that were never
+// recorded fail the test and return ErrUnexpectedCall; interactions left
+// unused when the test ends fail it too.
+package replaystore
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/gostratum/storagex"
+)
+
+// Version is the cassette file format version
+const Version = 1
+
+// Operation names used in cassettes. They match the Op field of the
+// StorageErrors returned by the S3 adapter.
+const (
+	OpPut               = "put"
+	OpPutFile           = "put_file"
+	OpGet               = "get"
+	OpHead              = "head"
+	OpList              = "list"
+	OpDelete            = "delete"
+	OpDeleteBatch       = "delete_batch"
+	OpMultipartUpload   = "multipart_upload"
+	OpCreateMultipart   = "create_multipart"
+	OpUploadPart        = "upload_part"
+	OpCompleteMultipart = "complete_multipart"
+	OpAbortMultipart    = "abort_multipart"
+	OpPresignGet        = "presign_get"
+	OpPresignPut        = "presign_put"
+)
+
+// Cassette is a recorded sequence of Storage calls
+type Cassette struct {
+	Version      int            `json:"version"`
+	Interactions []*Interaction `json:"interactions"`
+}
+
+// Interaction is one recorded Storage call
+type Interaction struct {
+	// Op is the operation name (see the Op constants)
+	Op string `json:"op"`
+
+	// Key is the object key, if the operation takes one
+	Key string `json:"key,omitempty"`
+
+	// Args holds the remaining arguments (options, upload IDs, part
+	// numbers, ...) as JSON. Replay compares them exactly.
+	Args json.RawMessage `json:"args,omitempty"`
+
+	// Body describes the request body of uploads
+	Body *Body `json:"body,omitempty"`
+
+	// Result holds the operation's return values
+	Result *Result `json:"result,omitempty"`
+
+	// ResponseBody is the object content returned by Get
+	ResponseBody *Body `json:"response_body,omitempty"`
+
+	// Error is the returned error, if any
+	Error *Error `json:"error,omitempty"`
+}
+
+// Body identifies a payload by hash. Data holds the payload itself for Get
+// responses, and for request bodies when RecordOptions.StoreRequestBodies is
+// set.
+type Body struct {
+	SHA256 string `json:"sha256"`
+	Size   int64  `json:"size"`
+	Data   []byte `json:"data,omitempty"`
+}
+
+// Result holds the non-error return values of an operation
+type Result struct {
+	Stat   *storagex.Stat     `json:"stat,omitempty"`
+	Page   *storagex.ListPage `json:"page,omitempty"`
+	Failed []string           `json:"failed,omitempty"`
+
+	// Value is the upload ID, part ETag or presigned URL
+	Value string `json:"value,omitempty"`
+}
+
+// Error is a recorded error. Kind names the storagex sentinel it wrapped so
+// that errors.Is keeps working on replay.
+type Error struct {
+	Kind    string `json:"kind"`
+	Op      string `json:"op,omitempty"`
+	Key     string `json:"key,omitempty"`
+	Message string `json:"message"`
+}
+
+// errorKinds maps cassette error kinds to storagex sentinels. Sentinels that
+// wrap others come before them, so the most specific kind is recorded.
+var errorKinds = []struct {
+	kind string
+	err  error
+}{
+	{"not_found", storagex.ErrNotFound},
+	{"precondition_failed", storagex.ErrPreconditionFailed},
+	{"archived", storagex.ErrArchived},
+	{"retained", storagex.ErrRetained},
+	{"conflict", storagex.ErrConflict},
+	{"invalid_config", storagex.ErrInvalidConfig},
+	{"aborted", storagex.ErrAborted},
+	{"throttled", storagex.ErrThrottled},
+	{"timeout", storagex.ErrTimeout},
+	{"too_large", storagex.ErrTooLarge},
+	{"invalid_key", storagex.ErrInvalidKey},
+	{"not_modified", storagex.ErrNotModified},
+}
+
+// encodeError converts err into its cassette form
+func encodeError(err error) *Error {
+	if err == nil {
+		return nil
+	}
+
+	e := &Error{Kind: "other", Message: err.Error()}
+	for _, k := range errorKinds {
+		if errors.Is(err, k.err) {
+			e.Kind = k.kind
+			break
+		}
+	}
+
+	var storageErr *storagex.StorageError
+	if errors.As(err, &storageErr) {
+		e.Op, e.Key, e.Message = storageErr.Op, storageErr.Key, storageErr.Err.Error()
+	}
+	return e
+}
+
+// decode rebuilds an error equivalent to the recorded one
+func (e *Error) decode() error {
+	err := &replayedError{message: e.Message}
+	for _, k := range errorKinds {
+		if k.kind == e.Kind {
+			err.sentinel = k.err
+		}
+	}
+	if e.Op != "" {
+		return &storagex.StorageError{Op: e.Op, Key: e.Key, Err: err}
+	}
+	return err
+}
+
+// replayedError carries the recorded message and unwraps to the recorded
+// sentinel
+type replayedError struct {
+	message  string
+	sentinel error
+}
+
+func (e *replayedError) Error() string {
+	return e.message
+}
+
+func (e *replayedError) Unwrap() error {
+	return e.sentinel
+}
+
+// newBody hashes data, keeping a copy when store is set
+func newBody(data []byte, store bool) *Body {
+	sum := sha256.Sum256(data)
+	b := &Body{SHA256: hex.EncodeToString(sum[:]), Size: int64(len(data))}
+	if store {
+		b.Data = bytes.Clone(data)
+	}
+	return b
+}
+
+// marshalArgs encodes an interaction's arguments
+func marshalArgs(args any) json.RawMessage {
+	if args == nil {
+		return nil
+	}
+	data, err := json.Marshal(args)
+	if err != nil {
+		// Arguments are plain structs; this cannot happen
+		panic(fmt.Sprintf("replaystore: encoding arguments: %v", err))
+	}
+	return data
+}
+
+// Load reads a cassette file
+func Load(path string) (*Cassette, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("replaystore: reading cassette: %w", err)
+	}
+
+	var c Cassette
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("replaystore: decoding cassette %s: %w", path, err)
+	}
+	if c.Version != Version {
+		return nil, fmt.Errorf("replaystore: cassette %s has version %d, want %d", path, c.Version, Version)
+	}
+
+	// Canonicalize arguments so that formatting does not affect matching
+	for _, ix := range c.Interactions {
+		if len(ix.Args) > 0 {
+			var buf bytes.Buffer
+			if err := json.Compact(&buf, ix.Args); err != nil {
+				return nil, fmt.Errorf("replaystore: decoding cassette %s: %w", path, err)
+			}
+			ix.Args = buf.Bytes()
+		}
+	}
+	return &c, nil
+}
+
+// Save writes the cassette as indented JSON, creating parent directories
+func (c *Cassette) Save(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("replaystore: encoding cassette: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("replaystore: writing cassette: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("replaystore: writing cassette: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,297 @@
+package replaystore
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/gostratum/storagex"
+)
+
+// Argument shapes stored in Interaction.Args
+type (
+	putArgs struct {
+		Options *storagex.PutOptions `json:"options,omitempty"`
+	}
+
+	deleteBatchArgs struct {
+		Keys []string `json:"keys"`
+	}
+
+	multipartUploadArgs struct {
+		Config  *storagex.MultipartConfig `json:"config,omitempty"`
+		Options *storagex.PutOptions      `json:"options,omitempty"`
+	}
+
+	uploadPartArgs struct {
+		UploadID   string `json:"upload_id"`
+		PartNumber int32  `json:"part_number"`
+		Size       int64  `json:"size"`
+	}
+
+	completeArgs struct {
+		UploadID string   `json:"upload_id"`
+		ETags    []string `json:"etags"`
+	}
+
+	abortArgs struct {
+		UploadID string `json:"upload_id"`
+	}
+
+	presignArgs struct {
+		Options *storagex.PresignOptions `json:"options,omitempty"`
+
+		// SSECustomerKeySHA256 stands in for Options.SSECustomerKey, so
+		// the key never ends up in a cassette
+		SSECustomerKeySHA256 string `json:"sse_customer_key_sha256,omitempty"`
+	}
+)
+
+// newPresignArgs returns the arguments of a presign call with the SSE-C key
+// replaced by its hash
+func newPresignArgs(opts *storagex.PresignOptions) presignArgs {
+	if opts == nil || len(opts.SSECustomerKey) == 0 {
+		return presignArgs{Options: opts}
+	}
+	redacted := *opts
+	redacted.SSECustomerKey = nil
+	sum := sha256.Sum256(opts.SSECustomerKey)
+	return presignArgs{Options: &redacted, SSECustomerKeySHA256: hex.EncodeToString(sum[:])}
+}
+
+// RecordOptions configures a Recorder
+type RecordOptions struct {
+	// StoreRequestBodies keeps upload payloads in the cassette in addition
+	// to their hash. Get responses are always stored.
+	StoreRequestBodies bool
+}
+
+// Recorder is a storagex.Storage that forwards every call to the wrapped
+// storage and records it. It is safe for concurrent use; interactions are
+// recorded in completion order.
+type Recorder struct {
+	next storagex.Storage
+	opts RecordOptions
+
+	mu       sync.Mutex
+	cassette Cassette
+}
+
+// NewRecorder wraps next with recording
+func NewRecorder(next storagex.Storage, opts RecordOptions) *Recorder {
+	return &Recorder{
+		next:     next,
+		opts:     opts,
+		cassette: Cassette{Version: Version},
+	}
+}
+
+// Cassette returns a copy of the interactions recorded so far
+func (r *Recorder) Cassette() *Cassette {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return &Cassette{
+		Version:      r.cassette.Version,
+		Interactions: append([]*Interaction(nil), r.cassette.Interactions...),
+	}
+}
+
+// Save writes the interactions recorded so far to path
+func (r *Recorder) Save(path string) error {
+	return r.Cassette().Save(path)
+}
+
+func (r *Recorder) record(ix *Interaction, err error) {
+	if err != nil {
+		ix.Result, ix.ResponseBody = nil, nil
+		ix.Error = encodeError(err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cassette.Interactions = append(r.cassette.Interactions, ix)
+}
+
+// hashingReader hashes (and optionally buffers) what the wrapped storage
+// reads from a request body
+type hashingReader struct {
+	r    io.Reader
+	hash hash.Hash
+	size int64
+	buf  *bytes.Buffer
+}
+
+func newHashingReader(r io.Reader, store bool) *hashingReader {
+	h := &hashingReader{r: r, hash: sha256.New()}
+	if store {
+		h.buf = &bytes.Buffer{}
+	}
+	return h
+}
+
+func (h *hashingReader) Read(p []byte) (int, error) {
+	n, err := h.r.Read(p)
+	h.hash.Write(p[:n])
+	h.size += int64(n)
+	if h.buf != nil {
+		h.buf.Write(p[:n])
+	}
+	return n, err
+}
+
+func (h *hashingReader) body() *Body {
+	b := &Body{SHA256: hex.EncodeToString(h.hash.Sum(nil)), Size: h.size}
+	if h.buf != nil {
+		b.Data = h.buf.Bytes()
+	}
+	return b
+}
+
+// Put stores an object from an io.Reader
+func (r *Recorder) Put(ctx context.Context, key string, src io.Reader, opts *storagex.PutOptions) (storagex.Stat, error) {
+	body := newHashingReader(src, r.opts.StoreRequestBodies)
+	stat, err := r.next.Put(ctx, key, body, opts)
+	r.record(&Interaction{Op: OpPut, Key: key, Args: marshalArgs(putArgs{opts}), Body: body.body(), Result: &Result{Stat: &stat}}, err)
+	return stat, err
+}
+
+// PutBytes stores an object from a byte slice. It is recorded as a Put.
+func (r *Recorder) PutBytes(ctx context.Context, key string, data []byte, opts *storagex.PutOptions) (storagex.Stat, error) {
+	stat, err := r.next.PutBytes(ctx, key, data, opts)
+	r.record(&Interaction{Op: OpPut, Key: key, Args: marshalArgs(putArgs{opts}), Body: newBody(data, r.opts.StoreRequestBodies), Result: &Result{Stat: &stat}}, err)
+	return stat, err
+}
+
+// PutFile stores an object from a local file path. The file content, not
+// its path, is recorded, so replays may use a different temporary directory.
+func (r *Recorder) PutFile(ctx context.Context, key string, path string, opts *storagex.PutOptions) (storagex.Stat, error) {
+	data, readErr := os.ReadFile(path)
+	stat, err := r.next.PutFile(ctx, key, path, opts)
+	ix := &Interaction{Op: OpPutFile, Key: key, Args: marshalArgs(putArgs{opts}), Result: &Result{Stat: &stat}}
+	if readErr == nil {
+		ix.Body = newBody(data, r.opts.StoreRequestBodies)
+	}
+	r.record(ix, err)
+	return stat, err
+}
+
+// Get retrieves an object. The body is read completely so it can be
+// recorded; the caller receives an in-memory copy.
+func (r *Recorder) Get(ctx context.Context, key string) (storagex.ReaderAtCloser, storagex.Stat, error) {
+	reader, stat, err := r.next.Get(ctx, key)
+	if err != nil {
+		r.record(&Interaction{Op: OpGet, Key: key}, err)
+		return nil, stat, err
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		err = &storagex.StorageError{Op: OpGet, Key: key, Err: err}
+		r.record(&Interaction{Op: OpGet, Key: key}, err)
+		return nil, storagex.Stat{}, err
+	}
+	r.record(&Interaction{Op: OpGet, Key: key, Result: &Result{Stat: &stat}, ResponseBody: newBody(data, true)}, nil)
+	return newBodyReader(data), stat, nil
+}
+
+// Head retrieves object metadata
+func (r *Recorder) Head(ctx context.Context, key string) (storagex.Stat, error) {
+	stat, err := r.next.Head(ctx, key)
+	r.record(&Interaction{Op: OpHead, Key: key, Result: &Result{Stat: &stat}}, err)
+	return stat, err
+}
+
+// List retrieves objects with optional filtering and pagination
+func (r *Recorder) List(ctx context.Context, opts storagex.ListOptions) (storagex.ListPage, error) {
+	page, err := r.next.List(ctx, opts)
+	r.record(&Interaction{Op: OpList, Args: marshalArgs(opts), Result: &Result{Page: &page}}, err)
+	return page, err
+}
+
+// Delete removes a single object
+func (r *Recorder) Delete(ctx context.Context, key string) error {
+	err := r.next.Delete(ctx, key)
+	r.record(&Interaction{Op: OpDelete, Key: key}, err)
+	return err
+}
+
+// DeleteBatch removes multiple objects
+func (r *Recorder) DeleteBatch(ctx context.Context, keys []string) ([]string, error) {
+	failed, err := r.next.DeleteBatch(ctx, keys)
+	r.record(&Interaction{Op: OpDeleteBatch, Args: marshalArgs(deleteBatchArgs{keys}), Result: &Result{Failed: failed}}, err)
+	return failed, err
+}
+
+// MultipartUpload uploads a large object; it is recorded as one interaction
+func (r *Recorder) MultipartUpload(ctx context.Context, key string, src io.Reader, cfg *storagex.MultipartConfig, putOpts *storagex.PutOptions) (storagex.Stat, error) {
+	body := newHashingReader(src, r.opts.StoreRequestBodies)
+	stat, err := r.next.MultipartUpload(ctx, key, body, cfg, putOpts)
+	r.record(&Interaction{Op: OpMultipartUpload, Key: key, Args: marshalArgs(multipartUploadArgs{cfg, putOpts}), Body: body.body(), Result: &Result{Stat: &stat}}, err)
+	return stat, err
+}
+
+// CreateMultipart initiates a multipart upload session
+func (r *Recorder) CreateMultipart(ctx context.Context, key string, putOpts *storagex.PutOptions) (string, error) {
+	uploadID, err := r.next.CreateMultipart(ctx, key, putOpts)
+	r.record(&Interaction{Op: OpCreateMultipart, Key: key, Args: marshalArgs(putArgs{putOpts}), Result: &Result{Value: uploadID}}, err)
+	return uploadID, err
+}
+
+// UploadPart uploads a single part in a multipart upload
+func (r *Recorder) UploadPart(ctx context.Context, key, uploadID string, partNumber int32, part io.Reader, size int64) (string, error) {
+	body := newHashingReader(part, r.opts.StoreRequestBodies)
+	etag, err := r.next.UploadPart(ctx, key, uploadID, partNumber, body, size)
+	r.record(&Interaction{Op: OpUploadPart, Key: key, Args: marshalArgs(uploadPartArgs{uploadID, partNumber, size}), Body: body.body(), Result: &Result{Value: etag}}, err)
+	return etag, err
+}
+
+// CompleteMultipart finalizes a multipart upload
+func (r *Recorder) CompleteMultipart(ctx context.Context, key, uploadID string, etags []string) (storagex.Stat, error) {
+	stat, err := r.next.CompleteMultipart(ctx, key, uploadID, etags)
+	r.record(&Interaction{Op: OpCompleteMultipart, Key: key, Args: marshalArgs(completeArgs{uploadID, etags}), Result: &Result{Stat: &stat}}, err)
+	return stat, err
+}
+
+// AbortMultipart cancels a multipart upload
+func (r *Recorder) AbortMultipart(ctx context.Context, key, uploadID string) error {
+	err := r.next.AbortMultipart(ctx, key, uploadID)
+	r.record(&Interaction{Op: OpAbortMultipart, Key: key, Args: marshalArgs(abortArgs{uploadID})}, err)
+	return err
+}
+
+// PresignGet generates a presigned download URL
+func (r *Recorder) PresignGet(ctx context.Context, key string, opts *storagex.PresignOptions) (string, error) {
+	url, err := r.next.PresignGet(ctx, key, opts)
+	r.record(&Interaction{Op: OpPresignGet, Key: key, Args: marshalArgs(newPresignArgs(opts)), Result: &Result{Value: url}}, err)
+	return url, err
+}
+
+// PresignPut generates a presigned upload URL
+func (r *Recorder) PresignPut(ctx context.Context, key string, opts *storagex.PresignOptions) (string, error) {
+	url, err := r.next.PresignPut(ctx, key, opts)
+	r.record(&Interaction{Op: OpPresignPut, Key: key, Args: marshalArgs(newPresignArgs(opts)), Result: &Result{Value: url}}, err)
+	return url, err
+}
+
+// bodyReader serves a recorded or buffered object body
+type bodyReader struct {
+	*bytes.Reader
+	size int64
+}
+
+func newBodyReader(data []byte) *bodyReader {
+	return &bodyReader{Reader: bytes.NewReader(data), size: int64(len(data))}
+}
+
+func (b *bodyReader) Close() error { return nil }
+
+func (b *bodyReader) Size() int64 { return b.size }
+
+var _ storagex.Storage = (*Recorder)(nil)
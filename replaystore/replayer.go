@@ -0,0 +1,347 @@
+package replaystore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gostratum/storagex"
+)
+
+// ErrUnexpectedCall is returned by a Replayer for calls that match no
+// remaining recorded interaction
+var ErrUnexpectedCall = errors.New("replaystore: unexpected storage call")
+
+// ReplayOptions configures a Replayer
+type ReplayOptions struct {
+	// Ordered requires calls to arrive in exactly the recorded order. By
+	// default each call consumes the first unused interaction that matches
+	// it, which tolerates reordering by concurrent code.
+	Ordered bool
+}
+
+// Replayer is a storagex.Storage that serves recorded interactions. Each
+// interaction answers one call. It is safe for concurrent use.
+type Replayer struct {
+	t    testing.TB
+	opts ReplayOptions
+
+	mu           sync.Mutex
+	interactions []*Interaction
+	used         []bool
+}
+
+// NewReplayer serves the interactions of c
+func NewReplayer(c *Cassette, opts ReplayOptions) *Replayer {
+	return &Replayer{
+		opts:         opts,
+		interactions: c.Interactions,
+		used:         make([]bool, len(c.Interactions)),
+	}
+}
+
+// Open loads the cassette at path and returns a Replayer bound to t:
+// unexpected calls are reported with t.Errorf, and interactions still unused
+// when the test finishes fail it.
+func Open(t testing.TB, path string, opts ReplayOptions) (*Replayer, error) {
+	c, err := Load(path)
+	if err != nil {
+		return nil, err
+	}
+
+	p := NewReplayer(c, opts)
+	p.t = t
+	t.Cleanup(func() {
+		for _, ix := range p.Unused() {
+			t.Errorf("replaystore: recorded %s was never called", describe(ix.Op, ix.Key, ix.Args, ix.Body))
+		}
+	})
+	return p, nil
+}
+
+// Unused returns the interactions that have not been replayed yet
+func (p *Replayer) Unused() []*Interaction {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var unused []*Interaction
+	for i, ix := range p.interactions {
+		if !p.used[i] {
+			unused = append(unused, ix)
+		}
+	}
+	return unused
+}
+
+// match consumes the interaction answering a call
+func (p *Replayer) match(op, key string, args any, body *Body) (*Interaction, error) {
+	encoded := marshalArgs(args)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var near *Interaction
+	for i, ix := range p.interactions {
+		if p.used[i] {
+			continue
+		}
+		if ix.Op == op && ix.Key == key && bytes.Equal(ix.Args, encoded) && sameBody(ix.Body, body) {
+			p.used[i] = true
+			return ix, nil
+		}
+		if near == nil && ix.Op == op && ix.Key == key {
+			near = ix
+		}
+		if p.opts.Ordered {
+			near = ix
+			break
+		}
+	}
+
+	msg := "no recorded interaction for " + describe(op, key, encoded, body)
+	if near != nil {
+		msg += "; closest is " + describe(near.Op, near.Key, near.Args, near.Body)
+	}
+	if p.t != nil {
+		p.t.Errorf("replaystore: %s", msg)
+	}
+	return nil, &storagex.StorageError{Op: op, Key: key, Err: fmt.Errorf("%w: %s", ErrUnexpectedCall, msg)}
+}
+
+func sameBody(recorded, actual *Body) bool {
+	if recorded == nil || actual == nil {
+		return recorded == nil && actual == nil
+	}
+	return recorded.SHA256 == actual.SHA256 && recorded.Size == actual.Size
+}
+
+// describe formats a call for error messages
+func describe(op, key string, args []byte, body *Body) string {
+	var b strings.Builder
+	b.WriteString(op)
+	if key != "" {
+		fmt.Fprintf(&b, " %q", key)
+	}
+	if len(args) > 0 {
+		fmt.Fprintf(&b, " args=%s", args)
+	}
+	if body != nil {
+		fmt.Fprintf(&b, " body=sha256:%s (%d bytes)", body.SHA256, body.Size)
+	}
+	return b.String()
+}
+
+// readBody hashes a request body
+func readBody(op, key string, r io.Reader) (*Body, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, &storagex.StorageError{Op: op, Key: key, Err: err}
+	}
+	return newBody(data, false), nil
+}
+
+// replayStat returns the recorded Stat or error of ix
+func replayStat(ix *Interaction) (storagex.Stat, error) {
+	if ix.Error != nil {
+		return storagex.Stat{}, ix.Error.decode()
+	}
+	if ix.Result == nil || ix.Result.Stat == nil {
+		return storagex.Stat{}, nil
+	}
+	return *ix.Result.Stat, nil
+}
+
+// replayValue returns the recorded string result or error of ix
+func replayValue(ix *Interaction) (string, error) {
+	if ix.Error != nil {
+		return "", ix.Error.decode()
+	}
+	if ix.Result == nil {
+		return "", nil
+	}
+	return ix.Result.Value, nil
+}
+
+func replayErr(ix *Interaction) error {
+	if ix.Error != nil {
+		return ix.Error.decode()
+	}
+	return nil
+}
+
+// Put replays a recorded Put with the same key, options and body
+func (p *Replayer) Put(ctx context.Context, key string, r io.Reader, opts *storagex.PutOptions) (storagex.Stat, error) {
+	body, err := readBody(OpPut, key, r)
+	if err != nil {
+		return storagex.Stat{}, err
+	}
+	ix, err := p.match(OpPut, key, putArgs{opts}, body)
+	if err != nil {
+		return storagex.Stat{}, err
+	}
+	return replayStat(ix)
+}
+
+// PutBytes replays a recorded Put with the same key, options and body
+func (p *Replayer) PutBytes(ctx context.Context, key string, data []byte, opts *storagex.PutOptions) (storagex.Stat, error) {
+	ix, err := p.match(OpPut, key, putArgs{opts}, newBody(data, false))
+	if err != nil {
+		return storagex.Stat{}, err
+	}
+	return replayStat(ix)
+}
+
+// PutFile replays a recorded PutFile whose file had the same content
+func (p *Replayer) PutFile(ctx context.Context, key string, path string, opts *storagex.PutOptions) (storagex.Stat, error) {
+	var body *Body
+	if data, err := os.ReadFile(path); err == nil {
+		body = newBody(data, false)
+	}
+	ix, err := p.match(OpPutFile, key, putArgs{opts}, body)
+	if err != nil {
+		return storagex.Stat{}, err
+	}
+	return replayStat(ix)
+}
+
+// Get replays a recorded Get, serving the recorded body
+func (p *Replayer) Get(ctx context.Context, key string) (storagex.ReaderAtCloser, storagex.Stat, error) {
+	ix, err := p.match(OpGet, key, nil, nil)
+	if err != nil {
+		return nil, storagex.Stat{}, err
+	}
+	stat, err := replayStat(ix)
+	if err != nil {
+		return nil, stat, err
+	}
+	var data []byte
+	if ix.ResponseBody != nil {
+		data = ix.ResponseBody.Data
+	}
+	return newBodyReader(data), stat, nil
+}
+
+// Head replays a recorded Head
+func (p *Replayer) Head(ctx context.Context, key string) (storagex.Stat, error) {
+	ix, err := p.match(OpHead, key, nil, nil)
+	if err != nil {
+		return storagex.Stat{}, err
+	}
+	return replayStat(ix)
+}
+
+// List replays a recorded List with the same options
+func (p *Replayer) List(ctx context.Context, opts storagex.ListOptions) (storagex.ListPage, error) {
+	ix, err := p.match(OpList, "", opts, nil)
+	if err != nil {
+		return storagex.ListPage{}, err
+	}
+	if ix.Error != nil {
+		return storagex.ListPage{}, ix.Error.decode()
+	}
+	if ix.Result == nil || ix.Result.Page == nil {
+		return storagex.ListPage{}, nil
+	}
+	return *ix.Result.Page, nil
+}
+
+// Delete replays a recorded Delete
+func (p *Replayer) Delete(ctx context.Context, key string) error {
+	ix, err := p.match(OpDelete, key, nil, nil)
+	if err != nil {
+		return err
+	}
+	return replayErr(ix)
+}
+
+// DeleteBatch replays a recorded DeleteBatch with the same keys
+func (p *Replayer) DeleteBatch(ctx context.Context, keys []string) ([]string, error) {
+	ix, err := p.match(OpDeleteBatch, "", deleteBatchArgs{keys}, nil)
+	if err != nil {
+		return keys, err
+	}
+	if ix.Result == nil {
+		return nil, replayErr(ix)
+	}
+	return ix.Result.Failed, replayErr(ix)
+}
+
+// MultipartUpload replays a recorded MultipartUpload with the same body
+func (p *Replayer) MultipartUpload(ctx context.Context, key string, src io.Reader, cfg *storagex.MultipartConfig, putOpts *storagex.PutOptions) (storagex.Stat, error) {
+	body, err := readBody(OpMultipartUpload, key, src)
+	if err != nil {
+		return storagex.Stat{}, err
+	}
+	ix, err := p.match(OpMultipartUpload, key, multipartUploadArgs{cfg, putOpts}, body)
+	if err != nil {
+		return storagex.Stat{}, err
+	}
+	return replayStat(ix)
+}
+
+// CreateMultipart replays a recorded CreateMultipart, returning the
+// recorded upload ID
+func (p *Replayer) CreateMultipart(ctx context.Context, key string, putOpts *storagex.PutOptions) (string, error) {
+	ix, err := p.match(OpCreateMultipart, key, putArgs{putOpts}, nil)
+	if err != nil {
+		return "", err
+	}
+	return replayValue(ix)
+}
+
+// UploadPart replays a recorded UploadPart with the same part and body
+func (p *Replayer) UploadPart(ctx context.Context, key, uploadID string, partNumber int32, part io.Reader, size int64) (string, error) {
+	body, err := readBody(OpUploadPart, key, part)
+	if err != nil {
+		return "", err
+	}
+	ix, err := p.match(OpUploadPart, key, uploadPartArgs{uploadID, partNumber, size}, body)
+	if err != nil {
+		return "", err
+	}
+	return replayValue(ix)
+}
+
+// CompleteMultipart replays a recorded CompleteMultipart
+func (p *Replayer) CompleteMultipart(ctx context.Context, key, uploadID string, etags []string) (storagex.Stat, error) {
+	ix, err := p.match(OpCompleteMultipart, key, completeArgs{uploadID, etags}, nil)
+	if err != nil {
+		return storagex.Stat{}, err
+	}
+	return replayStat(ix)
+}
+
+// AbortMultipart replays a recorded AbortMultipart
+func (p *Replayer) AbortMultipart(ctx context.Context, key, uploadID string) error {
+	ix, err := p.match(OpAbortMultipart, key, abortArgs{uploadID}, nil)
+	if err != nil {
+		return err
+	}
+	return replayErr(ix)
+}
+
+// PresignGet replays a recorded PresignGet, returning the recorded URL
+func (p *Replayer) PresignGet(ctx context.Context, key string, opts *storagex.PresignOptions) (string, error) {
+	ix, err := p.match(OpPresignGet, key, newPresignArgs(opts), nil)
+	if err != nil {
+		return "", err
+	}
+	return replayValue(ix)
+}
+
+// PresignPut replays a recorded PresignPut, returning the recorded URL
+func (p *Replayer) PresignPut(ctx context.Context, key string, opts *storagex.PresignOptions) (string, error) {
+	ix, err := p.match(OpPresignPut, key, newPresignArgs(opts), nil)
+	if err != nil {
+		return "", err
+	}
+	return replayValue(ix)
+}
+
+var _ storagex.Storage = (*Replayer)(nil)
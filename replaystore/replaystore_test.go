@@ -0,0 +1,197 @@
+package replaystore_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/gostratum/storagex"
+	"github.com/gostratum/storagex/internal/testutil"
+	"github.com/gostratum/storagex/replaystore"
+)
+
+// scenario exercises a representative mix of calls and checks the responses,
+// so it can run against both the recorder and the replayer
+func scenario(t *testing.T, storage storagex.Storage, dir string) {
+	t.Helper()
+	ctx := context.Background()
+
+	stat, err := storage.PutBytes(ctx, "docs/a.txt", []byte("alpha"), &storagex.PutOptions{ContentType: "text/plain", Overwrite: true})
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), stat.Size)
+
+	_, err = storage.Put(ctx, "docs/a.txt", strings.NewReader("again"), &storagex.PutOptions{})
+	assert.True(t, errors.Is(err, storagex.ErrConflict))
+
+	file := filepath.Join(dir, "b.txt")
+	require.NoError(t, os.WriteFile(file, []byte("bravo"), 0o644))
+	_, err = storage.PutFile(ctx, "docs/b.txt", file, nil)
+	require.NoError(t, err)
+
+	reader, stat, err := storage.Get(ctx, "docs/a.txt")
+	require.NoError(t, err)
+	data, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	reader.Close()
+	assert.Equal(t, "alpha", string(data))
+	assert.Equal(t, "text/plain", stat.ContentType)
+
+	_, err = storage.Head(ctx, "docs/missing.txt")
+	assert.True(t, storagex.IsNotFound(err))
+
+	page, err := storage.List(ctx, storagex.ListOptions{Prefix: "docs/"})
+	require.NoError(t, err)
+	require.Len(t, page.Keys, 2)
+	assert.Equal(t, "docs/b.txt", page.Keys[1].Key)
+
+	uploadID, err := storage.CreateMultipart(ctx, "docs/big.bin", nil)
+	require.NoError(t, err)
+	etag, err := storage.UploadPart(ctx, "docs/big.bin", uploadID, 1, bytes.NewReader([]byte("part-1")), 6)
+	require.NoError(t, err)
+	_, err = storage.CompleteMultipart(ctx, "docs/big.bin", uploadID, []string{etag})
+	require.NoError(t, err)
+
+	failed, err := storage.DeleteBatch(ctx, []string{"docs/a.txt", "docs/b.txt", "docs/big.bin"})
+	require.NoError(t, err)
+	assert.Empty(t, failed)
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	golden := filepath.Join(t.TempDir(), "testdata", "scenario.json")
+
+	rec := replaystore.NewRecorder(testutil.NewMockStorage(), replaystore.RecordOptions{})
+	scenario(t, rec, t.TempDir())
+	require.NoError(t, rec.Save(golden))
+
+	cassette, err := replaystore.Load(golden)
+	require.NoError(t, err)
+	assert.Len(t, cassette.Interactions, 10)
+
+	// The replay uses a different directory for PutFile; only content matters
+	player, err := replaystore.Open(t, golden, replaystore.ReplayOptions{Ordered: true})
+	require.NoError(t, err)
+	scenario(t, player, t.TempDir())
+	assert.Empty(t, player.Unused())
+}
+
+func TestReplay_UnexpectedCalls(t *testing.T) {
+	ctx := context.Background()
+	rec := replaystore.NewRecorder(testutil.NewMockStorage(), replaystore.RecordOptions{})
+	_, err := rec.PutBytes(ctx, "a.txt", []byte("alpha"), nil)
+	require.NoError(t, err)
+	_, err = rec.Head(ctx, "a.txt")
+	require.NoError(t, err)
+
+	player := replaystore.NewReplayer(rec.Cassette(), replaystore.ReplayOptions{})
+
+	// Different body
+	_, err = player.PutBytes(ctx, "a.txt", []byte("other"), nil)
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, replaystore.ErrUnexpectedCall))
+	assert.Contains(t, err.Error(), "closest is put")
+
+	// Unordered replay tolerates reordering
+	_, err = player.Head(ctx, "a.txt")
+	require.NoError(t, err)
+	_, err = player.PutBytes(ctx, "a.txt", []byte("alpha"), nil)
+	require.NoError(t, err)
+
+	// Each interaction answers a single call
+	_, err = player.Head(ctx, "a.txt")
+	assert.True(t, errors.Is(err, replaystore.ErrUnexpectedCall))
+	assert.Empty(t, player.Unused())
+}
+
+func TestRecorder_StoreRequestBodies(t *testing.T) {
+	rec := replaystore.NewRecorder(testutil.NewMockStorage(), replaystore.RecordOptions{StoreRequestBodies: true})
+	_, err := rec.Put(context.Background(), "a.txt", strings.NewReader("alpha"), nil)
+	require.NoError(t, err)
+
+	ix := rec.Cassette().Interactions[0]
+	require.NotNil(t, ix.Body)
+	assert.Equal(t, "alpha", string(ix.Body.Data))
+	assert.Equal(t, int64(5), ix.Body.Size)
+}
+
+func TestRecorder_RedactsSSECustomerKey(t *testing.T) {
+	ctx := context.Background()
+	golden := filepath.Join(t.TempDir(), "presign.json")
+	key := []byte("0123456789abcdef0123456789abcdef")
+	opts := &storagex.PresignOptions{SSECustomerAlgorithm: "AES256", SSECustomerKey: key}
+
+	rec := replaystore.NewRecorder(testutil.NewMockStorage(), replaystore.RecordOptions{})
+	_, err := rec.PresignGet(ctx, "secret.bin", opts)
+	require.NoError(t, err)
+	require.NoError(t, rec.Save(golden))
+
+	data, err := os.ReadFile(golden)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), string(key))
+	assert.NotContains(t, string(data), base64.StdEncoding.EncodeToString(key))
+	assert.Equal(t, key, opts.SSECustomerKey)
+
+	// Replay still tells keys apart
+	cassette, err := replaystore.Load(golden)
+	require.NoError(t, err)
+	player := replaystore.NewReplayer(cassette, replaystore.ReplayOptions{})
+	_, err = player.PresignGet(ctx, "secret.bin", &storagex.PresignOptions{SSECustomerAlgorithm: "AES256", SSECustomerKey: bytes.Repeat([]byte("x"), 32)})
+	assert.ErrorIs(t, err, replaystore.ErrUnexpectedCall)
+	_, err = player.PresignGet(ctx, "secret.bin", opts)
+	assert.NoError(t, err)
+}
+
+// failingStorage fails every Head with err
+type failingStorage struct {
+	storagex.Storage
+	err error
+}
+
+func (s failingStorage) Head(ctx context.Context, key string) (storagex.Stat, error) {
+	return storagex.Stat{}, &storagex.StorageError{Op: "head", Key: key, Err: s.err}
+}
+
+func TestReplay_ErrorKinds(t *testing.T) {
+	ctx := context.Background()
+	sentinels := []error{
+		storagex.ErrNotFound,
+		storagex.ErrPreconditionFailed,
+		storagex.ErrArchived,
+		storagex.ErrRetained,
+		storagex.ErrConflict,
+		storagex.ErrInvalidConfig,
+		storagex.ErrAborted,
+		storagex.ErrThrottled,
+		storagex.ErrTimeout,
+		storagex.ErrTooLarge,
+		storagex.ErrInvalidKey,
+		storagex.ErrNotModified,
+	}
+	for _, sentinel := range sentinels {
+		t.Run(sentinel.Error(), func(t *testing.T) {
+			golden := filepath.Join(t.TempDir(), "errors.json")
+			rec := replaystore.NewRecorder(failingStorage{testutil.NewMockStorage(), sentinel}, replaystore.RecordOptions{})
+			_, recorded := rec.Head(ctx, "a.txt")
+			require.NoError(t, rec.Save(golden))
+
+			player, err := replaystore.Open(t, golden, replaystore.ReplayOptions{})
+			require.NoError(t, err)
+			_, replayed := player.Head(ctx, "a.txt")
+			require.ErrorIs(t, replayed, sentinel)
+			assert.Equal(t, recorded.Error(), replayed.Error())
+
+			// A replayed error is no more specific than the recorded one
+			for _, other := range sentinels {
+				assert.Equal(t, errors.Is(recorded, other), errors.Is(replayed, other), other.Error())
+			}
+		})
+	}
+}
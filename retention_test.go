@@ -0,0 +1,107 @@
+package storagex_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/gostratum/storagex"
+	"github.com/gostratum/storagex/internal/testutil"
+)
+
+func TestValidateRetention(t *testing.T) {
+	future := time.Now().Add(time.Hour)
+	assert.NoError(t, storagex.ValidateRetention("", time.Time{}))
+	assert.NoError(t, storagex.ValidateRetention(storagex.LockModeCompliance, future))
+
+	for _, tc := range []struct {
+		mode  storagex.LockMode
+		until time.Time
+	}{
+		{storagex.LockModeGovernance, time.Time{}},
+		{"", future},
+		{"WORM", future},
+		{storagex.LockModeGovernance, time.Now().Add(-time.Hour)},
+	} {
+		assert.ErrorIs(t, storagex.ValidateRetention(tc.mode, tc.until), storagex.ErrInvalidConfig, "%s %s", tc.mode, tc.until)
+	}
+}
+
+func TestRetention_ObjectLock(t *testing.T) {
+	ctx := context.Background()
+	mock := testutil.NewMockStorage()
+	storage := storagex.NewRetryStorage(mock, storagex.RetryPolicy{})
+	manager, ok := storagex.Capability[storagex.RetentionManager](storage)
+	require.True(t, ok)
+
+	until := time.Now().Add(24 * time.Hour).Truncate(time.Second)
+	stat, err := storage.PutBytes(ctx, "records/compliance.pdf", []byte("signed"), &storagex.PutOptions{
+		LockMode:    storagex.LockModeCompliance,
+		RetainUntil: until,
+	})
+	require.NoError(t, err)
+	require.NotNil(t, stat.Retention)
+	assert.Equal(t, storagex.LockModeCompliance, stat.Retention.Mode)
+
+	stat, err = storage.Head(ctx, "records/compliance.pdf")
+	require.NoError(t, err)
+	assert.Equal(t, &storagex.Retention{Mode: storagex.LockModeCompliance, RetainUntil: until}, stat.Retention)
+
+	// Compliance retention blocks deletes and overwrites, even with bypass
+	err = storage.Delete(storagex.ContextWithGovernanceBypass(ctx), "records/compliance.pdf")
+	assert.True(t, storagex.IsRetained(err))
+	assert.ErrorIs(t, err, storagex.ErrConflict)
+	_, err = storage.PutBytes(ctx, "records/compliance.pdf", []byte("forged"), nil)
+	assert.True(t, storagex.IsRetained(err))
+	assert.Equal(t, "signed", readString(t, storage, "records/compliance.pdf"))
+
+	// It can be extended but not shortened
+	require.NoError(t, manager.SetRetention(ctx, "records/compliance.pdf", storagex.LockModeCompliance, until.Add(time.Hour)))
+	err = manager.SetRetention(ctx, "records/compliance.pdf", storagex.LockModeCompliance, until)
+	assert.True(t, storagex.IsRetained(err))
+	err = manager.SetRetention(storagex.ContextWithGovernanceBypass(ctx), "records/compliance.pdf", "", time.Time{})
+	assert.True(t, storagex.IsRetained(err))
+
+	// Governance retention yields to callers that bypass it
+	_, err = storage.PutBytes(ctx, "records/governance.pdf", []byte("draft"), &storagex.PutOptions{
+		LockMode:    storagex.LockModeGovernance,
+		RetainUntil: until,
+	})
+	require.NoError(t, err)
+	err = manager.SetRetention(ctx, "records/governance.pdf", "", time.Time{})
+	assert.True(t, storagex.IsRetained(err))
+	failed, err := storage.DeleteBatch(ctx, []string{"records/governance.pdf"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"records/governance.pdf"}, failed)
+	require.NoError(t, storage.Delete(storagex.ContextWithGovernanceBypass(ctx), "records/governance.pdf"))
+	assert.False(t, exists(t, storage, "records/governance.pdf"))
+}
+
+func TestRetention_LegalHold(t *testing.T) {
+	ctx := context.Background()
+	mock := testutil.NewMockStorage()
+
+	_, err := mock.PutBytes(ctx, "evidence.eml", []byte("mail"), &storagex.PutOptions{LegalHold: true})
+	require.NoError(t, err)
+	retention, err := mock.GetRetention(ctx, "evidence.eml")
+	require.NoError(t, err)
+	assert.True(t, retention.LegalHold)
+	assert.True(t, retention.Locked(time.Now()))
+
+	// Legal holds cannot be bypassed, only released
+	err = mock.Delete(storagex.ContextWithGovernanceBypass(ctx), "evidence.eml")
+	assert.True(t, storagex.IsRetained(err))
+
+	require.NoError(t, mock.SetLegalHold(ctx, "evidence.eml", false))
+	stat, err := mock.Head(ctx, "evidence.eml")
+	require.NoError(t, err)
+	assert.Nil(t, stat.Retention)
+	require.NoError(t, mock.Delete(ctx, "evidence.eml"))
+
+	_, err = mock.GetRetention(ctx, "evidence.eml")
+	assert.True(t, storagex.IsNotFound(err))
+	assert.True(t, storagex.IsNotFound(mock.SetLegalHold(ctx, "evidence.eml", true)))
+}
@@ -0,0 +1,422 @@
+package storagex
+
+import (
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+)
+
+// Retry modes for Config.RetryMode
+const (
+	// RetryModeSDK leaves retries to the adapter's client (the AWS SDK
+	// retryer for S3)
+	RetryModeSDK = "sdk"
+
+	// RetryModeStorageX disables adapter-level retries and wraps the
+	// storage in a RetryStorage instead
+	RetryModeStorageX = "storagex"
+)
+
+// IsRetryableError reports whether an operation that failed with err may
+// succeed if repeated. Cancellations, open circuit breakers and errors
+// describing the request or the object (not found, conflict, invalid key or
+// config, too large) are permanent; timeouts are transient. Errors implementing
+// interface{ Retryable() bool } decide for themselves. Other errors are
+// assumed transient.
+func IsRetryableError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	// Don't retry cancellation
+	if errors.Is(err, context.Canceled) || errors.Is(err, ErrAborted) {
+		return false
+	}
+
+	// An open breaker keeps failing fast until its timeout
+	if errors.Is(err, ErrCircuitOpen) {
+		return false
+	}
+
+	// Don't retry errors that would fail again
+	if errors.Is(err, ErrInvalidConfig) ||
+		errors.Is(err, ErrInvalidKey) ||
+		errors.Is(err, ErrNotFound) ||
+		errors.Is(err, ErrConflict) ||
+		errors.Is(err, ErrTooLarge) {
+		return false
+	}
+
+	if errors.Is(err, ErrTimeout) {
+		return true
+	}
+
+	var retryable interface{ Retryable() bool }
+	if errors.As(err, &retryable) {
+		return retryable.Retryable()
+	}
+
+	// Default to retryable for unknown errors
+	return true
+}
+
+// RetryPolicy configures a RetryStorage
+type RetryPolicy struct {
+	// MaxRetries is the number of retries after the first attempt
+	MaxRetries int
+
+	// BackoffInitial is the delay before the first retry. Later delays
+	// double, with 10% jitter, up to BackoffMax.
+	BackoffInitial time.Duration
+
+	// BackoffMax caps the delay between retries
+	BackoffMax time.Duration
+
+	// Retryable classifies errors (default: IsRetryableError)
+	Retryable func(error) bool
+
+	// HedgeDelay, when positive, sends a second Get for the same key if the
+	// first has not answered within this delay and uses whichever answers
+	// first. This trims tail latency at the cost of extra requests.
+	HedgeDelay time.Duration
+}
+
+// RetryPolicyFromConfig builds a RetryPolicy from the retry settings of cfg
+func RetryPolicyFromConfig(cfg *Config) RetryPolicy {
+	return RetryPolicy{
+		MaxRetries:     cfg.MaxRetries,
+		BackoffInitial: cfg.BackoffInitial,
+		BackoffMax:     cfg.BackoffMax,
+		HedgeDelay:     cfg.HedgeDelay,
+	}
+}
+
+// RetryStorage is a Storage decorator that retries failed operations with
+// exponential backoff, independent of the backend.
+//
+// Only idempotent calls are repeated. Put, MultipartUpload and UploadPart
+// are retried only when their body implements io.Seeker, so it can be
+// rewound; other bodies get a single attempt. PutBytes and PutFile are
+// always retryable. A retried Put with Overwrite=false may report
+// ErrConflict, and a retried conditional write ErrPreconditionFailed, if an
+// earlier attempt succeeded without its response arriving.
+type RetryStorage struct {
+	next   Storage
+	policy RetryPolicy
+}
+
+// NewRetryStorage wraps next with retries
+func NewRetryStorage(next Storage, policy RetryPolicy) *RetryStorage {
+	if policy.Retryable == nil {
+		policy.Retryable = IsRetryableError
+	}
+	if policy.BackoffInitial <= 0 {
+		policy.BackoffInitial = 200 * time.Millisecond
+	}
+	if policy.BackoffMax < policy.BackoffInitial {
+		policy.BackoffMax = policy.BackoffInitial
+	}
+	return &RetryStorage{next: next, policy: policy}
+}
+
+// Unwrap returns the wrapped storage
+func (r *RetryStorage) Unwrap() Storage {
+	return r.next
+}
+
+// ForwardsTo reports that conditional writes are retried and forwarded to
+// the wrapped storage
+func (r *RetryStorage) ForwardsTo(iface reflect.Type) (Storage, bool) {
+	return r.next, iface == conditionalWriterType
+}
+
+func (r *RetryStorage) newBackOff() backoff.BackOff {
+	b := backoff.NewExponentialBackOff()
+	b.InitialInterval = r.policy.BackoffInitial
+	b.MaxInterval = r.policy.BackoffMax
+	b.MaxElapsedTime = 0
+	b.Multiplier = 2.0
+	b.RandomizationFactor = 0.1
+	b.Reset()
+	return b
+}
+
+// retry calls fn until it succeeds, fails permanently, runs out of retries
+// or ctx is done. before, if set, runs ahead of every retry; an error from
+// it ends the loop with the previous error.
+func retry[T any](ctx context.Context, r *RetryStorage, maxRetries int, before func() error, fn func() (T, error)) (T, error) {
+	b := r.newBackOff()
+	for attempt := 0; ; attempt++ {
+		v, err := fn()
+		if err == nil || attempt >= maxRetries || !r.policy.Retryable(err) {
+			return v, err
+		}
+
+		timer := time.NewTimer(b.NextBackOff())
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return v, err
+		case <-timer.C:
+		}
+
+		if before != nil {
+			if rewindErr := before(); rewindErr != nil {
+				return v, err
+			}
+		}
+	}
+}
+
+// rewinder returns how many retries a body allows and a function that
+// rewinds it to its current position
+func (r *RetryStorage) rewinder(body io.Reader) (int, func() error) {
+	seeker, ok := body.(io.Seeker)
+	if !ok {
+		return 0, nil
+	}
+	offset, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, nil
+	}
+	return r.policy.MaxRetries, func() error {
+		_, err := seeker.Seek(offset, io.SeekStart)
+		return err
+	}
+}
+
+// Put stores an object, retrying only if r can be rewound
+func (r *RetryStorage) Put(ctx context.Context, key string, body io.Reader, opts *PutOptions) (Stat, error) {
+	retries, rewind := r.rewinder(body)
+	return retry(ctx, r, retries, rewind, func() (Stat, error) {
+		return r.next.Put(ctx, key, body, opts)
+	})
+}
+
+// PutBytes stores an object from a byte slice
+func (r *RetryStorage) PutBytes(ctx context.Context, key string, data []byte, opts *PutOptions) (Stat, error) {
+	return retry(ctx, r, r.policy.MaxRetries, nil, func() (Stat, error) {
+		return r.next.PutBytes(ctx, key, data, opts)
+	})
+}
+
+// PutFile stores an object from a local file path
+func (r *RetryStorage) PutFile(ctx context.Context, key string, path string, opts *PutOptions) (Stat, error) {
+	return retry(ctx, r, r.policy.MaxRetries, nil, func() (Stat, error) {
+		return r.next.PutFile(ctx, key, path, opts)
+	})
+}
+
+// getResult is the outcome of one Get attempt
+type getResult struct {
+	reader ReaderAtCloser
+	stat   Stat
+	err    error
+}
+
+// Get retrieves an object, hedging slow requests when HedgeDelay is set
+func (r *RetryStorage) Get(ctx context.Context, key string) (ReaderAtCloser, Stat, error) {
+	res, err := retry(ctx, r, r.policy.MaxRetries, nil, func() (getResult, error) {
+		if r.policy.HedgeDelay > 0 {
+			res := r.hedgedGet(ctx, key)
+			return res, res.err
+		}
+		reader, stat, err := r.next.Get(ctx, key)
+		return getResult{reader, stat, err}, err
+	})
+	return res.reader, res.stat, err
+}
+
+// hedgedGet races the first Get against a second one started after
+// HedgeDelay. The loser is cancelled and its body closed.
+func (r *RetryStorage) hedgedGet(ctx context.Context, key string) getResult {
+	type attempt struct {
+		getResult
+		cancel context.CancelFunc
+	}
+	results := make(chan attempt, 2)
+	start := func() {
+		attemptCtx, cancel := context.WithCancel(ctx)
+		go func() {
+			reader, stat, err := r.next.Get(attemptCtx, key)
+			results <- attempt{getResult{reader, stat, err}, cancel}
+		}()
+	}
+
+	start()
+	inflight := 1
+	timer := time.NewTimer(r.policy.HedgeDelay)
+	defer timer.Stop()
+	hedge := timer.C
+
+	for {
+		select {
+		case <-hedge:
+			hedge = nil
+			start()
+			inflight++
+
+		case res := <-results:
+			inflight--
+			if res.err == nil {
+				// Discard the other attempt, if any, once it returns
+				for ; inflight > 0; inflight-- {
+					go func() {
+						loser := <-results
+						loser.cancel()
+						if loser.err == nil {
+							loser.reader.Close()
+						}
+					}()
+				}
+				res.reader = &cancelOnClose{ReaderAtCloser: res.reader, cancel: res.cancel}
+				return res.getResult
+			}
+			res.cancel()
+			if inflight == 0 {
+				return res.getResult
+			}
+			// Wait for the other attempt rather than hedging again
+			hedge = nil
+		}
+	}
+}
+
+// cancelOnClose releases a hedged attempt's context when its body is closed
+type cancelOnClose struct {
+	ReaderAtCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	err := c.ReaderAtCloser.Close()
+	c.cancel()
+	return err
+}
+
+// Head retrieves object metadata
+func (r *RetryStorage) Head(ctx context.Context, key string) (Stat, error) {
+	return retry(ctx, r, r.policy.MaxRetries, nil, func() (Stat, error) {
+		return r.next.Head(ctx, key)
+	})
+}
+
+// List retrieves objects with optional filtering and pagination
+func (r *RetryStorage) List(ctx context.Context, opts ListOptions) (ListPage, error) {
+	return retry(ctx, r, r.policy.MaxRetries, nil, func() (ListPage, error) {
+		return r.next.List(ctx, opts)
+	})
+}
+
+// Delete removes a single object
+func (r *RetryStorage) Delete(ctx context.Context, key string) error {
+	_, err := retry(ctx, r, r.policy.MaxRetries, nil, func() (struct{}, error) {
+		return struct{}{}, r.next.Delete(ctx, key)
+	})
+	return err
+}
+
+// DeleteBatch removes multiple objects
+func (r *RetryStorage) DeleteBatch(ctx context.Context, keys []string) ([]string, error) {
+	return retry(ctx, r, r.policy.MaxRetries, nil, func() ([]string, error) {
+		return r.next.DeleteBatch(ctx, keys)
+	})
+}
+
+// MultipartUpload uploads a large object, retrying the whole upload only if
+// src can be rewound
+func (r *RetryStorage) MultipartUpload(ctx context.Context, key string, src io.Reader, cfg *MultipartConfig, putOpts *PutOptions) (Stat, error) {
+	retries, rewind := r.rewinder(src)
+	return retry(ctx, r, retries, rewind, func() (Stat, error) {
+		return r.next.MultipartUpload(ctx, key, src, cfg, putOpts)
+	})
+}
+
+// CreateMultipart initiates a multipart upload session
+func (r *RetryStorage) CreateMultipart(ctx context.Context, key string, putOpts *PutOptions) (string, error) {
+	return retry(ctx, r, r.policy.MaxRetries, nil, func() (string, error) {
+		return r.next.CreateMultipart(ctx, key, putOpts)
+	})
+}
+
+// UploadPart uploads a single part, retrying only if part can be rewound
+func (r *RetryStorage) UploadPart(ctx context.Context, key, uploadID string, partNumber int32, part io.Reader, size int64) (string, error) {
+	retries, rewind := r.rewinder(part)
+	return retry(ctx, r, retries, rewind, func() (string, error) {
+		return r.next.UploadPart(ctx, key, uploadID, partNumber, part, size)
+	})
+}
+
+// CompleteMultipart finalizes a multipart upload
+func (r *RetryStorage) CompleteMultipart(ctx context.Context, key, uploadID string, etags []string) (Stat, error) {
+	return retry(ctx, r, r.policy.MaxRetries, nil, func() (Stat, error) {
+		return r.next.CompleteMultipart(ctx, key, uploadID, etags)
+	})
+}
+
+// AbortMultipart cancels a multipart upload
+func (r *RetryStorage) AbortMultipart(ctx context.Context, key, uploadID string) error {
+	_, err := retry(ctx, r, r.policy.MaxRetries, nil, func() (struct{}, error) {
+		return struct{}{}, r.next.AbortMultipart(ctx, key, uploadID)
+	})
+	return err
+}
+
+// PutIfAbsent stores an object if the key does not exist, retrying only if r
+// can be rewound. It fails with ErrInvalidConfig if the wrapped storage
+// does not implement ConditionalWriter.
+func (r *RetryStorage) PutIfAbsent(ctx context.Context, key string, body io.Reader, opts *PutOptions) (Stat, error) {
+	writer, err := conditionalWriterOf(r.next, "put_if_absent", key)
+	if err != nil {
+		return Stat{}, err
+	}
+	retries, rewind := r.rewinder(body)
+	return retry(ctx, r, retries, rewind, func() (Stat, error) {
+		return writer.PutIfAbsent(ctx, key, body, opts)
+	})
+}
+
+// PutIfMatch replaces an object if its ETag is etag. See PutIfAbsent.
+func (r *RetryStorage) PutIfMatch(ctx context.Context, key string, body io.Reader, etag string, opts *PutOptions) (Stat, error) {
+	writer, err := conditionalWriterOf(r.next, "put_if_match", key)
+	if err != nil {
+		return Stat{}, err
+	}
+	retries, rewind := r.rewinder(body)
+	return retry(ctx, r, retries, rewind, func() (Stat, error) {
+		return writer.PutIfMatch(ctx, key, body, etag, opts)
+	})
+}
+
+// DeleteIfMatch removes an object if its ETag is etag
+func (r *RetryStorage) DeleteIfMatch(ctx context.Context, key, etag string) error {
+	writer, err := conditionalWriterOf(r.next, "delete_if_match", key)
+	if err != nil {
+		return err
+	}
+	_, err = retry(ctx, r, r.policy.MaxRetries, nil, func() (struct{}, error) {
+		return struct{}{}, writer.DeleteIfMatch(ctx, key, etag)
+	})
+	return err
+}
+
+// PresignGet generates a presigned download URL. Presigning is local, so
+// it is not retried.
+func (r *RetryStorage) PresignGet(ctx context.Context, key string, opts *PresignOptions) (string, error) {
+	return r.next.PresignGet(ctx, key, opts)
+}
+
+// PresignPut generates a presigned upload URL. Presigning is local, so it
+// is not retried.
+func (r *RetryStorage) PresignPut(ctx context.Context, key string, opts *PresignOptions) (string, error) {
+	return r.next.PresignPut(ctx, key, opts)
+}
+
+var (
+	_ Storage           = (*RetryStorage)(nil)
+	_ ConditionalWriter = (*RetryStorage)(nil)
+)
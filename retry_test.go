@@ -0,0 +1,137 @@
+package storagex_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/gostratum/storagex"
+	"github.com/gostratum/storagex/faultstore"
+	"github.com/gostratum/storagex/internal/testutil"
+)
+
+func TestIsRetryableError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"canceled", context.Canceled, false},
+		{"aborted", &storagex.StorageError{Op: "get", Err: storagex.ErrAborted}, false},
+		{"not found", &storagex.StorageError{Op: "get", Err: storagex.ErrNotFound}, false},
+		{"conflict", storagex.ErrConflict, false},
+		{"too large", storagex.ErrTooLarge, false},
+		{"timeout", &storagex.StorageError{Op: "put", Err: storagex.ErrTimeout}, true},
+		{"throttled", faultstore.ErrThrottled, true},
+		{"unknown", errors.New("connection reset"), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, storagex.IsRetryableError(tt.err))
+		})
+	}
+}
+
+func newRetryStorage(rules ...faultstore.Rule) (*storagex.RetryStorage, *faultstore.Store) {
+	faults := faultstore.New(testutil.NewMockStorage(), faultstore.Options{Rules: rules})
+	return storagex.NewRetryStorage(faults, storagex.RetryPolicy{
+		MaxRetries:     3,
+		BackoffInitial: time.Millisecond,
+		BackoffMax:     5 * time.Millisecond,
+	}), faults
+}
+
+func TestRetryStorage_RetriesTransientErrors(t *testing.T) {
+	ctx := context.Background()
+	storage, faults := newRetryStorage(faultstore.Rule{
+		Name:  "throttle",
+		Ops:   []faultstore.Op{faultstore.OpPut},
+		Count: 2,
+		Err:   faultstore.ErrThrottled,
+	})
+
+	_, err := storage.PutBytes(ctx, "a.txt", []byte("alpha"), nil)
+	require.NoError(t, err)
+	assert.Equal(t, 2, faults.Fired("throttle"))
+
+	// Permanent errors are returned at once
+	faults.AddRule(faultstore.Rule{Name: "conflict", Ops: []faultstore.Op{faultstore.OpHead}, Err: storagex.ErrConflict})
+	_, err = storage.Head(ctx, "a.txt")
+	assert.True(t, errors.Is(err, storagex.ErrConflict))
+	assert.Equal(t, 1, faults.Fired("conflict"))
+
+	// Retries stop after MaxRetries
+	faults.AddRule(faultstore.Rule{Name: "down", Ops: []faultstore.Op{faultstore.OpList}, Err: storagex.ErrTimeout})
+	_, err = storage.List(ctx, storagex.ListOptions{})
+	assert.True(t, errors.Is(err, storagex.ErrTimeout))
+	assert.Equal(t, 4, faults.Fired("down"))
+}
+
+func TestRetryStorage_OnlyRewindableBodiesAreRetried(t *testing.T) {
+	ctx := context.Background()
+	storage, faults := newRetryStorage()
+	failOnce := func(name string) {
+		faults.AddRule(faultstore.Rule{Name: name, Ops: []faultstore.Op{faultstore.OpPut}, Count: 1, Err: storagex.ErrTimeout})
+	}
+
+	// A plain reader cannot be replayed
+	failOnce("stream")
+	_, err := storage.Put(ctx, "stream.txt", io.MultiReader(strings.NewReader("alpha")), nil)
+	assert.True(t, errors.Is(err, storagex.ErrTimeout))
+
+	// A seekable body is rewound to where it started
+	failOnce("seekable")
+	body := bytes.NewReader([]byte("skip:alpha"))
+	_, err = body.Seek(5, io.SeekStart)
+	require.NoError(t, err)
+	_, err = storage.Put(ctx, "seekable.txt", body, nil)
+	require.NoError(t, err)
+
+	reader, _, err := storage.Get(ctx, "seekable.txt")
+	require.NoError(t, err)
+	defer reader.Close()
+	data, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "alpha", string(data))
+}
+
+func TestRetryStorage_HedgedGet(t *testing.T) {
+	ctx := context.Background()
+	faults := faultstore.New(testutil.NewMockStorage(), faultstore.Options{})
+	storage := storagex.NewRetryStorage(faults, storagex.RetryPolicy{HedgeDelay: 10 * time.Millisecond})
+
+	_, err := storage.PutBytes(ctx, "hot.txt", []byte("hot"), nil)
+	require.NoError(t, err)
+
+	// Only the first request is slow; the hedge answers
+	faults.AddRule(faultstore.Rule{Ops: []faultstore.Op{faultstore.OpGet}, Count: 1, Latency: 5 * time.Second})
+
+	start := time.Now()
+	reader, stat, err := storage.Get(ctx, "hot.txt")
+	require.NoError(t, err)
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Equal(t, int64(3), stat.Size)
+
+	data, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	require.NoError(t, reader.Close())
+	assert.Equal(t, "hot", string(data))
+}
+
+func ExampleNewRetryStorage() {
+	storage := storagex.NewRetryStorage(testutil.NewMockStorage(), storagex.RetryPolicyFromConfig(storagex.DefaultConfig()))
+
+	_, err := storage.Head(context.Background(), "missing.txt")
+	fmt.Println(storagex.IsNotFound(err))
+	// Output: true
+}
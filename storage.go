@@ -7,6 +7,8 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"reflect"
+	"strings"
 	"time"
 )
 
@@ -32,6 +34,29 @@ var (
 
 	// ErrInvalidKey indicates the object key is invalid
 	ErrInvalidKey = errors.New("storagex: invalid object key")
+
+	// ErrThrottled indicates the backend asked the client to slow down
+	// (e.g., S3 503 SlowDown). It wraps ErrTimeout, so throttled calls are
+	// retryable.
+	ErrThrottled = fmt.Errorf("storagex: request throttled: %w", ErrTimeout)
+
+	// ErrNotModified indicates a conditional read found the object unchanged
+	ErrNotModified = errors.New("storagex: object not modified")
+
+	// ErrArchived indicates the object is in an archive storage class
+	// (e.g., S3 Glacier) and must be restored before it can be read. It
+	// wraps ErrConflict, which archived objects were reported as before.
+	ErrArchived = fmt.Errorf("storagex: object archived: %w", ErrConflict)
+
+	// ErrRetained indicates a delete, overwrite or retention change was
+	// refused because the object is under Object Lock retention or legal
+	// hold. It wraps ErrConflict.
+	ErrRetained = fmt.Errorf("storagex: object under retention: %w", ErrConflict)
+
+	// ErrPreconditionFailed indicates a conditional write or delete found
+	// the object in a different state than required (see
+	// ConditionalWriter). It wraps ErrConflict.
+	ErrPreconditionFailed = fmt.Errorf("storagex: precondition failed: %w", ErrConflict)
 )
 
 // StorageError wraps underlying errors with additional context
@@ -57,6 +82,70 @@ func IsNotFound(err error) bool {
 	return errors.Is(err, ErrNotFound)
 }
 
+// IsThrottled checks if an error is or wraps ErrThrottled
+func IsThrottled(err error) bool {
+	return errors.Is(err, ErrThrottled)
+}
+
+// IsArchived checks if an error is or wraps ErrArchived
+func IsArchived(err error) bool {
+	return errors.Is(err, ErrArchived)
+}
+
+// IsRetained checks if an error is or wraps ErrRetained
+func IsRetained(err error) bool {
+	return errors.Is(err, ErrRetained)
+}
+
+// IsPreconditionFailed checks if an error is or wraps ErrPreconditionFailed
+func IsPreconditionFailed(err error) bool {
+	return errors.Is(err, ErrPreconditionFailed)
+}
+
+// Storage classes understood by the S3 adapter. Other providers may accept
+// their own class names.
+const (
+	StorageClassStandard           = "STANDARD"
+	StorageClassStandardIA         = "STANDARD_IA"
+	StorageClassOneZoneIA          = "ONEZONE_IA"
+	StorageClassIntelligentTiering = "INTELLIGENT_TIERING"
+	StorageClassGlacierIR          = "GLACIER_IR"
+	StorageClassGlacier            = "GLACIER"
+	StorageClassDeepArchive        = "DEEP_ARCHIVE"
+)
+
+// IsArchiveClass reports whether objects of a storage class must be
+// restored before they can be read
+func IsArchiveClass(class string) bool {
+	return class == StorageClassGlacier || class == StorageClassDeepArchive
+}
+
+// RestoreTier selects how fast (and at what cost) an archived object is
+// restored
+type RestoreTier string
+
+const (
+	// RestoreTierExpedited restores within minutes (not available for
+	// DEEP_ARCHIVE)
+	RestoreTierExpedited RestoreTier = "Expedited"
+
+	// RestoreTierStandard restores within hours
+	RestoreTierStandard RestoreTier = "Standard"
+
+	// RestoreTierBulk is the cheapest and slowest tier
+	RestoreTierBulk RestoreTier = "Bulk"
+)
+
+// RestoreStatus describes the restore of an archived object
+type RestoreStatus struct {
+	// InProgress is true until the restored copy is readable
+	InProgress bool
+
+	// ExpiresAt is when the restored copy is removed again (zero while
+	// the restore is in progress)
+	ExpiresAt time.Time
+}
+
 // PutOptions configures object storage operations
 type PutOptions struct {
 	// ContentType specifies the MIME type of the object
@@ -75,6 +164,18 @@ type PutOptions struct {
 
 	// ContentEncoding sets the Content-Encoding header
 	ContentEncoding string
+
+	// StorageClass selects the storage class (e.g., StorageClassStandardIA);
+	// empty uses the bucket default. It also applies to multipart uploads.
+	StorageClass string
+
+	// LockMode and RetainUntil place Object Lock retention on the new
+	// object; both must be set together (see ValidateRetention)
+	LockMode    LockMode
+	RetainUntil time.Time
+
+	// LegalHold places a legal hold on the new object
+	LegalHold bool
 }
 
 // Stat contains object metadata and statistics
@@ -99,6 +200,14 @@ type Stat struct {
 
 	// StorageClass indicates the storage tier (if applicable)
 	StorageClass string
+
+	// Restore describes the restore of an archived object; nil if no
+	// restore was requested. Set by Get and Head, not by List.
+	Restore *RestoreStatus
+
+	// Retention is the Object Lock state of the object; nil if it has no
+	// retention or legal hold. Set by Get and Head, not by List.
+	Retention *Retention
 }
 
 // ListOptions configures object listing operations
@@ -158,6 +267,76 @@ type PresignOptions struct {
 
 	// ContentLengthRange restricts upload size [min, max] bytes
 	ContentLengthRange [2]int64
+
+	// ResponseContentDisposition overrides the Content-Disposition header
+	// returned by a presigned GET (see ContentDispositionAttachment)
+	ResponseContentDisposition string
+
+	// ResponseContentType overrides the Content-Type header returned by a
+	// presigned GET. When empty, ContentType is used for GET requests.
+	ResponseContentType string
+
+	// ResponseCacheControl overrides the Cache-Control header returned by a
+	// presigned GET
+	ResponseCacheControl string
+
+	// VersionID selects a specific object version for presigned GETs
+	VersionID string
+
+	// SSECustomerAlgorithm enables SSE-C (e.g., "AES256"). The client must
+	// send the matching x-amz-server-side-encryption-customer-* headers.
+	SSECustomerAlgorithm string
+
+	// SSECustomerKey is the raw customer-provided encryption key for SSE-C
+	SSECustomerKey []byte
+
+	// ChecksumAlgorithm requires presigned PUT uploads to carry a checksum
+	// ("CRC32", "CRC32C", "SHA1" or "SHA256")
+	ChecksumAlgorithm string
+
+	// Checksum is the expected base64-encoded checksum of the upload for
+	// ChecksumAlgorithm. When set, S3 rejects bodies that do not match.
+	Checksum string
+}
+
+// ContentDispositionAttachment builds a Content-Disposition value that makes
+// browsers download the object under filename. Non-ASCII names are encoded
+// per RFC 6266 with an ASCII fallback.
+func ContentDispositionAttachment(filename string) string {
+	fallback := make([]rune, 0, len(filename))
+	ascii := true
+	for _, r := range filename {
+		switch {
+		case r == '"' || r == '\\':
+			fallback = append(fallback, '_')
+		case r < 0x20 || r > 0x7e:
+			fallback = append(fallback, '_')
+			ascii = false
+		default:
+			fallback = append(fallback, r)
+		}
+	}
+
+	disposition := fmt.Sprintf("attachment; filename=%q", string(fallback))
+	if !ascii {
+		disposition += "; filename*=UTF-8''" + encodeRFC5987(filename)
+	}
+	return disposition
+}
+
+// encodeRFC5987 percent-encodes every byte that is not an RFC 5987 attr-char
+func encodeRFC5987(s string) string {
+	const attrChars = "!#$&+-.^_`|~"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || strings.IndexByte(attrChars, c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
 }
 
 // ReaderAtCloser combines io.ReadCloser with optional ReadAt capability
@@ -168,6 +347,10 @@ type ReaderAtCloser interface {
 	Size() int64
 }
 
+// DeleteBatchSize is the largest number of keys to pass to one DeleteBatch
+// call, the S3 DeleteObjects limit
+const DeleteBatchSize = 1000
+
 // Storage is the main interface for object storage operations
 type Storage interface {
 	// Put stores an object from an io.Reader
@@ -229,3 +412,164 @@ type MultipartUploadInfo struct {
 	UploadID  string
 	Initiated time.Time
 }
+
+// MultipartLister is implemented by storages that can enumerate in-progress
+// multipart uploads (e.g., to find and abort dangling uploads)
+type MultipartLister interface {
+	// ListMultipartUploads returns the in-progress uploads whose key starts with prefix
+	ListMultipartUploads(ctx context.Context, prefix string) ([]MultipartUploadInfo, error)
+}
+
+// StorageClassManager is implemented by storages with storage classes and
+// archive tiers (e.g., S3 with Glacier)
+type StorageClassManager interface {
+	// Transition changes the storage class of an existing object in place.
+	// Archived objects must be restored first.
+	Transition(ctx context.Context, key, class string) (Stat, error)
+
+	// RestoreObject requests a temporary readable copy of an archived
+	// object, kept for days. Restores take minutes to hours; Head reports
+	// progress in Stat.Restore. Requesting a restore that is already in
+	// progress is not an error.
+	RestoreObject(ctx context.Context, key string, days int, tier RestoreTier) error
+}
+
+// CapabilityForwarder is implemented by decorators that implement an
+// optional interface only by forwarding it, through their own policy, to
+// the storage they wrap (e.g., RetryStorage retries conditional writes).
+// Capability stops at such a decorator instead of unwrapping past it, but
+// reports the interface as missing when the storage it forwards to does not
+// provide it.
+type CapabilityForwarder interface {
+	// ForwardsTo returns the storage the decorator forwards the interface
+	// type iface to, and false if it does not forward iface
+	ForwardsTo(iface reflect.Type) (Storage, bool)
+}
+
+// Capability returns the first storage in the Unwrap chain of s, starting
+// with s itself, that implements T. Pass-through decorators only implement
+// the Storage interface, so optional interfaces such as StorageClassManager
+// are found on the storage they wrap. Decorators that must see conditional
+// writes (RetryStorage, RateLimitStorage, CircuitBreakerStorage,
+// MirrorStorage and the read cache) implement ConditionalWriter themselves
+// and CapabilityForwarder, so writes are not sent around them. TieredStorage
+// has no Unwrap, since calls on the storages it wraps would bypass its
+// pointers.
+//
+//	if manager, ok := storagex.Capability[storagex.StorageClassManager](storage); ok {
+//	    err = manager.RestoreObject(ctx, key, 7, storagex.RestoreTierStandard)
+//	}
+func Capability[T any](s Storage) (T, bool) {
+	c, ok := capability(s, reflect.TypeFor[T]()).(T)
+	return c, ok
+}
+
+// HasCapability reports whether Capability finds the interface type iface
+// on s. Decorators use it to check the storage they forward to.
+func HasCapability(s Storage, iface reflect.Type) bool {
+	return capability(s, iface) != nil
+}
+
+// capability returns the storage Capability finds for t, or nil
+func capability(s Storage, t reflect.Type) Storage {
+	for s != nil {
+		if reflect.TypeOf(s).AssignableTo(t) {
+			if f, ok := s.(CapabilityForwarder); ok {
+				if next, ok := f.ForwardsTo(t); ok && !HasCapability(next, t) {
+					return nil
+				}
+			}
+			return s
+		}
+		u, ok := s.(interface{ Unwrap() Storage })
+		if !ok {
+			break
+		}
+		s = u.Unwrap()
+	}
+	return nil
+}
+
+// conditionalWriterType is the reflect.Type of ConditionalWriter
+var conditionalWriterType = reflect.TypeFor[ConditionalWriter]()
+
+// conditionalWriterOf returns the ConditionalWriter a decorator forwards
+// conditional writes to, or ErrInvalidConfig if next does not provide one
+func conditionalWriterOf(next Storage, op, key string) (ConditionalWriter, error) {
+	writer, ok := Capability[ConditionalWriter](next)
+	if !ok {
+		return nil, &StorageError{Op: op, Key: key, Err: fmt.Errorf("wrapped storage does not support conditional writes: %w", ErrInvalidConfig)}
+	}
+	return writer, nil
+}
+
+// WaitRestored polls Head every interval until the restore of an archived
+// object completes and returns its Stat. It fails with ErrArchived if no
+// restore was requested.
+func WaitRestored(ctx context.Context, storage Storage, key string, interval time.Duration) (Stat, error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		stat, err := storage.Head(ctx, key)
+		if err != nil {
+			if ctx.Err() != nil {
+				// The deadline passed during Head rather than between polls
+				return stat, waitCancelled(ctx, key)
+			}
+			return stat, err
+		}
+		if stat.Restore == nil {
+			if IsArchiveClass(stat.StorageClass) {
+				return stat, &StorageError{Op: "restore", Key: key, Err: fmt.Errorf("%w: no restore requested", ErrArchived)}
+			}
+			return stat, nil
+		}
+		if !stat.Restore.InProgress {
+			return stat, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return stat, waitCancelled(ctx, key)
+		case <-ticker.C:
+		}
+	}
+}
+
+// waitCancelled returns the error of a WaitRestored whose ctx is done
+func waitCancelled(ctx context.Context, key string) error {
+	err := ErrAborted
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		err = ErrTimeout
+	}
+	return &StorageError{Op: "restore", Key: key, Err: err}
+}
+
+// ConditionalGetter is implemented by storages that can skip transferring an
+// object the caller already has (e.g., S3 If-None-Match)
+type ConditionalGetter interface {
+	// GetIfNoneMatch retrieves an object unless its ETag equals etag, in
+	// which case it returns ErrNotModified
+	GetIfNoneMatch(ctx context.Context, key, etag string) (ReaderAtCloser, Stat, error)
+}
+
+// ConditionalWriter is implemented by storages whose writes and deletes can
+// be made conditional on the current state of the object, checked
+// atomically by the backend (e.g., S3 and MinIO conditional writes). Unlike
+// PutOptions.Overwrite, which may check and write separately, concurrent
+// conditional writes cannot both succeed. Writes whose condition does not
+// hold fail with ErrPreconditionFailed.
+type ConditionalWriter interface {
+	// PutIfAbsent stores an object only if the key does not exist
+	// (If-None-Match: *). opts.Overwrite is ignored.
+	PutIfAbsent(ctx context.Context, key string, r io.Reader, opts *PutOptions) (Stat, error)
+
+	// PutIfMatch replaces an object only if its current ETag is etag
+	// (If-Match). opts.Overwrite is ignored.
+	PutIfMatch(ctx context.Context, key string, r io.Reader, etag string, opts *PutOptions) (Stat, error)
+
+	// DeleteIfMatch removes an object only if its current ETag is etag. It
+	// fails with ErrNotFound if the object does not exist.
+	DeleteIfMatch(ctx context.Context, key, etag string) error
+}
@@ -0,0 +1,70 @@
+package storagex_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/gostratum/storagex"
+	"github.com/gostratum/storagex/internal/testutil"
+)
+
+func TestStorageClass_ArchiveAndRestore(t *testing.T) {
+	ctx := context.Background()
+	mock := testutil.NewMockStorage()
+
+	stat, err := mock.PutBytes(ctx, "ia.txt", []byte("infrequent"), &storagex.PutOptions{StorageClass: storagex.StorageClassStandardIA})
+	require.NoError(t, err)
+	assert.Equal(t, storagex.StorageClassStandardIA, stat.StorageClass)
+	assert.Equal(t, "infrequent", readString(t, mock, "ia.txt"))
+
+	_, err = mock.PutBytes(ctx, "cold.txt", []byte("archived"), &storagex.PutOptions{StorageClass: storagex.StorageClassGlacier})
+	require.NoError(t, err)
+	_, _, err = mock.Get(ctx, "cold.txt")
+	assert.True(t, storagex.IsArchived(err))
+	assert.ErrorIs(t, err, storagex.ErrConflict)
+
+	// The capability is found through decorators
+	storage := storagex.NewRetryStorage(mock, storagex.RetryPolicy{})
+	manager, ok := storagex.Capability[storagex.StorageClassManager](storage)
+	require.True(t, ok)
+
+	_, err = storagex.WaitRestored(ctx, storage, "cold.txt", time.Millisecond)
+	assert.True(t, storagex.IsArchived(err), "no restore requested")
+
+	require.NoError(t, manager.RestoreObject(ctx, "cold.txt", 7, storagex.RestoreTierBulk))
+	stat, err = storage.Head(ctx, "cold.txt")
+	require.NoError(t, err)
+	require.NotNil(t, stat.Restore)
+	assert.True(t, stat.Restore.InProgress)
+
+	waitCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err = storagex.WaitRestored(waitCtx, storage, "cold.txt", time.Millisecond)
+	assert.ErrorIs(t, err, storagex.ErrTimeout)
+
+	mock.CompleteRestore("cold.txt")
+	stat, err = storagex.WaitRestored(ctx, storage, "cold.txt", time.Millisecond)
+	require.NoError(t, err)
+	assert.False(t, stat.Restore.InProgress)
+	assert.Equal(t, "archived", readString(t, storage, "cold.txt"))
+
+	// Restored objects can move back to an online class
+	stat, err = manager.Transition(ctx, "cold.txt", storagex.StorageClassStandard)
+	require.NoError(t, err)
+	assert.Equal(t, storagex.StorageClassStandard, stat.StorageClass)
+	assert.Nil(t, stat.Restore)
+
+	_, err = manager.Transition(ctx, "ia.txt", storagex.StorageClassDeepArchive)
+	require.NoError(t, err)
+	_, err = manager.Transition(ctx, "ia.txt", storagex.StorageClassStandard)
+	assert.True(t, storagex.IsArchived(err))
+
+	// Online objects need no restore
+	stat, err = storagex.WaitRestored(ctx, storage, "cold.txt", time.Millisecond)
+	require.NoError(t, err)
+	assert.Equal(t, storagex.StorageClassStandard, stat.StorageClass)
+}
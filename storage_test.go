@@ -0,0 +1,23 @@
+package storagex
+
+import "testing"
+
+func TestContentDispositionAttachment(t *testing.T) {
+	tests := []struct {
+		name     string
+		filename string
+		want     string
+	}{
+		{"ascii", "report.pdf", `attachment; filename="report.pdf"`},
+		{"quotes", `say "hi".txt`, `attachment; filename="say _hi_.txt"`},
+		{"unicode", "résumé.pdf", `attachment; filename="r_sum_.pdf"; filename*=UTF-8''r%C3%A9sum%C3%A9.pdf`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ContentDispositionAttachment(tt.filename); got != tt.want {
+				t.Fatalf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,487 @@
+// Package storagextest provides a conformance suite that any storagex.Storage
+// implementation can run to check it honors the Storage contract.
+//
+// Example usage (in an adapter's _test.go file):
+//
+//	func TestConformance(t *testing.T) {
+//	    storagextest.RunConformance(t, func(t *testing.T) storagex.Storage {
+//	        return newTestStorage(t)
+//	    })
+//	}
+//
+// Every subtest writes below its own random key prefix and removes what it
+// wrote, so the factory may return the same storage (and bucket) each time.
+package storagextest
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/gostratum/storagex"
+)
+
+// minPartSize is the smallest non-final multipart part accepted by S3
+const minPartSize = 5 << 20
+
+// Factory returns the storage under test. It is called once per subtest.
+type Factory func(t *testing.T) storagex.Storage
+
+// RunConformance runs the Storage contract tests against storages returned
+// by factory.
+//
+// The contract checked:
+//   - Put/PutBytes/PutFile/Get/Head round-trip content, content type and metadata
+//   - a nil *PutOptions overwrites; Overwrite=false returns ErrConflict
+//   - Get and Head of a missing key return ErrNotFound; Delete is idempotent
+//   - List returns keys in lexicographic order, honors PageSize and
+//     continuation tokens, and groups CommonPrefixes by Delimiter
+//   - DeleteBatch only reports keys it failed to delete, ignoring missing ones
+//   - multipart uploads complete in part order and are unusable once aborted
+//   - a cancelled context fails with context.Canceled or ErrAborted
+//   - keys with non-ASCII characters, spaces and reserved URL characters
+//     round-trip unchanged
+func RunConformance(t *testing.T, factory Factory) {
+	t.Helper()
+
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, s storagex.Storage, prefix string)
+	}{
+		{"PutGetHead", testPutGetHead},
+		{"PutFile", testPutFile},
+		{"EmptyObject", testEmptyObject},
+		{"Overwrite", testOverwrite},
+		{"NotFound", testNotFound},
+		{"ListPagination", testListPagination},
+		{"ListDelimiter", testListDelimiter},
+		{"DeleteBatch", testDeleteBatch},
+		{"MultipartLifecycle", testMultipartLifecycle},
+		{"MultipartAbort", testMultipartAbort},
+		{"MultipartUpload", testMultipartUpload},
+		{"ContextCancellation", testContextCancellation},
+		{"UnicodeKeys", testUnicodeKeys},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage := factory(t)
+			require.NotNil(t, storage, "factory returned nil storage")
+
+			prefix := randomPrefix(t)
+			t.Cleanup(func() { cleanupPrefix(t, storage, prefix) })
+			tt.fn(t, storage, prefix)
+		})
+	}
+}
+
+func randomPrefix(t *testing.T) string {
+	t.Helper()
+	b := make([]byte, 6)
+	_, err := rand.Read(b)
+	require.NoError(t, err)
+	return "storagextest-" + hex.EncodeToString(b) + "/"
+}
+
+// cleanupPrefix removes every object written by a subtest
+func cleanupPrefix(t *testing.T, storage storagex.Storage, prefix string) {
+	ctx := context.Background()
+	keys, err := listAll(ctx, storage, prefix)
+	if err != nil {
+		t.Logf("storagextest: cleanup of %s failed: %v", prefix, err)
+		return
+	}
+	if len(keys) > 0 {
+		if _, err := storage.DeleteBatch(ctx, keys); err != nil {
+			t.Logf("storagextest: cleanup of %s failed: %v", prefix, err)
+		}
+	}
+}
+
+func listAll(ctx context.Context, storage storagex.Storage, prefix string) ([]string, error) {
+	var keys []string
+	opts := storagex.ListOptions{Prefix: prefix}
+	for {
+		page, err := storage.List(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range page.Keys {
+			keys = append(keys, obj.Key)
+		}
+		if !page.IsTruncated || page.NextToken == "" {
+			return keys, nil
+		}
+		opts.ContinuationToken = page.NextToken
+	}
+}
+
+func readObject(t *testing.T, storage storagex.Storage, key string) ([]byte, storagex.Stat) {
+	t.Helper()
+	reader, stat, err := storage.Get(context.Background(), key)
+	require.NoError(t, err, "Get %q", key)
+	defer reader.Close()
+
+	data, err := io.ReadAll(reader)
+	require.NoError(t, err, "reading %q", key)
+	return data, stat
+}
+
+func putBytes(t *testing.T, storage storagex.Storage, key string, data []byte) {
+	t.Helper()
+	_, err := storage.PutBytes(context.Background(), key, data, &storagex.PutOptions{Overwrite: true})
+	require.NoError(t, err, "PutBytes %q", key)
+}
+
+func testData(n int) []byte {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	return data
+}
+
+func testPutGetHead(t *testing.T, storage storagex.Storage, prefix string) {
+	ctx := context.Background()
+	key := prefix + "docs/report.txt"
+	content := []byte("conformance payload")
+
+	stat, err := storage.Put(ctx, key, bytes.NewReader(content), &storagex.PutOptions{
+		ContentType: "text/plain",
+		Metadata:    map[string]string{"owner": "alice"},
+		Overwrite:   true,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, key, stat.Key)
+	assert.Equal(t, int64(len(content)), stat.Size)
+
+	data, getStat := readObject(t, storage, key)
+	assert.Equal(t, content, data)
+	assert.Equal(t, int64(len(content)), getStat.Size)
+	assert.Equal(t, "text/plain", getStat.ContentType)
+
+	head, err := storage.Head(ctx, key)
+	require.NoError(t, err)
+	assert.Equal(t, key, head.Key)
+	assert.Equal(t, int64(len(content)), head.Size)
+	assert.Equal(t, "text/plain", head.ContentType)
+	assert.Equal(t, "alice", head.Metadata["owner"])
+	assert.NotEmpty(t, head.ETag)
+	assert.False(t, head.LastModified.IsZero(), "LastModified should be set")
+}
+
+func testPutFile(t *testing.T, storage storagex.Storage, prefix string) {
+	path := filepath.Join(t.TempDir(), "upload.bin")
+	content := testData(4096)
+	require.NoError(t, os.WriteFile(path, content, 0o644))
+
+	key := prefix + "files/upload.bin"
+	stat, err := storage.PutFile(context.Background(), key, path, &storagex.PutOptions{Overwrite: true})
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(content)), stat.Size)
+
+	data, _ := readObject(t, storage, key)
+	assert.Equal(t, content, data)
+}
+
+func testEmptyObject(t *testing.T, storage storagex.Storage, prefix string) {
+	key := prefix + "empty"
+	putBytes(t, storage, key, nil)
+
+	data, stat := readObject(t, storage, key)
+	assert.Empty(t, data)
+	assert.Equal(t, int64(0), stat.Size)
+}
+
+func testOverwrite(t *testing.T, storage storagex.Storage, prefix string) {
+	ctx := context.Background()
+	key := prefix + "overwrite.txt"
+
+	_, err := storage.PutBytes(ctx, key, []byte("v1"), &storagex.PutOptions{})
+	require.NoError(t, err, "Overwrite=false must succeed for a new key")
+
+	_, err = storage.PutBytes(ctx, key, []byte("v2"), &storagex.PutOptions{})
+	require.Error(t, err)
+	assert.ErrorIs(t, err, storagex.ErrConflict)
+
+	data, _ := readObject(t, storage, key)
+	assert.Equal(t, "v1", string(data), "a conflicting Put must not modify the object")
+
+	_, err = storage.PutBytes(ctx, key, []byte("v3"), nil)
+	require.NoError(t, err, "nil options must overwrite")
+	data, _ = readObject(t, storage, key)
+	assert.Equal(t, "v3", string(data))
+
+	_, err = storage.PutBytes(ctx, key, []byte("v4"), &storagex.PutOptions{Overwrite: true})
+	require.NoError(t, err)
+	data, _ = readObject(t, storage, key)
+	assert.Equal(t, "v4", string(data))
+}
+
+func testNotFound(t *testing.T, storage storagex.Storage, prefix string) {
+	ctx := context.Background()
+	key := prefix + "missing"
+
+	_, _, err := storage.Get(ctx, key)
+	assert.ErrorIs(t, err, storagex.ErrNotFound, "Get")
+
+	_, err = storage.Head(ctx, key)
+	assert.ErrorIs(t, err, storagex.ErrNotFound, "Head")
+
+	var storageErr *storagex.StorageError
+	if assert.ErrorAs(t, err, &storageErr, "errors should be *StorageError") {
+		assert.NotEmpty(t, storageErr.Op)
+	}
+
+	assert.NoError(t, storage.Delete(ctx, key), "Delete of a missing key is idempotent")
+
+	putBytes(t, storage, key, []byte("x"))
+	require.NoError(t, storage.Delete(ctx, key))
+	_, err = storage.Head(ctx, key)
+	assert.ErrorIs(t, err, storagex.ErrNotFound, "Head after Delete")
+}
+
+func testListPagination(t *testing.T, storage storagex.Storage, prefix string) {
+	ctx := context.Background()
+	want := []string{prefix + "a", prefix + "b", prefix + "c/d", prefix + "e", prefix + "f"}
+	for _, key := range want {
+		putBytes(t, storage, key, []byte(key))
+	}
+
+	var got []string
+	opts := storagex.ListOptions{Prefix: prefix, PageSize: 2}
+	for pages := 0; ; pages++ {
+		require.Less(t, pages, len(want)+1, "pagination does not terminate")
+
+		page, err := storage.List(ctx, opts)
+		require.NoError(t, err)
+		assert.LessOrEqual(t, len(page.Keys), 2, "PageSize must be honored")
+		for _, obj := range page.Keys {
+			got = append(got, obj.Key)
+			if obj.Key == prefix+"a" {
+				assert.Equal(t, int64(len(prefix+"a")), obj.Size)
+			}
+		}
+
+		if !page.IsTruncated {
+			break
+		}
+		require.NotEmpty(t, page.NextToken, "truncated pages must return NextToken")
+		opts.ContinuationToken = page.NextToken
+	}
+	assert.Equal(t, want, got, "keys must be listed once each, in lexicographic order")
+
+	page, err := storage.List(ctx, storagex.ListOptions{Prefix: prefix + "c/"})
+	require.NoError(t, err)
+	require.Len(t, page.Keys, 1)
+	assert.Equal(t, prefix+"c/d", page.Keys[0].Key)
+	assert.False(t, page.IsTruncated)
+}
+
+func testListDelimiter(t *testing.T, storage storagex.Storage, prefix string) {
+	ctx := context.Background()
+	for _, key := range []string{"a.txt", "dir1/b.txt", "dir1/sub/c.txt", "dir2/d.txt"} {
+		putBytes(t, storage, prefix+key, []byte(key))
+	}
+
+	page, err := storage.List(ctx, storagex.ListOptions{Prefix: prefix, Delimiter: "/"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{prefix + "a.txt"}, statKeys(page.Keys))
+	assert.Equal(t, []string{prefix + "dir1/", prefix + "dir2/"}, sorted(page.CommonPrefixes))
+
+	page, err = storage.List(ctx, storagex.ListOptions{Prefix: prefix + "dir1/", Delimiter: "/"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{prefix + "dir1/b.txt"}, statKeys(page.Keys))
+	assert.Equal(t, []string{prefix + "dir1/sub/"}, page.CommonPrefixes)
+}
+
+func statKeys(stats []storagex.Stat) []string {
+	keys := make([]string, len(stats))
+	for i, s := range stats {
+		keys[i] = s.Key
+	}
+	return keys
+}
+
+func sorted(s []string) []string {
+	out := append([]string(nil), s...)
+	sort.Strings(out)
+	return out
+}
+
+func testDeleteBatch(t *testing.T, storage storagex.Storage, prefix string) {
+	ctx := context.Background()
+	existing := []string{prefix + "del/1", prefix + "del/2", prefix + "del/3"}
+	for _, key := range existing {
+		putBytes(t, storage, key, []byte("x"))
+	}
+	putBytes(t, storage, prefix+"keep", []byte("x"))
+
+	batch := append(append([]string(nil), existing...), prefix+"del/missing")
+	failed, err := storage.DeleteBatch(ctx, batch)
+	require.NoError(t, err)
+	assert.Subset(t, batch, failed, "failed keys must come from the batch")
+	assert.NotContains(t, failed, prefix+"del/missing", "missing keys are not failures")
+
+	for _, key := range existing {
+		_, err := storage.Head(ctx, key)
+		if contains(failed, key) {
+			assert.NoError(t, err, "%q was reported as failed but is gone", key)
+		} else {
+			assert.ErrorIs(t, err, storagex.ErrNotFound, "%q should be deleted", key)
+		}
+	}
+
+	_, err = storage.Head(ctx, prefix+"keep")
+	assert.NoError(t, err, "keys outside the batch must survive")
+
+	failed, err = storage.DeleteBatch(ctx, nil)
+	assert.NoError(t, err, "an empty batch is a no-op")
+	assert.Empty(t, failed)
+}
+
+func contains(s []string, v string) bool {
+	for _, x := range s {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+func testMultipartLifecycle(t *testing.T, storage storagex.Storage, prefix string) {
+	ctx := context.Background()
+	key := prefix + "multipart/video.bin"
+	data := testData(minPartSize + 1024)
+
+	uploadID, err := storage.CreateMultipart(ctx, key, &storagex.PutOptions{ContentType: "video/mp4", Overwrite: true})
+	require.NoError(t, err)
+	require.NotEmpty(t, uploadID)
+
+	etag1, err := storage.UploadPart(ctx, key, uploadID, 1, bytes.NewReader(data[:minPartSize]), minPartSize)
+	require.NoError(t, err)
+	etag2, err := storage.UploadPart(ctx, key, uploadID, 2, bytes.NewReader(data[minPartSize:]), int64(len(data)-minPartSize))
+	require.NoError(t, err)
+
+	_, err = storage.Head(ctx, key)
+	assert.ErrorIs(t, err, storagex.ErrNotFound, "object must not exist before completion")
+
+	_, err = storage.CompleteMultipart(ctx, key, uploadID, []string{etag1, etag2})
+	require.NoError(t, err)
+
+	got, stat := readObject(t, storage, key)
+	assert.Equal(t, int64(len(data)), stat.Size)
+	assert.True(t, bytes.Equal(data, got), "multipart content must match")
+	assert.Equal(t, "video/mp4", stat.ContentType)
+}
+
+func testMultipartAbort(t *testing.T, storage storagex.Storage, prefix string) {
+	ctx := context.Background()
+	key := prefix + "multipart/aborted.bin"
+
+	uploadID, err := storage.CreateMultipart(ctx, key, nil)
+	require.NoError(t, err)
+	etag, err := storage.UploadPart(ctx, key, uploadID, 1, bytes.NewReader([]byte("part")), 4)
+	require.NoError(t, err)
+
+	require.NoError(t, storage.AbortMultipart(ctx, key, uploadID))
+
+	_, err = storage.CompleteMultipart(ctx, key, uploadID, []string{etag})
+	assert.Error(t, err, "an aborted upload cannot be completed")
+
+	_, err = storage.Head(ctx, key)
+	assert.ErrorIs(t, err, storagex.ErrNotFound)
+
+	if lister, ok := storage.(storagex.MultipartLister); ok {
+		uploads, err := lister.ListMultipartUploads(ctx, prefix)
+		require.NoError(t, err)
+		assert.Empty(t, uploads, "aborted uploads must not be listed")
+	}
+}
+
+func testMultipartUpload(t *testing.T, storage storagex.Storage, prefix string) {
+	key := prefix + "multipart/auto.bin"
+	data := testData(2*minPartSize + 17)
+
+	stat, err := storage.MultipartUpload(context.Background(), key, bytes.NewReader(data),
+		&storagex.MultipartConfig{PartSizeBytes: minPartSize, Concurrency: 2},
+		&storagex.PutOptions{Overwrite: true})
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(data)), stat.Size)
+
+	got, _ := readObject(t, storage, key)
+	assert.True(t, bytes.Equal(data, got), "multipart content must match")
+}
+
+func testContextCancellation(t *testing.T, storage storagex.Storage, prefix string) {
+	key := prefix + "cancelled"
+	putBytes(t, storage, key, []byte("x"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	assertCancelled := func(op string, err error) {
+		t.Helper()
+		require.Error(t, err, op)
+		assert.True(t, errors.Is(err, context.Canceled) || errors.Is(err, storagex.ErrAborted),
+			"%s: want context.Canceled or ErrAborted, got %v", op, err)
+	}
+
+	_, err := storage.PutBytes(ctx, prefix+"new", []byte("x"), nil)
+	assertCancelled("PutBytes", err)
+	_, _, err = storage.Get(ctx, key)
+	assertCancelled("Get", err)
+	_, err = storage.Head(ctx, key)
+	assertCancelled("Head", err)
+	_, err = storage.List(ctx, storagex.ListOptions{Prefix: prefix})
+	assertCancelled("List", err)
+	assertCancelled("Delete", storage.Delete(ctx, key))
+	_, err = storage.CreateMultipart(ctx, prefix+"mp", nil)
+	assertCancelled("CreateMultipart", err)
+
+	_, err = storage.Head(context.Background(), prefix+"new")
+	assert.ErrorIs(t, err, storagex.ErrNotFound, "a cancelled Put must not create the object")
+}
+
+func testUnicodeKeys(t *testing.T, storage storagex.Storage, prefix string) {
+	ctx := context.Background()
+	keys := []string{
+		prefix + "unicode/日本語/ファイル.txt",
+		prefix + "unicode/résumé 2024.pdf",
+		prefix + "unicode/emoji 🚀.bin",
+		prefix + "unicode/reserved+&=?#%.txt",
+	}
+
+	for _, key := range keys {
+		putBytes(t, storage, key, []byte(key))
+
+		head, err := storage.Head(ctx, key)
+		require.NoError(t, err, "Head %q", key)
+		assert.Equal(t, key, head.Key)
+
+		data, _ := readObject(t, storage, key)
+		assert.Equal(t, key, string(data))
+	}
+
+	listed, err := listAll(ctx, storage, prefix+"unicode/")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, keys, listed)
+
+	failed, err := storage.DeleteBatch(ctx, keys)
+	require.NoError(t, err)
+	assert.Empty(t, failed)
+	for _, key := range keys {
+		_, err := storage.Head(ctx, key)
+		assert.ErrorIs(t, err, storagex.ErrNotFound, "%q should be deleted", key)
+	}
+}
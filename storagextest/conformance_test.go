@@ -0,0 +1,65 @@
+package storagextest_test
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/gostratum/storagex"
+	"github.com/gostratum/storagex/faultstore"
+	"github.com/gostratum/storagex/internal/testutil"
+	"github.com/gostratum/storagex/storagextest"
+)
+
+func TestConformance_MockStorage(t *testing.T) {
+	storagextest.RunConformance(t, func(t *testing.T) storagex.Storage {
+		return testutil.NewMockStorage()
+	})
+}
+
+// failureRecorder records the keys DeleteBatch reports as failed
+type failureRecorder struct {
+	storagex.Storage
+
+	mu     sync.Mutex
+	failed []string
+}
+
+func (r *failureRecorder) DeleteBatch(ctx context.Context, keys []string) ([]string, error) {
+	failed, err := r.Storage.DeleteBatch(ctx, keys)
+	r.mu.Lock()
+	r.failed = append(r.failed, failed...)
+	r.mu.Unlock()
+	return failed, err
+}
+
+func TestConformance_PartialDeleteBatch(t *testing.T) {
+	var recorders []*failureRecorder
+	storagextest.RunConformance(t, func(t *testing.T) storagex.Storage {
+		// One key of the DeleteBatch test cannot be deleted
+		store := faultstore.New(testutil.NewMockStorage(), faultstore.Options{Rules: []faultstore.Rule{{
+			Name:     "stuck",
+			Ops:      []faultstore.Op{faultstore.OpDeleteBatch},
+			Key:      "*/del/2",
+			FailKeys: true,
+		}}})
+		recorder := &failureRecorder{Storage: store}
+		recorders = append(recorders, recorder)
+		return recorder
+	})
+
+	// Only the stuck key came back, once from the test and once from its
+	// cleanup
+	var failed []string
+	for _, r := range recorders {
+		failed = append(failed, r.failed...)
+	}
+	if assert.Len(t, failed, 2) {
+		for _, key := range failed {
+			assert.True(t, strings.HasSuffix(key, "/del/2"), key)
+		}
+	}
+}
@@ -0,0 +1,273 @@
+package sync
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gostratum/storagex"
+)
+
+const (
+	// ChecksumMetadataKey is the user metadata key under which Sync stores the
+	// hex MD5 of uploaded objects, since multipart ETags are not content hashes
+	ChecksumMetadataKey = "md5"
+
+	// tempSuffix marks partially downloaded files; they are never synced
+	tempSuffix = ".storagex-sync"
+)
+
+// Endpoint is one side of a sync: a local directory or a storage prefix.
+// Create endpoints with Local and Remote.
+type Endpoint interface {
+	fmt.Stringer
+
+	// list returns every file below the endpoint keyed by slash-separated
+	// relative path
+	list(ctx context.Context) (map[string]entry, error)
+
+	// open returns the content of rel starting at offset, and its content type
+	open(ctx context.Context, rel string, offset int64) (io.ReadCloser, string, error)
+
+	// checksum returns the hex MD5 of an entry, or "" if it is unknown
+	checksum(ctx context.Context, e entry) (string, error)
+
+	// remove deletes the given relative paths
+	remove(ctx context.Context, rels []string) error
+}
+
+// entry describes a single file or object
+type entry struct {
+	path    string
+	size    int64
+	modTime time.Time
+	etag    string
+}
+
+// localEndpoint is a directory on the local filesystem
+type localEndpoint struct {
+	dir string
+}
+
+// Local returns an endpoint for a local directory. A missing directory is
+// an error as a source and is created on demand as a destination.
+func Local(dir string) Endpoint {
+	return &localEndpoint{dir: filepath.Clean(dir)}
+}
+
+func (l *localEndpoint) String() string {
+	return l.dir
+}
+
+func (l *localEndpoint) filePath(rel string) string {
+	return filepath.Join(l.dir, filepath.FromSlash(rel))
+}
+
+func (l *localEndpoint) list(ctx context.Context) (map[string]entry, error) {
+	entries := make(map[string]entry)
+	err := filepath.WalkDir(l.dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() || strings.HasSuffix(p, tempSuffix) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(l.dir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		entries[rel] = entry{path: rel, size: info.Size(), modTime: info.ModTime()}
+		return nil
+	})
+	return entries, err
+}
+
+func (l *localEndpoint) open(_ context.Context, rel string, offset int64) (io.ReadCloser, string, error) {
+	f, err := os.Open(l.filePath(rel))
+	if err != nil {
+		return nil, "", err
+	}
+	if offset > 0 {
+		if _, err := f.Seek(offset, io.SeekStart); err != nil {
+			f.Close()
+			return nil, "", err
+		}
+	}
+	return f, mime.TypeByExtension(filepath.Ext(rel)), nil
+}
+
+func (l *localEndpoint) checksum(_ context.Context, e entry) (string, error) {
+	f, err := os.Open(l.filePath(e.path))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := md5.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func (l *localEndpoint) remove(ctx context.Context, rels []string) error {
+	for _, rel := range rels {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := os.Remove(l.filePath(rel)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// write stores r at rel via a temporary file and stamps it with modTime, so
+// an interrupted download never leaves a truncated file and the next
+// size+mtime comparison sees the file as up to date
+func (l *localEndpoint) write(rel string, r io.Reader, modTime time.Time) (int64, error) {
+	target := l.filePath(rel)
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return 0, err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(target), "."+filepath.Base(target)+".*"+tempSuffix)
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+
+	n, err := io.Copy(tmp, r)
+	if err != nil {
+		tmp.Close()
+		return n, err
+	}
+	if err := tmp.Close(); err != nil {
+		return n, err
+	}
+	if err := os.Chtimes(tmp.Name(), modTime, modTime); err != nil {
+		return n, err
+	}
+	return n, os.Rename(tmp.Name(), target)
+}
+
+// remoteEndpoint is a key prefix in a storage
+type remoteEndpoint struct {
+	storage storagex.Storage
+	prefix  string
+}
+
+// Remote returns an endpoint for every object below prefix in storage
+func Remote(storage storagex.Storage, prefix string) Endpoint {
+	prefix = strings.TrimPrefix(prefix, "/")
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	return &remoteEndpoint{storage: storage, prefix: prefix}
+}
+
+func (r *remoteEndpoint) String() string {
+	return "remote:" + r.prefix
+}
+
+func (r *remoteEndpoint) key(rel string) string {
+	return r.prefix + rel
+}
+
+func (r *remoteEndpoint) list(ctx context.Context) (map[string]entry, error) {
+	entries := make(map[string]entry)
+	opts := storagex.ListOptions{Prefix: r.prefix}
+	for {
+		page, err := r.storage.List(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range page.Keys {
+			rel := strings.TrimPrefix(obj.Key, r.prefix)
+			if rel == "" || strings.HasSuffix(rel, "/") {
+				continue // folder marker
+			}
+			entries[rel] = entry{path: rel, size: obj.Size, modTime: obj.LastModified, etag: obj.ETag}
+		}
+		if !page.IsTruncated || page.NextToken == "" {
+			return entries, nil
+		}
+		opts.ContinuationToken = page.NextToken
+	}
+}
+
+func (r *remoteEndpoint) open(ctx context.Context, rel string, offset int64) (io.ReadCloser, string, error) {
+	reader, stat, err := r.storage.Get(ctx, r.key(rel))
+	if err != nil {
+		return nil, "", err
+	}
+	if offset > 0 {
+		if _, err := io.CopyN(io.Discard, reader, offset); err != nil {
+			reader.Close()
+			return nil, "", err
+		}
+	}
+	return reader, stat.ContentType, nil
+}
+
+func (r *remoteEndpoint) checksum(ctx context.Context, e entry) (string, error) {
+	if etag := strings.Trim(e.etag, `"`); isMD5(etag) {
+		return etag, nil
+	}
+
+	stat, err := r.storage.Head(ctx, r.key(e.path))
+	if err != nil {
+		return "", err
+	}
+	return stat.Metadata[ChecksumMetadataKey], nil
+}
+
+func (r *remoteEndpoint) remove(ctx context.Context, rels []string) error {
+	keys := make([]string, len(rels))
+	for i, rel := range rels {
+		keys[i] = r.key(rel)
+	}
+
+	for start := 0; start < len(keys); start += storagex.DeleteBatchSize {
+		end := min(start+storagex.DeleteBatchSize, len(keys))
+		failed, err := r.storage.DeleteBatch(ctx, keys[start:end])
+		if err != nil {
+			return err
+		}
+		if len(failed) > 0 {
+			return &storagex.StorageError{
+				Op:  "sync_delete",
+				Key: failed[0],
+				Err: fmt.Errorf("failed to delete %d objects", len(failed)),
+			}
+		}
+	}
+	return nil
+}
+
+// isMD5 reports whether an ETag is a plain MD5 digest (single-part uploads)
+func isMD5(etag string) bool {
+	if len(etag) != 32 {
+		return false
+	}
+	_, err := hex.DecodeString(etag)
+	return err == nil
+}
@@ -0,0 +1,187 @@
+package sync
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// manifestFlushInterval bounds how often completed files are persisted; part
+// uploads are always persisted immediately
+const manifestFlushInterval = time.Second
+
+// manifest records sync progress on local disk so an interrupted sync can
+// skip finished files and resume multipart uploads part by part
+type manifest struct {
+	path string
+
+	mu        sync.Mutex
+	state     manifestState
+	lastFlush time.Time
+}
+
+type manifestState struct {
+	Source      string                     `json:"source"`
+	Destination string                     `json:"destination"`
+	Files       map[string]manifestFile    `json:"files"`
+	Uploads     map[string]*manifestUpload `json:"uploads"`
+}
+
+// manifestFile is a source file that was copied successfully
+type manifestFile struct {
+	Size     int64     `json:"size"`
+	ModTime  time.Time `json:"mod_time"`
+	Checksum string    `json:"checksum,omitempty"`
+}
+
+// manifestUpload is an in-progress multipart upload
+type manifestUpload struct {
+	Key      string    `json:"key"`
+	UploadID string    `json:"upload_id"`
+	Size     int64     `json:"size"`
+	ModTime  time.Time `json:"mod_time"`
+	PartSize int64     `json:"part_size"`
+	ETags    []string  `json:"etags"`
+}
+
+// loadManifest reads the manifest at path. A missing file, or one written
+// for a different source/destination pair, yields an empty manifest.
+func loadManifest(path string, src, dst Endpoint) (*manifest, error) {
+	m := &manifest{
+		path: path,
+		state: manifestState{
+			Source:      src.String(),
+			Destination: dst.String(),
+			Files:       make(map[string]manifestFile),
+			Uploads:     make(map[string]*manifestUpload),
+		},
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var state manifestState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+	if state.Source != m.state.Source || state.Destination != m.state.Destination {
+		return m, nil
+	}
+	if state.Files != nil {
+		m.state.Files = state.Files
+	}
+	if state.Uploads != nil {
+		m.state.Uploads = state.Uploads
+	}
+	return m, nil
+}
+
+// completed returns the record of a previously copied file
+func (m *manifest) completed(rel string) (manifestFile, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, ok := m.state.Files[rel]
+	return f, ok
+}
+
+// upload returns a copy of the in-progress upload for rel, if any
+func (m *manifest) upload(rel string) *manifestUpload {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u, ok := m.state.Uploads[rel]
+	if !ok {
+		return nil
+	}
+	clone := *u
+	clone.ETags = append([]string(nil), u.ETags...)
+	return &clone
+}
+
+// startUpload records a new multipart upload and persists it
+func (m *manifest) startUpload(rel string, u *manifestUpload) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	clone := *u
+	m.state.Uploads[rel] = &clone
+	return m.saveLocked()
+}
+
+// addPart records a finished part and persists it
+func (m *manifest) addPart(rel, etag string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if u, ok := m.state.Uploads[rel]; ok {
+		u.ETags = append(u.ETags, etag)
+	}
+	return m.saveLocked()
+}
+
+// dropUpload forgets an upload that can no longer be resumed
+func (m *manifest) dropUpload(rel string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.state.Uploads, rel)
+}
+
+// finish records a completed copy, persisting at most once per flush interval
+func (m *manifest) finish(rel string, f manifestFile) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.state.Files[rel] = f
+	if _, ok := m.state.Uploads[rel]; ok {
+		delete(m.state.Uploads, rel)
+		return m.saveLocked()
+	}
+	if time.Since(m.lastFlush) < manifestFlushInterval {
+		return nil
+	}
+	return m.saveLocked()
+}
+
+// prune drops completed records for files no longer in the source
+func (m *manifest) prune(source map[string]entry) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for rel := range m.state.Files {
+		if _, ok := source[rel]; !ok {
+			delete(m.state.Files, rel)
+		}
+	}
+}
+
+// save persists the manifest
+func (m *manifest) save() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.saveLocked()
+}
+
+// saveLocked writes the manifest atomically; the caller must hold m.mu
+func (m *manifest) saveLocked() error {
+	data, err := json.Marshal(&m.state)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(m.path), 0o755); err != nil {
+		return err
+	}
+	tmp := m.path + tempSuffix
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, m.path); err != nil {
+		return err
+	}
+	m.lastFlush = time.Now()
+	return nil
+}
@@ -0,0 +1,640 @@
+// Package sync mirrors files between local directories and storage prefixes.
+//
+// Sync compares source and destination by size and modification time (or by
+// MD5 checksum), copies what differs with bounded concurrency, optionally
+// deletes extraneous destination files, and can record progress in a local
+// manifest so that an interrupted sync resumes where it stopped, including
+// partway through large multipart uploads.
+//
+// Example usage:
+//
+//	result, err := sync.Sync(ctx, sync.Local("/var/backups"), sync.Remote(storage, "backups/"), sync.Options{
+//	    Delete:       true,
+//	    Exclude:      []string{"*.tmp"},
+//	    ManifestPath: "/var/lib/backup/sync-manifest.json",
+//	})
+package sync
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gostratum/core/logx"
+	"github.com/gostratum/storagex"
+)
+
+const (
+	// DefaultConcurrency is the default number of files copied in parallel
+	DefaultConcurrency = 4
+
+	// DefaultMultipartThreshold is the default size above which uploads use
+	// multipart
+	DefaultMultipartThreshold = 64 << 20
+
+	// DefaultPartSize is the default multipart part size
+	DefaultPartSize = 8 << 20
+
+	// minPartSize is the smallest non-final part accepted by S3
+	minPartSize = 5 << 20
+)
+
+// CompareMode selects how Sync decides whether a file needs copying
+type CompareMode int
+
+const (
+	// CompareSizeModTime copies files whose size differs or whose source is
+	// newer than the destination (compared at one-second precision)
+	CompareSizeModTime CompareMode = iota
+
+	// CompareChecksum copies files whose size or MD5 checksum differs
+	CompareChecksum
+)
+
+// Options configures a sync
+type Options struct {
+	// Compare selects the comparison strategy (default: CompareSizeModTime)
+	Compare CompareMode
+
+	// Delete removes destination files that do not exist in the source.
+	// Files excluded by Include/Exclude are never deleted.
+	Delete bool
+
+	// Include limits the sync to paths matching at least one glob. Patterns
+	// use path.Match syntax against the slash-separated relative path;
+	// patterns without a "/" also match the base name, and a trailing "/**"
+	// matches everything below a directory.
+	Include []string
+
+	// Exclude skips paths matching any glob (same syntax as Include)
+	Exclude []string
+
+	// DryRun computes the plan without copying or deleting anything
+	DryRun bool
+
+	// Concurrency is the number of files copied in parallel (default: 4)
+	Concurrency int
+
+	// MultipartThreshold is the size above which uploads to storage use
+	// multipart (default: 64MB)
+	MultipartThreshold int64
+
+	// PartSize is the multipart part size (default: 8MB, minimum: 5MB)
+	PartSize int64
+
+	// ManifestPath optionally names a local file where progress is
+	// recorded. Re-running an interrupted sync with the same manifest skips
+	// finished files and resumes multipart uploads from the last part. In
+	// checksum mode, files the manifest recorded as copied and unchanged at
+	// the source are not hashed again.
+	ManifestPath string
+
+	// Logger is an optional logger
+	Logger logx.Logger
+}
+
+// applyDefaults fills unset options
+func (o *Options) applyDefaults() {
+	if o.Concurrency <= 0 {
+		o.Concurrency = DefaultConcurrency
+	}
+	if o.PartSize == 0 {
+		o.PartSize = DefaultPartSize
+	}
+	if o.MultipartThreshold == 0 {
+		o.MultipartThreshold = DefaultMultipartThreshold
+	}
+	if o.Logger == nil {
+		o.Logger = logx.NewNoopLogger()
+	}
+}
+
+// validate checks option values and glob syntax
+func (o *Options) validate() error {
+	if o.PartSize < minPartSize {
+		return fmt.Errorf("%w: part size must be at least 5MB", storagex.ErrInvalidConfig)
+	}
+	if o.MultipartThreshold < 0 {
+		return fmt.Errorf("%w: multipart threshold cannot be negative", storagex.ErrInvalidConfig)
+	}
+	for _, pattern := range append(append([]string(nil), o.Include...), o.Exclude...) {
+		if _, err := path.Match(strings.TrimSuffix(pattern, "/**"), ""); err != nil {
+			return fmt.Errorf("%w: invalid pattern %q: %v", storagex.ErrInvalidConfig, pattern, err)
+		}
+	}
+	return nil
+}
+
+// selected reports whether rel passes the include/exclude filters
+func (o *Options) selected(rel string) bool {
+	if len(o.Include) > 0 && !matchAny(o.Include, rel) {
+		return false
+	}
+	return !matchAny(o.Exclude, rel)
+}
+
+func matchAny(patterns []string, rel string) bool {
+	for _, pattern := range patterns {
+		if dir, ok := strings.CutSuffix(pattern, "/**"); ok {
+			if strings.HasPrefix(rel, dir+"/") {
+				return true
+			}
+			continue
+		}
+		if ok, _ := path.Match(pattern, rel); ok {
+			return true
+		}
+		if !strings.Contains(pattern, "/") {
+			if ok, _ := path.Match(pattern, path.Base(rel)); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ActionType is the kind of change a sync makes
+type ActionType string
+
+const (
+	// ActionCopy copies a file from source to destination
+	ActionCopy ActionType = "copy"
+
+	// ActionDelete removes an extraneous destination file
+	ActionDelete ActionType = "delete"
+)
+
+// Action is a single planned change
+type Action struct {
+	Type ActionType
+
+	// Path is the slash-separated path relative to both endpoints
+	Path string
+
+	// Size is the source size for copies and the destination size for deletes
+	Size int64
+
+	// Reason explains the action: "new", "size", "modtime", "checksum" or
+	// "extraneous"
+	Reason string
+
+	src      entry
+	checksum string
+}
+
+func (a Action) String() string {
+	if a.Type == ActionDelete {
+		return fmt.Sprintf("%s %s (%s)", a.Type, a.Path, a.Reason)
+	}
+	return fmt.Sprintf("%s %s (%d bytes, %s)", a.Type, a.Path, a.Size, a.Reason)
+}
+
+// Result summarizes a sync
+type Result struct {
+	// Actions is the plan: copies sorted by path, then deletes sorted by path.
+	// With DryRun nothing was applied.
+	Actions []Action
+
+	// Copied and Deleted count applied actions
+	Copied  int
+	Deleted int
+
+	// Skipped counts source files that were already up to date
+	Skipped int
+
+	// BytesCopied is the number of bytes written to the destination
+	BytesCopied int64
+}
+
+// WritePlan writes one line per planned action
+func (r *Result) WritePlan(w io.Writer) error {
+	for _, a := range r.Actions {
+		if _, err := fmt.Fprintln(w, a); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Sync makes dst mirror src. Copy errors do not stop other copies; they are
+// joined into the returned error and, if any occur, no deletes are applied.
+func Sync(ctx context.Context, src, dst Endpoint, opts Options) (*Result, error) {
+	if src == nil || dst == nil {
+		return nil, fmt.Errorf("%w: source and destination are required", storagex.ErrInvalidConfig)
+	}
+
+	opts.applyDefaults()
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+
+	s := &syncer{src: src, dst: dst, opts: opts}
+	if opts.ManifestPath != "" && !opts.DryRun {
+		m, err := loadManifest(opts.ManifestPath, src, dst)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load sync manifest: %w", err)
+		}
+		s.manifest = m
+	}
+
+	srcEntries, err := s.listFiltered(ctx, src)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", src, err)
+	}
+	dstEntries, err := s.listFiltered(ctx, dst)
+	if _, local := dst.(*localEndpoint); local && errors.Is(err, fs.ErrNotExist) {
+		dstEntries, err = map[string]entry{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", dst, err)
+	}
+
+	result, err := s.plan(ctx, srcEntries, dstEntries)
+	if err != nil {
+		return nil, err
+	}
+
+	opts.Logger.Debug("Sync planned", storagex.ArgsToFields(
+		"source", src.String(),
+		"destination", dst.String(),
+		"actions", len(result.Actions),
+		"skipped", result.Skipped,
+		"dry_run", opts.DryRun,
+	)...)
+
+	if opts.DryRun {
+		return result, nil
+	}
+
+	err = s.apply(ctx, result)
+
+	if s.manifest != nil {
+		s.manifest.prune(srcEntries)
+		if saveErr := s.manifest.save(); saveErr != nil {
+			err = errors.Join(err, fmt.Errorf("failed to save sync manifest: %w", saveErr))
+		}
+	}
+
+	opts.Logger.Info("Sync finished", storagex.ArgsToFields(
+		"source", src.String(),
+		"destination", dst.String(),
+		"copied", result.Copied,
+		"deleted", result.Deleted,
+		"skipped", result.Skipped,
+		"bytes", result.BytesCopied,
+	)...)
+
+	return result, err
+}
+
+// syncer holds the state of a single Sync call
+type syncer struct {
+	src      Endpoint
+	dst      Endpoint
+	opts     Options
+	manifest *manifest
+
+	mu sync.Mutex
+}
+
+// listFiltered lists an endpoint, dropping filtered paths and the manifest itself
+func (s *syncer) listFiltered(ctx context.Context, e Endpoint) (map[string]entry, error) {
+	entries, err := e.list(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	manifestRel := ""
+	if local, ok := e.(*localEndpoint); ok && s.opts.ManifestPath != "" {
+		if rel, err := filepath.Rel(local.dir, filepath.Clean(s.opts.ManifestPath)); err == nil {
+			manifestRel = filepath.ToSlash(rel)
+		}
+	}
+
+	for rel := range entries {
+		if rel == manifestRel || rel == manifestRel+tempSuffix || !s.opts.selected(rel) {
+			delete(entries, rel)
+		}
+	}
+	return entries, nil
+}
+
+// plan compares both sides and returns the actions to apply
+func (s *syncer) plan(ctx context.Context, srcEntries, dstEntries map[string]entry) (*Result, error) {
+	result := &Result{}
+
+	for _, rel := range sortedKeys(srcEntries) {
+		srcEntry := srcEntries[rel]
+		dstEntry, exists := dstEntries[rel]
+
+		reason, checksum, err := s.compare(ctx, srcEntry, dstEntry, exists)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compare %s: %w", rel, err)
+		}
+		if reason == "" {
+			result.Skipped++
+			continue
+		}
+		result.Actions = append(result.Actions, Action{
+			Type:     ActionCopy,
+			Path:     rel,
+			Size:     srcEntry.size,
+			Reason:   reason,
+			src:      srcEntry,
+			checksum: checksum,
+		})
+	}
+
+	if s.opts.Delete {
+		for _, rel := range sortedKeys(dstEntries) {
+			if _, ok := srcEntries[rel]; ok {
+				continue
+			}
+			result.Actions = append(result.Actions, Action{
+				Type:   ActionDelete,
+				Path:   rel,
+				Size:   dstEntries[rel].size,
+				Reason: "extraneous",
+			})
+		}
+	}
+
+	return result, nil
+}
+
+// compare returns why src must be copied ("" if it is up to date) and, in
+// checksum mode, the source checksum to record on the destination
+func (s *syncer) compare(ctx context.Context, src, dst entry, exists bool) (string, string, error) {
+	if s.opts.Compare != CompareChecksum {
+		switch {
+		case !exists:
+			return "new", "", nil
+		case src.size != dst.size:
+			return "size", "", nil
+		case src.modTime.Truncate(time.Second).After(dst.modTime.Truncate(time.Second)):
+			return "modtime", "", nil
+		}
+		return "", "", nil
+	}
+
+	// A file this manifest already copied, unchanged since, needs no hashing
+	if exists && src.size == dst.size && s.manifest != nil {
+		if done, ok := s.manifest.completed(src.path); ok && done.Size == src.size && done.ModTime.Equal(src.modTime) {
+			return "", "", nil
+		}
+	}
+
+	srcSum, err := s.src.checksum(ctx, src)
+	if err != nil {
+		return "", "", err
+	}
+	switch {
+	case !exists:
+		return "new", srcSum, nil
+	case src.size != dst.size:
+		return "size", srcSum, nil
+	}
+
+	dstSum, err := s.dst.checksum(ctx, dst)
+	if err != nil {
+		return "", "", err
+	}
+	if srcSum == "" || srcSum != dstSum {
+		return "checksum", srcSum, nil
+	}
+	return "", srcSum, nil
+}
+
+// apply runs copies with bounded concurrency, then deletes
+func (s *syncer) apply(ctx context.Context, result *Result) error {
+	var (
+		wg   sync.WaitGroup
+		errs []error
+		sem  = make(chan struct{}, s.opts.Concurrency)
+	)
+
+	var deletes []string
+	for i := range result.Actions {
+		action := &result.Actions[i]
+		if action.Type == ActionDelete {
+			deletes = append(deletes, action.Path)
+			continue
+		}
+
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			return errors.Join(append(errs, ctx.Err())...)
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			n, err := s.copy(ctx, action)
+
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("copy %s: %w", action.Path, err))
+				return
+			}
+			result.Copied++
+			result.BytesCopied += n
+		}()
+	}
+	wg.Wait()
+
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	if len(deletes) > 0 {
+		if err := s.dst.remove(ctx, deletes); err != nil {
+			return fmt.Errorf("failed to delete extraneous files: %w", err)
+		}
+		result.Deleted = len(deletes)
+	}
+	return nil
+}
+
+// copy copies a single file and records it in the manifest
+func (s *syncer) copy(ctx context.Context, a *Action) (int64, error) {
+	s.opts.Logger.Debug("Sync copying", storagex.ArgsToFields(
+		"path", a.Path,
+		"size", a.Size,
+		"reason", a.Reason,
+	)...)
+
+	var (
+		n   int64
+		err error
+	)
+	switch dst := s.dst.(type) {
+	case *localEndpoint:
+		n, err = s.download(ctx, dst, a)
+	case *remoteEndpoint:
+		n, err = s.upload(ctx, dst, a)
+	default:
+		err = fmt.Errorf("unsupported destination %T", s.dst)
+	}
+	if err != nil {
+		return n, err
+	}
+
+	if s.manifest != nil {
+		err = s.manifest.finish(a.Path, manifestFile{Size: a.src.size, ModTime: a.src.modTime, Checksum: a.checksum})
+	}
+	return n, err
+}
+
+func (s *syncer) download(ctx context.Context, dst *localEndpoint, a *Action) (int64, error) {
+	r, _, err := s.src.open(ctx, a.Path, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+
+	return dst.write(a.Path, r, a.src.modTime)
+}
+
+func (s *syncer) upload(ctx context.Context, dst *remoteEndpoint, a *Action) (int64, error) {
+	putOpts := &storagex.PutOptions{Overwrite: true}
+	if a.checksum != "" {
+		putOpts.Metadata = map[string]string{ChecksumMetadataKey: a.checksum}
+	}
+
+	if a.src.size > s.opts.MultipartThreshold && s.manifest != nil {
+		return s.resumableUpload(ctx, dst, a, putOpts)
+	}
+
+	r, contentType, err := s.src.open(ctx, a.Path, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+	putOpts.ContentType = contentType
+
+	var stat storagex.Stat
+	if a.src.size > s.opts.MultipartThreshold {
+		stat, err = dst.storage.MultipartUpload(ctx, dst.key(a.Path), r, &storagex.MultipartConfig{
+			PartSizeBytes: s.opts.PartSize,
+		}, putOpts)
+	} else {
+		stat, err = dst.storage.Put(ctx, dst.key(a.Path), r, putOpts)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return stat.Size, nil
+}
+
+// resumableUpload uploads parts one at a time, checkpointing each part in the
+// manifest so a later sync can continue from the last finished part
+func (s *syncer) resumableUpload(ctx context.Context, dst *remoteEndpoint, a *Action, putOpts *storagex.PutOptions) (int64, error) {
+	key := dst.key(a.Path)
+
+	state := s.manifest.upload(a.Path)
+	if state != nil && (state.Key != key || state.Size != a.src.size || !state.ModTime.Equal(a.src.modTime) || state.PartSize != s.opts.PartSize) {
+		// The source changed since the upload started; start over
+		_ = dst.storage.AbortMultipart(ctx, state.Key, state.UploadID)
+		s.manifest.dropUpload(a.Path)
+		state = nil
+	}
+
+	n, err := s.uploadParts(ctx, dst, a, key, state, putOpts)
+	if err != nil && state != nil && (errors.Is(err, storagex.ErrAborted) || storagex.IsNotFound(err)) {
+		// The recorded upload expired or was aborted elsewhere
+		s.opts.Logger.Debug("Sync restarting expired multipart upload", storagex.ArgsToFields(
+			"path", a.Path,
+			"upload_id", state.UploadID,
+		)...)
+		s.manifest.dropUpload(a.Path)
+		return s.uploadParts(ctx, dst, a, key, nil, putOpts)
+	}
+	return n, err
+}
+
+func (s *syncer) uploadParts(ctx context.Context, dst *remoteEndpoint, a *Action, key string, state *manifestUpload, putOpts *storagex.PutOptions) (int64, error) {
+	offset := int64(0)
+	if state != nil {
+		offset = int64(len(state.ETags)) * state.PartSize
+	}
+
+	r, contentType, err := s.src.open(ctx, a.Path, offset)
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+
+	if state == nil {
+		putOpts.ContentType = contentType
+		uploadID, err := dst.storage.CreateMultipart(ctx, key, putOpts)
+		if err != nil {
+			return 0, err
+		}
+		state = &manifestUpload{
+			Key:      key,
+			UploadID: uploadID,
+			Size:     a.src.size,
+			ModTime:  a.src.modTime,
+			PartSize: s.opts.PartSize,
+		}
+		if err := s.manifest.startUpload(a.Path, state); err != nil {
+			return 0, err
+		}
+	} else {
+		s.opts.Logger.Debug("Sync resuming multipart upload", storagex.ArgsToFields(
+			"path", a.Path,
+			"upload_id", state.UploadID,
+			"offset", offset,
+		)...)
+	}
+
+	buf := make([]byte, state.PartSize)
+	written := int64(0)
+	for offset < state.Size {
+		size := min(state.PartSize, state.Size-offset)
+		if _, err := io.ReadFull(r, buf[:size]); err != nil {
+			return written, err
+		}
+
+		partNumber := int32(len(state.ETags) + 1)
+		etag, err := dst.storage.UploadPart(ctx, key, state.UploadID, partNumber, bytes.NewReader(buf[:size]), size)
+		if err != nil {
+			return written, err
+		}
+		state.ETags = append(state.ETags, etag)
+		if err := s.manifest.addPart(a.Path, etag); err != nil {
+			return written, err
+		}
+
+		offset += size
+		written += size
+	}
+
+	if _, err := dst.storage.CompleteMultipart(ctx, key, state.UploadID, state.ETags); err != nil {
+		return written, err
+	}
+	return written, nil
+}
+
+func sortedKeys(m map[string]entry) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
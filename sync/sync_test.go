@@ -0,0 +1,277 @@
+package sync_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/gostratum/storagex"
+	"github.com/gostratum/storagex/internal/testutil"
+	"github.com/gostratum/storagex/sync"
+)
+
+func writeFile(t *testing.T, dir, rel, content string) {
+	t.Helper()
+	p := filepath.Join(dir, filepath.FromSlash(rel))
+	require.NoError(t, os.MkdirAll(filepath.Dir(p), 0o755))
+	require.NoError(t, os.WriteFile(p, []byte(content), 0o644))
+}
+
+func readObject(t *testing.T, storage storagex.Storage, key string) string {
+	t.Helper()
+	reader, _, err := storage.Get(context.Background(), key)
+	require.NoError(t, err)
+	defer reader.Close()
+	data, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func actionPaths(result *sync.Result, typ sync.ActionType) []string {
+	var paths []string
+	for _, a := range result.Actions {
+		if a.Type == typ {
+			paths = append(paths, a.Path)
+		}
+	}
+	return paths
+}
+
+func TestSync_LocalToRemote(t *testing.T) {
+	storage := testutil.NewMockStorage()
+	ctx := context.Background()
+	dir := t.TempDir()
+	writeFile(t, dir, "a.txt", "alpha")
+	writeFile(t, dir, "nested/b.json", `{"b":1}`)
+
+	result, err := sync.Sync(ctx, sync.Local(dir), sync.Remote(storage, "backup"), sync.Options{})
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.Copied)
+	assert.Equal(t, int64(12), result.BytesCopied)
+	assert.Equal(t, "alpha", readObject(t, storage, "backup/a.txt"))
+
+	stat, err := storage.Head(ctx, "backup/nested/b.json")
+	require.NoError(t, err)
+	assert.Equal(t, "application/json", stat.ContentType)
+
+	// Nothing changed: everything is skipped
+	result, err = sync.Sync(ctx, sync.Local(dir), sync.Remote(storage, "backup"), sync.Options{})
+	require.NoError(t, err)
+	assert.Empty(t, result.Actions)
+	assert.Equal(t, 2, result.Skipped)
+
+	// A size change is detected
+	writeFile(t, dir, "a.txt", "alpha v2")
+	result, err = sync.Sync(ctx, sync.Local(dir), sync.Remote(storage, "backup"), sync.Options{})
+	require.NoError(t, err)
+	require.Len(t, result.Actions, 1)
+	assert.Equal(t, "size", result.Actions[0].Reason)
+	assert.Equal(t, "alpha v2", readObject(t, storage, "backup/a.txt"))
+}
+
+func TestSync_RemoteToLocalRoundTrip(t *testing.T) {
+	storage := testutil.NewMockStorage()
+	ctx := context.Background()
+	for key, body := range map[string]string{"data/x.txt": "x", "data/deep/y.txt": "yy", "other/z.txt": "z"} {
+		_, err := storage.PutBytes(ctx, key, []byte(body), &storagex.PutOptions{Overwrite: true})
+		require.NoError(t, err)
+	}
+
+	dir := filepath.Join(t.TempDir(), "restore")
+	result, err := sync.Sync(ctx, sync.Remote(storage, "data/"), sync.Local(dir), sync.Options{})
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.Copied)
+
+	data, err := os.ReadFile(filepath.Join(dir, "deep", "y.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "yy", string(data))
+
+	// Downloaded files carry the remote modification time
+	result, err = sync.Sync(ctx, sync.Remote(storage, "data/"), sync.Local(dir), sync.Options{})
+	require.NoError(t, err)
+	assert.Empty(t, result.Actions)
+}
+
+func TestSync_RemoteToRemote(t *testing.T) {
+	src := testutil.NewMockStorage()
+	dst := testutil.NewMockStorage()
+	ctx := context.Background()
+	_, err := src.PutBytes(ctx, "logs/app.log", []byte("line"), &storagex.PutOptions{ContentType: "text/plain", Overwrite: true})
+	require.NoError(t, err)
+
+	result, err := sync.Sync(ctx, sync.Remote(src, "logs"), sync.Remote(dst, "archive/logs"), sync.Options{})
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Copied)
+
+	stat, err := dst.Head(ctx, "archive/logs/app.log")
+	require.NoError(t, err)
+	assert.Equal(t, "text/plain", stat.ContentType)
+}
+
+func TestSync_DeleteAndFilters(t *testing.T) {
+	storage := testutil.NewMockStorage()
+	ctx := context.Background()
+	for _, key := range []string{"b/keep.txt", "b/stale.txt", "b/cache/old.bin", "b/notes.tmp"} {
+		_, err := storage.PutBytes(ctx, key, []byte("old"), &storagex.PutOptions{Overwrite: true})
+		require.NoError(t, err)
+	}
+
+	dir := t.TempDir()
+	writeFile(t, dir, "keep.txt", "old")
+	writeFile(t, dir, "draft.tmp", "ignored")
+	writeFile(t, dir, "cache/new.bin", "ignored")
+	writeFile(t, dir, "docs/readme.md", "doc")
+	past := time.Now().Add(-time.Hour)
+	require.NoError(t, os.Chtimes(filepath.Join(dir, "keep.txt"), past, past))
+
+	opts := sync.Options{
+		Delete:  true,
+		Exclude: []string{"*.tmp", "cache/**"},
+	}
+
+	plan, err := sync.Sync(ctx, sync.Local(dir), sync.Remote(storage, "b"), sync.Options{
+		Delete:  opts.Delete,
+		Exclude: opts.Exclude,
+		DryRun:  true,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"docs/readme.md"}, actionPaths(plan, sync.ActionCopy))
+	assert.Equal(t, []string{"stale.txt"}, actionPaths(plan, sync.ActionDelete))
+
+	var out bytes.Buffer
+	require.NoError(t, plan.WritePlan(&out))
+	assert.Equal(t, "copy docs/readme.md (3 bytes, new)\ndelete stale.txt (extraneous)\n", out.String())
+
+	// Dry run changed nothing
+	_, err = storage.Head(ctx, "b/stale.txt")
+	require.NoError(t, err)
+
+	result, err := sync.Sync(ctx, sync.Local(dir), sync.Remote(storage, "b"), opts)
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Copied)
+	assert.Equal(t, 1, result.Deleted)
+
+	_, err = storage.Head(ctx, "b/stale.txt")
+	assert.True(t, storagex.IsNotFound(err))
+	// Excluded destination files are left alone
+	_, err = storage.Head(ctx, "b/cache/old.bin")
+	assert.NoError(t, err)
+	_, err = storage.Head(ctx, "b/notes.tmp")
+	assert.NoError(t, err)
+
+	t.Run("include", func(t *testing.T) {
+		plan, err := sync.Sync(ctx, sync.Local(dir), sync.Remote(testutil.NewMockStorage(), ""), sync.Options{
+			Include: []string{"docs/**", "*.txt"},
+			DryRun:  true,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"docs/readme.md", "keep.txt"}, actionPaths(plan, sync.ActionCopy))
+	})
+}
+
+func TestSync_ChecksumMode(t *testing.T) {
+	storage := testutil.NewMockStorage()
+	ctx := context.Background()
+	dir := t.TempDir()
+	writeFile(t, dir, "config.yaml", "a: 1")
+
+	_, err := sync.Sync(ctx, sync.Local(dir), sync.Remote(storage, "cfg"), sync.Options{Compare: sync.CompareChecksum})
+	require.NoError(t, err)
+
+	stat, err := storage.Head(ctx, "cfg/config.yaml")
+	require.NoError(t, err)
+	sum := md5.Sum([]byte("a: 1"))
+	assert.Equal(t, hex.EncodeToString(sum[:]), stat.Metadata[sync.ChecksumMetadataKey])
+
+	// Same size and an old mtime would fool size+mtime, but not checksums
+	writeFile(t, dir, "config.yaml", "a: 2")
+	past := time.Now().Add(-time.Hour)
+	require.NoError(t, os.Chtimes(filepath.Join(dir, "config.yaml"), past, past))
+
+	result, err := sync.Sync(ctx, sync.Local(dir), sync.Remote(storage, "cfg"), sync.Options{DryRun: true})
+	require.NoError(t, err)
+	assert.Empty(t, result.Actions)
+
+	result, err = sync.Sync(ctx, sync.Local(dir), sync.Remote(storage, "cfg"), sync.Options{Compare: sync.CompareChecksum})
+	require.NoError(t, err)
+	require.Len(t, result.Actions, 1)
+	assert.Equal(t, "checksum", result.Actions[0].Reason)
+	assert.Equal(t, "a: 2", readObject(t, storage, "cfg/config.yaml"))
+}
+
+// flakyStorage fails UploadPart after a number of successful parts
+type flakyStorage struct {
+	*testutil.MockStorage
+	failAfter int
+	parts     int
+}
+
+func (f *flakyStorage) UploadPart(ctx context.Context, key, uploadID string, partNumber int32, part io.Reader, size int64) (string, error) {
+	f.parts++
+	if f.failAfter >= 0 && f.parts > f.failAfter {
+		return "", errors.New("connection reset")
+	}
+	return f.MockStorage.UploadPart(ctx, key, uploadID, partNumber, part, size)
+}
+
+func TestSync_ResumesMultipartFromManifest(t *testing.T) {
+	mock := testutil.NewMockStorage()
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	data := strings.Repeat("0123456789abcdef", (16<<20)/16) + "!"
+	writeFile(t, dir, "disk.img", data)
+	writeFile(t, dir, "small.txt", "small")
+
+	opts := sync.Options{
+		MultipartThreshold: 5 << 20,
+		PartSize:           5 << 20,
+		ManifestPath:       filepath.Join(dir, ".sync-manifest.json"),
+	}
+
+	flaky := &flakyStorage{MockStorage: mock, failAfter: 2}
+	_, err := sync.Sync(ctx, sync.Local(dir), sync.Remote(flaky, "img"), opts)
+	require.Error(t, err)
+	assert.FileExists(t, opts.ManifestPath)
+
+	resumed := &flakyStorage{MockStorage: mock, failAfter: -1}
+	result, err := sync.Sync(ctx, sync.Local(dir), sync.Remote(resumed, "img"), opts)
+	require.NoError(t, err)
+
+	// Four parts in total; two were uploaded before the failure
+	assert.Equal(t, 2, resumed.parts)
+	assert.Equal(t, []string{"disk.img"}, actionPaths(result, sync.ActionCopy))
+	assert.Equal(t, data, readObject(t, mock, "img/disk.img"))
+
+	// The manifest is never synced itself
+	_, err = mock.Head(ctx, "img/.sync-manifest.json")
+	assert.True(t, storagex.IsNotFound(err))
+
+	uploads, err := mock.ListMultipartUploads(ctx, "")
+	require.NoError(t, err)
+	assert.Empty(t, uploads)
+}
+
+func TestSync_InvalidOptions(t *testing.T) {
+	dst := sync.Remote(testutil.NewMockStorage(), "")
+
+	_, err := sync.Sync(context.Background(), sync.Local(t.TempDir()), dst, sync.Options{PartSize: 1 << 20})
+	assert.ErrorIs(t, err, storagex.ErrInvalidConfig)
+
+	_, err = sync.Sync(context.Background(), sync.Local(t.TempDir()), dst, sync.Options{Exclude: []string{"[bad"}})
+	assert.ErrorIs(t, err, storagex.ErrInvalidConfig)
+
+	_, err = sync.Sync(context.Background(), sync.Local(filepath.Join(t.TempDir(), "missing")), dst, sync.Options{})
+	assert.Error(t, err, "a missing source directory must not look like an empty one")
+}
@@ -16,6 +16,7 @@ import (
 
 	"github.com/gostratum/storagex"
 	"github.com/gostratum/storagex/adapters/s3"
+	"github.com/gostratum/storagex/storagextest"
 )
 
 func TestS3Integration(t *testing.T) {
@@ -121,6 +122,14 @@ func TestS3Integration(t *testing.T) {
 	t.Run("ErrorHandling", func(t *testing.T) {
 		testErrorHandling(t, storage)
 	})
+
+	// The shared contract suite runs against gofakes3 by default and against
+	// MinIO/Localstack/AWS when STORAGEX_USE_REAL_S3=true
+	t.Run("Conformance", func(t *testing.T) {
+		storagextest.RunConformance(t, func(*testing.T) storagex.Storage {
+			return storage
+		})
+	})
 }
 
 func testBasicOperations(t *testing.T, storage storagex.Storage) {
@@ -0,0 +1,587 @@
+package storagex
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Tier names reported in Stat.StorageClass by TieredStorage
+const (
+	TierHot  = "hot"
+	TierCold = "cold"
+)
+
+// Metadata of the pointer objects TieredStorage leaves in the hot tier for
+// objects stored in the cold tier
+const (
+	tierPointerKey      = "storagex-tier"
+	tierSizeKey         = "storagex-tier-size"
+	tierETagKey         = "storagex-tier-etag"
+	tierContentTypeKey  = "storagex-tier-content-type"
+	tierLastModifiedKey = "storagex-tier-modified"
+)
+
+// Migration results recorded through the Instrumenter
+const (
+	MigrationMigrated = "migrated"
+	MigrationSkipped  = "skipped"
+	MigrationFailed   = "failed"
+)
+
+// TieredOptions configures a TieredStorage
+type TieredOptions struct {
+	// MaxHotSize is the largest object kept in the hot tier. Larger
+	// objects of known size are written to the cold tier directly, and
+	// larger objects written through Put are migrated. With MaxHotSize
+	// set, multipart uploads go to the cold tier. (0: no size limit)
+	MaxHotSize int64
+
+	// MaxHotAge is how long an object stays in the hot tier after it was
+	// last modified before it is migrated (0: no age limit)
+	MaxHotAge time.Duration
+
+	// MigrateInterval is how often a background worker migrates objects
+	// that exceed a limit (0: only when Migrate is called)
+	MigrateInterval time.Duration
+
+	// Instrumenter optionally records migrations
+	Instrumenter *Instrumenter
+
+	// Clock is an optional time source (useful for testing)
+	Clock func() time.Time
+}
+
+// MigrationReport describes a Migrate run
+type MigrationReport struct {
+	// Scanned counts the hot tier objects examined
+	Scanned int
+
+	// Migrated counts the objects moved to the cold tier
+	Migrated int
+
+	// BytesMigrated is the total size of the migrated objects
+	BytesMigrated int64
+}
+
+// TieredStorage is a Storage that keeps objects in a fast hot tier (e.g.,
+// local disk or a hot bucket) or a cheap cold tier, by size and age, behind
+// one namespace. Any Storage can be a tier.
+//
+// The hot tier holds the namespace: an object stored in the cold tier is
+// represented in the hot tier by an empty pointer object whose metadata
+// records the object's size, ETag, content type and modification time. Get
+// follows pointers, Head and List report the cold object from them, and
+// Stat.StorageClass is TierHot or TierCold. Listings Head the empty objects
+// they return to tell pointers from empty objects, since listings do not
+// carry metadata.
+//
+// Writes of known size above MaxHotSize (PutBytes, PutFile, multipart) go
+// to the cold tier; other writes go to the hot tier and Migrate moves them
+// once they exceed MaxHotSize or MaxHotAge. Objects are not promoted back.
+// Every write Heads the hot tier first, to honor Overwrite and to remove a
+// cold copy the write replaces. Writes and migrations of a key are
+// serialized within the process; a migration gives up on an object that
+// changed while it was copied. When the hot tier implements
+// ConditionalWriter, the pointer replaces the object only if its ETag is
+// still the copied one, so writes from other processes are never lost.
+// Without it, run migrations only while this TieredStorage is the single
+// writer: a write landing between the last check and the pointer write is
+// replaced by the pointer.
+type TieredStorage struct {
+	hot  Storage
+	cold Storage
+	opts TieredOptions
+
+	locks keyLocks
+
+	cancel    context.CancelFunc
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewTieredStorage composes a hot and a cold tier. With MigrateInterval
+// set, it starts a background migration worker; Close stops it.
+func NewTieredStorage(hot, cold Storage, opts TieredOptions) (*TieredStorage, error) {
+	if hot == nil || cold == nil {
+		return nil, fmt.Errorf("%w: tiered storage needs a hot and a cold tier", ErrInvalidConfig)
+	}
+	if opts.MaxHotSize < 0 || opts.MaxHotAge < 0 || opts.MigrateInterval < 0 {
+		return nil, fmt.Errorf("%w: tier limits must not be negative", ErrInvalidConfig)
+	}
+	if opts.Clock == nil {
+		opts.Clock = time.Now
+	}
+
+	t := &TieredStorage{hot: hot, cold: cold, opts: opts}
+	if opts.MigrateInterval > 0 {
+		ctx, cancel := context.WithCancel(context.Background())
+		t.cancel, t.done = cancel, make(chan struct{})
+		go t.run(ctx)
+	}
+	return t, nil
+}
+
+// Close stops the background migration worker
+func (t *TieredStorage) Close() error {
+	t.closeOnce.Do(func() {
+		if t.cancel != nil {
+			t.cancel()
+			<-t.done
+		}
+	})
+	return nil
+}
+
+func (t *TieredStorage) run(ctx context.Context) {
+	defer close(t.done)
+	ticker := time.NewTicker(t.opts.MigrateInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			t.Migrate(ctx)
+		}
+	}
+}
+
+func (t *TieredStorage) record(result string) {
+	if t.opts.Instrumenter != nil {
+		t.opts.Instrumenter.RecordTierMigration(result)
+	}
+}
+
+// isPointer reports whether stat describes a pointer to the cold tier
+func isPointer(stat Stat) bool {
+	return stat.Size == 0 && stat.Metadata[tierPointerKey] == TierCold
+}
+
+// pointerMetadata returns the metadata of a pointer to the cold object
+// described by stat
+func pointerMetadata(stat Stat) map[string]string {
+	metadata := make(map[string]string, len(stat.Metadata)+5)
+	for k, v := range stat.Metadata {
+		metadata[k] = v
+	}
+	metadata[tierPointerKey] = TierCold
+	metadata[tierSizeKey] = strconv.FormatInt(stat.Size, 10)
+	metadata[tierETagKey] = stat.ETag
+	metadata[tierContentTypeKey] = stat.ContentType
+	metadata[tierLastModifiedKey] = stat.LastModified.UTC().Format(time.RFC3339Nano)
+	return metadata
+}
+
+// resolvePointer returns the stat of the cold object a pointer describes
+func resolvePointer(pointer Stat) Stat {
+	stat := Stat{
+		Key:          pointer.Key,
+		ETag:         pointer.Metadata[tierETagKey],
+		ContentType:  pointer.Metadata[tierContentTypeKey],
+		LastModified: pointer.LastModified,
+		StorageClass: TierCold,
+	}
+	stat.Size, _ = strconv.ParseInt(pointer.Metadata[tierSizeKey], 10, 64)
+	if modified, err := time.Parse(time.RFC3339Nano, pointer.Metadata[tierLastModifiedKey]); err == nil {
+		stat.LastModified = modified
+	}
+	for k, v := range pointer.Metadata {
+		if k == tierPointerKey || strings.HasPrefix(k, tierPointerKey+"-") {
+			continue
+		}
+		if stat.Metadata == nil {
+			stat.Metadata = make(map[string]string, len(pointer.Metadata))
+		}
+		stat.Metadata[k] = v
+	}
+	return stat
+}
+
+// inTier sets the tier of a stat
+func inTier(stat Stat, tier string) Stat {
+	stat.StorageClass = tier
+	return stat
+}
+
+// pointerOptions returns the PutOptions of the pointer to a cold object
+func pointerOptions(stat Stat) *PutOptions {
+	return &PutOptions{
+		ContentType: stat.ContentType,
+		Metadata:    pointerMetadata(stat),
+		Overwrite:   true,
+	}
+}
+
+// writePointer records in the hot tier that key is stored in the cold tier
+func (t *TieredStorage) writePointer(ctx context.Context, key string, stat Stat) error {
+	_, err := t.hot.PutBytes(ctx, key, nil, pointerOptions(stat))
+	return err
+}
+
+// replaceWithPointer is writePointer for a hot object whose ETag is etag.
+// It fails with ErrPreconditionFailed if the object changed, when the hot
+// tier implements ConditionalWriter; otherwise it overwrites the object
+// unconditionally.
+func (t *TieredStorage) replaceWithPointer(ctx context.Context, key, etag string, stat Stat) error {
+	writer, ok := Capability[ConditionalWriter](t.hot)
+	if !ok {
+		return t.writePointer(ctx, key, stat)
+	}
+	_, err := writer.PutIfMatch(ctx, key, strings.NewReader(""), etag, pointerOptions(stat))
+	return err
+}
+
+func overwrites(opts *PutOptions) bool {
+	return opts == nil || opts.Overwrite
+}
+
+// write stores key in the cold tier when toCold is set and in the hot tier
+// otherwise. write calls fn with the chosen tier and the PutOptions to use.
+func (t *TieredStorage) write(ctx context.Context, op, key string, toCold bool, opts *PutOptions, fn func(Storage, *PutOptions) (Stat, error)) (Stat, error) {
+	defer t.locks.lock(key)()
+
+	prev, err := t.hot.Head(ctx, key)
+	exists := err == nil
+	if err != nil && !IsNotFound(err) {
+		return Stat{}, err
+	}
+
+	if !toCold {
+		stat, err := fn(t.hot, opts)
+		if err != nil {
+			return stat, err
+		}
+		if exists && isPointer(prev) {
+			// The cold copy is no longer referenced; a failure only
+			// leaves an orphan
+			t.cold.Delete(ctx, key)
+		}
+		return inTier(stat, TierHot), nil
+	}
+
+	if exists && !overwrites(opts) {
+		return Stat{}, &StorageError{Op: op, Key: key, Err: ErrConflict}
+	}
+	// The cold tier may hold a copy left by an earlier version
+	coldOpts := PutOptions{Overwrite: true}
+	if opts != nil {
+		coldOpts = *opts
+		coldOpts.Overwrite = true
+	}
+	stat, err := fn(t.cold, &coldOpts)
+	if err != nil {
+		return stat, err
+	}
+	// Adapters may not echo the options in the returned stat
+	if stat.ContentType == "" {
+		stat.ContentType = coldOpts.ContentType
+	}
+	if stat.Metadata == nil {
+		stat.Metadata = coldOpts.Metadata
+	}
+	if stat.LastModified.IsZero() {
+		stat.LastModified = t.opts.Clock()
+	}
+	if err := t.writePointer(ctx, key, stat); err != nil {
+		return Stat{}, &StorageError{Op: op, Key: key, Err: err}
+	}
+	return inTier(stat, TierCold), nil
+}
+
+// coldBySize reports whether an object of size belongs in the cold tier
+func (t *TieredStorage) coldBySize(size int64) bool {
+	return t.opts.MaxHotSize > 0 && size > t.opts.MaxHotSize
+}
+
+// Put stores an object in the hot tier; Migrate moves it if it is too large
+func (t *TieredStorage) Put(ctx context.Context, key string, r io.Reader, opts *PutOptions) (Stat, error) {
+	return t.write(ctx, "put", key, false, opts, func(s Storage, opts *PutOptions) (Stat, error) {
+		return s.Put(ctx, key, r, opts)
+	})
+}
+
+// PutBytes stores an object in the tier its size belongs to
+func (t *TieredStorage) PutBytes(ctx context.Context, key string, data []byte, opts *PutOptions) (Stat, error) {
+	return t.write(ctx, "put", key, t.coldBySize(int64(len(data))), opts, func(s Storage, opts *PutOptions) (Stat, error) {
+		return s.PutBytes(ctx, key, data, opts)
+	})
+}
+
+// PutFile stores a file in the tier its size belongs to
+func (t *TieredStorage) PutFile(ctx context.Context, key string, path string, opts *PutOptions) (Stat, error) {
+	toCold := false
+	if info, err := os.Stat(path); err == nil {
+		toCold = t.coldBySize(info.Size())
+	}
+	return t.write(ctx, "put_file", key, toCold, opts, func(s Storage, opts *PutOptions) (Stat, error) {
+		return s.PutFile(ctx, key, path, opts)
+	})
+}
+
+// Get retrieves an object from the tier that holds it
+func (t *TieredStorage) Get(ctx context.Context, key string) (ReaderAtCloser, Stat, error) {
+	reader, stat, err := t.hot.Get(ctx, key)
+	if err != nil || !isPointer(stat) {
+		return reader, inTier(stat, TierHot), err
+	}
+	reader.Close()
+
+	reader, stat, err = t.cold.Get(ctx, key)
+	return reader, inTier(stat, TierCold), err
+}
+
+// Head retrieves object metadata, from the pointer for cold objects
+func (t *TieredStorage) Head(ctx context.Context, key string) (Stat, error) {
+	stat, err := t.hot.Head(ctx, key)
+	if err != nil {
+		return stat, err
+	}
+	if isPointer(stat) {
+		return resolvePointer(stat), nil
+	}
+	return inTier(stat, TierHot), nil
+}
+
+// List retrieves objects of both tiers
+func (t *TieredStorage) List(ctx context.Context, opts ListOptions) (ListPage, error) {
+	page, err := t.hot.List(ctx, opts)
+	if err != nil {
+		return page, err
+	}
+	for i, stat := range page.Keys {
+		if stat.Size != 0 {
+			page.Keys[i] = inTier(stat, TierHot)
+			continue
+		}
+		// Listings carry no metadata; only a Head tells a pointer from
+		// an empty object
+		full, err := t.hot.Head(ctx, stat.Key)
+		switch {
+		case err == nil && isPointer(full):
+			page.Keys[i] = resolvePointer(full)
+		case err == nil || IsNotFound(err):
+			page.Keys[i] = inTier(stat, TierHot)
+		default:
+			return ListPage{}, err
+		}
+	}
+	return page, nil
+}
+
+// Delete removes an object from both tiers
+func (t *TieredStorage) Delete(ctx context.Context, key string) error {
+	defer t.locks.lock(key)()
+	if err := t.hot.Delete(ctx, key); err != nil {
+		return err
+	}
+	return t.cold.Delete(ctx, key)
+}
+
+// DeleteBatch removes objects from both tiers. Keys the hot tier fails to
+// delete are kept in the cold tier.
+func (t *TieredStorage) DeleteBatch(ctx context.Context, keys []string) ([]string, error) {
+	failed, err := t.hot.DeleteBatch(ctx, keys)
+	if err != nil {
+		return failed, err
+	}
+
+	skip := make(map[string]bool, len(failed))
+	for _, key := range failed {
+		skip[key] = true
+	}
+	deleted := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if !skip[key] {
+			deleted = append(deleted, key)
+		}
+	}
+	if len(deleted) == 0 {
+		return failed, nil
+	}
+
+	coldFailed, err := t.cold.DeleteBatch(ctx, deleted)
+	return append(failed, coldFailed...), err
+}
+
+// multipartTier returns the tier multipart uploads go to
+func (t *TieredStorage) multipartTier() Storage {
+	if t.opts.MaxHotSize > 0 {
+		return t.cold
+	}
+	return t.hot
+}
+
+// MultipartUpload uploads an object, to the cold tier when MaxHotSize is set
+func (t *TieredStorage) MultipartUpload(ctx context.Context, key string, src io.Reader, cfg *MultipartConfig, putOpts *PutOptions) (Stat, error) {
+	return t.write(ctx, "multipart_upload", key, t.opts.MaxHotSize > 0, putOpts, func(s Storage, opts *PutOptions) (Stat, error) {
+		return s.MultipartUpload(ctx, key, src, cfg, opts)
+	})
+}
+
+// CreateMultipart initiates a multipart upload session, in the cold tier
+// when MaxHotSize is set
+func (t *TieredStorage) CreateMultipart(ctx context.Context, key string, putOpts *PutOptions) (string, error) {
+	return t.multipartTier().CreateMultipart(ctx, key, putOpts)
+}
+
+// UploadPart uploads a single part in a multipart upload
+func (t *TieredStorage) UploadPart(ctx context.Context, key, uploadID string, partNumber int32, part io.Reader, size int64) (string, error) {
+	return t.multipartTier().UploadPart(ctx, key, uploadID, partNumber, part, size)
+}
+
+// CompleteMultipart finalizes a multipart upload and, for the cold tier,
+// records its pointer
+func (t *TieredStorage) CompleteMultipart(ctx context.Context, key, uploadID string, etags []string) (Stat, error) {
+	return t.write(ctx, "complete_multipart", key, t.opts.MaxHotSize > 0, nil, func(s Storage, _ *PutOptions) (Stat, error) {
+		return s.CompleteMultipart(ctx, key, uploadID, etags)
+	})
+}
+
+// AbortMultipart cancels a multipart upload
+func (t *TieredStorage) AbortMultipart(ctx context.Context, key, uploadID string) error {
+	return t.multipartTier().AbortMultipart(ctx, key, uploadID)
+}
+
+// PresignGet generates a presigned download URL on the tier that holds
+// the object
+func (t *TieredStorage) PresignGet(ctx context.Context, key string, opts *PresignOptions) (string, error) {
+	stat, err := t.hot.Head(ctx, key)
+	if err == nil && isPointer(stat) {
+		return t.cold.PresignGet(ctx, key, opts)
+	}
+	return t.hot.PresignGet(ctx, key, opts)
+}
+
+// PresignPut generates a presigned upload URL for the hot tier. Objects
+// uploaded with it are migrated like objects written through Put.
+func (t *TieredStorage) PresignPut(ctx context.Context, key string, opts *PresignOptions) (string, error) {
+	return t.hot.PresignPut(ctx, key, opts)
+}
+
+// due reports whether a hot object exceeds a limit of the policy
+func (t *TieredStorage) due(stat Stat) bool {
+	if stat.Size == 0 {
+		// Pointers and empty objects are not worth migrating
+		return false
+	}
+	if t.coldBySize(stat.Size) {
+		return true
+	}
+	return t.opts.MaxHotAge > 0 && t.opts.Clock().Sub(stat.LastModified) > t.opts.MaxHotAge
+}
+
+// Migrate moves the hot objects that exceed MaxHotSize or MaxHotAge to the
+// cold tier. It keeps going after a failed object and returns the errors of
+// every failure.
+func (t *TieredStorage) Migrate(ctx context.Context) (*MigrationReport, error) {
+	report := &MigrationReport{}
+	var errs []error
+
+	opts := ListOptions{}
+	for {
+		page, err := t.hot.List(ctx, opts)
+		if err != nil {
+			return report, errors.Join(append(errs, err)...)
+		}
+		for _, stat := range page.Keys {
+			report.Scanned++
+			if !t.due(stat) {
+				continue
+			}
+			migrated, err := t.migrate(ctx, stat)
+			switch {
+			case err != nil:
+				t.record(MigrationFailed)
+				errs = append(errs, err)
+			case migrated:
+				t.record(MigrationMigrated)
+				report.Migrated++
+				report.BytesMigrated += stat.Size
+			default:
+				t.record(MigrationSkipped)
+			}
+		}
+		if ctx.Err() != nil {
+			return report, errors.Join(append(errs, ctx.Err())...)
+		}
+		if !page.IsTruncated || page.NextToken == "" {
+			return report, errors.Join(errs...)
+		}
+		opts.ContinuationToken = page.NextToken
+	}
+}
+
+// migrate copies one hot object to the cold tier and replaces it with a
+// pointer. It reports false if the object changed since it was listed.
+func (t *TieredStorage) migrate(ctx context.Context, listed Stat) (bool, error) {
+	key := listed.Key
+	defer t.locks.lock(key)()
+
+	reader, stat, err := t.hot.Get(ctx, key)
+	if IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if isPointer(stat) || stat.ETag != listed.ETag {
+		reader.Close()
+		return false, nil
+	}
+
+	coldStat, err := t.cold.Put(ctx, key, reader, &PutOptions{
+		ContentType: stat.ContentType,
+		Metadata:    stat.Metadata,
+		Overwrite:   true,
+	})
+	reader.Close()
+	if err != nil {
+		return false, &StorageError{Op: "migrate", Key: key, Err: err}
+	}
+
+	// Give up if another client changed the object during the copy
+	current, err := t.hot.Head(ctx, key)
+	if err != nil || current.ETag != stat.ETag {
+		t.discardCopy(ctx, key)
+		if IsNotFound(err) {
+			err = nil
+		}
+		return false, err
+	}
+
+	// The pointer keeps the hot modification time so age stays meaningful
+	coldStat.LastModified = stat.LastModified
+	if coldStat.ContentType == "" {
+		coldStat.ContentType = stat.ContentType
+	}
+	coldStat.Metadata = stat.Metadata
+	if err := t.replaceWithPointer(ctx, key, stat.ETag, coldStat); err != nil {
+		// Or if it changed after the check above
+		if IsPreconditionFailed(err) {
+			t.discardCopy(ctx, key)
+			return false, nil
+		}
+		return false, &StorageError{Op: "migrate", Key: key, Err: err}
+	}
+	return true, nil
+}
+
+// discardCopy deletes the cold copy of an abandoned migration, unless the
+// hot object now points to the cold tier: then another client stored key
+// in the cold tier since, over the copy
+func (t *TieredStorage) discardCopy(ctx context.Context, key string) {
+	if current, err := t.hot.Head(ctx, key); err == nil && isPointer(current) {
+		return
+	}
+	t.cold.Delete(ctx, key)
+}
+
+var _ Storage = (*TieredStorage)(nil)
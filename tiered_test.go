@@ -0,0 +1,242 @@
+package storagex_test
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/gostratum/storagex"
+	"github.com/gostratum/storagex/internal/testutil"
+	"github.com/gostratum/storagex/storagextest"
+)
+
+func newTiered(t *testing.T, opts storagex.TieredOptions) (*storagex.TieredStorage, *testutil.MockStorage, *testutil.MockStorage) {
+	t.Helper()
+	hot, cold := testutil.NewMockStorage(), testutil.NewMockStorage()
+	tiered, err := storagex.NewTieredStorage(hot, cold, opts)
+	require.NoError(t, err)
+	t.Cleanup(func() { tiered.Close() })
+	return tiered, hot, cold
+}
+
+func exists(t *testing.T, storage storagex.Storage, key string) bool {
+	t.Helper()
+	_, err := storage.Head(context.Background(), key)
+	if storagex.IsNotFound(err) {
+		return false
+	}
+	require.NoError(t, err)
+	return true
+}
+
+func objectCount(t *testing.T, storage storagex.Storage) int {
+	t.Helper()
+	page, err := storage.List(context.Background(), storagex.ListOptions{})
+	require.NoError(t, err)
+	return len(page.Keys)
+}
+
+func TestTiered_RoutesBySize(t *testing.T) {
+	ctx := context.Background()
+	tiered, hot, cold := newTiered(t, storagex.TieredOptions{MaxHotSize: 8})
+
+	stat, err := tiered.PutBytes(ctx, "small.txt", []byte("small"), nil)
+	require.NoError(t, err)
+	assert.Equal(t, storagex.TierHot, stat.StorageClass)
+
+	stat, err = tiered.PutBytes(ctx, "large.txt", []byte("large object"), &storagex.PutOptions{
+		ContentType: "text/plain",
+		Metadata:    map[string]string{"owner": "ops"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, storagex.TierCold, stat.StorageClass)
+	assert.True(t, exists(t, cold, "large.txt"))
+	assert.False(t, exists(t, cold, "small.txt"))
+
+	// One namespace over both tiers
+	assert.Equal(t, "large object", readString(t, tiered, "large.txt"))
+	stat, err = tiered.Head(ctx, "large.txt")
+	require.NoError(t, err)
+	assert.Equal(t, int64(12), stat.Size)
+	assert.Equal(t, storagex.TierCold, stat.StorageClass)
+	assert.Equal(t, "text/plain", stat.ContentType)
+	assert.Equal(t, map[string]string{"owner": "ops"}, stat.Metadata)
+
+	page, err := tiered.List(ctx, storagex.ListOptions{})
+	require.NoError(t, err)
+	classes := map[string]string{}
+	for _, s := range page.Keys {
+		classes[s.Key] = s.StorageClass
+	}
+	assert.Equal(t, map[string]string{"small.txt": storagex.TierHot, "large.txt": storagex.TierCold}, classes)
+
+	// The hot tier only keeps an empty pointer
+	hotStat, err := hot.Head(ctx, "large.txt")
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), hotStat.Size)
+
+	// Overwrite is honored across tiers
+	_, err = tiered.PutBytes(ctx, "large.txt", []byte("another large object"), &storagex.PutOptions{})
+	assert.ErrorIs(t, err, storagex.ErrConflict)
+
+	// Replacing a cold object with a small one drops the cold copy
+	_, err = tiered.PutBytes(ctx, "large.txt", []byte("tiny"), nil)
+	require.NoError(t, err)
+	assert.False(t, exists(t, cold, "large.txt"))
+	assert.Equal(t, "tiny", readString(t, tiered, "large.txt"))
+
+	// Empty objects are not mistaken for pointers
+	_, err = tiered.PutBytes(ctx, "empty.txt", nil, nil)
+	require.NoError(t, err)
+	stat, err = tiered.Head(ctx, "empty.txt")
+	require.NoError(t, err)
+	assert.Equal(t, storagex.TierHot, stat.StorageClass)
+}
+
+func TestTiered_PutFileAndDelete(t *testing.T) {
+	ctx := context.Background()
+	tiered, hot, cold := newTiered(t, storagex.TieredOptions{MaxHotSize: 8})
+
+	path := filepath.Join(t.TempDir(), "big.bin")
+	require.NoError(t, os.WriteFile(path, []byte(strings.Repeat("x", 32)), 0o644))
+	stat, err := tiered.PutFile(ctx, "big.bin", path, nil)
+	require.NoError(t, err)
+	assert.Equal(t, storagex.TierCold, stat.StorageClass)
+
+	require.NoError(t, tiered.Delete(ctx, "big.bin"))
+	assert.False(t, exists(t, hot, "big.bin"))
+	assert.False(t, exists(t, cold, "big.bin"))
+
+	_, err = tiered.PutBytes(ctx, "a.bin", []byte(strings.Repeat("a", 16)), nil)
+	require.NoError(t, err)
+	_, err = tiered.PutBytes(ctx, "b.txt", []byte("b"), nil)
+	require.NoError(t, err)
+	failed, err := tiered.DeleteBatch(ctx, []string{"a.bin", "b.txt"})
+	require.NoError(t, err)
+	assert.Empty(t, failed)
+	assert.Equal(t, 0, objectCount(t, hot))
+	assert.Equal(t, 0, objectCount(t, cold))
+}
+
+func TestTiered_Migrate(t *testing.T) {
+	ctx := context.Background()
+	clock := &fakeClock{now: time.Now()}
+	tiered, hot, cold := newTiered(t, storagex.TieredOptions{
+		MaxHotSize: 8,
+		MaxHotAge:  24 * time.Hour,
+		Clock:      clock.Now,
+	})
+
+	// Put cannot know the size up front, so the object lands in the hot tier
+	_, err := tiered.Put(ctx, "streamed.bin", strings.NewReader("streamed large object"), nil)
+	require.NoError(t, err)
+	_, err = tiered.PutBytes(ctx, "recent.txt", []byte("recent"), nil)
+	require.NoError(t, err)
+	assert.False(t, exists(t, cold, "streamed.bin"))
+
+	report, err := tiered.Migrate(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, report.Scanned)
+	assert.Equal(t, 1, report.Migrated)
+	assert.Equal(t, int64(21), report.BytesMigrated)
+	assert.True(t, exists(t, cold, "streamed.bin"))
+	assert.Equal(t, "streamed large object", readString(t, tiered, "streamed.bin"))
+
+	// Old objects follow once they exceed MaxHotAge
+	clock.Advance(25 * time.Hour)
+	report, err = tiered.Migrate(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, report.Migrated)
+	stat, err := tiered.Head(ctx, "recent.txt")
+	require.NoError(t, err)
+	assert.Equal(t, storagex.TierCold, stat.StorageClass)
+	assert.Equal(t, int64(6), stat.Size)
+
+	// Pointers are not migrated again
+	report, err = tiered.Migrate(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, report.Migrated)
+	assert.Equal(t, 2, objectCount(t, hot))
+}
+
+// racingStorage overwrites an object right before the first conditional
+// write to it, like another process writing during a migration
+type racingStorage struct {
+	*testutil.MockStorage
+	raced bool
+}
+
+func (s *racingStorage) PutIfMatch(ctx context.Context, key string, r io.Reader, etag string, opts *storagex.PutOptions) (storagex.Stat, error) {
+	if !s.raced {
+		s.raced = true
+		if _, err := s.MockStorage.PutBytes(ctx, key, []byte("concurrent write"), nil); err != nil {
+			return storagex.Stat{}, err
+		}
+	}
+	return s.MockStorage.PutIfMatch(ctx, key, r, etag, opts)
+}
+
+func TestTiered_MigrateKeepsConcurrentWrites(t *testing.T) {
+	ctx := context.Background()
+	hot := &racingStorage{MockStorage: testutil.NewMockStorage()}
+	cold := testutil.NewMockStorage()
+	tiered, err := storagex.NewTieredStorage(hot, cold, storagex.TieredOptions{MaxHotSize: 8})
+	require.NoError(t, err)
+	defer tiered.Close()
+
+	_, err = tiered.Put(ctx, "streamed.bin", strings.NewReader("streamed large object"), nil)
+	require.NoError(t, err)
+
+	// The write that lands after the copy wins over the pointer
+	report, err := tiered.Migrate(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, report.Migrated)
+	assert.Equal(t, "concurrent write", readString(t, tiered, "streamed.bin"))
+	assert.False(t, exists(t, cold, "streamed.bin"))
+
+	// The next run migrates the new object
+	report, err = tiered.Migrate(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, report.Migrated)
+	assert.Equal(t, "concurrent write", readString(t, tiered, "streamed.bin"))
+	assert.True(t, exists(t, cold, "streamed.bin"))
+}
+
+func TestTiered_Multipart(t *testing.T) {
+	ctx := context.Background()
+	tiered, _, cold := newTiered(t, storagex.TieredOptions{MaxHotSize: 8})
+
+	id, err := tiered.CreateMultipart(ctx, "parts.bin", nil)
+	require.NoError(t, err)
+	etag, err := tiered.UploadPart(ctx, "parts.bin", id, 1, strings.NewReader("multipart body"), 14)
+	require.NoError(t, err)
+	stat, err := tiered.CompleteMultipart(ctx, "parts.bin", id, []string{etag})
+	require.NoError(t, err)
+	assert.Equal(t, storagex.TierCold, stat.StorageClass)
+	assert.True(t, exists(t, cold, "parts.bin"))
+	assert.Equal(t, "multipart body", readString(t, tiered, "parts.bin"))
+}
+
+func TestTiered_HidesTierCapabilities(t *testing.T) {
+	tiered, _, _ := newTiered(t, storagex.TieredOptions{})
+
+	// Writes on the hot tier directly would overwrite pointers
+	_, ok := storagex.Capability[storagex.ConditionalWriter](tiered)
+	assert.False(t, ok)
+	_, ok = storagex.Capability[storagex.StorageClassManager](tiered)
+	assert.False(t, ok)
+}
+
+func TestTiered_Conformance(t *testing.T) {
+	storagextest.RunConformance(t, func(t *testing.T) storagex.Storage {
+		tiered, _, _ := newTiered(t, storagex.TieredOptions{MaxHotSize: 64})
+		return tiered
+	})
+}
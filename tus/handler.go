@@ -0,0 +1,717 @@
+// Package tus implements a tus 1.0 resumable upload server on top of any
+// storagex.Storage. Upload chunks are mapped onto the multipart API
+// (CreateMultipart/UploadPart/CompleteMultipart) and the upload state is
+// persisted in the storage itself so that any replica can resume an upload.
+//
+// Supported extensions: creation, termination and expiration.
+//
+// Example usage:
+//
+//	handler, err := tus.NewHandler(storage, tus.Config{
+//	    BasePath: "/files/",
+//	    MaxSize:  5 << 30,
+//	})
+//	if err != nil {
+//	    return err
+//	}
+//	mux.Handle("/files/", handler)
+package tus
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gostratum/core/logx"
+	"github.com/gostratum/storagex"
+)
+
+const (
+	// Version is the tus protocol version implemented by the handler
+	Version = "1.0.0"
+
+	// Extensions lists the tus protocol extensions supported by the handler
+	Extensions = "creation,termination,expiration"
+
+	// offsetContentType is the mandatory content type for PATCH requests
+	offsetContentType = "application/offset+octet-stream"
+
+	// minPartSize is the smallest non-final part accepted by S3
+	minPartSize = 5 << 20
+
+	// lockStripes is the number of locks upload IDs are spread over
+	lockStripes = 64
+)
+
+// Config configures the tus handler
+type Config struct {
+	// BasePath is the URL path the handler is mounted at (default: "/files/")
+	BasePath string
+
+	// KeyPrefix is prepended to upload IDs to build the final object key
+	// (default: "uploads/")
+	KeyPrefix string
+
+	// StatePrefix is where upload state and buffered tail chunks are
+	// persisted (default: ".tus/")
+	StatePrefix string
+
+	// PartSize is the multipart part size; chunks smaller than this are
+	// buffered until enough data arrives (default: 8MB, minimum: 5MB)
+	PartSize int64
+
+	// MaxSize is the maximum accepted Upload-Length (0 means unlimited)
+	MaxSize int64
+
+	// Expiration is how long an unfinished upload may stay idle before it
+	// is rejected and eligible for cleanup (default: 24h)
+	Expiration time.Duration
+
+	// KeyFunc optionally maps an upload to its final object key. When nil,
+	// KeyPrefix+id is used.
+	KeyFunc func(id string, metadata map[string]string) string
+
+	// Logger is an optional logger
+	Logger logx.Logger
+
+	// Clock is an optional time provider (useful for testing)
+	Clock func() time.Time
+}
+
+// applyDefaults fills unset configuration values
+func (c *Config) applyDefaults() {
+	if c.BasePath == "" {
+		c.BasePath = "/files/"
+	}
+	if !strings.HasSuffix(c.BasePath, "/") {
+		c.BasePath += "/"
+	}
+	if c.KeyPrefix == "" {
+		c.KeyPrefix = "uploads/"
+	}
+	if c.StatePrefix == "" {
+		c.StatePrefix = ".tus/"
+	}
+	if c.PartSize == 0 {
+		c.PartSize = 8 << 20
+	}
+	if c.Expiration == 0 {
+		c.Expiration = 24 * time.Hour
+	}
+	if c.Logger == nil {
+		c.Logger = logx.NewNoopLogger()
+	}
+	if c.Clock == nil {
+		c.Clock = time.Now
+	}
+}
+
+// Handler is an http.Handler implementing the tus resumable upload protocol
+type Handler struct {
+	storage storagex.Storage
+	cfg     Config
+
+	locks [lockStripes]sync.Mutex
+}
+
+// NewHandler creates a tus handler backed by the given storage
+func NewHandler(storage storagex.Storage, cfg Config) (*Handler, error) {
+	if storage == nil {
+		return nil, fmt.Errorf("%w: storage cannot be nil", storagex.ErrInvalidConfig)
+	}
+
+	cfg.applyDefaults()
+
+	if cfg.PartSize < minPartSize {
+		return nil, fmt.Errorf("%w: part size must be at least 5MB", storagex.ErrInvalidConfig)
+	}
+	if cfg.MaxSize < 0 {
+		return nil, fmt.Errorf("%w: max size cannot be negative", storagex.ErrInvalidConfig)
+	}
+
+	return &Handler{
+		storage: storage,
+		cfg:     cfg,
+	}, nil
+}
+
+// uploadState is the persisted state of a single upload
+type uploadState struct {
+	ID          string            `json:"id"`
+	Key         string            `json:"key"`
+	UploadID    string            `json:"upload_id,omitempty"`
+	Length      int64             `json:"length"`
+	Offset      int64             `json:"offset"`
+	TailSize    int64             `json:"tail_size"`
+	ETags       []string          `json:"etags,omitempty"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+	RawMetadata string            `json:"raw_metadata,omitempty"`
+	Completed   bool              `json:"completed"`
+	ExpiresAt   time.Time         `json:"expires_at"`
+}
+
+// ServeHTTP dispatches tus requests
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	method := r.Method
+	if override := r.Header.Get("X-HTTP-Method-Override"); override != "" {
+		method = strings.ToUpper(override)
+	}
+
+	w.Header().Set("Tus-Resumable", Version)
+
+	if method == http.MethodOptions {
+		h.handleOptions(w)
+		return
+	}
+
+	if r.Header.Get("Tus-Resumable") != Version {
+		w.Header().Set("Tus-Version", Version)
+		http.Error(w, "unsupported tus version", http.StatusPreconditionFailed)
+		return
+	}
+
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, strings.TrimSuffix(h.cfg.BasePath, "/")), "/")
+
+	switch {
+	case method == http.MethodPost && id == "":
+		h.handleCreate(w, r)
+	case method == http.MethodHead && id != "":
+		h.handleHead(w, r, id)
+	case method == http.MethodPatch && id != "":
+		h.handlePatch(w, r, id)
+	case method == http.MethodDelete && id != "":
+		h.handleDelete(w, r, id)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleOptions advertises the server capabilities
+func (h *Handler) handleOptions(w http.ResponseWriter) {
+	w.Header().Set("Tus-Version", Version)
+	w.Header().Set("Tus-Extension", Extensions)
+	if h.cfg.MaxSize > 0 {
+		w.Header().Set("Tus-Max-Size", strconv.FormatInt(h.cfg.MaxSize, 10))
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleCreate implements the creation extension
+func (h *Handler) handleCreate(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if r.Header.Get("Upload-Defer-Length") != "" {
+		http.Error(w, "deferred upload length is not supported", http.StatusBadRequest)
+		return
+	}
+
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		http.Error(w, "invalid Upload-Length", http.StatusBadRequest)
+		return
+	}
+	if h.cfg.MaxSize > 0 && length > h.cfg.MaxSize {
+		http.Error(w, "upload exceeds maximum size", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	rawMetadata := r.Header.Get("Upload-Metadata")
+	metadata, err := parseMetadata(rawMetadata)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	id := strings.ReplaceAll(uuid.New().String(), "-", "")
+	key := h.cfg.KeyPrefix + id
+	if h.cfg.KeyFunc != nil {
+		key = h.cfg.KeyFunc(id, metadata)
+	}
+
+	state := &uploadState{
+		ID:          id,
+		Key:         key,
+		Length:      length,
+		Metadata:    metadata,
+		RawMetadata: rawMetadata,
+		ExpiresAt:   h.cfg.Clock().Add(h.cfg.Expiration),
+	}
+
+	putOpts := &storagex.PutOptions{
+		ContentType: metadata["filetype"],
+		Overwrite:   true,
+	}
+
+	if length == 0 {
+		// Multipart uploads need at least one part; store empty objects directly
+		if _, err := h.storage.PutBytes(ctx, key, nil, putOpts); err != nil {
+			h.writeStorageError(w, "create", err)
+			return
+		}
+		state.Completed = true
+	} else {
+		uploadID, err := h.storage.CreateMultipart(ctx, key, putOpts)
+		if err != nil {
+			h.writeStorageError(w, "create", err)
+			return
+		}
+		state.UploadID = uploadID
+	}
+
+	if err := h.saveState(ctx, state); err != nil {
+		h.writeStorageError(w, "create", err)
+		return
+	}
+
+	h.cfg.Logger.Debug("tus upload created", storagex.ArgsToFields(
+		"id", id,
+		"key", key,
+		"length", length,
+	)...)
+
+	w.Header().Set("Location", h.cfg.BasePath+id)
+	w.Header().Set("Upload-Expires", state.ExpiresAt.UTC().Format(http.TimeFormat))
+	w.WriteHeader(http.StatusCreated)
+}
+
+// handleHead reports the current upload offset
+func (h *Handler) handleHead(w http.ResponseWriter, r *http.Request, id string) {
+	state, ok := h.loadActiveState(r.Context(), w, id)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Upload-Offset", strconv.FormatInt(state.Offset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(state.Length, 10))
+	if state.RawMetadata != "" {
+		w.Header().Set("Upload-Metadata", state.RawMetadata)
+	}
+	if !state.Completed {
+		w.Header().Set("Upload-Expires", state.ExpiresAt.UTC().Format(http.TimeFormat))
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// handlePatch appends data to an upload
+func (h *Handler) handlePatch(w http.ResponseWriter, r *http.Request, id string) {
+	ctx := r.Context()
+
+	if r.Header.Get("Content-Type") != offsetContentType {
+		http.Error(w, "Content-Type must be "+offsetContentType, http.StatusUnsupportedMediaType)
+		return
+	}
+
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		http.Error(w, "invalid Upload-Offset", http.StatusBadRequest)
+		return
+	}
+
+	unlock := h.lock(id)
+	defer unlock()
+
+	state, ok := h.loadActiveState(ctx, w, id)
+	if !ok {
+		return
+	}
+
+	if offset != state.Offset {
+		http.Error(w, "Upload-Offset does not match current offset", http.StatusConflict)
+		return
+	}
+	if state.Completed {
+		w.Header().Set("Upload-Offset", strconv.FormatInt(state.Offset, 10))
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if err := h.appendChunk(ctx, state, r.Body); err != nil {
+		h.writeStorageError(w, "patch", err)
+		return
+	}
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(state.Offset, 10))
+	if !state.Completed {
+		w.Header().Set("Upload-Expires", state.ExpiresAt.UTC().Format(http.TimeFormat))
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// appendChunk streams body into parts, buffering any sub-part tail in storage
+func (h *Handler) appendChunk(ctx context.Context, state *uploadState, body io.Reader) error {
+	var buf bytes.Buffer
+	loadedTail := ""
+	if state.TailSize > 0 {
+		loadedTail = h.tailKey(state)
+		tail, err := h.loadTail(ctx, state)
+		if err != nil {
+			return err
+		}
+		buf.Write(tail)
+	}
+
+	src := io.LimitReader(body, state.Length-state.Offset)
+	chunk := make([]byte, 32<<10)
+
+	var readErr error
+	for {
+		want := h.cfg.PartSize - int64(buf.Len())
+		if want > int64(len(chunk)) {
+			want = int64(len(chunk))
+		}
+
+		n, err := src.Read(chunk[:want])
+		buf.Write(chunk[:n])
+		state.Offset += int64(n)
+
+		if int64(buf.Len()) == h.cfg.PartSize {
+			if err := h.uploadPart(ctx, state, buf.Bytes()); err != nil {
+				return err
+			}
+			buf.Reset()
+		}
+
+		if err != nil {
+			if err != io.EOF {
+				// Keep the bytes we received so the client can resume
+				readErr = err
+			}
+			break
+		}
+	}
+
+	if state.Offset == state.Length {
+		if buf.Len() > 0 {
+			if err := h.uploadPart(ctx, state, buf.Bytes()); err != nil {
+				return err
+			}
+		}
+		return h.complete(ctx, state)
+	}
+
+	// The tail is keyed by the part it will become, so if saving the state
+	// fails after parts were uploaded, the persisted state still names the
+	// tail it was saved with
+	tailKey := h.tailKey(state)
+	if buf.Len() > 0 {
+		if _, err := h.storage.PutBytes(ctx, tailKey, buf.Bytes(), &storagex.PutOptions{Overwrite: true}); err != nil {
+			return err
+		}
+	}
+	state.TailSize = int64(buf.Len())
+	state.ExpiresAt = h.cfg.Clock().Add(h.cfg.Expiration)
+
+	if err := h.saveState(ctx, state); err != nil {
+		return err
+	}
+
+	if loadedTail != "" && loadedTail != tailKey {
+		if err := h.storage.Delete(ctx, loadedTail); err != nil && !storagex.IsNotFound(err) {
+			h.cfg.Logger.Warn("failed to delete tus tail chunk", storagex.ArgsToFields("id", state.ID, "error", err)...)
+		}
+	}
+
+	if readErr != nil {
+		h.cfg.Logger.Warn("tus chunk interrupted", storagex.ArgsToFields(
+			"id", state.ID,
+			"offset", state.Offset,
+			"error", readErr,
+		)...)
+	}
+	return nil
+}
+
+// uploadPart uploads one full (or final) part and records its ETag
+func (h *Handler) uploadPart(ctx context.Context, state *uploadState, data []byte) error {
+	partNumber := int32(len(state.ETags) + 1)
+	etag, err := h.storage.UploadPart(ctx, state.Key, state.UploadID, partNumber, bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return err
+	}
+	state.ETags = append(state.ETags, etag)
+	state.TailSize = 0
+	return nil
+}
+
+// complete finalizes the multipart upload and marks the state as completed
+func (h *Handler) complete(ctx context.Context, state *uploadState) error {
+	if _, err := h.storage.CompleteMultipart(ctx, state.Key, state.UploadID, state.ETags); err != nil {
+		return err
+	}
+
+	state.Completed = true
+	state.TailSize = 0
+	state.ExpiresAt = h.cfg.Clock().Add(h.cfg.Expiration)
+	if err := h.saveState(ctx, state); err != nil {
+		return err
+	}
+
+	if err := h.deleteTails(ctx, state.ID); err != nil {
+		h.cfg.Logger.Warn("failed to delete tus tail chunk", storagex.ArgsToFields("id", state.ID, "error", err)...)
+	}
+
+	h.cfg.Logger.Info("tus upload completed", storagex.ArgsToFields(
+		"id", state.ID,
+		"key", state.Key,
+		"size", state.Length,
+		"parts", len(state.ETags),
+	)...)
+	return nil
+}
+
+// handleDelete implements the termination extension
+func (h *Handler) handleDelete(w http.ResponseWriter, r *http.Request, id string) {
+	ctx := r.Context()
+
+	unlock := h.lock(id)
+	defer unlock()
+
+	state, err := h.loadState(ctx, id)
+	if err != nil {
+		h.writeStorageError(w, "delete", err)
+		return
+	}
+
+	if err := h.terminate(ctx, state); err != nil {
+		h.writeStorageError(w, "delete", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// terminate aborts an unfinished upload and removes its persisted state
+func (h *Handler) terminate(ctx context.Context, state *uploadState) error {
+	if !state.Completed && state.UploadID != "" {
+		if err := h.storage.AbortMultipart(ctx, state.Key, state.UploadID); err != nil && !storagex.IsNotFound(err) {
+			return err
+		}
+	}
+
+	if err := h.deleteTails(ctx, state.ID); err != nil {
+		return err
+	}
+	return h.storage.Delete(ctx, h.stateKey(state.ID))
+}
+
+// deleteTails removes the buffered tail chunks of an upload, including any
+// left behind by a failed state save
+func (h *Handler) deleteTails(ctx context.Context, id string) error {
+	page, err := h.storage.List(ctx, storagex.ListOptions{Prefix: h.cfg.StatePrefix + id + "."})
+	if err != nil {
+		return err
+	}
+	var keys []string
+	for _, obj := range page.Keys {
+		if strings.HasSuffix(obj.Key, ".part") {
+			keys = append(keys, obj.Key)
+		}
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	_, err = h.storage.DeleteBatch(ctx, keys)
+	return err
+}
+
+// CleanupExpired aborts and removes uploads whose expiration has passed.
+// It returns the number of uploads removed. Run it periodically from a
+// single replica (e.g. a cron job).
+func (h *Handler) CleanupExpired(ctx context.Context) (int, error) {
+	now := h.cfg.Clock()
+	removed := 0
+	token := ""
+
+	for {
+		page, err := h.storage.List(ctx, storagex.ListOptions{
+			Prefix:            h.cfg.StatePrefix,
+			ContinuationToken: token,
+		})
+		if err != nil {
+			return removed, err
+		}
+
+		for _, obj := range page.Keys {
+			if !strings.HasSuffix(obj.Key, ".info") {
+				continue
+			}
+			id := strings.TrimSuffix(strings.TrimPrefix(obj.Key, h.cfg.StatePrefix), ".info")
+
+			unlock := h.lock(id)
+			state, err := h.loadState(ctx, id)
+			if err == nil && now.After(state.ExpiresAt) {
+				if err = h.terminate(ctx, state); err == nil {
+					removed++
+				}
+			}
+			unlock()
+
+			if err != nil && !storagex.IsNotFound(err) {
+				return removed, err
+			}
+		}
+
+		if !page.IsTruncated || page.NextToken == "" {
+			return removed, nil
+		}
+		token = page.NextToken
+	}
+}
+
+// loadActiveState loads state and writes the HTTP error for missing or
+// expired uploads. It returns false when the request has been answered.
+func (h *Handler) loadActiveState(ctx context.Context, w http.ResponseWriter, id string) (*uploadState, bool) {
+	state, err := h.loadState(ctx, id)
+	if err != nil {
+		h.writeStorageError(w, "load", err)
+		return nil, false
+	}
+
+	if !state.Completed && h.cfg.Clock().After(state.ExpiresAt) {
+		http.Error(w, "upload expired", http.StatusGone)
+		return nil, false
+	}
+	return state, true
+}
+
+// loadState reads persisted upload state
+func (h *Handler) loadState(ctx context.Context, id string) (*uploadState, error) {
+	if id == "" || strings.ContainsAny(id, "/.") {
+		return nil, &storagex.StorageError{Op: "tus_load", Key: id, Err: storagex.ErrNotFound}
+	}
+
+	reader, _, err := h.storage.Get(ctx, h.stateKey(id))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	var state uploadState
+	if err := json.NewDecoder(reader).Decode(&state); err != nil {
+		return nil, &storagex.StorageError{Op: "tus_load", Key: id, Err: fmt.Errorf("corrupt upload state: %w", err)}
+	}
+	return &state, nil
+}
+
+// saveState persists upload state
+func (h *Handler) saveState(ctx context.Context, state *uploadState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	_, err = h.storage.PutBytes(ctx, h.stateKey(state.ID), data, &storagex.PutOptions{
+		ContentType: "application/json",
+		Overwrite:   true,
+	})
+	return err
+}
+
+// loadTail reads the buffered tail chunk, truncated to the persisted size so
+// that a tail written without a matching state update is ignored
+func (h *Handler) loadTail(ctx context.Context, state *uploadState) ([]byte, error) {
+	reader, _, err := h.storage.Get(ctx, h.tailKey(state))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	tail, err := io.ReadAll(io.LimitReader(reader, state.TailSize))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(tail)) != state.TailSize {
+		return nil, &storagex.StorageError{
+			Op:  "tus_load",
+			Key: state.ID,
+			Err: fmt.Errorf("buffered chunk is %d bytes, expected %d", len(tail), state.TailSize),
+		}
+	}
+	return tail, nil
+}
+
+func (h *Handler) stateKey(id string) string { return h.cfg.StatePrefix + id + ".info" }
+
+// tailKey names the buffered tail of an upload after the part it belongs to
+func (h *Handler) tailKey(state *uploadState) string {
+	return h.cfg.StatePrefix + state.ID + "." + strconv.Itoa(len(state.ETags)+1) + ".part"
+}
+
+// lock serializes requests for a single upload within this process. Requests
+// for the same upload on different replicas are guarded by the offset check.
+// Uploads are spread over a fixed set of striped mutexes, so the locks do
+// not grow with the number of uploads.
+func (h *Handler) lock(id string) func() {
+	hash := fnv.New32a()
+	hash.Write([]byte(id))
+	mu := &h.locks[hash.Sum32()%lockStripes]
+	mu.Lock()
+	return mu.Unlock
+}
+
+// writeStorageError maps storage errors to HTTP status codes
+func (h *Handler) writeStorageError(w http.ResponseWriter, op string, err error) {
+	switch {
+	case errors.Is(err, storagex.ErrNotFound):
+		http.Error(w, "upload not found", http.StatusNotFound)
+	case errors.Is(err, storagex.ErrTooLarge):
+		http.Error(w, "upload too large", http.StatusRequestEntityTooLarge)
+	case errors.Is(err, context.Canceled), errors.Is(err, storagex.ErrAborted):
+		http.Error(w, "upload aborted", http.StatusBadRequest)
+	default:
+		h.cfg.Logger.Error("tus request failed", storagex.ArgsToFields("op", op, "error", err)...)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+	}
+}
+
+// parseMetadata decodes the Upload-Metadata header
+func parseMetadata(header string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	if strings.TrimSpace(header) == "" {
+		return metadata, nil
+	}
+
+	for _, pair := range strings.Split(header, ",") {
+		parts := strings.Fields(pair)
+		switch len(parts) {
+		case 1:
+			metadata[parts[0]] = ""
+		case 2:
+			value, err := base64.StdEncoding.DecodeString(parts[1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid Upload-Metadata value for %q", parts[0])
+			}
+			metadata[parts[0]] = string(value)
+		default:
+			return nil, fmt.Errorf("invalid Upload-Metadata pair %q", pair)
+		}
+	}
+	return metadata, nil
+}
+
+// EncodeMetadata builds an Upload-Metadata header value (useful for clients
+// and tests)
+func EncodeMetadata(metadata map[string]string) string {
+	keys := make([]string, 0, len(metadata))
+	for k := range metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, k+" "+base64.StdEncoding.EncodeToString([]byte(metadata[k])))
+	}
+	return strings.Join(pairs, ",")
+}
@@ -0,0 +1,262 @@
+package tus_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/gostratum/storagex"
+	"github.com/gostratum/storagex/faultstore"
+	"github.com/gostratum/storagex/internal/testutil"
+	"github.com/gostratum/storagex/tus"
+)
+
+const partSize = 5 << 20
+
+func newServer(t *testing.T, storage *testutil.MockStorage, clock func() time.Time) *httptest.Server {
+	t.Helper()
+	handler, err := tus.NewHandler(storage, tus.Config{
+		BasePath: "/files/",
+		PartSize: partSize,
+		MaxSize:  64 << 20,
+		Clock:    clock,
+	})
+	require.NoError(t, err)
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func doRequest(t *testing.T, method, url string, body []byte, headers map[string]string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set("Tus-Resumable", tus.Version)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	return resp
+}
+
+func create(t *testing.T, srv *httptest.Server, length int) string {
+	t.Helper()
+	resp := doRequest(t, http.MethodPost, srv.URL+"/files/", nil, map[string]string{
+		"Upload-Length":   strconv.Itoa(length),
+		"Upload-Metadata": tus.EncodeMetadata(map[string]string{"filename": "photo.jpg", "filetype": "image/jpeg"}),
+	})
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	require.NotEmpty(t, resp.Header.Get("Upload-Expires"))
+	return srv.URL + resp.Header.Get("Location")
+}
+
+func patch(t *testing.T, url string, offset int, chunk []byte) *http.Response {
+	t.Helper()
+	return doRequest(t, http.MethodPatch, url, chunk, map[string]string{
+		"Content-Type":  "application/offset+octet-stream",
+		"Upload-Offset": strconv.Itoa(offset),
+	})
+}
+
+func listUploads(t *testing.T, storage *testutil.MockStorage) []storagex.MultipartUploadInfo {
+	t.Helper()
+	uploads, err := storage.ListMultipartUploads(context.Background(), "")
+	require.NoError(t, err)
+	return uploads
+}
+
+func testData(n int) []byte {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	return data
+}
+
+func TestHandler_Options(t *testing.T) {
+	srv := newServer(t, testutil.NewMockStorage(), nil)
+
+	req, err := http.NewRequest(http.MethodOptions, srv.URL+"/files/", nil)
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	assert.Equal(t, tus.Version, resp.Header.Get("Tus-Version"))
+	assert.Equal(t, tus.Extensions, resp.Header.Get("Tus-Extension"))
+	assert.Equal(t, strconv.Itoa(64<<20), resp.Header.Get("Tus-Max-Size"))
+}
+
+func TestHandler_RejectsMissingVersion(t *testing.T) {
+	srv := newServer(t, testutil.NewMockStorage(), nil)
+
+	resp, err := http.Post(srv.URL+"/files/", "", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusPreconditionFailed, resp.StatusCode)
+}
+
+func TestHandler_ResumableUploadAcrossReplicas(t *testing.T) {
+	storage := testutil.NewMockStorage()
+	podA := newServer(t, storage, nil)
+	podB := newServer(t, storage, nil)
+
+	data := testData(12<<20 + 123)
+	location := create(t, podA, len(data))
+
+	// Small chunks are buffered until a full part is available
+	resp := patch(t, location, 0, data[:3<<20])
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+	assert.Equal(t, strconv.Itoa(3<<20), resp.Header.Get("Upload-Offset"))
+
+	// A different replica picks up the upload from persisted state
+	resumeURL := podB.URL + location[len(podA.URL):]
+	head := doRequest(t, http.MethodHead, resumeURL, nil, nil)
+	require.Equal(t, http.StatusOK, head.StatusCode)
+	assert.Equal(t, strconv.Itoa(3<<20), head.Header.Get("Upload-Offset"))
+	assert.Equal(t, strconv.Itoa(len(data)), head.Header.Get("Upload-Length"))
+	assert.Equal(t, "no-store", head.Header.Get("Cache-Control"))
+
+	resp = patch(t, resumeURL, 3<<20, data[3<<20:9<<20])
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	// Mismatched offsets are rejected
+	resp = patch(t, location, 0, data[:10])
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+
+	resp = patch(t, location, 9<<20, data[9<<20:])
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+	assert.Equal(t, strconv.Itoa(len(data)), resp.Header.Get("Upload-Offset"))
+
+	id := location[len(podA.URL+"/files/"):]
+	reader, stat, err := storage.Get(context.Background(), "uploads/"+id)
+	require.NoError(t, err)
+	defer reader.Close()
+
+	got, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Equal(t, data, got)
+	assert.Equal(t, "image/jpeg", stat.ContentType)
+	assert.Empty(t, listUploads(t, storage))
+}
+
+func TestHandler_FailedStateSaveKeepsTail(t *testing.T) {
+	mock := testutil.NewMockStorage()
+	storage := faultstore.New(mock, faultstore.Options{})
+	handler, err := tus.NewHandler(storage, tus.Config{PartSize: partSize})
+	require.NoError(t, err)
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+
+	data := testData(12 << 20)
+	location := create(t, srv, len(data))
+	resp := patch(t, location, 0, data[:3<<20])
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	// This chunk completes part 1 and buffers a new tail, but the state
+	// save fails, so the upload stays at the previous offset
+	storage.AddRule(faultstore.Rule{Name: "state", Ops: []faultstore.Op{faultstore.OpPut}, Key: ".tus/*.info", Count: 1, Err: faultstore.ErrTimeout})
+	resp = patch(t, location, 3<<20, data[3<<20:9<<20])
+	require.GreaterOrEqual(t, resp.StatusCode, 500)
+
+	head := doRequest(t, http.MethodHead, location, nil, nil)
+	require.Equal(t, strconv.Itoa(3<<20), head.Header.Get("Upload-Offset"))
+	resp = patch(t, location, 3<<20, data[3<<20:])
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	id := location[len(srv.URL+"/files/"):]
+	reader, _, err := mock.Get(context.Background(), "uploads/"+id)
+	require.NoError(t, err)
+	defer reader.Close()
+	got, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Equal(t, data, got)
+
+	// No tail chunks are left behind
+	page, err := mock.List(context.Background(), storagex.ListOptions{Prefix: ".tus/"})
+	require.NoError(t, err)
+	require.Len(t, page.Keys, 1)
+	assert.Equal(t, ".tus/"+id+".info", page.Keys[0].Key)
+}
+
+func TestHandler_EmptyUpload(t *testing.T) {
+	storage := testutil.NewMockStorage()
+	srv := newServer(t, storage, nil)
+
+	location := create(t, srv, 0)
+	head := doRequest(t, http.MethodHead, location, nil, nil)
+	require.Equal(t, http.StatusOK, head.StatusCode)
+	assert.Equal(t, "0", head.Header.Get("Upload-Offset"))
+
+	id := location[len(srv.URL+"/files/"):]
+	stat, err := storage.Head(context.Background(), "uploads/"+id)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), stat.Size)
+}
+
+func TestHandler_Termination(t *testing.T) {
+	storage := testutil.NewMockStorage()
+	srv := newServer(t, storage, nil)
+
+	location := create(t, srv, 10<<20)
+	resp := patch(t, location, 0, testData(1024))
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+	require.Len(t, listUploads(t, storage), 1)
+
+	resp = doRequest(t, http.MethodDelete, location, nil, nil)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	assert.Empty(t, listUploads(t, storage))
+
+	head := doRequest(t, http.MethodHead, location, nil, nil)
+	assert.Equal(t, http.StatusNotFound, head.StatusCode)
+}
+
+func TestHandler_Expiration(t *testing.T) {
+	storage := testutil.NewMockStorage()
+	now := time.Now()
+	clock := func() time.Time { return now }
+
+	handler, err := tus.NewHandler(storage, tus.Config{PartSize: partSize, Expiration: time.Hour, Clock: clock})
+	require.NoError(t, err)
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+
+	location := create(t, srv, 1024)
+
+	now = now.Add(2 * time.Hour)
+	resp := patch(t, location, 0, testData(10))
+	assert.Equal(t, http.StatusGone, resp.StatusCode)
+
+	removed, err := handler.CleanupExpired(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, removed)
+	assert.Empty(t, listUploads(t, storage))
+}
+
+func TestHandler_CreateValidation(t *testing.T) {
+	srv := newServer(t, testutil.NewMockStorage(), nil)
+
+	resp := doRequest(t, http.MethodPost, srv.URL+"/files/", nil, nil)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp = doRequest(t, http.MethodPost, srv.URL+"/files/", nil, map[string]string{
+		"Upload-Length": strconv.Itoa(128 << 20),
+	})
+	assert.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+}
+
+func TestNewHandler_RejectsSmallParts(t *testing.T) {
+	_, err := tus.NewHandler(testutil.NewMockStorage(), tus.Config{PartSize: 1 << 20})
+	require.Error(t, err)
+}
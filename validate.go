@@ -94,6 +94,63 @@ func ValidateConfig(cfg *Config) error {
 	if cfg.BackoffMax <= cfg.BackoffInitial {
 		errors = append(errors, "backoff_max must be greater than backoff_initial")
 	}
+	if cfg.RetryMode != RetryModeSDK && cfg.RetryMode != RetryModeStorageX {
+		errors = append(errors, fmt.Sprintf("unsupported retry_mode %q, must be %q or %q", cfg.RetryMode, RetryModeSDK, RetryModeStorageX))
+	}
+	if cfg.HedgeDelay < 0 {
+		errors = append(errors, "hedge_delay cannot be negative")
+	}
+
+	// Validate circuit breaker and bulkhead configuration
+	if cfg.CircuitBreaker.Enabled {
+		if cfg.CircuitBreaker.FailureThreshold <= 0 {
+			errors = append(errors, "circuit_breaker.failure_threshold must be positive")
+		}
+		if cfg.CircuitBreaker.OpenTimeout <= 0 {
+			errors = append(errors, "circuit_breaker.open_timeout must be positive")
+		}
+		if cfg.CircuitBreaker.HalfOpenProbes <= 0 {
+			errors = append(errors, "circuit_breaker.half_open_probes must be positive")
+		}
+	}
+	if cfg.Bulkhead.MaxReads < 0 || cfg.Bulkhead.MaxWrites < 0 || cfg.Bulkhead.MaxLists < 0 {
+		errors = append(errors, "bulkhead limits cannot be negative")
+	}
+	if cfg.Bulkhead.MaxWait < 0 {
+		errors = append(errors, "bulkhead.max_wait cannot be negative")
+	}
+
+	// Validate rate limit configuration
+	if cfg.RateLimit.Rate < 0 || cfg.RateLimit.PrefixRate < 0 || cfg.RateLimit.TenantRate < 0 {
+		errors = append(errors, "rate_limit rates cannot be negative")
+	}
+	for op, rate := range cfg.RateLimit.Operations {
+		if rate < 0 {
+			errors = append(errors, fmt.Sprintf("rate_limit.operations.%s cannot be negative", op))
+		}
+	}
+	if cfg.RateLimit.Burst < 0 {
+		errors = append(errors, "rate_limit.burst cannot be negative")
+	}
+	if cfg.RateLimit.MaxWait < 0 {
+		errors = append(errors, "rate_limit.max_wait cannot be negative")
+	}
+	if cfg.RateLimit.MinFactor < 0 || cfg.RateLimit.MinFactor > 1 {
+		errors = append(errors, "rate_limit.min_factor must be between 0 and 1")
+	}
+
+	// Validate bucket provisioning
+	errors = append(errors, validateProvisioning(cfg.Provisioning)...)
+
+	// Validate browser uploads
+	for _, method := range cfg.BrowserUploads.Methods {
+		if !strings.EqualFold(method, "PUT") && !strings.EqualFold(method, "POST") {
+			errors = append(errors, fmt.Sprintf("browser_uploads.methods: unsupported method %q, must be PUT or POST", method))
+		}
+	}
+
+	// Validate lifecycle rules
+	errors = append(errors, validateLifecycle(cfg.Lifecycle)...)
 
 	// Validate multipart configuration
 	if cfg.DefaultPartSize < 5<<20 { // 5MB minimum for S3
@@ -314,6 +371,42 @@ func applyConfigDefaults(cfg *Config) *Config {
 		sanitized.BackoffMax = 5 * time.Second
 	}
 
+	if sanitized.RetryMode == "" {
+		sanitized.RetryMode = RetryModeSDK
+	}
+
+	if sanitized.CircuitBreaker.FailureThreshold == 0 {
+		sanitized.CircuitBreaker.FailureThreshold = 5
+	}
+
+	if sanitized.CircuitBreaker.OpenTimeout == 0 {
+		sanitized.CircuitBreaker.OpenTimeout = 30 * time.Second
+	}
+
+	if sanitized.CircuitBreaker.HalfOpenProbes == 0 {
+		sanitized.CircuitBreaker.HalfOpenProbes = 1
+	}
+
+	if sanitized.RateLimit.PrefixDepth == 0 {
+		sanitized.RateLimit.PrefixDepth = 1
+	}
+
+	if sanitized.RateLimit.TenantKey == "" {
+		sanitized.RateLimit.TenantKey = "tenant_id"
+	}
+
+	if sanitized.RateLimit.MinFactor == 0 {
+		sanitized.RateLimit.MinFactor = 0.1
+	}
+
+	if sanitized.RateLimit.RecoveryInterval == 0 {
+		sanitized.RateLimit.RecoveryInterval = time.Second
+	}
+
+	if sanitized.RateLimit.RecoveryStep == 0 {
+		sanitized.RateLimit.RecoveryStep = 0.05
+	}
+
 	if sanitized.DefaultPartSize == 0 {
 		sanitized.DefaultPartSize = 8 << 20 // 8MB
 	}
@@ -378,6 +471,9 @@ func (cfg *Config) ConfigSummary() map[string]any {
 		"use_path_style":    cfg.UsePathStyle,
 		"request_timeout":   cfg.RequestTimeout.String(),
 		"max_retries":       cfg.MaxRetries,
+		"retry_mode":        cfg.RetryMode,
+		"circuit_breaker":   cfg.CircuitBreaker.Enabled,
+		"rate_limit":        cfg.RateLimit.enabled(),
 		"default_part_size": fmt.Sprintf("%d MB", cfg.DefaultPartSize/(1<<20)),
 		"default_parallel":  cfg.DefaultParallel,
 		"base_prefix":       cfg.BasePrefix,
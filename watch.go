@@ -0,0 +1,210 @@
+package storagex
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EventType is the kind of change reported by a Watcher
+type EventType string
+
+const (
+	// ObjectCreated reports a new object or a new version of an existing
+	// one (put, completed multipart upload or copy)
+	ObjectCreated EventType = "ObjectCreated"
+
+	// ObjectRemoved reports a deleted object
+	ObjectRemoved EventType = "ObjectRemoved"
+
+	// ObjectModified reports a changed object. Only Poller tells changes
+	// from new objects; notification-based watchers report both as
+	// ObjectCreated.
+	ObjectModified EventType = "ObjectModified"
+)
+
+// Event is one change to a watched bucket
+type Event struct {
+	// ID identifies the event. A redelivered event carries the same ID, so
+	// handlers can use it to drop duplicates.
+	ID string
+
+	// Type is the kind of change
+	Type EventType
+
+	// Key is the object key
+	Key string
+
+	// Stat describes the object after the change. For ObjectRemoved only
+	// Key is set; other fields are filled in as far as the source knows
+	// them.
+	Stat Stat
+
+	// Time is when the change happened
+	Time time.Time
+
+	// Cursor is the position of the event in the feed. Watchers store it
+	// in WatchOptions.Checkpoint once the event is handled; it is empty
+	// for sources that track delivery themselves (e.g., a queue).
+	Cursor string
+}
+
+// EventHandler handles one event. Returning an error leaves the event
+// unacknowledged, so it is delivered again.
+type EventHandler func(ctx context.Context, event Event) error
+
+// WatchOptions configures Watcher.Watch
+type WatchOptions struct {
+	// Prefix limits events to keys starting with it
+	Prefix string
+
+	// Types limits events to the listed types (default: all)
+	Types []EventType
+
+	// Checkpoint stores the cursor of the last handled event, so a watch
+	// that is restarted resumes where it left off. Without a checkpoint,
+	// or with an empty one, the watch starts with changes made after
+	// Watch is called.
+	Checkpoint Checkpoint
+
+	// RetryInterval is how long to wait before delivering an event again
+	// after the handler failed (default: 1s)
+	RetryInterval time.Duration
+}
+
+// Accepts reports whether an event matches the prefix and types of the
+// options
+func (o WatchOptions) Accepts(event Event) bool {
+	if !strings.HasPrefix(event.Key, o.Prefix) {
+		return false
+	}
+	if len(o.Types) == 0 {
+		return true
+	}
+	for _, t := range o.Types {
+		if t == event.Type {
+			return true
+		}
+	}
+	return false
+}
+
+// Watcher is implemented by storages that can report changes to their
+// objects as they happen
+type Watcher interface {
+	// Watch delivers events to handler one at a time, in the order the
+	// source reports them, until ctx is done or the source fails. An event
+	// is acknowledged only after handler returns nil; until then it is
+	// delivered again every RetryInterval. Delivery is therefore at least
+	// once and handlers must be idempotent. Watch returns ctx.Err() when
+	// ctx is cancelled.
+	Watch(ctx context.Context, opts WatchOptions, handler EventHandler) error
+}
+
+// Deliver calls handler with event until it succeeds, waiting
+// opts.RetryInterval between attempts. It returns ctx.Err() if ctx is done
+// first. Watcher implementations use it to get the retry behavior
+// documented on Watch.
+func Deliver(ctx context.Context, opts WatchOptions, handler EventHandler, event Event) error {
+	interval := opts.RetryInterval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := handler(ctx, event); err == nil {
+			return nil
+		}
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// Checkpoint stores the cursor of the last event a watch handled.
+// Implementations must be safe for concurrent use.
+type Checkpoint interface {
+	// Load returns the stored cursor, or "" if none was saved
+	Load() (string, error)
+
+	// Save stores a cursor, replacing the previous one
+	Save(cursor string) error
+}
+
+// NewMemoryCheckpoint creates a checkpoint that lives in memory. It lets a
+// watch be restarted within a process; use NewFileCheckpoint to resume
+// after the process exits.
+func NewMemoryCheckpoint() Checkpoint {
+	return &fileCheckpoint{}
+}
+
+// NewFileCheckpoint opens (creating its directory if needed) a durable
+// checkpoint stored in the file at path. The file is replaced atomically by
+// rename, so a crash leaves either the old or the new cursor.
+func NewFileCheckpoint(path string) (Checkpoint, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("storagex: create checkpoint directory: %w", err)
+	}
+	c := &fileCheckpoint{path: path}
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("storagex: read checkpoint: %w", err)
+	}
+	c.cursor = strings.TrimSpace(string(data))
+	return c, nil
+}
+
+// fileCheckpoint is a cursor in memory, optionally mirrored to a file
+type fileCheckpoint struct {
+	path string
+
+	mu     sync.Mutex
+	cursor string
+}
+
+// Load returns the stored cursor
+func (c *fileCheckpoint) Load() (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.cursor, nil
+}
+
+// Save stores a cursor
+func (c *fileCheckpoint) Save(cursor string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.path != "" {
+		tmp, err := os.CreateTemp(filepath.Dir(c.path), "tmp-checkpoint-*")
+		if err != nil {
+			return fmt.Errorf("storagex: write checkpoint: %w", err)
+		}
+		_, err = tmp.WriteString(cursor)
+		if err == nil {
+			err = tmp.Sync()
+		}
+		if closeErr := tmp.Close(); err == nil {
+			err = closeErr
+		}
+		if err == nil {
+			err = os.Rename(tmp.Name(), c.path)
+		}
+		if err != nil {
+			os.Remove(tmp.Name())
+			return fmt.Errorf("storagex: write checkpoint: %w", err)
+		}
+	}
+	c.cursor = cursor
+	return nil
+}
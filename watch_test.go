@@ -0,0 +1,193 @@
+package storagex_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/gostratum/storagex"
+	"github.com/gostratum/storagex/internal/testutil"
+)
+
+// eventRecorder collects delivered events and fails the first delivery of
+// the keys in failOnce
+type eventRecorder struct {
+	mu       sync.Mutex
+	events   []storagex.Event
+	failOnce map[string]bool
+	received chan struct{}
+}
+
+func newEventRecorder(failOnce ...string) *eventRecorder {
+	r := &eventRecorder{failOnce: make(map[string]bool), received: make(chan struct{}, 100)}
+	for _, key := range failOnce {
+		r.failOnce[key] = true
+	}
+	return r
+}
+
+func (r *eventRecorder) handle(ctx context.Context, event storagex.Event) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+	r.received <- struct{}{}
+	if r.failOnce[event.Key] {
+		delete(r.failOnce, event.Key)
+		return errors.New("handler failed")
+	}
+	return nil
+}
+
+func (r *eventRecorder) wait(t *testing.T, n int) []storagex.Event {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		select {
+		case <-r.received:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for event %d of %d", i+1, n)
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]storagex.Event(nil), r.events...)
+}
+
+// startWatch runs Watch until the test ends
+func startWatch(t *testing.T, watcher storagex.Watcher, opts storagex.WatchOptions, handler storagex.EventHandler) context.CancelFunc {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- watcher.Watch(ctx, opts, handler) }()
+	t.Cleanup(func() {
+		cancel()
+		assert.ErrorIs(t, <-done, context.Canceled)
+	})
+	return cancel
+}
+
+func TestWatch_MemoryDeliversChanges(t *testing.T) {
+	ctx := context.Background()
+	mock := testutil.NewMockStorage()
+	_, err := mock.PutBytes(ctx, "uploads/before.txt", []byte("old"), nil)
+	require.NoError(t, err)
+
+	// Found through decorators
+	watcher, ok := storagex.Capability[storagex.Watcher](storagex.NewRetryStorage(mock, storagex.RetryPolicy{}))
+	require.True(t, ok)
+
+	// Resume after the first change
+	checkpoint := storagex.NewMemoryCheckpoint()
+	require.NoError(t, checkpoint.Save("1"))
+
+	recorder := newEventRecorder("uploads/b.txt")
+	startWatch(t, watcher, storagex.WatchOptions{
+		Prefix:        "uploads/",
+		Checkpoint:    checkpoint,
+		RetryInterval: time.Millisecond,
+	}, recorder.handle)
+
+	_, err = mock.PutBytes(ctx, "uploads/a.txt", []byte("alpha"), &storagex.PutOptions{ContentType: "text/plain"})
+	require.NoError(t, err)
+	_, err = mock.PutBytes(ctx, "other/c.txt", []byte("ignored"), nil)
+	require.NoError(t, err)
+	_, err = mock.PutBytes(ctx, "uploads/b.txt", []byte("beta"), nil)
+	require.NoError(t, err)
+	require.NoError(t, mock.Delete(ctx, "uploads/a.txt"))
+	require.NoError(t, mock.Delete(ctx, "uploads/missing.txt"))
+
+	events := recorder.wait(t, 4)
+	require.Len(t, events, 4)
+
+	assert.Equal(t, storagex.ObjectCreated, events[0].Type)
+	assert.Equal(t, "uploads/a.txt", events[0].Key)
+	assert.Equal(t, int64(5), events[0].Stat.Size)
+	assert.Equal(t, "text/plain", events[0].Stat.ContentType)
+	assert.NotEmpty(t, events[0].Stat.ETag)
+
+	// The failed delivery is retried with the same ID
+	assert.Equal(t, "uploads/b.txt", events[1].Key)
+	assert.Equal(t, events[1], events[2])
+
+	assert.Equal(t, storagex.ObjectRemoved, events[3].Type)
+	assert.Equal(t, "uploads/a.txt", events[3].Stat.Key)
+}
+
+func TestWatch_MemoryResumesFromCheckpoint(t *testing.T) {
+	ctx := context.Background()
+	mock := testutil.NewMockStorage()
+	path := filepath.Join(t.TempDir(), "watch", "cursor")
+	checkpoint, err := storagex.NewFileCheckpoint(path)
+	require.NoError(t, err)
+	require.NoError(t, checkpoint.Save("0"))
+
+	recorder := newEventRecorder()
+	cancel := startWatch(t, mock, storagex.WatchOptions{Checkpoint: checkpoint}, recorder.handle)
+	_, err = mock.PutBytes(ctx, "a.txt", []byte("a"), nil)
+	require.NoError(t, err)
+	recorder.wait(t, 1)
+	require.Eventually(t, func() bool {
+		cursor, _ := checkpoint.Load()
+		return cursor == "1"
+	}, time.Second, 5*time.Millisecond)
+	cancel()
+
+	// Changes made while no watch runs are delivered after a restart
+	_, err = mock.PutBytes(ctx, "b.txt", []byte("b"), nil)
+	require.NoError(t, err)
+	_, err = mock.DeleteBatch(ctx, []string{"a.txt"})
+	require.NoError(t, err)
+
+	reopened, err := storagex.NewFileCheckpoint(path)
+	require.NoError(t, err)
+	cursor, err := reopened.Load()
+	require.NoError(t, err)
+	assert.Equal(t, "1", cursor)
+
+	restarted := newEventRecorder()
+	startWatch(t, mock, storagex.WatchOptions{
+		Checkpoint: reopened,
+		Types:      []storagex.EventType{storagex.ObjectRemoved},
+	}, restarted.handle)
+	events := restarted.wait(t, 1)
+	require.Len(t, events, 1)
+	assert.Equal(t, storagex.ObjectRemoved, events[0].Type)
+	assert.Equal(t, "a.txt", events[0].Key)
+
+	// Filtered events still advance the checkpoint
+	require.Eventually(t, func() bool {
+		cursor, _ := reopened.Load()
+		return cursor == "3"
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestWatchOptions_Accepts(t *testing.T) {
+	created := storagex.Event{Type: storagex.ObjectCreated, Key: "in/a"}
+	removed := storagex.Event{Type: storagex.ObjectRemoved, Key: "in/a"}
+
+	assert.True(t, storagex.WatchOptions{}.Accepts(created))
+	assert.True(t, storagex.WatchOptions{Prefix: "in/"}.Accepts(created))
+	assert.False(t, storagex.WatchOptions{Prefix: "out/"}.Accepts(created))
+
+	onlyCreated := storagex.WatchOptions{Types: []storagex.EventType{storagex.ObjectCreated}}
+	assert.True(t, onlyCreated.Accepts(created))
+	assert.False(t, onlyCreated.Accepts(removed))
+}
+
+func TestDeliver_StopsWithContext(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+
+	attempts := 0
+	err := storagex.Deliver(ctx, storagex.WatchOptions{RetryInterval: 5 * time.Millisecond}, func(context.Context, storagex.Event) error {
+		attempts++
+		return errors.New("down")
+	}, storagex.Event{Key: "a"})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Greater(t, attempts, 1)
+}